@@ -8,18 +8,20 @@ import (
 	"github.com/sparetimecoders/build-tools/pkg/config"
 	"github.com/sparetimecoders/build-tools/pkg/deploy"
 	"github.com/sparetimecoders/build-tools/pkg/kubectl"
+	"github.com/sparetimecoders/build-tools/pkg/verify"
 	ver "github.com/sparetimecoders/build-tools/pkg/version"
 	"io"
 	"os"
+	"path/filepath"
 	"time"
 )
 
 var (
-	version = "dev"
-	commit  = "none"
-	date    = "unknown"
-	exitFunc = os.Exit
-	out io.Writer = os.Stdout
+	version            = "dev"
+	commit             = "none"
+	date               = "unknown"
+	exitFunc           = os.Exit
+	out      io.Writer = os.Stdout
 )
 
 func main() {
@@ -31,10 +33,11 @@ func main() {
 }
 
 func doDeploy() int {
-	var context, namespace string
+	var context, namespace, only string
 	const (
 		contextUsage   = "override the context for default environment deployment target"
 		namespaceUsage = "override the namespace for default environment deployment target"
+		onlyUsage      = "only deploy the image with this name"
 	)
 	set := flag.NewFlagSet("deploy", flag.ExitOnError)
 	set.Usage = func() {
@@ -45,6 +48,7 @@ func doDeploy() int {
 	set.StringVar(&context, "c", "", contextUsage+" (shorthand)")
 	set.StringVar(&namespace, "namespace", "", namespaceUsage)
 	set.StringVar(&namespace, "n", "", namespaceUsage+" (shorthand)")
+	set.StringVar(&only, "only", "", onlyUsage)
 	_ = set.Parse(os.Args[1:])
 	if set.NArg() < 1 {
 		set.Usage()
@@ -71,15 +75,38 @@ func doDeploy() int {
 					return -2
 				}
 
+				var selected []string
+				if only != "" {
+					selected = append(selected, only)
+				}
+				images, err := cfg.CurrentImages("Dockerfile", selected)
+				if err != nil {
+					fmt.Println(err.Error())
+					return -4
+				}
+				if cfg.Signing.Verify() {
+					// Only images signed with the private key of the configured public key are deployed
+					if err := verifyImages(cfg, images, currentCI.Commit()); err != nil {
+						_, _ = fmt.Println(tml.Sprintf("<red>%s</red>", err.Error()))
+						return -5
+					}
+				}
+
 				tstamp := time.Now().Format(time.RFC3339)
 				client := kubectl.New(env, os.Stdout, os.Stderr)
 				defer client.Cleanup()
-				if err := deploy.Deploy(dir, currentCI.Commit(), currentCI.BuildName(), tstamp, environment, client, os.Stdout, os.Stderr); err != nil {
-					fmt.Println(err.Error())
-					return -3
+				for _, image := range images {
+					if err := deploy.Deploy(filepath.Join(dir, image.Context), currentCI.Commit(), image.Name, tstamp, environment, client, os.Stdout, os.Stderr); err != nil {
+						fmt.Println(err.Error())
+						return -3
+					}
 				}
 			}
 		}
 	}
 	return 0
 }
+
+func verifyImages(cfg *config.Config, images []config.Image, commit string) error {
+	return verify.Images(cfg.CurrentRegistry(), cfg.Signing.PublicKey, images, commit, os.Stdout)
+}
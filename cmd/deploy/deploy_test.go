@@ -2,8 +2,8 @@ package main
 
 import (
 	"bytes"
-	"github.com/stretchr/testify/assert"
 	"github.com/sparetimecoders/build-tools/pkg"
+	"github.com/stretchr/testify/assert"
 	"io/ioutil"
 	"os"
 	"path/filepath"
@@ -16,7 +16,7 @@ func TestVersion(t *testing.T) {
 	exitFunc = func(code int) {
 		assert.Equal(t, 0, code)
 	}
-	os.Args = []string{"build","-version"}
+	os.Args = []string{"build", "-version"}
 	main()
 
 	assert.Equal(t, "Version: 1.0.0, commit none, built at unknown\n", out.(*bytes.Buffer).String())
@@ -163,3 +163,32 @@ environments:
 	os.Args = []string{"deploy", "-c", "other", "-n", "dev", "dummy"}
 	main()
 }
+
+func TestDeploy_UnverifiedImage(t *testing.T) {
+	exitFunc = func(code int) {
+		assert.Equal(t, -5, code)
+	}
+
+	defer pkg.SetEnv("CI_COMMIT_SHA", "abc123")()
+	defer pkg.SetEnv("CI_PROJECT_NAME", "dummy")()
+	defer pkg.SetEnv("CI_COMMIT_REF_NAME", "master")()
+	oldPwd, _ := os.Getwd()
+	name, _ := ioutil.TempDir(os.TempDir(), "build-tools")
+	defer func() { _ = os.RemoveAll(name) }()
+	yaml := `
+environments:
+  dummy:
+    context: missing
+    namespace: none
+signing:
+  publicKey: missing.pub
+`
+	_ = ioutil.WriteFile(filepath.Join(name, ".buildtools.yaml"), []byte(yaml), 0777)
+
+	err := os.Chdir(name)
+	assert.NoError(t, err)
+	defer func() { _ = os.Chdir(oldPwd) }()
+
+	os.Args = []string{"deploy", "dummy"}
+	main()
+}
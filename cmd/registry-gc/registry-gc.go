@@ -0,0 +1,25 @@
+package main
+
+import (
+	gc "github.com/sparetimecoders/build-tools/pkg/registry-gc"
+	ver "github.com/sparetimecoders/build-tools/pkg/version"
+	"io"
+	"os"
+)
+
+var (
+	version            = "dev"
+	commit             = "none"
+	date               = "unknown"
+	exitFunc           = os.Exit
+	out      io.Writer = os.Stdout
+)
+
+func main() {
+	if ver.PrintVersionOnly(version, commit, date, out) {
+		exitFunc(0)
+	} else {
+		dir, _ := os.Getwd()
+		exitFunc(gc.RegistryGC(dir, os.Stdout, os.Stderr, os.Args[1:]...))
+	}
+}
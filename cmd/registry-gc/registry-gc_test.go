@@ -0,0 +1,32 @@
+package main
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"testing"
+)
+
+func TestRegistryGC_BadFlag(t *testing.T) {
+	os.Clearenv()
+	exitFunc = func(code int) {
+		assert.Equal(t, -1, code)
+	}
+
+	os.Args = []string{"registry-gc", "--unknown"}
+	main()
+}
+
+func TestVersion(t *testing.T) {
+	out = &bytes.Buffer{}
+	version = "1.0.0"
+	commit = "67d2fcf276fcd9cf743ad4be9a9ef5828adc082f"
+	date = "2006-01-02T15:04:05Z07:00"
+	exitFunc = func(code int) {
+		assert.Equal(t, 0, code)
+	}
+	os.Args = []string{"registry-gc", "-version"}
+	main()
+
+	assert.Equal(t, "Version: 1.0.0, commit 67d2fcf276fcd9cf743ad4be9a9ef5828adc082f, built at 2006-01-02T15:04:05Z07:00\n", out.(*bytes.Buffer).String())
+}
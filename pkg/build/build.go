@@ -2,7 +2,6 @@ package build
 
 import (
 	"bufio"
-	"bytes"
 	"context"
 	dkr "docker.io/go-docker"
 	"docker.io/go-docker/api/types"
@@ -10,15 +9,20 @@ import (
 	"flag"
 	"fmt"
 	"github.com/docker/docker/pkg/archive"
+	"github.com/docker/go-units"
 	"github.com/liamg/tml"
-	"github.com/sparetimecoders/build-tools/pkg"
+	"github.com/sparetimecoders/build-tools/pkg/changes"
 	"github.com/sparetimecoders/build-tools/pkg/ci"
 	"github.com/sparetimecoders/build-tools/pkg/config"
 	"github.com/sparetimecoders/build-tools/pkg/docker"
-	"github.com/sparetimecoders/build-tools/pkg/tar"
+	"github.com/sparetimecoders/build-tools/pkg/registry"
+	"github.com/sparetimecoders/build-tools/pkg/report"
 	"io"
+	"io/ioutil"
 	"os"
+	"path/filepath"
 	"strings"
+	"time"
 )
 
 type responsetype struct {
@@ -35,12 +39,7 @@ func DoBuild(dir string, out, eout io.Writer, args ...string) int {
 		_, _ = fmt.Fprintln(out, err.Error())
 		return -1
 	} else {
-		if buildContext, err := createBuildContext(dir); err != nil {
-			_, _ = fmt.Fprintln(out, err.Error())
-			return -2
-		} else {
-			return build(client, dir, buildContext, out, eout, args...)
-		}
+		return build(client, dir, createBuildContext, out, eout, args...)
 	}
 }
 
@@ -48,18 +47,87 @@ var dockerClient = func() (docker.Client, error) {
 	return dkr.NewEnvClient()
 }
 
-func createBuildContext(dir string) (io.ReadCloser, error) {
-	if ignored, err := docker.ParseDockerignore(dir); err != nil {
+// contextReader is a build context that is read once for every stage built
+type contextReader interface {
+	io.ReadSeeker
+	io.Closer
+}
+
+type buildContextFunc func(dir, dockerfile string, maxSize int64, out io.Writer) (contextReader, error)
+
+// tempFile is a file that's removed when closed
+type tempFile struct {
+	*os.File
+}
+
+func (f *tempFile) Close() error {
+	err := f.File.Close()
+	_ = os.Remove(f.Name())
+	return err
+}
+
+// createBuildContext writes the build context for dockerfile in dir to a temporary file and prints its size and largest
+// entries. Fails if the context is larger than maxSize, unless maxSize is 0
+func createBuildContext(dir, dockerfile string, maxSize int64, out io.Writer) (contextReader, error) {
+	ignored, err := docker.ParseDockerignore(dir, dockerfile)
+	if err != nil {
+		return nil, err
+	}
+	context, err := archive.TarWithOptions(dir, &archive.TarOptions{ExcludePatterns: ignored})
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = context.Close() }()
+
+	file, err := ioutil.TempFile("", "build-tools-context")
+	if err != nil {
+		return nil, err
+	}
+	temp := &tempFile{File: file}
+	size, err := docker.MeasureContext(io.TeeReader(context, temp))
+	if err != nil {
+		_ = temp.Close()
+		return nil, err
+	}
+	_, _ = fmt.Fprintln(out, tml.Sprintf("Build context is <green>%s</green> in <green>%d</green> files", units.HumanSize(float64(size.Total)), size.Files))
+	for _, entry := range size.Largest(5) {
+		name := entry.Path
+		if entry.Dir {
+			name += "/"
+		}
+		_, _ = fmt.Fprintf(out, "  %-30s %s\n", name, units.HumanSize(float64(entry.Size)))
+	}
+	if maxSize > 0 && size.Total > maxSize {
+		if suggestions := size.SuggestIgnores(maxSize, dockerfile, ".dockerignore"); len(suggestions) > 0 {
+			_, _ = fmt.Fprintln(out, tml.Sprintf("<yellow>Consider adding these entries to %s:</yellow>", filepath.Base(docker.DockerignoreFile(dir, dockerfile))))
+			for _, suggestion := range suggestions {
+				_, _ = fmt.Fprintf(out, "  %s\n", suggestion)
+			}
+		}
+		_ = temp.Close()
+		return nil, fmt.Errorf("build context is %s, larger than the maximum of %s", units.HumanSize(float64(size.Total)), units.HumanSize(float64(maxSize)))
+	}
+	if _, err := temp.Seek(0, io.SeekStart); err != nil {
+		_ = temp.Close()
 		return nil, err
-	} else {
-		return archive.TarWithOptions(dir, &archive.TarOptions{ExcludePatterns: ignored})
 	}
+	return temp, nil
 }
 
-func build(client docker.Client, dir string, buildContext io.ReadCloser, out, eout io.Writer, args ...string) int {
+func build(client docker.Client, dir string, buildContext buildContextFunc, out, eout io.Writer, args ...string) int {
 	var dockerfile string
 	var buildArgsFlags arrayFlags
+	var onlyFlags arrayFlags
 	var skipLogin bool
+	var skipUnchanged bool
+	var since string
+	var useBuildKit bool
+	var secretFlags arrayFlags
+	var sshFlags arrayFlags
+	var platformFlags arrayFlags
+	var reportFile string
+	var registryFlags arrayFlags
+	var sbomFormat string
 	const (
 		defaultDockerfile = "Dockerfile"
 		usage             = "name of the Dockerfile to use"
@@ -69,7 +137,17 @@ func build(client docker.Client, dir string, buildContext io.ReadCloser, out, eo
 	set.StringVar(&dockerfile, "file", defaultDockerfile, usage)
 	set.StringVar(&dockerfile, "f", defaultDockerfile, usage+" (shorthand)")
 	set.Var(&buildArgsFlags, "build-arg", "")
+	set.Var(&onlyFlags, "only", "only build the image with this name (can be repeated)")
+	set.Var(&registryFlags, "registry", "registry to tag the images for, i.e. ecr or all for every configured registry (can be repeated or comma separated)")
 	set.BoolVar(&skipLogin, "skiplogin", false, "disable login to docker registry")
+	set.BoolVar(&skipUnchanged, "skip-unchanged", false, "skip images whose context and Dockerfile did not change since the image was last built")
+	set.StringVar(&since, "since", "", "commit to compare against when skipping unchanged images (implies --skip-unchanged)")
+	set.StringVar(&reportFile, "report", "", "write a JSON report of the built images to this file")
+	set.BoolVar(&useBuildKit, "buildkit", false, "build using BuildKit")
+	set.Var(&secretFlags, "secret", "secret to expose to the build, i.e. id=<id>,src=<file> or id=<id>,env=<variable> (implies --buildkit)")
+	set.Var(&platformFlags, "platform", "platform to build for, i.e. linux/arm64 (can be repeated or comma separated)")
+	set.StringVar(&sbomFormat, "sbom", "", "generate an SBOM of each built image in this format, cyclonedx or spdx")
+	set.Var(&sshFlags, "ssh", "SSH agent socket or keys to expose to the build, i.e. default or <id>=<path> (implies --buildkit)")
 
 	_ = set.Parse(args)
 	cfg, err := config.Load(dir, out)
@@ -80,27 +158,37 @@ func build(client docker.Client, dir string, buildContext io.ReadCloser, out, eo
 	currentCI := cfg.CurrentCI()
 	_, _ = fmt.Fprintln(out, tml.Sprintf("Using CI <green>%s</green>", currentCI.Name()))
 
-	currentRegistry := cfg.CurrentRegistry()
-	_, _ = fmt.Fprintln(out, tml.Sprintf("Using registry <green>%s</green>", currentRegistry.Name()))
+	registries, err := cfg.CurrentRegistries(registryFlags)
+	if err != nil {
+		_, _ = fmt.Fprintln(eout, err.Error())
+		return -13
+	}
+	// The first registry is used for caching and change detection
+	currentRegistry := registries[0]
+	var registryUrls []string
+	for _, reg := range registries {
+		_, _ = fmt.Fprintln(out, tml.Sprintf("Using registry <green>%s</green>", reg.Name()))
+		registryUrls = append(registryUrls, reg.RegistryUrl())
+	}
 	if skipLogin {
 		_, _ = fmt.Fprintln(out, tml.Sprintf("Login <yellow>disabled</yellow>"))
 	} else {
-		_, _ = fmt.Fprintln(out, tml.Sprintf("Authenticating against registry <green>%s</green>", currentRegistry.Name()))
-		if err := currentRegistry.Login(client, out); err != nil {
-			_, _ = fmt.Fprintln(eout, err.Error())
-			return -4
+		for _, reg := range registries {
+			_, _ = fmt.Fprintln(out, tml.Sprintf("Authenticating against registry <green>%s</green>", reg.Name()))
+			if err := reg.Login(client, out); err != nil {
+				_, _ = fmt.Fprintln(eout, err.Error())
+				return -4
+			}
 		}
 	}
 
-	var buf bytes.Buffer
-	tee := io.TeeReader(buildContext, &buf)
-	stages, err := findStages(tee, dockerfile)
+	images, err := cfg.CurrentImages(dockerfile, onlyFlags)
 	if err != nil {
 		_, _ = fmt.Fprintln(eout, err.Error())
-		return -5
+		return -9
 	}
-	dockerTagOverride := os.Getenv("DOCKER_TAG")
 
+	dockerTagOverride := os.Getenv("DOCKER_TAG")
 	if !ci.IsValid(currentCI) && len(dockerTagOverride) == 0 {
 		_, _ = fmt.Fprintln(eout, tml.Sprintf("Commit and/or branch information is <red>missing</red>. Perhaps your not in a Git repository or forgot to set environment variables?"))
 		return -6
@@ -109,65 +197,184 @@ func build(client docker.Client, dir string, buildContext io.ReadCloser, out, eo
 	commit := currentCI.Commit()
 	branch := currentCI.BranchReplaceSlash()
 	_, _ = fmt.Fprintln(out, tml.Sprintf("Using build variables commit <green>%s</green> on branch <green>%s</green>", commit, branch))
-	var caches []string
+	if gitTag := currentCI.Tag(); len(gitTag) > 0 {
+		_, _ = fmt.Fprintln(out, tml.Sprintf("Using git tag <green>%s</green>", gitTag))
+	}
+	imageTags, err := cfg.ImageTags(out)
+	if err != nil {
+		_, _ = fmt.Fprintln(eout, err.Error())
+		return -8
+	}
 
-	buildArgs := map[string]*string{
-		"CI_COMMIT": &commit,
-		"CI_BRANCH": &branch,
-	}
-	for _, arg := range buildArgsFlags {
-		split := strings.Split(arg, "=")
-		key := split[0]
-		value := strings.Join(split[1:], "=")
-		if len(split) > 1 && len(value) > 0 {
-			buildArgs[key] = pkg.String(value)
-		} else {
-			_, _ = fmt.Fprintf(out, "ignoring build-arg %s\n", key)
+	platforms, err := cfg.CurrentPlatforms(platformFlags)
+	if err != nil {
+		_, _ = fmt.Fprintln(eout, err.Error())
+		return -11
+	}
+
+	var detector *changes.Detector
+	if skipUnchanged || len(since) > 0 {
+		api, err := registry.NewRegistryAPI(currentRegistry)
+		if err != nil {
+			_, _ = fmt.Fprintln(eout, err.Error())
+			return -4
+		}
+		detector = &changes.Detector{
+			VCS:         cfg.CurrentVCS(),
+			API:         api,
+			RegistryUrl: currentRegistry.RegistryUrl(),
+			Since:       since,
+			Tags:        previousTags(branch),
 		}
 	}
-	for _, stage := range stages {
-		tag := docker.Tag(currentRegistry.RegistryUrl(), currentCI.BuildName(), stage)
-		caches = append([]string{tag}, caches...)
-		if err := doBuild(client, bytes.NewBuffer(buf.Bytes()), dockerfile, buildArgs, []string{tag}, caches, stage, out, eout); err != nil {
+	labels, err := cfg.ImageLabels(time.Now())
+	if err != nil {
+		_, _ = fmt.Fprintln(eout, err.Error())
+		return -15
+	}
+
+	var buildKit *buildKitOptions
+	buildCfg := cfg.Build
+	if useBuildKit || buildCfg.BuildKit || len(buildCfg.Secrets) > 0 || len(buildCfg.SSH) > 0 || len(secretFlags) > 0 || len(sshFlags) > 0 {
+		if buildKit, err = buildKitOptionsFromConfig(buildCfg, secretFlags, sshFlags); err != nil {
 			_, _ = fmt.Fprintln(eout, err.Error())
-			return -7
+			return -10
 		}
+		_, _ = fmt.Fprintln(out, tml.Sprintf("Using <green>BuildKit</green>"))
+	}
+	if len(sbomFormat) > 0 {
+		buildCfg.SBOM = sbomFormat
+	}
+	if sbomFormat, err = buildCfg.SBOMFormat(); err != nil {
+		_, _ = fmt.Fprintln(eout, err.Error())
+		return -14
+	}
+	maxContextSize, err := cfg.BuildContext.MaxBytes()
+	if err != nil {
+		_, _ = fmt.Fprintln(eout, err.Error())
+		return -16
 	}
 
-	var tags []string
-	if len(dockerTagOverride) > 0 {
-		tag := docker.Tag(currentRegistry.RegistryUrl(), currentCI.BuildName(), dockerTagOverride)
-		caches = append([]string{tag}, caches...)
-		tags = append(tags, tag)
-		_, _ = fmt.Fprintf(out, "overriding docker tags with value from env DOCKER_TAG %s\n", dockerTagOverride)
-	} else {
-		branchTag := docker.Tag(currentRegistry.RegistryUrl(), currentCI.BuildName(), branch)
-		latestTag := docker.Tag(currentRegistry.RegistryUrl(), currentCI.BuildName(), "latest")
-		tags = append(tags, []string{
-			docker.Tag(currentRegistry.RegistryUrl(), currentCI.BuildName(), commit),
-			branchTag,
-		}...)
-		if currentCI.Branch() == "master" {
-			tags = append(tags, latestTag)
+	buildReport := &report.Report{}
+	for _, image := range images {
+		if detector != nil {
+			if previous, err := detector.Unchanged(image); err != nil {
+				_, _ = fmt.Fprintln(out, tml.Sprintf("<yellow>Unable to detect changes for image %s, building it: %s</yellow>", image.Name, err.Error()))
+			} else if previous != nil {
+				_, _ = fmt.Fprintln(out, tml.Sprintf("Image <green>%s</green> unchanged since <green>%s</green>, skipping build", image.Name, previous.Revision))
+				entry := buildReport.Add(image.Name, "")
+				entry.Unchanged = previous.Revision
+				entry.Done()
+				continue
+			}
+		}
+		if len(cfg.Images) > 0 {
+			_, _ = fmt.Fprintln(out, tml.Sprintf("Building image <green>%s</green>", image.Name))
+		}
+		buildArgs := cfg.BuildArgs(image, buildArgsFlags, out)
+		cacheTags := previousTags(branch)
+		if len(dockerTagOverride) > 0 {
+			cacheTags = imageTags
+		}
+		for _, platform := range platforms {
+			if len(platform) > 0 {
+				_, _ = fmt.Fprintln(out, tml.Sprintf("Building platform <green>%s</green>", platform))
+			}
+			var tags []string
+			for _, tag := range imageTags {
+				tags = append(tags, docker.Tags(registryUrls, image.Name, docker.PlatformTag(tag, platform))...)
+			}
+			var caches []string
+			for _, tag := range cacheTags {
+				caches = append(caches, docker.Tag(currentRegistry.RegistryUrl(), image.Name, docker.PlatformTag(tag, platform)))
+			}
+			entry := buildReport.Add(image.Name, platform)
+			entry.Tags = tags
+			entry.SetBuildArgs(buildArgs)
+			var code int
+			if buildKit != nil {
+				entry.Secrets = buildKit.secretIds()
+				code = buildImageWithBuildKit(buildKit, registryUrls, filepath.Join(dir, image.Context), image, platform, buildContext, maxContextSize, buildArgs, labels, tags, caches, entry, out, eout)
+			} else {
+				code = buildImage(client, registryUrls, filepath.Join(dir, image.Context), image, platform, buildContext, maxContextSize, buildArgs, labels, tags, caches, entry, out, eout)
+			}
+			if code != 0 {
+				return code
+			}
+			if len(sbomFormat) > 0 {
+				if err := writeSBOM(client, buildCfg.SBOMDirectory(dir), image.Name, platform, tags[0], sbomFormat, entry, out); err != nil {
+					_, _ = fmt.Fprintln(eout, err.Error())
+					return -14
+				}
+			}
+			entry.Done()
+		}
+	}
+
+	if len(reportFile) > 0 {
+		if err := buildReport.Write(reportFile); err != nil {
+			_, _ = fmt.Fprintln(eout, err.Error())
+			return -12
 		}
+		_, _ = fmt.Fprintln(out, tml.Sprintf("Wrote build report to <green>%s</green>", reportFile))
+	}
+	return 0
+}
 
-		caches = append([]string{branchTag, latestTag}, caches...)
+// previousTags returns the tags where the previous build of an image can be found
+func previousTags(branch string) []string {
+	if len(branch) > 0 {
+		return []string{branch, "latest"}
 	}
-	if err := doBuild(client, bytes.NewBuffer(buf.Bytes()), dockerfile, buildArgs, tags, caches, "", out, eout); err != nil {
+	return []string{"latest"}
+}
+
+func buildImage(client docker.Client, registryUrls []string, dir string, image config.Image, platform string, buildContext buildContextFunc, maxContextSize int64, buildArgs map[string]*string, labels map[string]string, tags, cacheFrom []string, entry *report.Image, out, eout io.Writer) int {
+	stages, err := findStages(dir, image.Dockerfile, buildArgs)
+	if err != nil {
 		_, _ = fmt.Fprintln(eout, err.Error())
-		return -7
+		return -5
+	}
+	entry.Stages = stages
+
+	context, err := buildContext(dir, image.Dockerfile, maxContextSize, out)
+	if err != nil {
+		_, _ = fmt.Fprintln(eout, err.Error())
+		return -2
+	}
+	defer func() { _ = context.Close() }()
+
+	var caches []string
+	for _, stage := range stages {
+		stageTags := docker.Tags(registryUrls, image.Name, docker.PlatformTag(stage, platform))
+		caches = append([]string{stageTags[0]}, caches...)
+		if err := doBuild(client, context, image.Dockerfile, platform, buildArgs, labels, stageTags, caches, stage, out, eout); err != nil {
+			_, _ = fmt.Fprintln(eout, err.Error())
+			return -7
+		}
 	}
 
+	caches = append(append([]string{}, cacheFrom...), caches...)
+	if err := doBuild(client, context, image.Dockerfile, platform, buildArgs, labels, tags, caches, "", out, eout); err != nil {
+		_, _ = fmt.Fprintln(eout, err.Error())
+		return -7
+	}
 	return 0
 }
 
-func doBuild(client docker.Client, buildContext io.Reader, dockerfile string, args map[string]*string, tags, caches []string, target string, out, eout io.Writer) error {
-	response, err := client.ImageBuild(context.Background(), buildContext, types.ImageBuildOptions{
+func doBuild(client docker.Client, buildContext io.ReadSeeker, dockerfile, platform string, args map[string]*string, labels map[string]string, tags, caches []string, target string, out, eout io.Writer) error {
+	if _, err := buildContext.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	// The context is wrapped so the HTTP client doesn't close it, it's reused for the next stage
+	response, err := client.ImageBuild(context.Background(), ioutil.NopCloser(buildContext), types.ImageBuildOptions{
 		BuildArgs:  args,
 		CacheFrom:  caches,
 		Dockerfile: dockerfile,
+		Labels:     labels,
 		Memory:     3 * 1024 * 1024 * 1024,
 		MemorySwap: -1,
+		Platform:   platform,
 		Remove:     true,
 		ShmSize:    256 * 1024 * 1024,
 		Tags:       tags,
@@ -196,14 +403,17 @@ func doBuild(client docker.Client, buildContext io.Reader, dockerfile string, ar
 	return nil
 }
 
-func findStages(buildContext io.Reader, dockerfile string) ([]string, error) {
-	content, err := tar.ExtractFileContent(buildContext, dockerfile)
+// findStages returns the named stages the final stage of dockerfile depends on, which are built and tagged separately
+func findStages(dir, dockerfile string, buildArgs map[string]*string) ([]string, error) {
+	content, err := ioutil.ReadFile(filepath.Join(dir, dockerfile))
 	if err != nil {
 		return nil, err
 	}
-	stages := docker.FindStages(content)
-
-	return stages, nil
+	parsed, err := docker.ParseDockerfile(string(content), buildArgs)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse %s: %v", dockerfile, err)
+	}
+	return parsed.CacheStages(), nil
 }
 
 type arrayFlags []string
@@ -1,6 +1,7 @@
 package build
 
 import (
+	"archive/tar"
 	"bytes"
 	"encoding/json"
 	"errors"
@@ -9,11 +10,18 @@ import (
 	"github.com/docker/docker/pkg/archive"
 	"github.com/stretchr/testify/assert"
 	"github.com/sparetimecoders/build-tools/pkg"
+	"github.com/sparetimecoders/build-tools/pkg/changes"
+	"github.com/sparetimecoders/build-tools/pkg/config"
 	"github.com/sparetimecoders/build-tools/pkg/docker"
+	"github.com/sparetimecoders/build-tools/pkg/registry"
+	"github.com/sparetimecoders/build-tools/pkg/report"
+	git2 "gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
 	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sort"
 	"testing"
 )
 
@@ -27,7 +35,7 @@ func TestMain(m *testing.M) {
 }
 
 func setup() string {
-	name, _ = ioutil.TempDir(os.TempDir(), "build-tools")
+	name = dockerfileDir("FROM scratch")
 	os.Clearenv()
 
 	return name
@@ -47,7 +55,7 @@ func TestBuild_BrokenConfig(t *testing.T) {
 	eout := &bytes.Buffer{}
 	client := &docker.MockDocker{}
 	buildContext, _ := archive.Generate("Dockerfile", "FROM scratch")
-	code := build(client, name, ioutil.NopCloser(buildContext), out, eout, "-f", "Dockerfile")
+	code := build(client, name, contextOf(buildContext), out, eout, "-f", "Dockerfile")
 
 	absPath, _ := filepath.Abs(filepath.Join(name, ".buildtools.yaml"))
 	assert.Equal(t, -3, code)
@@ -56,10 +64,6 @@ func TestBuild_BrokenConfig(t *testing.T) {
 }
 
 func TestBuild_NoRegistry(t *testing.T) {
-	filename := filepath.Join(name, "Dockerfile")
-	_ = ioutil.WriteFile(filename, []byte("FROM scratch"), 0777)
-	defer func() { _ = os.RemoveAll(filename) }()
-
 	defer pkg.SetEnv("CI_COMMIT_SHA", "abc123")()
 	defer pkg.SetEnv("CI_PROJECT_NAME", "reponame")()
 	defer pkg.SetEnv("CI_COMMIT_REF_NAME", "feature1")()
@@ -74,7 +78,7 @@ func TestBuild_NoRegistry(t *testing.T) {
 
 	code := DoBuild(name, out, eout)
 	assert.Equal(t, 0, code)
-	assert.Equal(t, "\x1b[0mUsing CI \x1b[32mGitlab\x1b[39m\x1b[0m\n\x1b[0mUsing registry \x1b[32mNo docker registry\x1b[39m\x1b[0m\n\x1b[0mAuthenticating against registry \x1b[32mNo docker registry\x1b[39m\x1b[0m\n\x1b[0mAuthentication \x1b[33mnot supported\x1b[39m for registry \x1b[32mNo docker registry\x1b[39m\x1b[0m\n\x1b[0mUsing build variables commit \x1b[32mabc123\x1b[39m on branch \x1b[32mfeature1\x1b[39m\x1b[0m\nBuild successful", out.String())
+	assert.Equal(t, "\x1b[0mUsing CI \x1b[32mGitlab\x1b[39m\x1b[0m\n\x1b[0mUsing registry \x1b[32mNo docker registry\x1b[39m\x1b[0m\n\x1b[0mAuthenticating against registry \x1b[32mNo docker registry\x1b[39m\x1b[0m\n\x1b[0mAuthentication \x1b[33mnot supported\x1b[39m for registry \x1b[32mNo docker registry\x1b[39m\x1b[0m\n\x1b[0mUsing build variables commit \x1b[32mabc123\x1b[39m on branch \x1b[32mfeature1\x1b[39m\x1b[0m\n\x1b[0mBuild context is \x1b[32m2.048kB\x1b[39m in \x1b[32m1\x1b[39m files\x1b[0m\n  Dockerfile                     12B\nBuild successful", out.String())
 	assert.Equal(t, "", eout.String())
 }
 
@@ -90,7 +94,7 @@ func TestBuild_LoginError(t *testing.T) {
 	eout := &bytes.Buffer{}
 	client := &docker.MockDocker{LoginError: fmt.Errorf("invalid username/password")}
 	buildContext, _ := archive.Generate("Dockerfile", "FROM scratch")
-	code := build(client, name, ioutil.NopCloser(buildContext), out, eout)
+	code := build(client, name, contextOf(buildContext), out, eout)
 
 	assert.Equal(t, -4, code)
 	assert.Equal(t, "\x1b[0mUsing CI \x1b[32mGitlab\x1b[39m\x1b[0m\n\x1b[0mUsing registry \x1b[32mDockerhub\x1b[39m\x1b[0m\n\x1b[0mAuthenticating against registry \x1b[32mDockerhub\x1b[39m\x1b[0m\nUnable to login\n", out.String())
@@ -109,7 +113,7 @@ func TestBuild_BuildError(t *testing.T) {
 	eout := &bytes.Buffer{}
 	client := &docker.MockDocker{BuildError: []error{fmt.Errorf("build error")}}
 	buildContext, _ := archive.Generate("Dockerfile", "FROM scratch")
-	code := build(client, name, ioutil.NopCloser(buildContext), out, eout)
+	code := build(client, name, contextOf(buildContext), out, eout)
 
 	assert.Equal(t, -7, code)
 	assert.Equal(t, "\x1b[0mUsing CI \x1b[32mGitlab\x1b[39m\x1b[0m\n\x1b[0mUsing registry \x1b[32mDockerhub\x1b[39m\x1b[0m\n\x1b[0mAuthenticating against registry \x1b[32mDockerhub\x1b[39m\x1b[0m\nLogged in\n\x1b[0mUsing build variables commit \x1b[32mabc123\x1b[39m on branch \x1b[32mfeature1\x1b[39m\x1b[0m\n", out.String())
@@ -128,7 +132,7 @@ func TestBuild_BuildResponseError(t *testing.T) {
 	eout := &bytes.Buffer{}
 	client := &docker.MockDocker{ResponseError: fmt.Errorf("build error")}
 	buildContext, _ := archive.Generate("Dockerfile", "FROM scratch")
-	code := build(client, name, ioutil.NopCloser(buildContext), out, eout)
+	code := build(client, name, contextOf(buildContext), out, eout)
 
 	assert.Equal(t, -7, code)
 	assert.Equal(t, "\x1b[0mUsing CI \x1b[32mGitlab\x1b[39m\x1b[0m\n\x1b[0mUsing registry \x1b[32mDockerhub\x1b[39m\x1b[0m\n\x1b[0mAuthenticating against registry \x1b[32mDockerhub\x1b[39m\x1b[0m\nLogged in\n\x1b[0mUsing build variables commit \x1b[32mabc123\x1b[39m on branch \x1b[32mfeature1\x1b[39m\x1b[0m\n", out.String())
@@ -147,7 +151,7 @@ func TestBuild_BrokenOutput(t *testing.T) {
 	eout := &bytes.Buffer{}
 	client := &docker.MockDocker{BrokenOutput: true}
 	buildContext, _ := archive.Generate("Dockerfile", "FROM scratch")
-	code := build(client, name, ioutil.NopCloser(buildContext), out, eout)
+	code := build(client, name, contextOf(buildContext), out, eout)
 
 	assert.Equal(t, -7, code)
 	assert.Equal(t, "\x1b[0mUsing CI \x1b[32mGitlab\x1b[39m\x1b[0m\n\x1b[0mUsing registry \x1b[32mDockerhub\x1b[39m\x1b[0m\n\x1b[0mAuthenticating against registry \x1b[32mDockerhub\x1b[39m\x1b[0m\nLogged in\n\x1b[0mUsing build variables commit \x1b[32mabc123\x1b[39m on branch \x1b[32mfeature1\x1b[39m\x1b[0m\n", out.String())
@@ -163,7 +167,7 @@ func TestBuild_WithBuildArgs(t *testing.T) {
 	eout := &bytes.Buffer{}
 	client := &docker.MockDocker{}
 	buildContext, _ := archive.Generate("Dockerfile", "FROM scratch")
-	code := build(client, name, ioutil.NopCloser(buildContext), out, eout, "--build-arg", "buildargs1=1", "--build-arg", "buildargs2=2")
+	code := build(client, name, contextOf(buildContext), out, eout, "--build-arg", "buildargs1=1", "--build-arg", "buildargs2=2")
 	assert.Equal(t, 0, code)
 
 	assert.Equal(t, 4, len(client.BuildOptions[0].BuildArgs))
@@ -180,7 +184,7 @@ func TestBuild_WithStrangeBuildArg(t *testing.T) {
 	eout := &bytes.Buffer{}
 	client := &docker.MockDocker{}
 	buildContext, _ := archive.Generate("Dockerfile", "FROM scratch")
-	code := build(client, name, ioutil.NopCloser(buildContext), out, eout, "--build-arg", "buildargs1=1=1", "--build-arg", "buildargs2", "--build-arg", "buildargs3=")
+	code := build(client, name, contextOf(buildContext), out, eout, "--build-arg", "buildargs1=1=1", "--build-arg", "buildargs2", "--build-arg", "buildargs3=")
 	assert.Equal(t, 0, code)
 
 	assert.Equal(t, 3, len(client.BuildOptions[0].BuildArgs))
@@ -198,7 +202,7 @@ func TestBuild_WithSkipLogin(t *testing.T) {
 	eout := &bytes.Buffer{}
 	client := &docker.MockDocker{}
 	buildContext, _ := archive.Generate("Dockerfile", "FROM scratch")
-	code := build(client, name, ioutil.NopCloser(buildContext), out, eout, "--skiplogin")
+	code := build(client, name, contextOf(buildContext), out, eout, "--skiplogin")
 	assert.Equal(t, 0, code)
 	assert.Equal(t, "\x1b[0mUsing CI \x1b[32mGitlab\x1b[39m\x1b[0m\n\x1b[0mUsing registry \x1b[32mDockerhub\x1b[39m\x1b[0m\n\x1b[0mLogin \x1b[33mdisabled\x1b[39m\x1b[0m\n\x1b[0mUsing build variables commit \x1b[32msha\x1b[39m on branch \x1b[32mmaster\x1b[39m\x1b[0m\nBuild successful", out.String())
 }
@@ -215,7 +219,7 @@ func TestBuild_FeatureBranch(t *testing.T) {
 	eout := &bytes.Buffer{}
 	client := &docker.MockDocker{}
 	buildContext, _ := archive.Generate("Dockerfile", "FROM scratch")
-	code := build(client, name, ioutil.NopCloser(buildContext), out, eout)
+	code := build(client, name, contextOf(buildContext), out, eout)
 
 	assert.Equal(t, 0, code)
 	assert.Equal(t, "Dockerfile", client.BuildOptions[0].Dockerfile)
@@ -244,7 +248,7 @@ func TestBuild_DockerTagOverride(t *testing.T) {
 	eout := &bytes.Buffer{}
 	client := &docker.MockDocker{}
 	buildContext, _ := archive.Generate("Dockerfile", "FROM scratch")
-	code := build(client, name, ioutil.NopCloser(buildContext), out, eout)
+	code := build(client, name, contextOf(buildContext), out, eout)
 
 	assert.Equal(t, 0, code)
 	assert.Equal(t, []string{"repo/build:override"}, client.BuildOptions[0].Tags)
@@ -264,7 +268,7 @@ func TestBuild_MasterBranch(t *testing.T) {
 	eout := &bytes.Buffer{}
 	client := &docker.MockDocker{}
 	buildContext, _ := archive.Generate("Dockerfile", "FROM scratch")
-	code := build(client, name, ioutil.NopCloser(buildContext), out, eout)
+	code := build(client, name, contextOf(buildContext), out, eout)
 
 	assert.Equal(t, 0, code)
 	assert.Equal(t, "Dockerfile", client.BuildOptions[0].Dockerfile)
@@ -286,6 +290,111 @@ func TestBuild_ParseError(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+func TestBuild_DockerignoreSemantics(t *testing.T) {
+	dir, _ := ioutil.TempDir(os.TempDir(), "build-tools")
+	defer func() { _ = os.RemoveAll(dir) }()
+	for _, file := range []string{"Dockerfile", "main.go", "debug.log", "src/app.go", "src/trace.log", "docs/keep.md", "docs/drop.md"} {
+		_ = os.MkdirAll(filepath.Dir(filepath.Join(dir, file)), 0777)
+		_ = ioutil.WriteFile(filepath.Join(dir, file), []byte(file), 0666)
+	}
+	_ = ioutil.WriteFile(filepath.Join(dir, ".dockerignore"), []byte("# build files\n*\n!src\n!/docs/keep.md\n**/*.log\n"), 0666)
+
+	context, err := createBuildContext(dir, "Dockerfile", 0, &bytes.Buffer{})
+	assert.NoError(t, err)
+	defer func() { _ = context.Close() }()
+
+	var files []string
+	reader := tar.NewReader(context)
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		assert.NoError(t, err)
+		if header.Typeflag == tar.TypeReg {
+			files = append(files, header.Name)
+		}
+	}
+	sort.Strings(files)
+	assert.Equal(t, []string{".dockerignore", "Dockerfile", "docs/keep.md", "src/app.go"}, files)
+}
+
+func TestBuild_ContextIsRemovedWhenClosed(t *testing.T) {
+	dir := dockerfileDir("FROM scratch")
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	context, err := createBuildContext(dir, "Dockerfile", 0, &bytes.Buffer{})
+	assert.NoError(t, err)
+	first, err := ioutil.ReadAll(context)
+	assert.NoError(t, err)
+	_, _ = context.Seek(0, io.SeekStart)
+	second, err := ioutil.ReadAll(context)
+	assert.NoError(t, err)
+	assert.Equal(t, first, second)
+
+	file := context.(*tempFile).Name()
+	assert.NoError(t, context.Close())
+	_, err = os.Stat(file)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestBuild_ContextTooLarge(t *testing.T) {
+	dir, _ := ioutil.TempDir(os.TempDir(), "build-tools")
+	defer func() { _ = os.RemoveAll(dir) }()
+	_ = ioutil.WriteFile(filepath.Join(dir, "Dockerfile"), []byte("FROM scratch"), 0666)
+	_ = ioutil.WriteFile(filepath.Join(dir, "main.go"), bytes.Repeat([]byte("a"), 1000), 0666)
+	_ = os.MkdirAll(filepath.Join(dir, "node_modules", "lib"), 0777)
+	_ = ioutil.WriteFile(filepath.Join(dir, "node_modules", "lib", "index.js"), bytes.Repeat([]byte("a"), 20000), 0666)
+	_ = ioutil.WriteFile(filepath.Join(dir, "data.csv"), bytes.Repeat([]byte("a"), 8000), 0666)
+
+	out := &bytes.Buffer{}
+	_, err := createBuildContext(dir, "Dockerfile", 10000, out)
+
+	assert.EqualError(t, err, "build context is 34.3kB, larger than the maximum of 10kB")
+	assert.Equal(t, "\x1b[0mBuild context is \x1b[32m34.3kB\x1b[39m in \x1b[32m4\x1b[39m files\x1b[0m\n  node_modules/                  20kB\n  data.csv                       8kB\n  main.go                        1kB\n  Dockerfile                     12B\n\x1b[0m\x1b[33mConsider adding these entries to .dockerignore:\x1b[39m\x1b[0m\n  node_modules\n  data.csv\n", out.String())
+
+	out = &bytes.Buffer{}
+	context, err := createBuildContext(dir, "Dockerfile", 40000, out)
+	assert.NoError(t, err)
+	_ = context.Close()
+}
+
+func TestBuild_InvalidContextMaxSize(t *testing.T) {
+	defer pkg.SetEnv("CI_COMMIT_SHA", "abc123")()
+	defer pkg.SetEnv("CI_PROJECT_NAME", "reponame")()
+	defer pkg.SetEnv("CI_COMMIT_REF_NAME", "master")()
+	defer pkg.SetEnv("BUILD_CONTEXT_MAX_SIZE", "huge")()
+
+	out := &bytes.Buffer{}
+	eout := &bytes.Buffer{}
+	client := &docker.MockDocker{}
+	buildContext, _ := archive.Generate("Dockerfile", "FROM scratch")
+	code := build(client, name, contextOf(buildContext), out, eout)
+
+	assert.Equal(t, -16, code)
+	assert.Equal(t, 0, len(client.BuildOptions))
+	assert.Equal(t, "invalid build context max size 'huge'\n", eout.String())
+}
+
+func TestBuild_NoTags(t *testing.T) {
+	defer pkg.SetEnv("CI_COMMIT_SHA", "abc123")()
+	defer pkg.SetEnv("CI_PROJECT_NAME", "reponame")()
+	defer pkg.SetEnv("CI_COMMIT_REF_NAME", "feature1")()
+	file := filepath.Join(name, ".buildtools.yaml")
+	_ = ioutil.WriteFile(file, []byte("tags:\n  templates: ['{{ .Version }}']\n"), 0777)
+	defer func() { _ = os.Remove(file) }()
+
+	out := &bytes.Buffer{}
+	eout := &bytes.Buffer{}
+	client := &docker.MockDocker{}
+	buildContext, _ := archive.Generate("Dockerfile", "FROM scratch")
+	code := build(client, name, contextOf(buildContext), out, eout)
+
+	assert.Equal(t, -8, code)
+	assert.Equal(t, 0, len(client.BuildOptions))
+	assert.Equal(t, "no tags for branch 'feature1' and commit 'abc123', every tag template rendered an empty tag\n", eout.String())
+}
+
 func TestBuild_BadDockerHost(t *testing.T) {
 	defer pkg.SetEnv("DOCKER_HOST", "abc-123")()
 	out := bytes.Buffer{}
@@ -296,14 +405,23 @@ func TestBuild_BadDockerHost(t *testing.T) {
 }
 
 func TestBuild_UnreadableDockerignore(t *testing.T) {
+	defer pkg.SetEnv("CI_COMMIT_SHA", "abc123")()
+	defer pkg.SetEnv("CI_PROJECT_NAME", "reponame")()
+	defer pkg.SetEnv("CI_COMMIT_REF_NAME", "master")()
 	filename := filepath.Join(name, ".dockerignore")
 	_ = os.Mkdir(filename, 0777)
 	defer func() { _ = os.RemoveAll(filename) }()
 	out := bytes.Buffer{}
 	eout := bytes.Buffer{}
+	tmpDockerClient := dockerClient
+	dockerClient = func() (client docker.Client, e error) {
+		return &docker.MockDocker{}, nil
+	}
+	defer func() { dockerClient = tmpDockerClient }()
+
 	exitCode := DoBuild(name, &out, &eout)
 	assert.Equal(t, -2, exitCode)
-	assert.Equal(t, fmt.Sprintf("read %s: is a directory\n", filename), out.String())
+	assert.Equal(t, fmt.Sprintf("read %s: is a directory\n", filename), eout.String())
 }
 
 func TestBuild_Unreadable_Dockerfile(t *testing.T) {
@@ -317,10 +435,31 @@ func TestBuild_Unreadable_Dockerfile(t *testing.T) {
 	out := &bytes.Buffer{}
 	eout := &bytes.Buffer{}
 	client := &docker.MockDocker{}
+	dir, _ := ioutil.TempDir(os.TempDir(), "build-tools")
+	defer func() { _ = os.RemoveAll(dir) }()
+	_ = os.Mkdir(filepath.Join(dir, "Dockerfile"), 0777)
 
-	code := build(client, name, ioutil.NopCloser(&brokenReader{}), out, eout)
+	code := build(client, dir, contextOf(&brokenReader{}), out, eout)
 
 	assert.Equal(t, -5, code)
+	assert.Equal(t, 0, len(client.BuildOptions))
+	assert.Equal(t, fmt.Sprintf("read %s: is a directory\n", filepath.Join(dir, "Dockerfile")), eout.String())
+}
+
+func TestBuild_BrokenContext(t *testing.T) {
+	defer pkg.SetEnv("CI_COMMIT_SHA", "abc123")()
+	defer pkg.SetEnv("CI_PROJECT_NAME", "reponame")()
+	defer pkg.SetEnv("CI_COMMIT_REF_NAME", "master")()
+	defer pkg.SetEnv("DOCKERHUB_REPOSITORY", "repo")()
+
+	out := &bytes.Buffer{}
+	eout := &bytes.Buffer{}
+	client := &docker.MockDocker{}
+
+	code := build(client, name, contextOf(&brokenReader{}), out, eout)
+
+	assert.Equal(t, -2, code)
+	assert.Equal(t, 0, len(client.BuildOptions))
 	assert.Equal(t, "read error\n", eout.String())
 }
 
@@ -346,7 +485,9 @@ COPY --from=test file2 .
 `
 
 	buildContext, _ := archive.Generate("Dockerfile", dockerfile)
-	code := build(client, name, ioutil.NopCloser(buildContext), out, eout)
+	dir := dockerfileDir(dockerfile)
+	defer func() { _ = os.RemoveAll(dir) }()
+	code := build(client, dir, contextOf(buildContext), out, eout)
 
 	assert.Equal(t, 0, code)
 	assert.Equal(t, "Dockerfile", client.BuildOptions[0].Dockerfile)
@@ -387,12 +528,95 @@ COPY --from=test file2 .
 `
 
 	buildContext, _ := archive.Generate("Dockerfile", dockerfile)
-	code := build(client, name, ioutil.NopCloser(buildContext), out, eout)
+	dir := dockerfileDir(dockerfile)
+	defer func() { _ = os.RemoveAll(dir) }()
+	code := build(client, dir, contextOf(buildContext), out, eout)
 
 	assert.Equal(t, -7, code)
 	assert.Equal(t, "build error\n", eout.String())
 }
 
+func TestBuild_SkipsUnusedStages(t *testing.T) {
+	defer pkg.SetEnv("CI_COMMIT_SHA", "abc123")()
+	defer pkg.SetEnv("CI_PROJECT_NAME", "reponame")()
+	defer pkg.SetEnv("CI_COMMIT_REF_NAME", "master")()
+	defer pkg.SetEnv("DOCKERHUB_REPOSITORY", "repo")()
+	defer pkg.SetEnv("DOCKERHUB_USERNAME", "user")()
+	defer pkg.SetEnv("DOCKERHUB_PASSWORD", "pass")()
+
+	out := &bytes.Buffer{}
+	eout := &bytes.Buffer{}
+	client := &docker.MockDocker{}
+	dockerfile := `
+ARG BASE=scratch
+FROM --platform=$BUILDPLATFORM ${BASE} AS deps
+FROM deps AS build
+RUN echo apa > file
+FROM scratch AS lint
+RUN echo cepa > file2
+FROM scratch
+COPY --from=build \
+  file .
+`
+
+	buildContext, _ := archive.Generate("Dockerfile", dockerfile)
+	dir := dockerfileDir(dockerfile)
+	defer func() { _ = os.RemoveAll(dir) }()
+	code := build(client, dir, contextOf(buildContext), out, eout)
+
+	assert.Equal(t, 0, code)
+	assert.Equal(t, 3, len(client.BuildOptions))
+	assert.Equal(t, "deps", client.BuildOptions[0].Target)
+	assert.Equal(t, "build", client.BuildOptions[1].Target)
+	assert.Equal(t, "", client.BuildOptions[2].Target)
+	assert.Equal(t, "", eout.String())
+}
+
+func TestBuild_InvalidDockerfile(t *testing.T) {
+	defer pkg.SetEnv("CI_COMMIT_SHA", "abc123")()
+	defer pkg.SetEnv("CI_PROJECT_NAME", "reponame")()
+	defer pkg.SetEnv("CI_COMMIT_REF_NAME", "master")()
+	defer pkg.SetEnv("DOCKERHUB_REPOSITORY", "repo")()
+	defer pkg.SetEnv("DOCKERHUB_USERNAME", "user")()
+	defer pkg.SetEnv("DOCKERHUB_PASSWORD", "pass")()
+
+	out := &bytes.Buffer{}
+	eout := &bytes.Buffer{}
+	client := &docker.MockDocker{}
+
+	buildContext, _ := archive.Generate("Dockerfile", "RUN echo apa")
+	dir := dockerfileDir("RUN echo apa")
+	defer func() { _ = os.RemoveAll(dir) }()
+	code := build(client, dir, contextOf(buildContext), out, eout)
+
+	assert.Equal(t, -5, code)
+	assert.Equal(t, 0, len(client.BuildOptions))
+	assert.Equal(t, "unable to parse Dockerfile: line 1: RUN before the first FROM\n", eout.String())
+}
+
+func contextOf(r io.Reader) buildContextFunc {
+	return func(dir, dockerfile string, maxSize int64, out io.Writer) (contextReader, error) {
+		content, err := ioutil.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+		return nopCloser{bytes.NewReader(content)}, nil
+	}
+}
+
+type nopCloser struct {
+	io.ReadSeeker
+}
+
+func (nopCloser) Close() error { return nil }
+
+// dockerfileDir creates a temporary directory containing a Dockerfile with content
+func dockerfileDir(content string) string {
+	dir, _ := ioutil.TempDir(os.TempDir(), "build-tools")
+	_ = ioutil.WriteFile(filepath.Join(dir, "Dockerfile"), []byte(content), 0666)
+	return dir
+}
+
 type brokenReader struct{}
 
 func (b brokenReader) Read(p []byte) (n int, err error) {
@@ -400,3 +624,391 @@ func (b brokenReader) Read(p []byte) (n int, err error) {
 }
 
 var _ io.Reader = &brokenReader{}
+
+func TestBuild_GitTag(t *testing.T) {
+	defer pkg.SetEnv("CI_COMMIT_SHA", "abc123")()
+	defer pkg.SetEnv("CI_PROJECT_NAME", "reponame")()
+	defer pkg.SetEnv("CI_COMMIT_REF_NAME", "v1.4.2")()
+	defer pkg.SetEnv("CI_COMMIT_TAG", "v1.4.2")()
+	defer pkg.SetEnv("DOCKERHUB_REPOSITORY", "repo")()
+
+	out := &bytes.Buffer{}
+	eout := &bytes.Buffer{}
+	client := &docker.MockDocker{}
+	buildContext, _ := archive.Generate("Dockerfile", "FROM scratch")
+	code := build(client, name, contextOf(buildContext), out, eout)
+
+	assert.Equal(t, 0, code)
+	assert.Equal(t, []string{"repo/reponame:abc123", "repo/reponame:1.4.2", "repo/reponame:1.4", "repo/reponame:1"}, client.BuildOptions[0].Tags)
+	assert.Equal(t, []string{"repo/reponame:latest"}, client.BuildOptions[0].CacheFrom)
+	assert.Equal(t, "\x1b[0mUsing CI \x1b[32mGitlab\x1b[39m\x1b[0m\n\x1b[0mUsing registry \x1b[32mDockerhub\x1b[39m\x1b[0m\n\x1b[0mAuthenticating against registry \x1b[32mDockerhub\x1b[39m\x1b[0m\nLogged in\n\x1b[0mUsing build variables commit \x1b[32mabc123\x1b[39m on branch \x1b[32m\x1b[39m\x1b[0m\n\x1b[0mUsing git tag \x1b[32mv1.4.2\x1b[39m\x1b[0m\nBuild successful", out.String())
+	assert.Equal(t, "", eout.String())
+}
+
+func TestBuild_ConfiguredTags(t *testing.T) {
+	defer pkg.SetEnv("CI_COMMIT_SHA", "abc1234567")()
+	defer pkg.SetEnv("CI_PROJECT_NAME", "reponame")()
+	defer pkg.SetEnv("CI_COMMIT_REF_NAME", "main")()
+	defer pkg.SetEnv("DOCKERHUB_REPOSITORY", "repo")()
+	defer pkg.SetEnv("BUILDTOOLS_CONTENT", `tags:
+  templates: ["{{ .ShortCommit }}", "{{ .Branch }}"]
+  mainBranches: [main]
+`)()
+
+	out := &bytes.Buffer{}
+	eout := &bytes.Buffer{}
+	client := &docker.MockDocker{}
+	buildContext, _ := archive.Generate("Dockerfile", "FROM scratch")
+	code := build(client, name, contextOf(buildContext), out, eout)
+
+	assert.Equal(t, 0, code)
+	assert.Equal(t, []string{"repo/reponame:abc1234", "repo/reponame:main", "repo/reponame:latest"}, client.BuildOptions[0].Tags)
+	assert.Equal(t, "", eout.String())
+}
+
+func TestBuild_BrokenTagTemplate(t *testing.T) {
+	defer pkg.SetEnv("CI_COMMIT_SHA", "abc123")()
+	defer pkg.SetEnv("CI_PROJECT_NAME", "reponame")()
+	defer pkg.SetEnv("CI_COMMIT_REF_NAME", "main")()
+	defer pkg.SetEnv("DOCKERHUB_REPOSITORY", "repo")()
+	defer pkg.SetEnv("BUILDTOOLS_CONTENT", `tags:
+  templates: ["{{ .Commit "]
+`)()
+
+	out := &bytes.Buffer{}
+	eout := &bytes.Buffer{}
+	client := &docker.MockDocker{}
+	buildContext, _ := archive.Generate("Dockerfile", "FROM scratch")
+	code := build(client, name, contextOf(buildContext), out, eout)
+
+	assert.Equal(t, -8, code)
+	assert.Equal(t, 0, len(client.BuildOptions))
+	assert.Equal(t, "invalid tag template '{{ .Commit ': template: tag:1: unclosed action\n", eout.String())
+}
+
+func TestBuild_MultipleImages(t *testing.T) {
+	defer pkg.SetEnv("CI_COMMIT_SHA", "abc123")()
+	defer pkg.SetEnv("CI_PROJECT_NAME", "reponame")()
+	defer pkg.SetEnv("CI_COMMIT_REF_NAME", "feature1")()
+	defer pkg.SetEnv("DOCKERHUB_REPOSITORY", "repo")()
+	defer pkg.SetEnv("BUILDTOOLS_CONTENT", `images:
+  - name: api
+    context: api
+    buildArgs:
+      SERVICE: api
+  - name: web
+    context: web
+    dockerfile: Dockerfile.web
+`)()
+	dir, _ := ioutil.TempDir(os.TempDir(), "build-tools")
+	defer func() { _ = os.RemoveAll(dir) }()
+	_ = os.MkdirAll(filepath.Join(dir, "api"), 0777)
+	_ = os.MkdirAll(filepath.Join(dir, "web"), 0777)
+	_ = ioutil.WriteFile(filepath.Join(dir, "api", "Dockerfile"), []byte("FROM scratch as build\nFROM scratch\nCOPY --from=build file ."), 0777)
+	_ = ioutil.WriteFile(filepath.Join(dir, "web", "Dockerfile.web"), []byte("FROM scratch"), 0777)
+
+	out := &bytes.Buffer{}
+	eout := &bytes.Buffer{}
+	client := &docker.MockDocker{}
+	code := build(client, dir, createBuildContext, out, eout)
+
+	assert.Equal(t, 0, code)
+	assert.Equal(t, "", eout.String())
+	assert.Equal(t, 3, len(client.BuildOptions))
+	assert.Equal(t, []string{"repo/api:build"}, client.BuildOptions[0].Tags)
+	assert.Equal(t, "api", *client.BuildOptions[0].BuildArgs["SERVICE"])
+	assert.Equal(t, []string{"repo/api:abc123", "repo/api:feature1"}, client.BuildOptions[1].Tags)
+	assert.Equal(t, []string{"repo/api:feature1", "repo/api:latest", "repo/api:build"}, client.BuildOptions[1].CacheFrom)
+	assert.Equal(t, "Dockerfile.web", client.BuildOptions[2].Dockerfile)
+	assert.Equal(t, []string{"repo/web:abc123", "repo/web:feature1"}, client.BuildOptions[2].Tags)
+	assert.Equal(t, []string{"repo/web:feature1", "repo/web:latest"}, client.BuildOptions[2].CacheFrom)
+	assert.Nil(t, client.BuildOptions[2].BuildArgs["SERVICE"])
+}
+
+func TestBuild_OnlyImage(t *testing.T) {
+	defer pkg.SetEnv("CI_COMMIT_SHA", "abc123")()
+	defer pkg.SetEnv("CI_PROJECT_NAME", "reponame")()
+	defer pkg.SetEnv("CI_COMMIT_REF_NAME", "feature1")()
+	defer pkg.SetEnv("DOCKERHUB_REPOSITORY", "repo")()
+	defer pkg.SetEnv("BUILDTOOLS_CONTENT", `images:
+  - name: api
+    context: api
+  - name: web
+    context: web
+`)()
+
+	out := &bytes.Buffer{}
+	eout := &bytes.Buffer{}
+	client := &docker.MockDocker{}
+	dir, _ := ioutil.TempDir(os.TempDir(), "build-tools")
+	defer func() { _ = os.RemoveAll(dir) }()
+	_ = os.MkdirAll(filepath.Join(dir, "web"), 0777)
+	_ = ioutil.WriteFile(filepath.Join(dir, "web", "Dockerfile"), []byte("FROM scratch"), 0666)
+	buildContext, _ := archive.Generate("Dockerfile", "FROM scratch")
+	code := build(client, dir, contextOf(buildContext), out, eout, "--only", "web")
+
+	assert.Equal(t, 0, code)
+	assert.Equal(t, 1, len(client.BuildOptions))
+	assert.Equal(t, []string{"repo/web:abc123", "repo/web:feature1"}, client.BuildOptions[0].Tags)
+	assert.Contains(t, out.String(), "Building image \x1b[32mweb\x1b[39m")
+}
+
+func TestBuild_OnlyUnknownImage(t *testing.T) {
+	defer pkg.SetEnv("CI_COMMIT_SHA", "abc123")()
+	defer pkg.SetEnv("CI_PROJECT_NAME", "reponame")()
+	defer pkg.SetEnv("CI_COMMIT_REF_NAME", "feature1")()
+	defer pkg.SetEnv("DOCKERHUB_REPOSITORY", "repo")()
+
+	out := &bytes.Buffer{}
+	eout := &bytes.Buffer{}
+	client := &docker.MockDocker{}
+	buildContext, _ := archive.Generate("Dockerfile", "FROM scratch")
+	code := build(client, name, contextOf(buildContext), out, eout, "--only", "web")
+
+	assert.Equal(t, -9, code)
+	assert.Equal(t, "no image named 'web' found, available images: reponame\n", eout.String())
+}
+
+func TestBuild_SkipUnchanged(t *testing.T) {
+	dir, _ := ioutil.TempDir(os.TempDir(), "build-tools")
+	defer func() { _ = os.RemoveAll(dir) }()
+	_, repo := config.InitRepoWithCommit(dir)
+	tree, _ := repo.Worktree()
+	_ = os.MkdirAll(filepath.Join(dir, "api"), 0777)
+	_ = os.MkdirAll(filepath.Join(dir, "web"), 0777)
+	_ = ioutil.WriteFile(filepath.Join(dir, "api", "Dockerfile"), []byte("FROM scratch"), 0777)
+	_ = ioutil.WriteFile(filepath.Join(dir, "web", "Dockerfile"), []byte("FROM scratch"), 0777)
+	_, _ = tree.Add("api/Dockerfile")
+	_, _ = tree.Add("web/Dockerfile")
+	previous, _ := tree.Commit("Images", &git2.CommitOptions{Author: &object.Signature{Email: "test@example.com"}})
+	_ = ioutil.WriteFile(filepath.Join(dir, "web", "Dockerfile"), []byte("FROM scratch\nENV CHANGED=true"), 0777)
+	_, _ = tree.Add("web/Dockerfile")
+	head, _ := tree.Commit("Change web", &git2.CommitOptions{Author: &object.Signature{Email: "test@example.com"}})
+
+	server := registry.NewMockRegistryServer()
+	defer server.Close()
+	server.AddImage("api", "latest", map[string]string{changes.RevisionLabel: previous.String()})
+	server.AddImage("web", "latest", map[string]string{changes.RevisionLabel: previous.String()})
+
+	defer pkg.SetEnv("CI_PROJECT_NAME", "reponame")()
+	defer pkg.SetEnv("DOCKERHUB_REPOSITORY", server.Host())()
+	defer pkg.SetEnv("BUILDTOOLS_CONTENT", `images:
+  - name: api
+    context: api
+  - name: web
+    context: web
+`)()
+
+	out := &bytes.Buffer{}
+	eout := &bytes.Buffer{}
+	client := &docker.MockDocker{}
+	code := build(client, dir, createBuildContext, out, eout, "--skip-unchanged")
+
+	assert.Equal(t, 0, code)
+	assert.Equal(t, "", eout.String())
+	assert.Contains(t, out.String(), fmt.Sprintf("\x1b[0mImage \x1b[32mapi\x1b[39m unchanged since \x1b[32m%s\x1b[39m, skipping build\x1b[0m\n", previous.String()))
+	assert.Equal(t, 1, len(client.BuildOptions))
+	assert.Equal(t, []string{server.Host() + "/web:" + head.String(), server.Host() + "/web:master", server.Host() + "/web:latest"}, client.BuildOptions[0].Tags)
+	assert.Equal(t, head.String(), client.BuildOptions[0].Labels[changes.RevisionLabel])
+}
+
+func TestBuild_SkipUnchangedWithoutVCS(t *testing.T) {
+	defer pkg.SetEnv("CI_COMMIT_SHA", "abc123")()
+	defer pkg.SetEnv("CI_PROJECT_NAME", "reponame")()
+	defer pkg.SetEnv("CI_COMMIT_REF_NAME", "feature1")()
+	server := registry.NewMockRegistryServer()
+	defer server.Close()
+	server.AddImage("reponame", "def456", map[string]string{changes.RevisionLabel: "def456"})
+	defer pkg.SetEnv("DOCKERHUB_REPOSITORY", server.Host())()
+
+	out := &bytes.Buffer{}
+	eout := &bytes.Buffer{}
+	client := &docker.MockDocker{}
+	buildContext, _ := archive.Generate("Dockerfile", "FROM scratch")
+	code := build(client, name, contextOf(buildContext), out, eout, "--since", "def456")
+
+	assert.Equal(t, 0, code)
+	assert.Contains(t, out.String(), "\x1b[0m\x1b[33mUnable to detect changes for image reponame, building it: listing changed files is not supported without a VCS\x1b[39m\x1b[0m\n")
+	assert.Equal(t, 1, len(client.BuildOptions))
+}
+
+func TestBuild_Platforms(t *testing.T) {
+	defer pkg.SetEnv("CI_COMMIT_SHA", "abc123")()
+	defer pkg.SetEnv("CI_PROJECT_NAME", "reponame")()
+	defer pkg.SetEnv("CI_COMMIT_REF_NAME", "feature1")()
+	defer pkg.SetEnv("DOCKERHUB_REPOSITORY", "repo")()
+	defer pkg.SetEnv("BUILDTOOLS_CONTENT", `build:
+  platforms:
+    - linux/amd64
+    - linux/arm64
+`)()
+	dir, _ := ioutil.TempDir(os.TempDir(), "build-tools")
+	defer func() { _ = os.RemoveAll(dir) }()
+	_ = ioutil.WriteFile(filepath.Join(dir, "Dockerfile"), []byte("FROM scratch as build\nFROM scratch\nCOPY --from=build file ."), 0777)
+
+	out := &bytes.Buffer{}
+	eout := &bytes.Buffer{}
+	client := &docker.MockDocker{}
+	code := build(client, dir, createBuildContext, out, eout)
+
+	assert.Equal(t, 0, code)
+	assert.Equal(t, "", eout.String())
+	assert.Contains(t, out.String(), "\x1b[0mBuilding platform \x1b[32mlinux/arm64\x1b[39m\x1b[0m\n")
+	assert.Equal(t, 4, len(client.BuildOptions))
+	assert.Equal(t, "linux/amd64", client.BuildOptions[0].Platform)
+	assert.Equal(t, []string{"repo/reponame:build-linux-amd64"}, client.BuildOptions[0].Tags)
+	assert.Equal(t, "linux/amd64", client.BuildOptions[1].Platform)
+	assert.Equal(t, []string{"repo/reponame:abc123-linux-amd64", "repo/reponame:feature1-linux-amd64"}, client.BuildOptions[1].Tags)
+	assert.Equal(t, []string{"repo/reponame:feature1-linux-amd64", "repo/reponame:latest-linux-amd64", "repo/reponame:build-linux-amd64"}, client.BuildOptions[1].CacheFrom)
+	assert.Equal(t, "linux/arm64", client.BuildOptions[3].Platform)
+	assert.Equal(t, []string{"repo/reponame:abc123-linux-arm64", "repo/reponame:feature1-linux-arm64"}, client.BuildOptions[3].Tags)
+}
+
+func TestBuild_MultipleRegistries(t *testing.T) {
+	defer pkg.SetEnv("CI_COMMIT_SHA", "abc123")()
+	defer pkg.SetEnv("CI_PROJECT_NAME", "reponame")()
+	defer pkg.SetEnv("CI_COMMIT_REF_NAME", "feature1")()
+	defer pkg.SetEnv("DOCKERHUB_REPOSITORY", "repo")()
+	defer pkg.SetEnv("QUAY_REPOSITORY", "org")()
+	dir, _ := ioutil.TempDir(os.TempDir(), "build-tools")
+	defer func() { _ = os.RemoveAll(dir) }()
+	_ = ioutil.WriteFile(filepath.Join(dir, "Dockerfile"), []byte("FROM scratch as build\nFROM scratch\nCOPY --from=build file ."), 0777)
+
+	out := &bytes.Buffer{}
+	eout := &bytes.Buffer{}
+	client := &docker.MockDocker{}
+	code := build(client, dir, createBuildContext, out, eout, "--registry", "all")
+
+	assert.Equal(t, 0, code)
+	assert.Equal(t, "", eout.String())
+	assert.Contains(t, out.String(), "\x1b[0mAuthenticating against registry \x1b[32mQuay.io\x1b[39m\x1b[0m\n")
+	assert.Equal(t, 2, len(client.BuildOptions))
+	assert.Equal(t, []string{"repo/reponame:build", "quay.io/org/reponame:build"}, client.BuildOptions[0].Tags)
+	assert.Equal(t, []string{"repo/reponame:abc123", "quay.io/org/reponame:abc123", "repo/reponame:feature1", "quay.io/org/reponame:feature1"}, client.BuildOptions[1].Tags)
+	assert.Equal(t, []string{"repo/reponame:feature1", "repo/reponame:latest", "repo/reponame:build"}, client.BuildOptions[1].CacheFrom)
+}
+
+func TestBuild_UnknownRegistry(t *testing.T) {
+	defer pkg.SetEnv("DOCKERHUB_REPOSITORY", "repo")()
+
+	out := &bytes.Buffer{}
+	eout := &bytes.Buffer{}
+	client := &docker.MockDocker{}
+	code := build(client, name, createBuildContext, out, eout, "--registry", "dockerhub,quay")
+
+	assert.Equal(t, -13, code)
+	assert.Equal(t, "registry 'quay' is not configured\n", eout.String())
+}
+
+func TestBuild_InvalidPlatform(t *testing.T) {
+	defer pkg.SetEnv("CI_COMMIT_SHA", "abc123")()
+	defer pkg.SetEnv("CI_PROJECT_NAME", "reponame")()
+	defer pkg.SetEnv("CI_COMMIT_REF_NAME", "feature1")()
+
+	out := &bytes.Buffer{}
+	eout := &bytes.Buffer{}
+	client := &docker.MockDocker{}
+	code := build(client, name, createBuildContext, out, eout, "--platform", "arm64")
+
+	assert.Equal(t, -11, code)
+	assert.Equal(t, 0, len(client.BuildOptions))
+	assert.Equal(t, "invalid platform 'arm64', expected os/arch[/variant]\n", eout.String())
+}
+
+func TestBuild_Report(t *testing.T) {
+	defer pkg.SetEnv("CI_COMMIT_SHA", "abc123")()
+	defer pkg.SetEnv("CI_PROJECT_NAME", "reponame")()
+	defer pkg.SetEnv("CI_COMMIT_REF_NAME", "feature1")()
+	defer pkg.SetEnv("DOCKERHUB_REPOSITORY", "repo")()
+	dir, _ := ioutil.TempDir(os.TempDir(), "build-tools")
+	defer func() { _ = os.RemoveAll(dir) }()
+	_ = ioutil.WriteFile(filepath.Join(dir, "Dockerfile"), []byte("FROM scratch as build\nFROM scratch\nCOPY --from=build file ."), 0777)
+	reportFile := filepath.Join(dir, "build.json")
+
+	out := &bytes.Buffer{}
+	eout := &bytes.Buffer{}
+	code := build(&docker.MockDocker{}, dir, createBuildContext, out, eout, "--report", reportFile, "--build-arg", "GITHUB_TOKEN=secret")
+
+	assert.Equal(t, 0, code)
+	assert.Equal(t, "", eout.String())
+	assert.Contains(t, out.String(), fmt.Sprintf("\x1b[0mWrote build report to \x1b[32m%s\x1b[39m\x1b[0m\n", reportFile))
+	content, _ := ioutil.ReadFile(reportFile)
+	result := &report.Report{}
+	assert.NoError(t, json.Unmarshal(content, result))
+	assert.Equal(t, 1, len(result.Images))
+	assert.Equal(t, "reponame", result.Images[0].Name)
+	assert.Equal(t, []string{"repo/reponame:abc123", "repo/reponame:feature1"}, result.Images[0].Tags)
+	assert.Equal(t, []string{"build"}, result.Images[0].Stages)
+	assert.Equal(t, map[string]string{"CI_COMMIT": "abc123", "CI_BRANCH": "feature1", "GITHUB_TOKEN": "[REDACTED]"}, result.Images[0].BuildArgs)
+}
+
+func TestBuild_ReportWriteError(t *testing.T) {
+	defer pkg.SetEnv("CI_COMMIT_SHA", "abc123")()
+	defer pkg.SetEnv("CI_PROJECT_NAME", "reponame")()
+	defer pkg.SetEnv("CI_COMMIT_REF_NAME", "feature1")()
+	dir, _ := ioutil.TempDir(os.TempDir(), "build-tools")
+	defer func() { _ = os.RemoveAll(dir) }()
+	_ = ioutil.WriteFile(filepath.Join(dir, "Dockerfile"), []byte("FROM scratch"), 0777)
+
+	out := &bytes.Buffer{}
+	eout := &bytes.Buffer{}
+	code := build(&docker.MockDocker{}, dir, createBuildContext, out, eout, "--report", filepath.Join(dir, "missing", "build.json"))
+
+	assert.Equal(t, -12, code)
+	assert.Contains(t, eout.String(), "no such file or directory")
+}
+
+func TestBuild_Labels(t *testing.T) {
+	defer pkg.SetEnv("CI_COMMIT_SHA", "abc123")()
+	defer pkg.SetEnv("CI_PROJECT_NAME", "reponame")()
+	defer pkg.SetEnv("CI_COMMIT_REF_NAME", "feature1")()
+	defer pkg.SetEnv("CI_JOB_URL", "https://gitlab.com/org/repo/-/jobs/42")()
+	defer pkg.SetEnv("SOURCE_DATE_EPOCH", "1580702400")()
+	defer pkg.SetEnv("BUILDTOOLS_CONTENT", `build:
+  labels:
+    team: platform
+    commit: "{{ .ShortCommit }}"
+`)()
+	dir, _ := ioutil.TempDir(os.TempDir(), "build-tools")
+	defer func() { _ = os.RemoveAll(dir) }()
+	_ = ioutil.WriteFile(filepath.Join(dir, "Dockerfile"), []byte("FROM scratch as build\nFROM scratch\nCOPY --from=build file ."), 0777)
+
+	out := &bytes.Buffer{}
+	eout := &bytes.Buffer{}
+	client := &docker.MockDocker{}
+	code := build(client, dir, createBuildContext, out, eout)
+
+	assert.Equal(t, 0, code)
+	assert.Equal(t, "", eout.String())
+	expected := map[string]string{
+		"org.opencontainers.image.revision":                 "abc123",
+		"org.opencontainers.image.created":                  "2020-02-03T04:00:00Z",
+		"org.opencontainers.image.ref.name":                 "feature1",
+		"com.github.sparetimecoders.build-tools.provenance": "Gitlab https://gitlab.com/org/repo/-/jobs/42",
+		"team":   "platform",
+		"commit": "abc123",
+	}
+	assert.Equal(t, expected, client.BuildOptions[0].Labels)
+	assert.Equal(t, expected, client.BuildOptions[1].Labels)
+}
+
+func TestBuild_InvalidLabel(t *testing.T) {
+	defer pkg.SetEnv("CI_COMMIT_SHA", "abc123")()
+	defer pkg.SetEnv("CI_PROJECT_NAME", "reponame")()
+	defer pkg.SetEnv("CI_COMMIT_REF_NAME", "feature1")()
+	defer pkg.SetEnv("BUILDTOOLS_CONTENT", `build:
+  labels:
+    team: "{{ .Team }}"
+`)()
+	dir, _ := ioutil.TempDir(os.TempDir(), "build-tools")
+	defer func() { _ = os.RemoveAll(dir) }()
+	_ = ioutil.WriteFile(filepath.Join(dir, "Dockerfile"), []byte("FROM scratch"), 0777)
+
+	eout := &bytes.Buffer{}
+	client := &docker.MockDocker{}
+	code := build(client, dir, createBuildContext, &bytes.Buffer{}, eout)
+
+	assert.Equal(t, -15, code)
+	assert.Contains(t, eout.String(), "invalid label template '{{ .Team }}'")
+	assert.Equal(t, 0, len(client.BuildOptions))
+}
@@ -0,0 +1,175 @@
+package build
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/sparetimecoders/build-tools/pkg/config"
+	"github.com/sparetimecoders/build-tools/pkg/docker"
+	"github.com/sparetimecoders/build-tools/pkg/report"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// buildKitOptions are the BuildKit specific options for a build
+type buildKitOptions struct {
+	secrets []string
+	ssh     []string
+}
+
+// dockerCli runs the docker CLI with BuildKit enabled, the go-docker client does not support the BuildKit
+// sessions needed for secrets and SSH forwarding. BuildKit writes the build progress to stderr, so both are written
+// to out and the last lines of the output are included in the error if the build fails
+var dockerCli = func(args []string, out io.Writer) error {
+	cmd := exec.Command("docker", args...)
+	cmd.Env = append(os.Environ(), "DOCKER_BUILDKIT=1")
+	tail := &outputTail{}
+	cmd.Stdout = io.MultiWriter(out, tail)
+	cmd.Stderr = cmd.Stdout
+	if err := cmd.Run(); err != nil {
+		if lines := tail.String(); len(lines) > 0 {
+			return fmt.Errorf("%v\n%s", err, lines)
+		}
+		return err
+	}
+	return nil
+}
+
+// outputTailLines is the number of lines of output kept by outputTail
+const outputTailLines = 10
+
+// outputTail keeps the last lines written to it
+type outputTail struct {
+	buf bytes.Buffer
+}
+
+func (t *outputTail) Write(p []byte) (int, error) {
+	t.buf.Write(p)
+	// Keep enough to find the last lines without holding on to the whole build output
+	if t.buf.Len() > 64*1024 {
+		t.buf.Next(t.buf.Len() - 32*1024)
+	}
+	return len(p), nil
+}
+
+// String returns the last lines written, without trailing whitespace
+func (t *outputTail) String() string {
+	lines := strings.Split(strings.TrimRight(t.buf.String(), " \r\n"), "\n")
+	if len(lines) > outputTailLines {
+		lines = lines[len(lines)-outputTailLines:]
+	}
+	return strings.Join(lines, "\n")
+}
+
+// secretIds returns the ids of the secrets exposed to the build
+func (o *buildKitOptions) secretIds() []string {
+	var ids []string
+	for _, secret := range o.secrets {
+		for _, field := range strings.Split(secret, ",") {
+			if strings.HasPrefix(field, "id=") {
+				ids = append(ids, strings.TrimPrefix(field, "id="))
+			}
+		}
+	}
+	return ids
+}
+
+func buildKitOptionsFromConfig(cfg *config.BuildConfig, secrets, ssh []string) (*buildKitOptions, error) {
+	options := &buildKitOptions{}
+	for _, secret := range cfg.Secrets {
+		arg, err := secret.Arg()
+		if err != nil {
+			return nil, err
+		}
+		options.secrets = append(options.secrets, arg)
+	}
+	options.secrets = append(options.secrets, secrets...)
+	options.ssh = append(append(options.ssh, cfg.SSH...), ssh...)
+	return options, nil
+}
+
+func buildImageWithBuildKit(options *buildKitOptions, registryUrls []string, dir string, image config.Image, platform string, buildContext buildContextFunc, maxContextSize int64, buildArgs map[string]*string, labels map[string]string, tags, cacheFrom []string, entry *report.Image, out, eout io.Writer) int {
+	stages, err := findStages(dir, image.Dockerfile, buildArgs)
+	if err != nil {
+		_, _ = fmt.Fprintln(eout, err.Error())
+		return -5
+	}
+	entry.Stages = stages
+
+	// The docker CLI sends the context itself, it's only created to report its size and enforce the maximum size
+	context, err := buildContext(dir, image.Dockerfile, maxContextSize, out)
+	if err != nil {
+		_, _ = fmt.Fprintln(eout, err.Error())
+		return -2
+	}
+	_ = context.Close()
+	dockerfile := filepath.Join(dir, image.Dockerfile)
+	var caches []string
+	for _, stage := range entry.Stages {
+		stageTags := docker.Tags(registryUrls, image.Name, docker.PlatformTag(stage, platform))
+		caches = append([]string{stageTags[0]}, caches...)
+		if err := doBuildKit(options, dir, dockerfile, platform, buildArgs, labels, stageTags, caches, stage, out); err != nil {
+			_, _ = fmt.Fprintln(eout, err.Error())
+			return -7
+		}
+	}
+
+	caches = append(append([]string{}, cacheFrom...), caches...)
+	if err := doBuildKit(options, dir, dockerfile, platform, buildArgs, labels, tags, caches, "", out); err != nil {
+		_, _ = fmt.Fprintln(eout, err.Error())
+		return -7
+	}
+	return 0
+}
+
+func doBuildKit(options *buildKitOptions, dir, dockerfile, platform string, buildArgs map[string]*string, labels map[string]string, tags, caches []string, target string, out io.Writer) error {
+	args := []string{"build", "--progress=plain", "--file", dockerfile}
+	for _, key := range sortedKeys(buildArgs) {
+		args = append(args, "--build-arg", fmt.Sprintf("%s=%s", key, *buildArgs[key]))
+	}
+	// Embed cache metadata so the pushed images can be used with --cache-from
+	args = append(args, "--build-arg", "BUILDKIT_INLINE_CACHE=1")
+	var labelKeys []string
+	for key := range labels {
+		labelKeys = append(labelKeys, key)
+	}
+	sort.Strings(labelKeys)
+	for _, key := range labelKeys {
+		args = append(args, "--label", fmt.Sprintf("%s=%s", key, labels[key]))
+	}
+	for _, tag := range tags {
+		args = append(args, "--tag", tag)
+	}
+	for _, cache := range caches {
+		args = append(args, "--cache-from", cache)
+	}
+	if target != "" {
+		args = append(args, "--target", target)
+	}
+	if platform != "" {
+		args = append(args, "--platform", platform)
+	}
+	for _, secret := range options.secrets {
+		args = append(args, "--secret", secret)
+	}
+	for _, ssh := range options.ssh {
+		args = append(args, "--ssh", ssh)
+	}
+	args = append(args, dir)
+	if err := dockerCli(args, out); err != nil {
+		return fmt.Errorf("docker build failed: %v", err)
+	}
+	return nil
+}
+
+func sortedKeys(m map[string]*string) []string {
+	var keys []string
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
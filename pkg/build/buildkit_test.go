@@ -0,0 +1,212 @@
+package build
+
+import (
+	"bytes"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/sparetimecoders/build-tools/pkg"
+	"github.com/sparetimecoders/build-tools/pkg/docker"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func mockDockerCli(calls *[][]string, err error) func() {
+	tmp := dockerCli
+	dockerCli = func(args []string, out io.Writer) error {
+		*calls = append(*calls, args)
+		_, _ = out.Write([]byte("#1 DONE\n"))
+		return err
+	}
+	return func() { dockerCli = tmp }
+}
+
+func TestBuild_BuildKit(t *testing.T) {
+	defer pkg.SetEnv("CI_COMMIT_SHA", "abc123")()
+	defer pkg.SetEnv("CI_PROJECT_NAME", "reponame")()
+	defer pkg.SetEnv("CI_COMMIT_REF_NAME", "feature1")()
+	defer pkg.SetEnv("DOCKERHUB_REPOSITORY", "repo")()
+	defer pkg.SetEnv("NPM_TOKEN", "secret")()
+	defer pkg.SetEnv("SOURCE_DATE_EPOCH", "1580702400")()
+	dir, _ := ioutil.TempDir(os.TempDir(), "build-tools")
+	defer func() { _ = os.RemoveAll(dir) }()
+	_ = ioutil.WriteFile(filepath.Join(dir, "Dockerfile"), []byte("FROM scratch as build\nRUN --mount=type=cache,target=/cache true\nFROM scratch\nCOPY --from=build file ."), 0777)
+
+	var calls [][]string
+	defer mockDockerCli(&calls, nil)()
+	out := &bytes.Buffer{}
+	eout := &bytes.Buffer{}
+	client := &docker.MockDocker{}
+	code := build(client, dir, createBuildContext, out, eout, "--secret", "id=npm,env=NPM_TOKEN", "--ssh", "default")
+
+	assert.Equal(t, 0, code)
+	assert.Equal(t, "", eout.String())
+	assert.Equal(t, 0, len(client.BuildOptions))
+	assert.Contains(t, out.String(), "Using \x1b[32mBuildKit\x1b[39m")
+	assert.Contains(t, out.String(), "#1 DONE\n")
+	dockerfile := filepath.Join(dir, "Dockerfile")
+	assert.Equal(t, [][]string{
+		{"build", "--progress=plain", "--file", dockerfile,
+			"--build-arg", "CI_BRANCH=feature1", "--build-arg", "CI_COMMIT=abc123", "--build-arg", "BUILDKIT_INLINE_CACHE=1",
+			"--label", "com.github.sparetimecoders.build-tools.provenance=Gitlab",
+			"--label", "org.opencontainers.image.created=2020-02-03T04:00:00Z",
+			"--label", "org.opencontainers.image.ref.name=feature1",
+			"--label", "org.opencontainers.image.revision=abc123",
+			"--tag", "repo/reponame:build", "--cache-from", "repo/reponame:build", "--target", "build",
+			"--secret", "id=npm,env=NPM_TOKEN", "--ssh", "default", dir},
+		{"build", "--progress=plain", "--file", dockerfile,
+			"--build-arg", "CI_BRANCH=feature1", "--build-arg", "CI_COMMIT=abc123", "--build-arg", "BUILDKIT_INLINE_CACHE=1",
+			"--label", "com.github.sparetimecoders.build-tools.provenance=Gitlab",
+			"--label", "org.opencontainers.image.created=2020-02-03T04:00:00Z",
+			"--label", "org.opencontainers.image.ref.name=feature1",
+			"--label", "org.opencontainers.image.revision=abc123",
+			"--tag", "repo/reponame:abc123", "--tag", "repo/reponame:feature1",
+			"--cache-from", "repo/reponame:feature1", "--cache-from", "repo/reponame:latest", "--cache-from", "repo/reponame:build",
+			"--secret", "id=npm,env=NPM_TOKEN", "--ssh", "default", dir},
+	}, calls)
+}
+
+func TestBuild_BuildKitFromConfig(t *testing.T) {
+	defer pkg.SetEnv("CI_COMMIT_SHA", "abc123")()
+	defer pkg.SetEnv("CI_PROJECT_NAME", "reponame")()
+	defer pkg.SetEnv("CI_COMMIT_REF_NAME", "feature1")()
+	defer pkg.SetEnv("BUILDTOOLS_CONTENT", `build:
+  secrets:
+    - id: netrc
+      file: /home/user/.netrc
+`)()
+	dir, _ := ioutil.TempDir(os.TempDir(), "build-tools")
+	defer func() { _ = os.RemoveAll(dir) }()
+	_ = ioutil.WriteFile(filepath.Join(dir, "Dockerfile"), []byte("FROM scratch"), 0777)
+
+	var calls [][]string
+	defer mockDockerCli(&calls, nil)()
+	out := &bytes.Buffer{}
+	eout := &bytes.Buffer{}
+	code := build(&docker.MockDocker{}, dir, createBuildContext, out, eout)
+
+	assert.Equal(t, 0, code)
+	assert.Equal(t, 1, len(calls))
+	assert.Contains(t, calls[0], "id=netrc,src=/home/user/.netrc")
+}
+
+func TestBuild_BuildKitInvalidSecret(t *testing.T) {
+	defer pkg.SetEnv("CI_COMMIT_SHA", "abc123")()
+	defer pkg.SetEnv("CI_PROJECT_NAME", "reponame")()
+	defer pkg.SetEnv("CI_COMMIT_REF_NAME", "feature1")()
+	defer pkg.SetEnv("BUILDTOOLS_CONTENT", `build:
+  secrets:
+    - id: netrc
+`)()
+
+	var calls [][]string
+	defer mockDockerCli(&calls, nil)()
+	out := &bytes.Buffer{}
+	eout := &bytes.Buffer{}
+	code := build(&docker.MockDocker{}, name, createBuildContext, out, eout)
+
+	assert.Equal(t, -10, code)
+	assert.Equal(t, 0, len(calls))
+	assert.Equal(t, "secret 'netrc' must have exactly one of file or env set\n", eout.String())
+}
+
+func TestBuild_BuildKitError(t *testing.T) {
+	defer pkg.SetEnv("CI_COMMIT_SHA", "abc123")()
+	defer pkg.SetEnv("CI_PROJECT_NAME", "reponame")()
+	defer pkg.SetEnv("CI_COMMIT_REF_NAME", "feature1")()
+	dir, _ := ioutil.TempDir(os.TempDir(), "build-tools")
+	defer func() { _ = os.RemoveAll(dir) }()
+	_ = ioutil.WriteFile(filepath.Join(dir, "Dockerfile"), []byte("FROM scratch"), 0777)
+
+	var calls [][]string
+	defer mockDockerCli(&calls, errors.New("exit status 1"))()
+	out := &bytes.Buffer{}
+	eout := &bytes.Buffer{}
+	code := build(&docker.MockDocker{}, dir, createBuildContext, out, eout, "--buildkit")
+
+	assert.Equal(t, -7, code)
+	assert.Equal(t, "docker build failed: exit status 1\n", eout.String())
+}
+
+func TestDockerCli_ErrorIncludesOutputTail(t *testing.T) {
+	dir, _ := ioutil.TempDir(os.TempDir(), "build-tools")
+	defer func() { _ = os.RemoveAll(dir) }()
+	script := "#!/bin/sh\necho \"#1 [internal] load build definition\"\nfor i in 1 2 3 4 5 6 7 8 9 10 11 12; do echo \"#2 step $i\" >&2; done\necho \"failed to solve: process did not complete successfully\" >&2\nexit 1\n"
+	_ = ioutil.WriteFile(filepath.Join(dir, "docker"), []byte(script), 0700)
+	path := os.Getenv("PATH")
+	defer func() { _ = os.Setenv("PATH", path) }()
+	_ = os.Setenv("PATH", dir+string(os.PathListSeparator)+path)
+
+	out := &bytes.Buffer{}
+	err := dockerCli([]string{"build", "."}, out)
+
+	assert.EqualError(t, err, "exit status 1\n#2 step 4\n#2 step 5\n#2 step 6\n#2 step 7\n#2 step 8\n#2 step 9\n#2 step 10\n#2 step 11\n#2 step 12\nfailed to solve: process did not complete successfully")
+	assert.Contains(t, out.String(), "#1 [internal] load build definition\n")
+	assert.Contains(t, out.String(), "#2 step 1\n")
+}
+
+func TestOutputTail(t *testing.T) {
+	tail := &outputTail{}
+	_, _ = tail.Write([]byte("first\n"))
+	assert.Equal(t, "first", tail.String())
+
+	for i := 0; i < 10000; i++ {
+		_, _ = tail.Write([]byte("line\n"))
+	}
+	_, _ = tail.Write([]byte("last\n\n"))
+	assert.Equal(t, strings.Repeat("line\n", 9)+"last", tail.String())
+	assert.True(t, tail.buf.Len() <= 64*1024)
+}
+
+func TestBuild_BuildKitContextTooLarge(t *testing.T) {
+	defer pkg.SetEnv("CI_COMMIT_SHA", "abc123")()
+	defer pkg.SetEnv("CI_PROJECT_NAME", "reponame")()
+	defer pkg.SetEnv("CI_COMMIT_REF_NAME", "feature1")()
+	defer pkg.SetEnv("BUILD_CONTEXT_MAX_SIZE", "10kB")()
+	dir, _ := ioutil.TempDir(os.TempDir(), "build-tools")
+	defer func() { _ = os.RemoveAll(dir) }()
+	_ = ioutil.WriteFile(filepath.Join(dir, "Dockerfile"), []byte("FROM scratch"), 0777)
+	_ = ioutil.WriteFile(filepath.Join(dir, "data.csv"), bytes.Repeat([]byte("a"), 20000), 0666)
+	_ = ioutil.WriteFile(filepath.Join(dir, ".dockerignore"), []byte("*.csv"), 0666)
+
+	var calls [][]string
+	defer mockDockerCli(&calls, nil)()
+	out := &bytes.Buffer{}
+	eout := &bytes.Buffer{}
+	code := build(&docker.MockDocker{}, dir, createBuildContext, out, eout, "--buildkit")
+
+	assert.Equal(t, 0, code)
+	assert.Equal(t, 1, len(calls))
+	assert.Contains(t, out.String(), "Build context is \x1b[32m")
+
+	_ = os.Remove(filepath.Join(dir, ".dockerignore"))
+	calls = nil
+	out = &bytes.Buffer{}
+	eout = &bytes.Buffer{}
+	code = build(&docker.MockDocker{}, dir, createBuildContext, out, eout, "--buildkit")
+
+	assert.Equal(t, -2, code)
+	assert.Equal(t, 0, len(calls))
+	assert.Contains(t, eout.String(), "larger than the maximum of 10kB")
+}
+
+func TestBuild_BuildKitMissingDockerfile(t *testing.T) {
+	defer pkg.SetEnv("CI_COMMIT_SHA", "abc123")()
+	defer pkg.SetEnv("CI_PROJECT_NAME", "reponame")()
+	defer pkg.SetEnv("CI_COMMIT_REF_NAME", "feature1")()
+	dir, _ := ioutil.TempDir(os.TempDir(), "build-tools")
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	var calls [][]string
+	defer mockDockerCli(&calls, nil)()
+	out := &bytes.Buffer{}
+	eout := &bytes.Buffer{}
+	code := build(&docker.MockDocker{}, dir, createBuildContext, out, eout, "--buildkit")
+
+	assert.Equal(t, -5, code)
+	assert.Equal(t, 0, len(calls))
+	assert.Contains(t, eout.String(), "no such file or directory")
+}
@@ -0,0 +1,35 @@
+package build
+
+import (
+	"fmt"
+	"github.com/liamg/tml"
+	"github.com/sparetimecoders/build-tools/pkg/docker"
+	"github.com/sparetimecoders/build-tools/pkg/report"
+	"github.com/sparetimecoders/build-tools/pkg/sbom"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// writeSBOM generates the SBOM of the built image tag and writes it to dir, where push picks it up
+func writeSBOM(client docker.Client, dir, name, platform, tag, format string, entry *report.Image, out io.Writer) error {
+	bom, err := sbom.Generate(client, tag)
+	if err != nil {
+		return err
+	}
+	content, err := bom.Encode(format)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	file := filepath.Join(dir, sbom.FileName(name, platform))
+	if err := ioutil.WriteFile(file, content, 0644); err != nil {
+		return err
+	}
+	entry.SBOMs = append(entry.SBOMs, file)
+	_, _ = fmt.Fprintln(out, tml.Sprintf("Wrote SBOM with <green>%d</green> packages to <green>%s</green>", len(bom.Packages), file))
+	return nil
+}
@@ -0,0 +1,117 @@
+package build
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/sparetimecoders/build-tools/pkg"
+	"github.com/sparetimecoders/build-tools/pkg/docker"
+	"github.com/sparetimecoders/build-tools/pkg/report"
+	"github.com/sparetimecoders/build-tools/pkg/sbom"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var debianImage = sbom.MockArchive(map[string]string{
+	"etc/os-release":      "ID=debian\nVERSION_ID=\"11\"\n",
+	"var/lib/dpkg/status": "Package: libc6\nStatus: install ok installed\nVersion: 2.31\n\nPackage: tzdata\nStatus: install ok installed\nVersion: 2021a\n",
+})
+
+func TestBuild_SBOM(t *testing.T) {
+	defer pkg.SetEnv("CI_COMMIT_SHA", "abc123")()
+	defer pkg.SetEnv("CI_PROJECT_NAME", "reponame")()
+	defer pkg.SetEnv("CI_COMMIT_REF_NAME", "feature1")()
+	defer pkg.SetEnv("DOCKERHUB_REPOSITORY", "repo")()
+	dir, _ := ioutil.TempDir(os.TempDir(), "build-tools")
+	defer func() { _ = os.RemoveAll(dir) }()
+	_ = ioutil.WriteFile(filepath.Join(dir, "Dockerfile"), []byte("FROM scratch as build\nFROM scratch"), 0777)
+	reportFile := filepath.Join(dir, "build.json")
+
+	out := &bytes.Buffer{}
+	eout := &bytes.Buffer{}
+	client := &docker.MockDocker{SaveOutput: debianImage}
+	code := build(client, dir, createBuildContext, out, eout, "--sbom", "CycloneDX", "--report", reportFile)
+
+	assert.Equal(t, 0, code)
+	assert.Equal(t, "", eout.String())
+	assert.Equal(t, []string{"repo/reponame:abc123"}, client.Saved)
+	file := filepath.Join(dir, "sbom", "reponame.json")
+	assert.Contains(t, out.String(), fmt.Sprintf("\x1b[0mWrote SBOM with \x1b[32m2\x1b[39m packages to \x1b[32m%s\x1b[39m\x1b[0m\n", file))
+	content, err := ioutil.ReadFile(file)
+	assert.NoError(t, err)
+	assert.Equal(t, sbom.MediaTypeCycloneDX, sbom.DetectMediaType(content))
+	assert.Contains(t, string(content), "pkg:deb/debian/libc6@2.31")
+	reportContent, _ := ioutil.ReadFile(reportFile)
+	result := &report.Report{}
+	_ = json.Unmarshal(reportContent, result)
+	assert.Equal(t, []string{file}, result.Images[0].SBOMs)
+}
+
+func TestBuild_SBOMFromConfigWithPlatforms(t *testing.T) {
+	defer pkg.SetEnv("CI_COMMIT_SHA", "abc123")()
+	defer pkg.SetEnv("CI_PROJECT_NAME", "reponame")()
+	defer pkg.SetEnv("CI_COMMIT_REF_NAME", "feature1")()
+	defer pkg.SetEnv("DOCKERHUB_REPOSITORY", "repo")()
+	defer pkg.SetEnv("BUILDTOOLS_CONTENT", `build:
+  sbom: spdx
+  sbomDir: target/sbom
+  platforms:
+    - linux/amd64
+    - linux/arm64
+`)()
+	dir, _ := ioutil.TempDir(os.TempDir(), "build-tools")
+	defer func() { _ = os.RemoveAll(dir) }()
+	_ = ioutil.WriteFile(filepath.Join(dir, "Dockerfile"), []byte("FROM scratch"), 0777)
+
+	out := &bytes.Buffer{}
+	eout := &bytes.Buffer{}
+	client := &docker.MockDocker{SaveOutput: debianImage}
+	code := build(client, dir, createBuildContext, out, eout)
+
+	assert.Equal(t, 0, code)
+	assert.Equal(t, "", eout.String())
+	assert.Equal(t, []string{"repo/reponame:abc123-linux-amd64", "repo/reponame:abc123-linux-arm64"}, client.Saved)
+	for _, name := range []string{"reponame-linux-amd64.json", "reponame-linux-arm64.json"} {
+		content, err := ioutil.ReadFile(filepath.Join(dir, "target", "sbom", name))
+		assert.NoError(t, err)
+		assert.Equal(t, sbom.MediaTypeSPDX, sbom.DetectMediaType(content))
+	}
+}
+
+func TestBuild_InvalidSBOMFormat(t *testing.T) {
+	defer pkg.SetEnv("CI_COMMIT_SHA", "abc123")()
+	defer pkg.SetEnv("CI_PROJECT_NAME", "reponame")()
+	defer pkg.SetEnv("CI_COMMIT_REF_NAME", "feature1")()
+	dir, _ := ioutil.TempDir(os.TempDir(), "build-tools")
+	defer func() { _ = os.RemoveAll(dir) }()
+	_ = ioutil.WriteFile(filepath.Join(dir, "Dockerfile"), []byte("FROM scratch"), 0777)
+
+	out := &bytes.Buffer{}
+	eout := &bytes.Buffer{}
+	client := &docker.MockDocker{}
+	code := build(client, dir, createBuildContext, out, eout, "--sbom", "syft")
+
+	assert.Equal(t, -14, code)
+	assert.Equal(t, "unsupported SBOM format 'syft', expected cyclonedx or spdx\n", eout.String())
+	assert.Equal(t, 0, len(client.BuildOptions))
+}
+
+func TestBuild_SBOMSaveError(t *testing.T) {
+	defer pkg.SetEnv("CI_COMMIT_SHA", "abc123")()
+	defer pkg.SetEnv("CI_PROJECT_NAME", "reponame")()
+	defer pkg.SetEnv("CI_COMMIT_REF_NAME", "feature1")()
+	dir, _ := ioutil.TempDir(os.TempDir(), "build-tools")
+	defer func() { _ = os.RemoveAll(dir) }()
+	_ = ioutil.WriteFile(filepath.Join(dir, "Dockerfile"), []byte("FROM scratch"), 0777)
+
+	out := &bytes.Buffer{}
+	eout := &bytes.Buffer{}
+	code := build(&docker.MockDocker{SaveError: errors.New("no such image")}, dir, createBuildContext, out, eout, "--sbom", "spdx")
+
+	assert.Equal(t, -14, code)
+	assert.Equal(t, "unable to save image noregistry/reponame:abc123: no such image\n", eout.String())
+}
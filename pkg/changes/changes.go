@@ -0,0 +1,76 @@
+package changes
+
+import (
+	"github.com/sparetimecoders/build-tools/pkg/config"
+	"github.com/sparetimecoders/build-tools/pkg/docker"
+	"github.com/sparetimecoders/build-tools/pkg/registry"
+	"github.com/sparetimecoders/build-tools/pkg/vcs"
+)
+
+// RevisionLabel is the image label holding the commit the image was built from
+const RevisionLabel = config.LabelRevision
+
+// Detector finds images whose inputs did not change since they were last built
+type Detector struct {
+	VCS         vcs.VCS
+	API         *registry.API
+	RegistryUrl string
+	// Since is an explicit commit to compare against, only the image tagged with it is used. If empty the revision
+	// label of the previous image tagged with one of Tags is used
+	Since string
+	// Tags are the tags to look for a previously built image in, in order
+	Tags []string
+}
+
+// Previous is a previously built image which can be reused
+type Previous struct {
+	Reference registry.Reference
+	Revision  string
+}
+
+// Unchanged returns the previously built image if none of the files in the build context or the Dockerfile
+// of image changed since it was built, or nil if the image must be built
+func (d *Detector) Unchanged(image config.Image) (*Previous, error) {
+	previous, err := d.previous(image)
+	if err != nil || previous == nil {
+		return nil, err
+	}
+	files, err := d.VCS.ChangedFiles(previous.Revision)
+	if err != nil {
+		return nil, err
+	}
+	if image.Affected(files) {
+		return nil, nil
+	}
+	return previous, nil
+}
+
+func (d *Detector) previous(image config.Image) (*Previous, error) {
+	tags := d.Tags
+	if d.Since != "" {
+		// An image tagged with another tag may have been built from any commit, so comparing it against
+		// Since could reuse an image built from different inputs
+		tags = []string{d.Since}
+	}
+	for _, tag := range tags {
+		ref, err := registry.ParseReference(docker.Tag(d.RegistryUrl, image.Name, tag))
+		if err != nil {
+			return nil, err
+		}
+		imageConfig, err := d.API.ImageConfig(ref)
+		if err == registry.ErrNotFound {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		revision := imageConfig.Config.Labels[RevisionLabel]
+		if revision == "" {
+			continue
+		}
+		if d.Since != "" {
+			revision = d.Since
+		}
+		return &Previous{Reference: ref, Revision: revision}, nil
+	}
+	return nil, nil
+}
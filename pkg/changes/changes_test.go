@@ -0,0 +1,96 @@
+package changes
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/sparetimecoders/build-tools/pkg/config"
+	"github.com/sparetimecoders/build-tools/pkg/registry"
+	"github.com/sparetimecoders/build-tools/pkg/vcs"
+	"io"
+	"testing"
+)
+
+func TestDetector_Unchanged(t *testing.T) {
+	server := registry.NewMockRegistryServer()
+	defer server.Close()
+	server.AddImage("api", "latest", map[string]string{RevisionLabel: "abc123"})
+
+	detector := &Detector{VCS: vcs.NewMockVcsWithChanges("services/web/main.go"), API: registry.NewAPI(""), RegistryUrl: server.Host(), Tags: []string{"feature", "latest"}}
+	previous, err := detector.Unchanged(config.Image{Name: "api", Context: "services/api", Dockerfile: "Dockerfile"})
+	assert.NoError(t, err)
+	assert.Equal(t, "abc123", previous.Revision)
+	assert.Equal(t, server.Host()+"/api:latest", previous.Reference.String())
+}
+
+func TestDetector_Changed(t *testing.T) {
+	server := registry.NewMockRegistryServer()
+	defer server.Close()
+	server.AddImage("api", "feature", map[string]string{RevisionLabel: "abc123"})
+
+	detector := &Detector{VCS: vcs.NewMockVcsWithChanges("services/api/main.go"), API: registry.NewAPI(""), RegistryUrl: server.Host(), Tags: []string{"feature", "latest"}}
+	previous, err := detector.Unchanged(config.Image{Name: "api", Context: "services/api", Dockerfile: "Dockerfile"})
+	assert.NoError(t, err)
+	assert.Nil(t, previous)
+}
+
+func TestDetector_NoPreviousImage(t *testing.T) {
+	server := registry.NewMockRegistryServer()
+	defer server.Close()
+	server.AddImage("api", "latest", nil)
+
+	detector := &Detector{VCS: vcs.NewMockVcsWithChanges(), API: registry.NewAPI(""), RegistryUrl: server.Host(), Tags: []string{"latest"}}
+	previous, err := detector.Unchanged(config.Image{Name: "api", Context: "services/api", Dockerfile: "Dockerfile"})
+	assert.NoError(t, err)
+	assert.Nil(t, previous)
+}
+
+func TestDetector_Since(t *testing.T) {
+	server := registry.NewMockRegistryServer()
+	defer server.Close()
+	server.AddImage("api", "latest", map[string]string{RevisionLabel: "abc123"})
+	server.AddImage("api", "def456", map[string]string{RevisionLabel: "def456"})
+
+	detector := &Detector{VCS: vcs.NewMockVcsWithChanges(), API: registry.NewAPI(""), RegistryUrl: server.Host(), Since: "def456", Tags: []string{"latest"}}
+	previous, err := detector.Unchanged(config.Image{Name: "api", Context: "services/api", Dockerfile: "Dockerfile"})
+	assert.NoError(t, err)
+	assert.Equal(t, "def456", previous.Revision)
+	assert.Equal(t, server.Host()+"/api:def456", previous.Reference.String())
+}
+
+func TestDetector_SinceWithoutImage(t *testing.T) {
+	server := registry.NewMockRegistryServer()
+	defer server.Close()
+	server.AddImage("api", "latest", map[string]string{RevisionLabel: "abc123"})
+
+	detector := &Detector{VCS: vcs.NewMockVcsWithChanges(), API: registry.NewAPI(""), RegistryUrl: server.Host(), Since: "def456", Tags: []string{"latest"}}
+	previous, err := detector.Unchanged(config.Image{Name: "api", Context: "services/api", Dockerfile: "Dockerfile"})
+	assert.NoError(t, err)
+	assert.Nil(t, previous)
+	assert.NotContains(t, server.Requests, "GET /v2/api/manifests/latest")
+}
+
+func TestDetector_VCSError(t *testing.T) {
+	server := registry.NewMockRegistryServer()
+	defer server.Close()
+	server.AddImage("api", "latest", map[string]string{RevisionLabel: "abc123"})
+
+	detector := &Detector{VCS: &brokenVcs{}, API: registry.NewAPI(""), RegistryUrl: server.Host(), Tags: []string{"latest"}}
+	_, err := detector.Unchanged(config.Image{Name: "api", Context: "services/api", Dockerfile: "Dockerfile"})
+	assert.EqualError(t, err, "broken")
+}
+
+type brokenVcs struct {
+	vcs.CommonVCS
+}
+
+func (b brokenVcs) Identify(dir string, out io.Writer) bool {
+	return true
+}
+
+func (b brokenVcs) Name() string {
+	return "broken"
+}
+
+func (b brokenVcs) ChangedFiles(since string) ([]string, error) {
+	return nil, errors.New("broken")
+}
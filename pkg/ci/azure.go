@@ -1,10 +1,20 @@
 package ci
 
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
 type Azure struct {
 	*Common
-	CICommit     string `env:"BUILD_SOURCEVERSION"`
-	CIBuildName  string `env:"BUILD_REPOSITORY_NAME"`
-	CIBranchName string `env:"BUILD_SOURCEBRANCHNAME"`
+	CICommit      string `env:"BUILD_SOURCEVERSION"`
+	CIBuildName   string `env:"BUILD_REPOSITORY_NAME"`
+	CIBranchName  string `env:"BUILD_SOURCEBRANCHNAME"`
+	CIBuildNumber string `env:"BUILD_BUILDID"`
+	CIRef         string `env:"BUILD_SOURCEBRANCH"`
+	CICollection  string `env:"SYSTEM_TEAMFOUNDATIONCOLLECTIONURI"`
+	CIProject     string `env:"SYSTEM_TEAMPROJECT"`
 }
 
 var _ CI = &Azure{}
@@ -22,6 +32,9 @@ func (c Azure) BuildName() string {
 }
 
 func (c Azure) Branch() string {
+	if strings.HasPrefix(c.CIRef, tagRefPrefix) {
+		return ""
+	}
 	return c.Common.Branch(c.CIBranchName)
 }
 
@@ -29,6 +42,28 @@ func (c Azure) Commit() string {
 	return c.Common.Commit(c.CICommit)
 }
 
+func (c Azure) Tag() string {
+	if strings.HasPrefix(c.CIRef, tagRefPrefix) {
+		return strings.TrimPrefix(c.CIRef, tagRefPrefix)
+	}
+	ref := c.CIRef
+	if ref == "" {
+		ref = c.CIBranchName
+	}
+	return c.Common.Tag("", ref)
+}
+
+func (c Azure) BuildNumber() string {
+	return c.CIBuildNumber
+}
+
+func (c Azure) BuildURL() string {
+	if c.CICollection == "" || c.CIProject == "" || c.CIBuildNumber == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s/%s/_build/results?buildId=%s", strings.TrimSuffix(c.CICollection, "/"), url.PathEscape(c.CIProject), c.CIBuildNumber)
+}
+
 func (c Azure) Configured() bool {
 	return c.CIBuildName != ""
 }
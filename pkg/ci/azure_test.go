@@ -56,3 +56,35 @@ func TestAzure_Commit_Fallback(t *testing.T) {
 
 	assert.Equal(t, "fallback-sha", ci.Commit())
 }
+
+func TestAzure_Tag(t *testing.T) {
+	ci := &Azure{CIBranchName: "v1.4.2", CIRef: "refs/tags/v1.4.2"}
+
+	assert.Equal(t, "v1.4.2", ci.Tag())
+	assert.Equal(t, "", ci.Branch())
+}
+
+func TestAzure_Tag_Fallback(t *testing.T) {
+	ci := &Azure{Common: &Common{VCS: vcs.NewMockVcsWithTag("v1.0.0")}}
+
+	assert.Equal(t, "v1.0.0", ci.Tag())
+}
+
+func TestAzure_Tag_BranchBuildOfTaggedCommit(t *testing.T) {
+	ci := &Azure{Common: &Common{VCS: vcs.NewMockVcsWithTag("v1.0.0")}, CIRef: "refs/heads/master", CIBranchName: "master"}
+
+	assert.Equal(t, "", ci.Tag())
+	assert.Equal(t, "master", ci.Branch())
+}
+
+func TestAzure_BuildURL(t *testing.T) {
+	ci := &Azure{CICollection: "https://dev.azure.com/org/", CIProject: "My Project", CIBuildNumber: "42"}
+
+	assert.Equal(t, "https://dev.azure.com/org/My%20Project/_build/results?buildId=42", ci.BuildURL())
+}
+
+func TestAzure_BuildURL_Missing(t *testing.T) {
+	ci := &Azure{CIBuildNumber: "42"}
+
+	assert.Equal(t, "", ci.BuildURL())
+}
@@ -2,9 +2,12 @@ package ci
 
 type Buildkite struct {
 	*Common
-	CICommit     string `env:"BUILDKITE_COMMIT"`
-	CIBuildName  string `env:"BUILDKITE_PIPELINE_SLUG"`
-	CIBranchName string `env:"BUILDKITE_BRANCH_NAME"`
+	CICommit      string `env:"BUILDKITE_COMMIT"`
+	CIBuildName   string `env:"BUILDKITE_PIPELINE_SLUG"`
+	CIBranchName  string `env:"BUILDKITE_BRANCH_NAME"`
+	CIBuildNumber string `env:"BUILDKITE_BUILD_NUMBER"`
+	CITag         string `env:"BUILDKITE_TAG"`
+	CIBuildURL    string `env:"BUILDKITE_BUILD_URL"`
 }
 
 var _ CI = &Buildkite{}
@@ -22,6 +25,9 @@ func (c *Buildkite) BuildName() string {
 }
 
 func (c *Buildkite) Branch() string {
+	if c.CITag != "" {
+		return ""
+	}
 	return c.Common.Branch(c.CIBranchName)
 }
 
@@ -29,6 +35,18 @@ func (c *Buildkite) Commit() string {
 	return c.Common.Commit(c.CICommit)
 }
 
+func (c *Buildkite) Tag() string {
+	return c.Common.Tag(c.CITag, c.CIBranchName)
+}
+
+func (c *Buildkite) BuildNumber() string {
+	return c.CIBuildNumber
+}
+
+func (c *Buildkite) BuildURL() string {
+	return c.CIBuildURL
+}
+
 func (c *Buildkite) Configured() bool {
 	return c.CIBuildName != ""
 }
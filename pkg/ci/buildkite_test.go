@@ -55,3 +55,29 @@ func TestBuildkite_Commit_Fallback(t *testing.T) {
 
 	assert.Equal(t, "fallback-sha", ci.Commit())
 }
+
+func TestBuildkite_Tag(t *testing.T) {
+	ci := &Buildkite{CIBranchName: "v1.4.2", CITag: "v1.4.2"}
+
+	assert.Equal(t, "v1.4.2", ci.Tag())
+	assert.Equal(t, "", ci.Branch())
+}
+
+func TestBuildkite_Tag_Fallback(t *testing.T) {
+	ci := &Buildkite{Common: &Common{VCS: vcs.NewMockVcsWithTag("v1.0.0")}}
+
+	assert.Equal(t, "v1.0.0", ci.Tag())
+}
+
+func TestBuildkite_Tag_BranchBuildOfTaggedCommit(t *testing.T) {
+	ci := &Buildkite{Common: &Common{VCS: vcs.NewMockVcsWithTag("v1.0.0")}, CIBranchName: "master"}
+
+	assert.Equal(t, "", ci.Tag())
+	assert.Equal(t, "master", ci.Branch())
+}
+
+func TestBuildkite_BuildURL(t *testing.T) {
+	ci := &Buildkite{CIBuildURL: "https://buildkite.com/org/pipeline/builds/42"}
+
+	assert.Equal(t, "https://buildkite.com/org/pipeline/builds/42", ci.BuildURL())
+}
@@ -14,6 +14,12 @@ type CI interface {
 	Branch() string
 	BranchReplaceSlash() string
 	Commit() string
+	// Tag returns the git tag being built, if any
+	Tag() string
+	// BuildNumber returns the build number assigned by the CI, if any
+	BuildNumber() string
+	// BuildURL returns the URL of the current build in the CI, if known
+	BuildURL() string
 	SetVCS(vcs vcs.VCS)
 	Configured() bool
 }
@@ -48,6 +54,23 @@ func (c *Common) Commit(name string) string {
 	return c.VCS.Commit()
 }
 
+// Tag returns tag if the CI reports a tag build. The tag of the current commit in the VCS is only used if the CI
+// doesn't report the ref being built at all, a branch build of a tagged commit is not a tag build
+func (c *Common) Tag(tag, ref string) string {
+	if tag != "" {
+		return tag
+	}
+	if ref != "" || c.VCS == nil {
+		return ""
+	}
+	return c.VCS.Tag()
+}
+
+// BranchTag returns the docker tag used for the branch name, i.e. feature/login is tagged as feature_login
+func BranchTag(name string) string {
+	return branchReplaceSlash(name)
+}
+
 func branchReplaceSlash(name string) string {
 	return strings.ReplaceAll(strings.ReplaceAll(name, "/", "_"), " ", "_")
 }
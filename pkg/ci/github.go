@@ -1,14 +1,19 @@
 package ci
 
 import (
+	"fmt"
 	"strings"
 )
 
 type Github struct {
 	*Common
-	CICommit     string `env:"GITHUB_SHA"`
-	CIBuildName  string `env:"RUNNER_WORKSPACE"`
-	CIBranchName string `env:"GITHUB_REF"`
+	CICommit      string `env:"GITHUB_SHA"`
+	CIBuildName   string `env:"RUNNER_WORKSPACE"`
+	CIBranchName  string `env:"GITHUB_REF"`
+	CIBuildNumber string `env:"GITHUB_RUN_NUMBER"`
+	CIServerURL   string `env:"GITHUB_SERVER_URL"`
+	CIRepository  string `env:"GITHUB_REPOSITORY"`
+	CIRunID       string `env:"GITHUB_RUN_ID"`
 }
 
 var _ CI = &Github{}
@@ -26,6 +31,9 @@ func (c *Github) BuildName() string {
 }
 
 func (c *Github) Branch() string {
+	if strings.HasPrefix(c.CIBranchName, tagRefPrefix) {
+		return ""
+	}
 	return c.Common.Branch(strings.TrimPrefix(c.CIBranchName, "refs/heads/"))
 }
 
@@ -33,6 +41,24 @@ func (c *Github) Commit() string {
 	return c.Common.Commit(c.CICommit)
 }
 
+func (c *Github) Tag() string {
+	if strings.HasPrefix(c.CIBranchName, tagRefPrefix) {
+		return strings.TrimPrefix(c.CIBranchName, tagRefPrefix)
+	}
+	return c.Common.Tag("", c.CIBranchName)
+}
+
+func (c *Github) BuildNumber() string {
+	return c.CIBuildNumber
+}
+
+func (c *Github) BuildURL() string {
+	if c.CIServerURL == "" || c.CIRepository == "" || c.CIRunID == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s/%s/actions/runs/%s", c.CIServerURL, c.CIRepository, c.CIRunID)
+}
+
 func (c *Github) Configured() bool {
 	return c.CIBuildName != ""
 }
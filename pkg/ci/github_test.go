@@ -61,3 +61,35 @@ func TestGithub_Commit_Fallback(t *testing.T) {
 
 	assert.Equal(t, "fallback-sha", ci.Commit())
 }
+
+func TestGithub_Tag(t *testing.T) {
+	ci := &Github{CIBranchName: "refs/tags/v1.4.2"}
+
+	assert.Equal(t, "v1.4.2", ci.Tag())
+	assert.Equal(t, "", ci.Branch())
+}
+
+func TestGithub_Tag_Fallback(t *testing.T) {
+	ci := &Github{Common: &Common{VCS: vcs.NewMockVcsWithTag("v1.0.0")}}
+
+	assert.Equal(t, "v1.0.0", ci.Tag())
+}
+
+func TestGithub_Tag_BranchBuildOfTaggedCommit(t *testing.T) {
+	ci := &Github{Common: &Common{VCS: vcs.NewMockVcsWithTag("v1.0.0")}, CIBranchName: "refs/heads/master"}
+
+	assert.Equal(t, "", ci.Tag())
+	assert.Equal(t, "master", ci.Branch())
+}
+
+func TestGithub_BuildURL(t *testing.T) {
+	ci := &Github{CIServerURL: "https://github.com", CIRepository: "org/repo", CIRunID: "1234"}
+
+	assert.Equal(t, "https://github.com/org/repo/actions/runs/1234", ci.BuildURL())
+}
+
+func TestGithub_BuildURL_Missing(t *testing.T) {
+	ci := &Github{CIServerURL: "https://github.com"}
+
+	assert.Equal(t, "", ci.BuildURL())
+}
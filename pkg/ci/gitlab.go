@@ -2,9 +2,12 @@ package ci
 
 type Gitlab struct {
 	*Common
-	CICommit     string `env:"CI_COMMIT_SHA"`
-	CIBuildName  string `env:"CI_PROJECT_NAME"`
-	CIBranchName string `env:"CI_COMMIT_REF_NAME"`
+	CICommit      string `env:"CI_COMMIT_SHA"`
+	CIBuildName   string `env:"CI_PROJECT_NAME"`
+	CIBranchName  string `env:"CI_COMMIT_REF_NAME"`
+	CIBuildNumber string `env:"CI_PIPELINE_IID"`
+	CITag         string `env:"CI_COMMIT_TAG"`
+	CIBuildURL    string `env:"CI_JOB_URL"`
 }
 
 var _ CI = &Gitlab{}
@@ -22,6 +25,9 @@ func (c *Gitlab) BuildName() string {
 }
 
 func (c *Gitlab) Branch() string {
+	if c.CITag != "" {
+		return ""
+	}
 	return c.Common.Branch(c.CIBranchName)
 }
 
@@ -29,6 +35,18 @@ func (c *Gitlab) Commit() string {
 	return c.Common.Commit(c.CICommit)
 }
 
+func (c *Gitlab) Tag() string {
+	return c.Common.Tag(c.CITag, c.CIBranchName)
+}
+
+func (c *Gitlab) BuildNumber() string {
+	return c.CIBuildNumber
+}
+
+func (c *Gitlab) BuildURL() string {
+	return c.CIBuildURL
+}
+
 func (c *Gitlab) Configured() bool {
 	return c.CIBuildName != ""
 }
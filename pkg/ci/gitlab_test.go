@@ -55,3 +55,29 @@ func TestGitlab_Commit_Fallback(t *testing.T) {
 
 	assert.Equal(t, "fallback-sha", ci.Commit())
 }
+
+func TestGitlab_Tag(t *testing.T) {
+	ci := &Gitlab{CIBranchName: "v1.4.2", CITag: "v1.4.2"}
+
+	assert.Equal(t, "v1.4.2", ci.Tag())
+	assert.Equal(t, "", ci.Branch())
+}
+
+func TestGitlab_Tag_Fallback(t *testing.T) {
+	ci := &Gitlab{Common: &Common{VCS: vcs.NewMockVcsWithTag("v1.0.0")}}
+
+	assert.Equal(t, "v1.0.0", ci.Tag())
+}
+
+func TestGitlab_Tag_BranchBuildOfTaggedCommit(t *testing.T) {
+	ci := &Gitlab{Common: &Common{VCS: vcs.NewMockVcsWithTag("v1.0.0")}, CIBranchName: "master"}
+
+	assert.Equal(t, "", ci.Tag())
+	assert.Equal(t, "master", ci.Branch())
+}
+
+func TestGitlab_BuildURL(t *testing.T) {
+	ci := &Gitlab{CIBuildURL: "https://gitlab.com/org/repo/-/jobs/42"}
+
+	assert.Equal(t, "https://gitlab.com/org/repo/-/jobs/42", ci.BuildURL())
+}
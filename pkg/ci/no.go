@@ -26,6 +26,18 @@ func (c No) Commit() string {
 	return c.VCS.Commit()
 }
 
+func (c No) Tag() string {
+	return c.Common.Tag("", "")
+}
+
+func (c No) BuildNumber() string {
+	return ""
+}
+
+func (c No) BuildURL() string {
+	return ""
+}
+
 func (c No) Configured() bool {
 	return false
 }
@@ -1,10 +1,15 @@
 package ci
 
+import (
+	"strings"
+)
+
 type TeamCity struct {
 	*Common
-	CICommit     string `env:"BUILD_VCS_NUMBER"`
-	CIBuildName  string `env:"TEAMCITY_PROJECT_NAME"`
-	CIBranchName string `env:"BUILD_VCS_BRANCH"`
+	CICommit      string `env:"BUILD_VCS_NUMBER"`
+	CIBuildName   string `env:"TEAMCITY_PROJECT_NAME"`
+	CIBranchName  string `env:"BUILD_VCS_BRANCH"`
+	CIBuildNumber string `env:"BUILD_NUMBER"`
 }
 
 var _ CI = &TeamCity{}
@@ -22,6 +27,9 @@ func (c TeamCity) BuildName() string {
 }
 
 func (c TeamCity) Branch() string {
+	if strings.HasPrefix(c.CIBranchName, tagRefPrefix) {
+		return ""
+	}
 	return c.Common.Branch(c.CIBranchName)
 }
 
@@ -29,6 +37,22 @@ func (c TeamCity) Commit() string {
 	return c.Common.Commit(c.CICommit)
 }
 
+func (c TeamCity) Tag() string {
+	if strings.HasPrefix(c.CIBranchName, tagRefPrefix) {
+		return strings.TrimPrefix(c.CIBranchName, tagRefPrefix)
+	}
+	return c.Common.Tag("", c.CIBranchName)
+}
+
+func (c TeamCity) BuildNumber() string {
+	return c.CIBuildNumber
+}
+
+// BuildURL is not known, TeamCity doesn't expose the URL of the build to the build environment
+func (c TeamCity) BuildURL() string {
+	return ""
+}
+
 func (c TeamCity) Configured() bool {
 	return c.CIBuildName != ""
 }
@@ -62,3 +62,23 @@ func TestTeamCityCI_Configured(t *testing.T) {
 
 	assert.True(t, ci.Configured())
 }
+
+func TestTeamCity_Tag(t *testing.T) {
+	ci := &TeamCity{CIBranchName: "refs/tags/v1.4.2"}
+
+	assert.Equal(t, "v1.4.2", ci.Tag())
+	assert.Equal(t, "", ci.Branch())
+}
+
+func TestTeamCity_Tag_Fallback(t *testing.T) {
+	ci := &TeamCity{Common: &Common{VCS: vcs.NewMockVcsWithTag("v1.0.0")}}
+
+	assert.Equal(t, "v1.0.0", ci.Tag())
+}
+
+func TestTeamCity_Tag_BranchBuildOfTaggedCommit(t *testing.T) {
+	ci := &TeamCity{Common: &Common{VCS: vcs.NewMockVcsWithTag("v1.0.0")}, CIBranchName: "master"}
+
+	assert.Equal(t, "", ci.Tag())
+	assert.Equal(t, "master", ci.Branch())
+}
@@ -0,0 +1,29 @@
+package ci
+
+import (
+	"fmt"
+	"regexp"
+)
+
+const tagRefPrefix = "refs/tags/"
+
+var semver = regexp.MustCompile(`^v?(0|[1-9]\d*)\.(0|[1-9]\d*)\.(0|[1-9]\d*)(-[0-9A-Za-z.-]+)?(\+[0-9A-Za-z.-]+)?$`)
+
+// VersionTags returns the docker tags to use for a semantic version git tag,
+// i.e. v1.4.2 gives 1.4.2, 1.4 and 1. Pre-releases only give the full version
+// and tags which are not semantic versions gives no tags at all
+func VersionTags(tag string) []string {
+	matches := semver.FindStringSubmatch(tag)
+	if matches == nil {
+		return nil
+	}
+	major, minor, patch, prerelease := matches[1], matches[2], matches[3], matches[4]
+	if prerelease != "" {
+		return []string{fmt.Sprintf("%s.%s.%s%s", major, minor, patch, prerelease)}
+	}
+	return []string{
+		fmt.Sprintf("%s.%s.%s", major, minor, patch),
+		fmt.Sprintf("%s.%s", major, minor),
+		major,
+	}
+}
@@ -0,0 +1,21 @@
+package ci
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestVersionTags(t *testing.T) {
+	assert.Equal(t, []string{"1.4.2", "1.4", "1"}, VersionTags("v1.4.2"))
+	assert.Equal(t, []string{"0.10.0", "0.10", "0"}, VersionTags("0.10.0"))
+}
+
+func TestVersionTags_Prerelease(t *testing.T) {
+	assert.Equal(t, []string{"2.0.0-rc.1"}, VersionTags("v2.0.0-rc.1+build.5"))
+}
+
+func TestVersionTags_NotSemver(t *testing.T) {
+	assert.Nil(t, VersionTags(""))
+	assert.Nil(t, VersionTags("release-1"))
+	assert.Nil(t, VersionTags("v1.2"))
+}
@@ -0,0 +1,99 @@
+package config
+
+import (
+	"fmt"
+	"github.com/sparetimecoders/build-tools/pkg/registry"
+	"path/filepath"
+	"strings"
+)
+
+// BuildConfig contains settings for how images are built
+type BuildConfig struct {
+	// BuildKit enables building with BuildKit instead of the legacy builder
+	BuildKit bool `yaml:"buildkit"`
+	// Secrets are exposed to `RUN --mount=type=secret` instructions, requires BuildKit
+	Secrets []Secret `yaml:"secrets"`
+	// SSH lists the agent sockets or keys exposed to `RUN --mount=type=ssh` instructions, i.e. `default` or `<id>=<path>`, requires BuildKit
+	SSH []string `yaml:"ssh"`
+	// Platforms to build images for, i.e. linux/amd64 and linux/arm64. Pushing creates a manifest list referencing all variants
+	Platforms []string `yaml:"platforms"`
+	// Labels are added to every built image, in addition to the OCI labels describing where the image came from.
+	// The values are Go templates with the same data as the tag templates
+	Labels map[string]string `yaml:"labels"`
+	// SBOM is the format of the software bill of materials generated for each built image, cyclonedx or spdx.
+	// No SBOM is generated if it's empty
+	SBOM string `yaml:"sbom" env:"BUILD_SBOM"`
+	// SBOMDir is the directory build writes the SBOMs to and push attaches them from, relative to the project directory
+	SBOMDir string `yaml:"sbomDir" env:"BUILD_SBOM_DIR"`
+}
+
+// DefaultSBOMDir is the directory the SBOMs are written to unless configured
+const DefaultSBOMDir = "sbom"
+
+// SBOMFormat returns the format of the SBOM to generate, or an empty string if no SBOM should be generated
+func (c *BuildConfig) SBOMFormat() (string, error) {
+	format := strings.ToLower(strings.TrimSpace(c.SBOM))
+	switch format {
+	case "", "cyclonedx", "spdx":
+		return format, nil
+	default:
+		return "", fmt.Errorf("unsupported SBOM format '%s', expected cyclonedx or spdx", c.SBOM)
+	}
+}
+
+// SBOMDirectory returns the directory the SBOMs of the images in dir are stored in
+func (c *BuildConfig) SBOMDirectory(dir string) string {
+	sbomDir := c.SBOMDir
+	if sbomDir == "" {
+		sbomDir = DefaultSBOMDir
+	}
+	if filepath.IsAbs(sbomDir) {
+		return sbomDir
+	}
+	return filepath.Join(dir, sbomDir)
+}
+
+// Secret is a build secret read from either a file or an environment variable
+type Secret struct {
+	ID   string `yaml:"id"`
+	File string `yaml:"file"`
+	Env  string `yaml:"env"`
+}
+
+// Arg returns the secret in the format expected by `docker build --secret`
+func (s Secret) Arg() (string, error) {
+	if s.ID == "" {
+		return "", fmt.Errorf("secret is missing an id")
+	}
+	if (s.File == "") == (s.Env == "") {
+		return "", fmt.Errorf("secret '%s' must have exactly one of file or env set", s.ID)
+	}
+	if s.File != "" {
+		return fmt.Sprintf("id=%s,src=%s", s.ID, s.File), nil
+	}
+	return fmt.Sprintf("id=%s,env=%s", s.ID, s.Env), nil
+}
+
+// CurrentPlatforms returns the platforms to build for, given as flags or configured, each entry may be comma separated.
+// If no platforms are given a list with a single empty platform is returned, meaning the platform of the docker daemon
+func (c *Config) CurrentPlatforms(flags []string) ([]string, error) {
+	platforms := c.Build.Platforms
+	if len(flags) > 0 {
+		platforms = flags
+	}
+	var result []string
+	for _, platform := range strings.Split(strings.Join(platforms, ","), ",") {
+		if len(strings.TrimSpace(platform)) == 0 {
+			continue
+		}
+		parsed, err := registry.ParsePlatform(strings.TrimSpace(platform))
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, parsed.String())
+	}
+	if len(result) == 0 {
+		return []string{""}, nil
+	}
+	return result, nil
+}
@@ -0,0 +1,60 @@
+package config
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestSecret_Arg(t *testing.T) {
+	arg, err := Secret{ID: "netrc", File: "/home/user/.netrc"}.Arg()
+	assert.NoError(t, err)
+	assert.Equal(t, "id=netrc,src=/home/user/.netrc", arg)
+
+	arg, err = Secret{ID: "npm", Env: "NPM_TOKEN"}.Arg()
+	assert.NoError(t, err)
+	assert.Equal(t, "id=npm,env=NPM_TOKEN", arg)
+
+	_, err = Secret{File: "/home/user/.netrc"}.Arg()
+	assert.EqualError(t, err, "secret is missing an id")
+
+	_, err = Secret{ID: "both", File: "file", Env: "ENV"}.Arg()
+	assert.EqualError(t, err, "secret 'both' must have exactly one of file or env set")
+}
+
+func TestCurrentPlatforms(t *testing.T) {
+	cfg := InitEmptyConfig()
+	platforms, err := cfg.CurrentPlatforms(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{""}, platforms)
+
+	cfg.Build.Platforms = []string{"linux/amd64", "linux/arm64"}
+	platforms, err = cfg.CurrentPlatforms(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"linux/amd64", "linux/arm64"}, platforms)
+
+	platforms, err = cfg.CurrentPlatforms([]string{"linux/arm64, linux/arm/v7"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"linux/arm64", "linux/arm/v7"}, platforms)
+
+	_, err = cfg.CurrentPlatforms([]string{"arm64"})
+	assert.EqualError(t, err, "invalid platform 'arm64', expected os/arch[/variant]")
+}
+
+func TestBuildConfig_SBOMFormat(t *testing.T) {
+	format, err := (&BuildConfig{}).SBOMFormat()
+	assert.NoError(t, err)
+	assert.Equal(t, "", format)
+
+	format, err = (&BuildConfig{SBOM: "CycloneDX"}).SBOMFormat()
+	assert.NoError(t, err)
+	assert.Equal(t, "cyclonedx", format)
+
+	_, err = (&BuildConfig{SBOM: "syft"}).SBOMFormat()
+	assert.EqualError(t, err, "unsupported SBOM format 'syft', expected cyclonedx or spdx")
+}
+
+func TestBuildConfig_SBOMDirectory(t *testing.T) {
+	assert.Equal(t, "/project/sbom", (&BuildConfig{}).SBOMDirectory("/project"))
+	assert.Equal(t, "/project/out/sbom", (&BuildConfig{SBOMDir: "out/sbom"}).SBOMDirectory("/project"))
+	assert.Equal(t, "/tmp/sbom", (&BuildConfig{SBOMDir: "/tmp/sbom"}).SBOMDirectory("/project"))
+}
@@ -0,0 +1,24 @@
+package config
+
+import (
+	"fmt"
+	"github.com/docker/go-units"
+)
+
+// BuildContextConfig contains the guardrails for the build context sent to the docker daemon
+type BuildContextConfig struct {
+	// MaxSize is the largest allowed build context, i.e. 200MB. Builds with larger contexts fail. No limit if empty
+	MaxSize string `yaml:"maxSize" env:"BUILD_CONTEXT_MAX_SIZE"`
+}
+
+// MaxBytes returns the largest allowed build context in bytes, or 0 if there is no limit
+func (c *BuildContextConfig) MaxBytes() (int64, error) {
+	if c == nil || c.MaxSize == "" {
+		return 0, nil
+	}
+	size, err := units.FromHumanSize(c.MaxSize)
+	if err != nil || size <= 0 {
+		return 0, fmt.Errorf("invalid build context max size '%s'", c.MaxSize)
+	}
+	return size, nil
+}
@@ -0,0 +1,37 @@
+package config
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestBuildContextConfig_MaxBytes(t *testing.T) {
+	tests := []struct {
+		maxSize  string
+		expected int64
+		err      string
+	}{
+		{maxSize: "", expected: 0},
+		{maxSize: "200MB", expected: 200 * 1000 * 1000},
+		{maxSize: "1.5gb", expected: 1500 * 1000 * 1000},
+		{maxSize: "1024", expected: 1024},
+		{maxSize: "lots", err: "invalid build context max size 'lots'"},
+		{maxSize: "0", err: "invalid build context max size '0'"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.maxSize, func(t *testing.T) {
+			cfg := &BuildContextConfig{MaxSize: tt.maxSize}
+			size, err := cfg.MaxBytes()
+			if tt.err != "" {
+				assert.EqualError(t, err, tt.err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.expected, size)
+			}
+		})
+	}
+	var missing *BuildContextConfig
+	size, err := missing.MaxBytes()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), size)
+}
@@ -14,6 +14,7 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 )
 
 type Config struct {
@@ -22,6 +23,13 @@ type Config struct {
 	Registry            *RegistryConfig        `yaml:"registry"`
 	Environments        map[string]Environment `yaml:"environments"`
 	Scaffold            *scaffold.Config       `yaml:"scaffold"`
+	Tags                *TagsConfig            `yaml:"tags"`
+	Images              []Image                `yaml:"images"`
+	Build               *BuildConfig           `yaml:"build"`
+	BuildContext        *BuildContextConfig    `yaml:"buildContext"`
+	Push                *PushConfig            `yaml:"push"`
+	GC                  *GCConfig              `yaml:"gc"`
+	Signing             *SigningConfig         `yaml:"signing"`
 	AvailableCI         []ci.CI
 	AvailableRegistries []registry.Registry
 }
@@ -39,11 +47,16 @@ type CIConfig struct {
 }
 
 type RegistryConfig struct {
+	ACR       *registry.ACR       `yaml:"acr"`
 	Dockerhub *registry.Dockerhub `yaml:"dockerhub"`
 	ECR       *registry.ECR       `yaml:"ecr"`
+	GCR       *registry.GCR       `yaml:"gcr"`
+	Generic   *registry.Generic   `yaml:"generic"`
 	Github    *registry.Github    `yaml:"github"`
 	Gitlab    *registry.Gitlab    `yaml:"gitlab"`
 	Quay      *registry.Quay      `yaml:"quay"`
+	// Targets are the names of the registries to build and push for, "all" selects every configured registry
+	Targets []string `yaml:"targets" env:"REGISTRY_TARGETS" envSeparator:","`
 }
 
 type Environment struct {
@@ -90,16 +103,25 @@ func InitEmptyConfig() *Config {
 			TeamCity:  &ci.TeamCity{Common: &ci.Common{}},
 		},
 		Registry: &RegistryConfig{
+			ACR:       &registry.ACR{},
 			Dockerhub: &registry.Dockerhub{},
 			ECR:       &registry.ECR{},
+			GCR:       &registry.GCR{},
+			Generic:   &registry.Generic{},
 			Github:    &registry.Github{},
 			Gitlab:    &registry.Gitlab{},
 			Quay:      &registry.Quay{},
 		},
-		Scaffold: scaffold.InitEmptyConfig(),
+		Scaffold:     scaffold.InitEmptyConfig(),
+		Tags:         &TagsConfig{},
+		Build:        &BuildConfig{},
+		BuildContext: &BuildContextConfig{},
+		Push:         &PushConfig{},
+		GC:           &GCConfig{},
+		Signing:      &SigningConfig{},
 	}
 	c.AvailableCI = []ci.CI{c.CI.Azure, c.CI.Buildkite, c.CI.Gitlab, c.CI.TeamCity, c.CI.Github}
-	c.AvailableRegistries = []registry.Registry{c.Registry.Dockerhub, c.Registry.ECR, c.Registry.Github, c.Registry.Gitlab, c.Registry.Quay}
+	c.AvailableRegistries = []registry.Registry{c.Registry.Dockerhub, c.Registry.ECR, c.Registry.Github, c.Registry.Gitlab, c.Registry.Quay, c.Registry.GCR, c.Registry.ACR, c.Registry.Generic}
 	return c
 }
 
@@ -128,6 +150,79 @@ func (c *Config) CurrentRegistry() registry.Registry {
 	return registry.NoDockerRegistry{}
 }
 
+// CurrentRegistries returns the registries to build and push for, given as flags or configured as targets.
+// If no targets are given, only the current registry is returned
+func (c *Config) CurrentRegistries(targets []string) ([]registry.Registry, error) {
+	if len(targets) == 0 {
+		targets = c.Registry.Targets
+	}
+	var names []string
+	for _, target := range targets {
+		for _, name := range strings.Split(target, ",") {
+			if name = strings.TrimSpace(name); len(name) > 0 {
+				names = append(names, name)
+			}
+		}
+	}
+	if len(names) == 0 {
+		return []registry.Registry{c.CurrentRegistry()}, nil
+	}
+	var registries []registry.Registry
+	add := func(reg registry.Registry) {
+		for _, r := range registries {
+			if r == reg {
+				return
+			}
+		}
+		registries = append(registries, reg)
+	}
+	for _, name := range names {
+		if strings.ToLower(name) == "all" {
+			for _, reg := range c.AvailableRegistries {
+				if reg.Configured() {
+					add(reg)
+				}
+			}
+			continue
+		}
+		reg, err := c.RegistryNamed(name)
+		if err != nil {
+			return nil, err
+		}
+		add(reg)
+	}
+	if len(registries) == 0 {
+		return nil, fmt.Errorf("no configured registry found")
+	}
+	return registries, nil
+}
+
+// RegistryNamed returns the registry configured with the given key in the registry section, i.e. ecr or quay.
+// The current registry is returned if name is empty
+func (c *Config) RegistryNamed(name string) (registry.Registry, error) {
+	if name == "" {
+		return c.CurrentRegistry(), nil
+	}
+	registries := map[string]registry.Registry{
+		"acr":       c.Registry.ACR,
+		"dockerhub": c.Registry.Dockerhub,
+		"ecr":       c.Registry.ECR,
+		"gcr":       c.Registry.GCR,
+		"generic":   c.Registry.Generic,
+		"github":    c.Registry.Github,
+		"gitlab":    c.Registry.Gitlab,
+		"quay":      c.Registry.Quay,
+	}
+	reg, exists := registries[strings.ToLower(name)]
+	if !exists {
+		return nil, fmt.Errorf("unknown registry '%s'", name)
+	}
+	if !reg.Configured() {
+		return nil, fmt.Errorf("registry '%s' is not configured", name)
+	}
+	return reg, nil
+}
+
 func (c *Config) CurrentEnvironment(environment string) (*Environment, error) {
 	if e, exists := c.Environments[environment]; exists {
 		return &e, nil
@@ -0,0 +1,41 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// DefaultKeepCommits is the number of commit tags kept per image unless configured
+const DefaultKeepCommits = 20
+
+// GCConfig is the policy used by registry-gc when deleting tags
+type GCConfig struct {
+	// KeepCommits is the number of commit tags to keep per image, the tags of the newest images are kept
+	KeepCommits int `yaml:"keepCommits"`
+	// Keep are regular expressions matching tags that are never deleted
+	Keep []string `yaml:"keep"`
+}
+
+// CommitsToKeep returns the number of commit tags to keep per image
+func (c *GCConfig) CommitsToKeep() int {
+	if c == nil || c.KeepCommits <= 0 {
+		return DefaultKeepCommits
+	}
+	return c.KeepCommits
+}
+
+// KeepPatterns returns the compiled Keep patterns, each matching the whole tag
+func (c *GCConfig) KeepPatterns() ([]*regexp.Regexp, error) {
+	if c == nil {
+		return nil, nil
+	}
+	var patterns []*regexp.Regexp
+	for _, keep := range c.Keep {
+		pattern, err := regexp.Compile("^(?:" + keep + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid keep pattern '%s': %v", keep, err)
+		}
+		patterns = append(patterns, pattern)
+	}
+	return patterns, nil
+}
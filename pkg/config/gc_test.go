@@ -0,0 +1,35 @@
+package config
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"github.com/sparetimecoders/build-tools/pkg"
+	"testing"
+)
+
+func TestGCConfig_CommitsToKeep(t *testing.T) {
+	assert.Equal(t, DefaultKeepCommits, (&GCConfig{}).CommitsToKeep())
+	assert.Equal(t, 5, (&GCConfig{KeepCommits: 5}).CommitsToKeep())
+}
+
+func TestGCConfig_KeepPatterns(t *testing.T) {
+	defer pkg.SetEnv("BUILDTOOLS_CONTENT", `gc:
+  keepCommits: 5
+  keep:
+    - prod
+    - release-.*
+`)()
+
+	cfg, err := Load(name, &bytes.Buffer{})
+	assert.NoError(t, err)
+	assert.Equal(t, 5, cfg.GC.CommitsToKeep())
+	patterns, err := cfg.GC.KeepPatterns()
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(patterns))
+	assert.True(t, patterns[0].MatchString("prod"))
+	assert.False(t, patterns[0].MatchString("production"))
+	assert.True(t, patterns[1].MatchString("release-1"))
+
+	_, err = (&GCConfig{Keep: []string{"("}}).KeepPatterns()
+	assert.EqualError(t, err, "invalid keep pattern '(': error parsing regexp: missing closing ): `^(?:()$`")
+}
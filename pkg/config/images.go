@@ -0,0 +1,103 @@
+package config
+
+import (
+	"fmt"
+	"github.com/sparetimecoders/build-tools/pkg"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// Image describes a docker image built from the repository
+type Image struct {
+	// Name of the image, defaults to the build name of the current CI
+	Name string `yaml:"name"`
+	// Context is the build context directory, relative to the repository root
+	Context string `yaml:"context"`
+	// Dockerfile is the path to the Dockerfile, relative to the context directory
+	Dockerfile string `yaml:"dockerfile"`
+	// BuildArgs are passed as build-args when building the image
+	BuildArgs map[string]string `yaml:"buildArgs"`
+}
+
+// CurrentImages returns the images to handle, i.e. all configured images or, if none are configured,
+// a single image built from the repository root. If only is given, just the images with matching names are returned
+func (c *Config) CurrentImages(dockerfile string, only []string) ([]Image, error) {
+	var images []Image
+	if len(c.Images) == 0 {
+		images = []Image{{Name: c.CurrentCI().BuildName(), Context: ".", Dockerfile: dockerfile}}
+	} else {
+		for _, image := range c.Images {
+			if image.Name == "" {
+				return nil, fmt.Errorf("image with context '%s' is missing a name", image.Context)
+			}
+			if image.Context == "" {
+				image.Context = "."
+			}
+			if image.Dockerfile == "" {
+				image.Dockerfile = dockerfile
+			}
+			images = append(images, image)
+		}
+	}
+	if len(only) == 0 {
+		return images, nil
+	}
+
+	var selected []Image
+	for _, name := range only {
+		found := false
+		for _, image := range images {
+			if image.Name == name {
+				selected = append(selected, image)
+				found = true
+			}
+		}
+		if !found {
+			var names []string
+			for _, image := range images {
+				names = append(names, image.Name)
+			}
+			return nil, fmt.Errorf("no image named '%s' found, available images: %s", name, strings.Join(names, ", "))
+		}
+	}
+	return selected, nil
+}
+
+// Affected returns true if any of files (relative to the repository root) is part of the build context
+// or is the Dockerfile of the image
+func (i Image) Affected(files []string) bool {
+	context := filepath.ToSlash(filepath.Clean(i.Context))
+	dockerfile := filepath.ToSlash(filepath.Join(i.Context, i.Dockerfile))
+	for _, file := range files {
+		if context == "." || file == dockerfile || strings.HasPrefix(file, context+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// BuildArgs returns the build-args image is built with: CI_COMMIT and CI_BRANCH of the current build, the configured
+// build args of the image and args given as KEY=value, i.e. with --build-arg. Args without a value are ignored.
+// Both build and push use it, so the Dockerfile stages are resolved with the same args
+func (c *Config) BuildArgs(image Image, args []string, out io.Writer) map[string]*string {
+	currentCI := c.CurrentCI()
+	buildArgs := map[string]*string{
+		"CI_COMMIT": pkg.String(currentCI.Commit()),
+		"CI_BRANCH": pkg.String(currentCI.BranchReplaceSlash()),
+	}
+	for key, value := range image.BuildArgs {
+		buildArgs[key] = pkg.String(value)
+	}
+	for _, arg := range args {
+		split := strings.Split(arg, "=")
+		key := split[0]
+		value := strings.Join(split[1:], "=")
+		if len(split) > 1 && len(value) > 0 {
+			buildArgs[key] = pkg.String(value)
+		} else {
+			_, _ = fmt.Fprintf(out, "ignoring build-arg %s\n", key)
+		}
+	}
+	return buildArgs
+}
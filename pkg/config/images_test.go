@@ -0,0 +1,118 @@
+package config
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCurrentImages_Default(t *testing.T) {
+	cfg := InitEmptyConfig()
+	cfg.CI.Gitlab.CIBuildName = "reponame"
+
+	images, err := cfg.CurrentImages("Dockerfile", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []Image{{Name: "reponame", Context: ".", Dockerfile: "Dockerfile"}}, images)
+}
+
+func TestCurrentImages_Configured(t *testing.T) {
+	cfg := InitEmptyConfig()
+	cfg.Images = []Image{
+		{Name: "api", Context: "services/api"},
+		{Name: "web", Context: "services/web", Dockerfile: "Dockerfile.web", BuildArgs: map[string]string{"NODE_ENV": "production"}},
+	}
+
+	images, err := cfg.CurrentImages("Dockerfile", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []Image{
+		{Name: "api", Context: "services/api", Dockerfile: "Dockerfile"},
+		{Name: "web", Context: "services/web", Dockerfile: "Dockerfile.web", BuildArgs: map[string]string{"NODE_ENV": "production"}},
+	}, images)
+}
+
+func TestCurrentImages_Only(t *testing.T) {
+	cfg := InitEmptyConfig()
+	cfg.Images = []Image{{Name: "api"}, {Name: "web"}}
+
+	images, err := cfg.CurrentImages("Dockerfile", []string{"web"})
+	assert.NoError(t, err)
+	assert.Equal(t, []Image{{Name: "web", Context: ".", Dockerfile: "Dockerfile"}}, images)
+}
+
+func TestCurrentImages_OnlyUnknown(t *testing.T) {
+	cfg := InitEmptyConfig()
+	cfg.Images = []Image{{Name: "api"}, {Name: "web"}}
+
+	_, err := cfg.CurrentImages("Dockerfile", []string{"worker"})
+	assert.EqualError(t, err, "no image named 'worker' found, available images: api, web")
+}
+
+func TestCurrentImages_MissingName(t *testing.T) {
+	cfg := InitEmptyConfig()
+	cfg.Images = []Image{{Context: "services/api"}}
+
+	_, err := cfg.CurrentImages("Dockerfile", nil)
+	assert.EqualError(t, err, "image with context 'services/api' is missing a name")
+}
+
+func TestLoad_Images(t *testing.T) {
+	os.Clearenv()
+	name, _ := ioutil.TempDir(os.TempDir(), "build-tools")
+	defer func() { _ = os.RemoveAll(name) }()
+	yaml := `images:
+  - name: api
+    context: services/api
+    buildArgs:
+      GOOS: linux
+  - name: web
+    context: services/web
+    dockerfile: Dockerfile.prod
+`
+	_ = ioutil.WriteFile(filepath.Join(name, ".buildtools.yaml"), []byte(yaml), 0777)
+
+	cfg, err := Load(name, &bytes.Buffer{})
+	assert.NoError(t, err)
+	assert.Equal(t, []Image{
+		{Name: "api", Context: "services/api", BuildArgs: map[string]string{"GOOS": "linux"}},
+		{Name: "web", Context: "services/web", Dockerfile: "Dockerfile.prod"},
+	}, cfg.Images)
+}
+
+func TestImage_Affected(t *testing.T) {
+	api := Image{Name: "api", Context: "services/api", Dockerfile: "Dockerfile"}
+	assert.True(t, api.Affected([]string{"README.md", "services/api/main.go"}))
+	assert.False(t, api.Affected([]string{"README.md", "services/apiary/main.go", "services/web/main.go"}))
+
+	external := Image{Name: "web", Context: "services/web", Dockerfile: "../../docker/Dockerfile.web"}
+	assert.True(t, external.Affected([]string{"docker/Dockerfile.web"}))
+
+	root := Image{Name: "root", Context: ".", Dockerfile: "Dockerfile"}
+	assert.True(t, root.Affected([]string{"README.md"}))
+	assert.False(t, root.Affected(nil))
+}
+
+func TestBuildArgs(t *testing.T) {
+	cfg := InitEmptyConfig()
+	cfg.CI.Gitlab.CIBuildName = "reponame"
+	cfg.CI.Gitlab.CICommit = "abc123"
+	cfg.CI.Gitlab.CIBranchName = "feature/login"
+	image := Image{Name: "web", BuildArgs: map[string]string{"NODE_ENV": "production", "CI_BRANCH": "configured"}}
+
+	out := &bytes.Buffer{}
+	args := cfg.BuildArgs(image, []string{"NODE_ENV=test", "URL=http://host?a=b", "EMPTY=", "NOVALUE"}, out)
+
+	values := make(map[string]string)
+	for key, value := range args {
+		values[key] = *value
+	}
+	assert.Equal(t, map[string]string{
+		"CI_COMMIT": "abc123",
+		"CI_BRANCH": "configured",
+		"NODE_ENV":  "test",
+		"URL":       "http://host?a=b",
+	}, values)
+	assert.Equal(t, "ignoring build-arg EMPTY\nignoring build-arg NOVALUE\n", out.String())
+}
@@ -0,0 +1,72 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The standard OCI labels describing where an image came from
+const (
+	LabelCreated  = "org.opencontainers.image.created"
+	LabelSource   = "org.opencontainers.image.source"
+	LabelVersion  = "org.opencontainers.image.version"
+	LabelRevision = "org.opencontainers.image.revision"
+	LabelRefName  = "org.opencontainers.image.ref.name"
+)
+
+// LabelProvenance is the label naming the CI system and the URL of the build that produced an image
+const LabelProvenance = "com.github.sparetimecoders.build-tools.provenance"
+
+// ImageLabels returns the labels to add to the images of the current build, i.e. the OCI labels, the provenance label and
+// the configured labels. created is the time of the build, unless SOURCE_DATE_EPOCH is set for reproducible builds.
+// The configured labels can replace any label except the revision, which is needed to detect unchanged images
+func (c *Config) ImageLabels(created time.Time) (map[string]string, error) {
+	if epoch := os.Getenv("SOURCE_DATE_EPOCH"); len(epoch) > 0 {
+		seconds, err := strconv.ParseInt(epoch, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid SOURCE_DATE_EPOCH '%s', expected seconds since 1970-01-01", epoch)
+		}
+		created = time.Unix(seconds, 0)
+	}
+	currentCI := c.CurrentCI()
+	labels := map[string]string{
+		LabelRevision:   currentCI.Commit(),
+		LabelCreated:    created.UTC().Format(time.RFC3339),
+		LabelProvenance: strings.TrimSpace(fmt.Sprintf("%s %s", currentCI.Name(), currentCI.BuildURL())),
+	}
+	version := currentCI.Tag()
+	ref := version
+	if len(ref) == 0 {
+		ref = currentCI.Branch()
+	}
+	if currentVCS := c.CurrentVCS(); currentVCS != nil {
+		if len(version) == 0 {
+			version = currentVCS.Version()
+		}
+		addLabel(labels, LabelSource, currentVCS.RemoteURL())
+	}
+	addLabel(labels, LabelVersion, version)
+	addLabel(labels, LabelRefName, ref)
+
+	data := c.tagData(currentCI)
+	for key, text := range c.Build.Labels {
+		if key == LabelRevision {
+			continue
+		}
+		value, err := render("label", text, data)
+		if err != nil {
+			return nil, err
+		}
+		addLabel(labels, key, value)
+	}
+	return labels, nil
+}
+
+func addLabel(labels map[string]string, key, value string) {
+	if len(value) > 0 {
+		labels[key] = value
+	}
+}
@@ -0,0 +1,127 @@
+package config
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/sparetimecoders/build-tools/pkg"
+	"github.com/sparetimecoders/build-tools/pkg/vcs"
+	"testing"
+	"time"
+)
+
+var buildTime = time.Date(2020, 2, 3, 4, 5, 6, 0, time.FixedZone("CET", 3600))
+
+func TestImageLabels(t *testing.T) {
+	cfg := InitEmptyConfig()
+	cfg.VCS.VCS = vcs.NewMockVcs()
+	cfg.CI.Gitlab.CIBuildName = "reponame"
+	cfg.CI.Gitlab.CICommit = "abc123"
+	cfg.CI.Gitlab.CIBranchName = "feature/labels"
+	cfg.CI.Gitlab.CIBuildURL = "https://gitlab.com/org/repo/-/jobs/42"
+
+	labels, err := cfg.ImageLabels(buildTime)
+
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		LabelRevision:   "abc123",
+		LabelCreated:    "2020-02-03T03:05:06Z",
+		LabelSource:     "https://github.com/example/repo.git",
+		LabelRefName:    "feature/labels",
+		LabelProvenance: "Gitlab https://gitlab.com/org/repo/-/jobs/42",
+	}, labels)
+}
+
+func TestImageLabels_Tag(t *testing.T) {
+	cfg := InitEmptyConfig()
+	cfg.VCS.VCS = vcs.NewMockVcs()
+	cfg.CI.Gitlab.CIBuildName = "reponame"
+	cfg.CI.Gitlab.CICommit = "abc123"
+	cfg.CI.Gitlab.CITag = "v1.4.2"
+
+	labels, err := cfg.ImageLabels(buildTime)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "v1.4.2", labels[LabelVersion])
+	assert.Equal(t, "v1.4.2", labels[LabelRefName])
+	assert.Equal(t, "Gitlab", labels[LabelProvenance])
+}
+
+func TestImageLabels_TagFromVCS(t *testing.T) {
+	cfg := InitEmptyConfig()
+	cfg.VCS.VCS = vcs.NewMockVcsWithTag("v1.0.0")
+	cfg.CI.Gitlab.CIBuildName = "reponame"
+	cfg.CI.Gitlab.CICommit = "abc123"
+
+	labels, err := cfg.ImageLabels(buildTime)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "v1.0.0", labels[LabelVersion])
+	assert.Equal(t, "v1.0.0", labels[LabelRefName])
+}
+
+func TestImageLabels_BranchBuildOfTaggedCommit(t *testing.T) {
+	cfg := InitEmptyConfig()
+	cfg.VCS.VCS = vcs.NewMockVcsWithTag("v1.0.0")
+	cfg.CI.Gitlab.CIBuildName = "reponame"
+	cfg.CI.Gitlab.CICommit = "abc123"
+	cfg.CI.Gitlab.CIBranchName = "master"
+
+	labels, err := cfg.ImageLabels(buildTime)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "v1.0.0", labels[LabelVersion])
+	assert.Equal(t, "master", labels[LabelRefName])
+}
+
+func TestImageLabels_Configured(t *testing.T) {
+	cfg := InitEmptyConfig()
+	cfg.VCS.VCS = vcs.NewMockVcs()
+	cfg.CI.Gitlab.CIBuildName = "reponame"
+	cfg.CI.Gitlab.CICommit = "abc123"
+	cfg.Build.Labels = map[string]string{
+		"team":        "platform",
+		"build":       "{{ .ShortCommit }}-{{ .BuildNumber }}",
+		LabelSource:   "https://example.com/repo",
+		LabelRevision: "other",
+		"empty":       "{{ .Version }}",
+	}
+
+	labels, err := cfg.ImageLabels(buildTime)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "platform", labels["team"])
+	assert.Equal(t, "abc123-", labels["build"])
+	assert.Equal(t, "https://example.com/repo", labels[LabelSource])
+	assert.Equal(t, "abc123", labels[LabelRevision])
+	_, exists := labels["empty"]
+	assert.False(t, exists)
+}
+
+func TestImageLabels_InvalidTemplate(t *testing.T) {
+	cfg := InitEmptyConfig()
+	cfg.VCS.VCS = vcs.NewMockVcs()
+	cfg.Build.Labels = map[string]string{"team": "{{ .Missing }}"}
+
+	_, err := cfg.ImageLabels(buildTime)
+
+	assert.EqualError(t, err, "invalid label template '{{ .Missing }}': template: label:1:3: executing \"label\" at <.Missing>: can't evaluate field Missing in type config.TagData")
+}
+
+func TestImageLabels_SourceDateEpoch(t *testing.T) {
+	defer pkg.SetEnv("SOURCE_DATE_EPOCH", "1580702400")()
+	cfg := InitEmptyConfig()
+	cfg.VCS.VCS = vcs.NewMockVcs()
+
+	labels, err := cfg.ImageLabels(buildTime)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "2020-02-03T04:00:00Z", labels[LabelCreated])
+}
+
+func TestImageLabels_InvalidSourceDateEpoch(t *testing.T) {
+	defer pkg.SetEnv("SOURCE_DATE_EPOCH", "yesterday")()
+	cfg := InitEmptyConfig()
+
+	_, err := cfg.ImageLabels(buildTime)
+
+	assert.EqualError(t, err, "invalid SOURCE_DATE_EPOCH 'yesterday', expected seconds since 1970-01-01")
+}
@@ -0,0 +1,54 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	// DefaultPushRetries is the number of times a failed push of a tag is retried unless configured
+	DefaultPushRetries = 3
+	// DefaultPushRetryDelay is the delay before the first retry unless configured
+	DefaultPushRetryDelay = 2 * time.Second
+)
+
+// PushConfig contains settings for how images are pushed
+type PushConfig struct {
+	// Retries is the number of times a push failing with a transient error is retried, a negative value disables retries
+	Retries int `yaml:"retries" env:"PUSH_RETRIES"`
+	// RetryDelay is the delay before the first retry, i.e. 5s, the delay grows exponentially for each following retry
+	RetryDelay string `yaml:"retryDelay" env:"PUSH_RETRY_DELAY"`
+	// Parallel is the number of tags pushed at the same time
+	Parallel int `yaml:"parallel" env:"PUSH_PARALLEL"`
+}
+
+// MaxRetries returns the number of times a failed push is retried
+func (c *PushConfig) MaxRetries() int {
+	if c == nil || c.Retries == 0 {
+		return DefaultPushRetries
+	}
+	if c.Retries < 0 {
+		return 0
+	}
+	return c.Retries
+}
+
+// InitialDelay returns the delay before the first retry
+func (c *PushConfig) InitialDelay() (time.Duration, error) {
+	if c == nil || c.RetryDelay == "" {
+		return DefaultPushRetryDelay, nil
+	}
+	delay, err := time.ParseDuration(c.RetryDelay)
+	if err != nil || delay <= 0 {
+		return 0, fmt.Errorf("invalid push retry delay '%s'", c.RetryDelay)
+	}
+	return delay, nil
+}
+
+// Concurrency returns the number of tags to push at the same time
+func (c *PushConfig) Concurrency() int {
+	if c == nil || c.Parallel <= 0 {
+		return 1
+	}
+	return c.Parallel
+}
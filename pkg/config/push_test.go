@@ -0,0 +1,45 @@
+package config
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"github.com/sparetimecoders/build-tools/pkg"
+	"testing"
+	"time"
+)
+
+func TestPushConfig_Defaults(t *testing.T) {
+	c := &PushConfig{}
+	assert.Equal(t, DefaultPushRetries, c.MaxRetries())
+	delay, err := c.InitialDelay()
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultPushRetryDelay, delay)
+	assert.Equal(t, 1, c.Concurrency())
+}
+
+func TestPushConfig_FromConfig(t *testing.T) {
+	defer pkg.SetEnv("BUILDTOOLS_CONTENT", `push:
+  retries: 5
+  retryDelay: 500ms
+`)()
+	defer pkg.SetEnv("PUSH_PARALLEL", "4")()
+
+	cfg, err := Load(name, &bytes.Buffer{})
+	assert.NoError(t, err)
+	assert.Equal(t, 5, cfg.Push.MaxRetries())
+	delay, err := cfg.Push.InitialDelay()
+	assert.NoError(t, err)
+	assert.Equal(t, 500*time.Millisecond, delay)
+	assert.Equal(t, 4, cfg.Push.Concurrency())
+}
+
+func TestPushConfig_DisabledRetries(t *testing.T) {
+	assert.Equal(t, 0, (&PushConfig{Retries: -1}).MaxRetries())
+}
+
+func TestPushConfig_InvalidDelay(t *testing.T) {
+	_, err := (&PushConfig{RetryDelay: "soon"}).InitialDelay()
+	assert.EqualError(t, err, "invalid push retry delay 'soon'")
+	_, err = (&PushConfig{RetryDelay: "-1s"}).InitialDelay()
+	assert.EqualError(t, err, "invalid push retry delay '-1s'")
+}
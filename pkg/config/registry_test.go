@@ -73,6 +73,46 @@ func TestEcr_Identify_MissingDockerRegistry(t *testing.T) {
 	assert.Equal(t, "", out.String())
 }
 
+func TestEcr_SettingsFromConfig(t *testing.T) {
+	defer pkg.SetEnv("BUILDTOOLS_CONTENT", `registry:
+  ecr:
+    url: 1234.dkr.ecr.eu-west-1.amazonaws.com
+    lifecyclePolicyFile: lifecycle.json
+    scanOnPush: false
+    imageTagMutability: IMMUTABLE
+    kmsKey: alias/ecr
+`)()
+	defer pkg.SetEnv("ECR_REPOSITORY_POLICY", `{"Version":"2012-10-17"}`)()
+
+	cfg, err := Load(name, &bytes.Buffer{})
+	assert.NoError(t, err)
+	ecr := cfg.Registry.ECR
+	assert.Equal(t, "lifecycle.json", ecr.LifecyclePolicyFile)
+	assert.Equal(t, "false", ecr.ScanOnPush)
+	assert.Equal(t, "IMMUTABLE", ecr.ImageTagMutability)
+	assert.Equal(t, "alias/ecr", ecr.KMSKey)
+	assert.Equal(t, `{"Version":"2012-10-17"}`, ecr.RepositoryPolicy)
+}
+
+func TestEcr_AssumeRoleFromConfig(t *testing.T) {
+	defer pkg.SetEnv("BUILDTOOLS_CONTENT", `registry:
+  ecr:
+    url: 2345.dkr.ecr.eu-west-1.amazonaws.com
+    roleArn: arn:aws:iam::2345:role/push-images
+    externalId: build-pipeline
+`)()
+	defer pkg.SetEnv("ECR_SESSION_NAME", "pipeline")()
+	defer pkg.SetEnv("ECR_REGISTRY_ID", "2345")()
+
+	cfg, err := Load(name, &bytes.Buffer{})
+	assert.NoError(t, err)
+	ecr := cfg.Registry.ECR
+	assert.Equal(t, "arn:aws:iam::2345:role/push-images", ecr.RoleArn)
+	assert.Equal(t, "build-pipeline", ecr.ExternalID)
+	assert.Equal(t, "pipeline", ecr.SessionName)
+	assert.Equal(t, "2345", ecr.RegistryID)
+}
+
 func TestGitlab_Identify(t *testing.T) {
 	defer pkg.SetEnv("CI_REGISTRY", "registry.gitlab.com")()
 	defer pkg.SetEnv("CI_REGISTRY_IMAGE", "registry.gitlab.com/group/image")()
@@ -157,3 +197,132 @@ func TestQuay_Name(t *testing.T) {
 	registry := cfg.CurrentRegistry()
 	assert.Equal(t, "Quay.io", registry.Name())
 }
+
+func TestGCR_Identify(t *testing.T) {
+	defer pkg.SetEnv("GCR_HOST", "europe-west1-docker.pkg.dev")()
+	defer pkg.SetEnv("GCR_PROJECT", "project")()
+	defer pkg.SetEnv("GCR_REPOSITORY", "images")()
+	defer pkg.SetEnv("GCR_ACCESS_TOKEN", "token")()
+
+	out := &bytes.Buffer{}
+	cfg, err := Load(name, out)
+	assert.NoError(t, err)
+	registry := cfg.CurrentRegistry()
+	assert.NotNil(t, registry)
+	assert.Equal(t, "GCR", registry.Name())
+	assert.Equal(t, "europe-west1-docker.pkg.dev/project/images", registry.RegistryUrl())
+	assert.Equal(t, "", out.String())
+}
+
+func TestGCR_FromConfig(t *testing.T) {
+	defer pkg.SetEnv("BUILDTOOLS_CONTENT", `registry:
+  gcr:
+    project: project
+    keyFile: /secrets/key.json
+`)()
+
+	cfg, err := Load(name, &bytes.Buffer{})
+	assert.NoError(t, err)
+	registry, err := cfg.RegistryNamed("gcr")
+	assert.NoError(t, err)
+	assert.Equal(t, "gcr.io/project", registry.RegistryUrl())
+	assert.Equal(t, "/secrets/key.json", cfg.Registry.GCR.KeyFile)
+}
+
+func TestACR_Identify(t *testing.T) {
+	defer pkg.SetEnv("ACR_REGISTRY", "myregistry")()
+	defer pkg.SetEnv("ACR_CLIENT_ID", "client")()
+	defer pkg.SetEnv("ACR_CLIENT_SECRET", "secret")()
+
+	out := &bytes.Buffer{}
+	cfg, err := Load(name, out)
+	assert.NoError(t, err)
+	registry := cfg.CurrentRegistry()
+	assert.NotNil(t, registry)
+	assert.Equal(t, "ACR", registry.Name())
+	assert.Equal(t, "myregistry.azurecr.io", registry.RegistryUrl())
+	assert.Equal(t, "", out.String())
+}
+
+func TestGeneric_Identify(t *testing.T) {
+	defer pkg.SetEnv("BUILDTOOLS_CONTENT", `registry:
+  generic:
+    url: harbor.example.com
+    path: team
+    harbor: true
+    insecure: true
+`)()
+	defer pkg.SetEnv("GENERIC_REGISTRY_USERNAME", "user")()
+
+	out := &bytes.Buffer{}
+	cfg, err := Load(name, out)
+	assert.NoError(t, err)
+	registry := cfg.CurrentRegistry()
+	assert.NotNil(t, registry)
+	assert.Equal(t, "Generic", registry.Name())
+	assert.Equal(t, "harbor.example.com/team", registry.RegistryUrl())
+	assert.Equal(t, "user", cfg.Registry.Generic.Username)
+	assert.True(t, cfg.Registry.Generic.Harbor)
+	assert.True(t, cfg.Registry.Generic.Insecure)
+}
+
+func TestRegistryNamed(t *testing.T) {
+	defer pkg.SetEnv("DOCKERHUB_REPOSITORY", "repo")()
+	defer pkg.SetEnv("QUAY_REPOSITORY", "org")()
+
+	cfg, err := Load(name, &bytes.Buffer{})
+	assert.NoError(t, err)
+	current, err := cfg.RegistryNamed("")
+	assert.NoError(t, err)
+	assert.Equal(t, "Dockerhub", current.Name())
+	quay, err := cfg.RegistryNamed("Quay")
+	assert.NoError(t, err)
+	assert.Equal(t, "Quay.io", quay.Name())
+
+	_, err = cfg.RegistryNamed("gitlab")
+	assert.EqualError(t, err, "registry 'gitlab' is not configured")
+	_, err = cfg.RegistryNamed("missing")
+	assert.EqualError(t, err, "unknown registry 'missing'")
+}
+
+func TestCurrentRegistries(t *testing.T) {
+	defer pkg.SetEnv("DOCKERHUB_REPOSITORY", "repo")()
+	defer pkg.SetEnv("QUAY_REPOSITORY", "org")()
+
+	cfg, err := Load(name, &bytes.Buffer{})
+	assert.NoError(t, err)
+
+	registries, err := cfg.CurrentRegistries(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []registry.Registry{cfg.Registry.Dockerhub}, registries)
+
+	registries, err = cfg.CurrentRegistries([]string{"quay,dockerhub"})
+	assert.NoError(t, err)
+	assert.Equal(t, []registry.Registry{cfg.Registry.Quay, cfg.Registry.Dockerhub}, registries)
+
+	registries, err = cfg.CurrentRegistries([]string{"quay", "all"})
+	assert.NoError(t, err)
+	assert.Equal(t, []registry.Registry{cfg.Registry.Quay, cfg.Registry.Dockerhub}, registries)
+
+	_, err = cfg.CurrentRegistries([]string{"dockerhub", "ecr"})
+	assert.EqualError(t, err, "registry 'ecr' is not configured")
+}
+
+func TestCurrentRegistries_FromConfig(t *testing.T) {
+	defer pkg.SetEnv("REGISTRY_TARGETS", "all")()
+
+	cfg, err := Load(name, &bytes.Buffer{})
+	assert.NoError(t, err)
+	_, err = cfg.CurrentRegistries(nil)
+	assert.EqualError(t, err, "no configured registry found")
+
+	cfg.Registry.ECR.Url = "url"
+	cfg.Registry.Quay.Repository = "org"
+	registries, err := cfg.CurrentRegistries(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []registry.Registry{cfg.Registry.ECR, cfg.Registry.Quay}, registries)
+
+	registries, err = cfg.CurrentRegistries([]string{"quay"})
+	assert.NoError(t, err)
+	assert.Equal(t, []registry.Registry{cfg.Registry.Quay}, registries)
+}
@@ -0,0 +1,21 @@
+package config
+
+// SigningConfig contains the keys used to sign pushed images and to verify them before deploying
+type SigningConfig struct {
+	// Key is the file with the (cosign compatible) private key used by push to sign the pushed images
+	Key string `yaml:"key" env:"SIGNING_KEY"`
+	// Password decrypts Key if it is encrypted, only read from the environment
+	Password string `yaml:"-" env:"COSIGN_PASSWORD"`
+	// PublicKey is the file with the public key used to verify the signatures, deploy verifies the images if set
+	PublicKey string `yaml:"publicKey" env:"SIGNING_PUBLIC_KEY"`
+}
+
+// Sign returns true if pushed images should be signed
+func (c *SigningConfig) Sign() bool {
+	return c != nil && c.Key != ""
+}
+
+// Verify returns true if images should be verified before they are deployed
+func (c *SigningConfig) Verify() bool {
+	return c != nil && c.PublicKey != ""
+}
@@ -0,0 +1,135 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/sparetimecoders/build-tools/pkg/ci"
+	"io"
+	"os"
+	"strings"
+	"text/template"
+)
+
+// TagsConfig describes which docker tags to create for each build
+type TagsConfig struct {
+	// Templates is a list of Go templates, each rendering a single tag. Tags rendering to an empty string are skipped
+	Templates []string `yaml:"templates"`
+	// MainBranches are the branches that will also be tagged with latest
+	MainBranches []string `yaml:"mainBranches"`
+}
+
+// TagData is the data available to the tag templates
+type TagData struct {
+	Commit      string
+	ShortCommit string
+	Branch      string
+	BuildNumber string
+	Timestamp   string
+	Version     string
+	MajorMinor  string
+	Major       string
+}
+
+var defaultTagTemplates = []string{
+	"{{ .Commit }}",
+	"{{ .Branch }}",
+	"{{ .Version }}",
+	"{{ .MajorMinor }}",
+	"{{ .Major }}",
+}
+
+var defaultMainBranches = []string{"master"}
+
+func (t *TagsConfig) templates() []string {
+	if t == nil || len(t.Templates) == 0 {
+		return defaultTagTemplates
+	}
+	return t.Templates
+}
+
+func (t *TagsConfig) mainBranches() []string {
+	if t == nil || len(t.MainBranches) == 0 {
+		return defaultMainBranches
+	}
+	return t.MainBranches
+}
+
+// IsMainBranch returns true if branch should be tagged as latest
+func (t *TagsConfig) IsMainBranch(branch string) bool {
+	for _, b := range t.mainBranches() {
+		if b == branch {
+			return true
+		}
+	}
+	return false
+}
+
+// ImageTags returns the docker tags (without registry and image name) to use for the current build.
+// The tags can be overridden by setting the DOCKER_TAG environment variable. An error is returned if every template
+// renders an empty tag, as there would be nothing to tag the image with
+func (c *Config) ImageTags(out io.Writer) ([]string, error) {
+	if dockerTag := os.Getenv("DOCKER_TAG"); len(dockerTag) > 0 {
+		_, _ = fmt.Fprintf(out, "overriding docker tags with value from env DOCKER_TAG %s\n", dockerTag)
+		return []string{dockerTag}, nil
+	}
+
+	currentCI := c.CurrentCI()
+	data := c.tagData(currentCI)
+	var tags []string
+	seen := make(map[string]bool)
+	for _, text := range c.Tags.templates() {
+		tag, err := render("tag", text, data)
+		if err != nil {
+			return nil, err
+		}
+		if len(tag) > 0 && !seen[tag] {
+			seen[tag] = true
+			tags = append(tags, tag)
+		}
+	}
+	if c.Tags.IsMainBranch(currentCI.Branch()) && !seen["latest"] {
+		tags = append(tags, "latest")
+	}
+	if len(tags) == 0 {
+		return nil, fmt.Errorf("no tags for branch '%s' and commit '%s', every tag template rendered an empty tag", currentCI.Branch(), currentCI.Commit())
+	}
+	return tags, nil
+}
+
+func (c *Config) tagData(currentCI ci.CI) TagData {
+	data := TagData{
+		Commit:      currentCI.Commit(),
+		Branch:      currentCI.BranchReplaceSlash(),
+		BuildNumber: currentCI.BuildNumber(),
+	}
+	if len(data.Commit) > 7 {
+		data.ShortCommit = data.Commit[:7]
+	} else {
+		data.ShortCommit = data.Commit
+	}
+	if currentVCS := c.CurrentVCS(); currentVCS != nil && !currentVCS.CommitTime().IsZero() {
+		data.Timestamp = currentVCS.CommitTime().UTC().Format("20060102150405")
+	}
+	versions := ci.VersionTags(currentCI.Tag())
+	if len(versions) > 0 {
+		data.Version = versions[0]
+	}
+	if len(versions) == 3 {
+		data.MajorMinor = versions[1]
+		data.Major = versions[2]
+	}
+	return data
+}
+
+// render executes a tag or label template
+func render(kind, text string, data TagData) (string, error) {
+	t, err := template.New(kind).Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("invalid %s template '%s': %v", kind, text, err)
+	}
+	buf := bytes.Buffer{}
+	if err := t.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("invalid %s template '%s': %v", kind, text, err)
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
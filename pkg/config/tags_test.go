@@ -0,0 +1,128 @@
+package config
+
+import (
+	"bytes"
+	"github.com/sparetimecoders/build-tools/pkg"
+	"github.com/sparetimecoders/build-tools/pkg/vcs"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestImageTags_Default(t *testing.T) {
+	cfg := InitEmptyConfig()
+	cfg.CI.Gitlab.CIBuildName = "reponame"
+	cfg.CI.Gitlab.CICommit = "abc123"
+	cfg.CI.Gitlab.CIBranchName = "feature/first"
+
+	out := &bytes.Buffer{}
+	tags, err := cfg.ImageTags(out)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"abc123", "feature_first"}, tags)
+	assert.Equal(t, "", out.String())
+}
+
+func TestImageTags_DefaultMaster(t *testing.T) {
+	cfg := InitEmptyConfig()
+	cfg.CI.Gitlab.CIBuildName = "reponame"
+	cfg.CI.Gitlab.CICommit = "abc123"
+	cfg.CI.Gitlab.CIBranchName = "master"
+
+	tags, err := cfg.ImageTags(&bytes.Buffer{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"abc123", "master", "latest"}, tags)
+}
+
+func TestImageTags_DefaultGitTag(t *testing.T) {
+	cfg := InitEmptyConfig()
+	cfg.CI.Gitlab.CIBuildName = "reponame"
+	cfg.CI.Gitlab.CICommit = "abc123"
+	cfg.CI.Gitlab.CIBranchName = "v1.4.2"
+	cfg.CI.Gitlab.CITag = "v1.4.2"
+
+	tags, err := cfg.ImageTags(&bytes.Buffer{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"abc123", "1.4.2", "1.4", "1"}, tags)
+}
+
+func TestImageTags_BranchBuildOfTaggedCommit(t *testing.T) {
+	cfg := InitEmptyConfig()
+	cfg.VCS.VCS = vcs.NewMockVcsWithTag("v1.4.2")
+	cfg.CI.Gitlab.CIBuildName = "reponame"
+	cfg.CI.Gitlab.CICommit = "abc123"
+	cfg.CI.Gitlab.CIBranchName = "master"
+
+	tags, err := cfg.ImageTags(&bytes.Buffer{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"abc123", "master", "latest"}, tags)
+}
+
+func TestImageTags_Templates(t *testing.T) {
+	cfg := InitEmptyConfig()
+	cfg.VCS.VCS = vcs.NewMockVcs()
+	cfg.CI.Gitlab.CIBuildName = "reponame"
+	cfg.CI.Gitlab.CICommit = "abc1234567"
+	cfg.CI.Gitlab.CIBranchName = "main"
+	cfg.CI.Gitlab.CIBuildNumber = "42"
+	cfg.Tags.Templates = []string{"{{ .ShortCommit }}", "{{ .Branch }}-{{ .BuildNumber }}", "{{ .Timestamp }}", "{{ .Version }}"}
+	cfg.Tags.MainBranches = []string{"main", "trunk"}
+
+	tags, err := cfg.ImageTags(&bytes.Buffer{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"abc1234", "main-42", "20191001123000", "latest"}, tags)
+}
+
+func TestImageTags_InvalidTemplate(t *testing.T) {
+	cfg := InitEmptyConfig()
+	cfg.VCS.VCS = vcs.NewMockVcs()
+	cfg.CI.Gitlab.CIBuildName = "reponame"
+	cfg.Tags.Templates = []string{"{{ .Missing }}"}
+
+	_, err := cfg.ImageTags(&bytes.Buffer{})
+	assert.EqualError(t, err, "invalid tag template '{{ .Missing }}': template: tag:1:3: executing \"tag\" at <.Missing>: can't evaluate field Missing in type config.TagData")
+}
+
+func TestImageTags_NoTags(t *testing.T) {
+	cfg := InitEmptyConfig()
+	cfg.VCS.VCS = vcs.NewMockVcs()
+	cfg.CI.Gitlab.CIBuildName = "reponame"
+	cfg.CI.Gitlab.CICommit = "abc123"
+	cfg.CI.Gitlab.CIBranchName = "feature1"
+	cfg.Tags.Templates = []string{"{{ .Version }}"}
+
+	tags, err := cfg.ImageTags(&bytes.Buffer{})
+	assert.EqualError(t, err, "no tags for branch 'feature1' and commit 'abc123', every tag template rendered an empty tag")
+	assert.Nil(t, tags)
+}
+
+func TestImageTags_DockerTagOverride(t *testing.T) {
+	defer pkg.SetEnv("DOCKER_TAG", "override")()
+	cfg := InitEmptyConfig()
+
+	out := &bytes.Buffer{}
+	tags, err := cfg.ImageTags(out)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"override"}, tags)
+	assert.Equal(t, "overriding docker tags with value from env DOCKER_TAG override\n", out.String())
+}
+
+func TestLoad_Tags(t *testing.T) {
+	os.Clearenv()
+	name, _ := ioutil.TempDir(os.TempDir(), "build-tools")
+	defer func() { _ = os.RemoveAll(name) }()
+	yaml := `tags:
+  templates:
+    - "{{ .Commit }}"
+  mainBranches:
+    - main
+`
+	_ = ioutil.WriteFile(filepath.Join(name, ".buildtools.yaml"), []byte(yaml), 0777)
+
+	cfg, err := Load(name, &bytes.Buffer{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"{{ .Commit }}"}, cfg.Tags.Templates)
+	assert.True(t, cfg.Tags.IsMainBranch("main"))
+	assert.False(t, cfg.Tags.IsMainBranch("master"))
+}
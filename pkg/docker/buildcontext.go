@@ -0,0 +1,116 @@
+package docker
+
+import (
+	"archive/tar"
+	"io"
+	"io/ioutil"
+	"path"
+	"sort"
+	"strings"
+)
+
+// ContextSize is the size of a build context, measured from the tar sent to the docker daemon
+type ContextSize struct {
+	// Total is the size of the tar in bytes
+	Total int64
+	// Files is the number of regular files in the context
+	Files int
+	// Entries are the files and directories in the root of the context, with the total size of their content
+	Entries []ContextEntry
+}
+
+// ContextEntry is a file or directory in the root of a build context
+type ContextEntry struct {
+	Path string
+	// Size is the size of the file, or of all files in the directory
+	Size int64
+	Dir  bool
+}
+
+type countingReader struct {
+	reader io.Reader
+	count  int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.reader.Read(p)
+	c.count += int64(n)
+	return n, err
+}
+
+// MeasureContext reads the build context tar from r, returning its size and the size of each entry in its root,
+// largest first
+func MeasureContext(r io.Reader) (*ContextSize, error) {
+	counter := &countingReader{reader: r}
+	reader := tar.NewReader(counter)
+	size := &ContextSize{}
+	entries := make(map[string]*ContextEntry)
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		name := strings.TrimPrefix(path.Clean("/"+header.Name), "/")
+		if len(name) == 0 {
+			continue
+		}
+		parts := strings.SplitN(name, "/", 2)
+		entry, exists := entries[parts[0]]
+		if !exists {
+			entry = &ContextEntry{Path: parts[0]}
+			entries[parts[0]] = entry
+		}
+		entry.Dir = entry.Dir || len(parts) > 1 || header.Typeflag == tar.TypeDir
+		if header.Typeflag == tar.TypeReg || header.Typeflag == tar.TypeRegA {
+			size.Files++
+			entry.Size += header.Size
+		}
+	}
+	// Read the padding at the end of the archive as well, it's sent to the daemon
+	if _, err := io.Copy(ioutil.Discard, counter); err != nil {
+		return nil, err
+	}
+	size.Total = counter.count
+	for _, entry := range entries {
+		size.Entries = append(size.Entries, *entry)
+	}
+	sort.Slice(size.Entries, func(i, j int) bool {
+		if size.Entries[i].Size == size.Entries[j].Size {
+			return size.Entries[i].Path < size.Entries[j].Path
+		}
+		return size.Entries[i].Size > size.Entries[j].Size
+	})
+	return size, nil
+}
+
+// Largest returns the n largest entries in the root of the context
+func (c *ContextSize) Largest(n int) []ContextEntry {
+	if len(c.Entries) < n {
+		return c.Entries
+	}
+	return c.Entries[:n]
+}
+
+// SuggestIgnores returns .dockerignore patterns for the largest entries in the root of the context that would bring
+// it below maxSize if excluded. Entries in keep, i.e. the Dockerfile, are never suggested
+func (c *ContextSize) SuggestIgnores(maxSize int64, keep ...string) []string {
+	kept := make(map[string]bool)
+	for _, k := range keep {
+		kept[strings.SplitN(strings.TrimPrefix(path.Clean("/"+k), "/"), "/", 2)[0]] = true
+	}
+	var patterns []string
+	remaining := c.Total
+	for _, entry := range c.Entries {
+		if remaining <= maxSize || entry.Size == 0 {
+			break
+		}
+		if kept[entry.Path] {
+			continue
+		}
+		patterns = append(patterns, entry.Path)
+		remaining -= entry.Size
+	}
+	return patterns
+}
@@ -0,0 +1,68 @@
+package docker
+
+import (
+	"archive/tar"
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func contextArchive(t *testing.T, files map[string]int, dirs ...string) *bytes.Buffer {
+	buf := &bytes.Buffer{}
+	writer := tar.NewWriter(buf)
+	for _, dir := range dirs {
+		assert.NoError(t, writer.WriteHeader(&tar.Header{Name: dir + "/", Typeflag: tar.TypeDir, Mode: 0755}))
+	}
+	for name, size := range files {
+		assert.NoError(t, writer.WriteHeader(&tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0644, Size: int64(size)}))
+		_, err := writer.Write(bytes.Repeat([]byte("a"), size))
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, writer.Close())
+	return buf
+}
+
+func TestMeasureContext(t *testing.T) {
+	content := contextArchive(t, map[string]int{
+		"Dockerfile":                20,
+		"./node_modules/a/index.js": 3000,
+		"node_modules/b/index.js":   2000,
+		"src/main.go":               1000,
+		"data.csv":                  4000,
+	}, "empty")
+	total := int64(content.Len())
+
+	size, err := MeasureContext(content)
+	assert.NoError(t, err)
+	assert.Equal(t, total, size.Total)
+	assert.Equal(t, 5, size.Files)
+	assert.Equal(t, []ContextEntry{
+		{Path: "node_modules", Size: 5000, Dir: true},
+		{Path: "data.csv", Size: 4000},
+		{Path: "src", Size: 1000, Dir: true},
+		{Path: "Dockerfile", Size: 20},
+		{Path: "empty", Size: 0, Dir: true},
+	}, size.Entries)
+	assert.Equal(t, size.Entries[:2], size.Largest(2))
+	assert.Equal(t, size.Entries, size.Largest(10))
+}
+
+func TestMeasureContext_Broken(t *testing.T) {
+	_, err := MeasureContext(bytes.NewBufferString("not a tar archive, but long enough to be read as a header block"))
+	assert.Error(t, err)
+}
+
+func TestContextSize_SuggestIgnores(t *testing.T) {
+	size := &ContextSize{
+		Total: 12000,
+		Entries: []ContextEntry{
+			{Path: "docker", Size: 6000, Dir: true},
+			{Path: "node_modules", Size: 4000, Dir: true},
+			{Path: "data.csv", Size: 1500},
+			{Path: "src", Size: 500, Dir: true},
+		},
+	}
+	assert.Equal(t, []string{"node_modules", "data.csv"}, size.SuggestIgnores(7000, "docker/Dockerfile", ".dockerignore"))
+	assert.Equal(t, []string{"docker"}, size.SuggestIgnores(7000, "Dockerfile"))
+	assert.Equal(t, []string(nil), size.SuggestIgnores(12000, "Dockerfile"))
+}
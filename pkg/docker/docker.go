@@ -1,18 +1,12 @@
 package docker
 
 import (
-	"bufio"
-	"bytes"
 	"context"
 	"docker.io/go-docker"
 	"docker.io/go-docker/api/types"
 	"docker.io/go-docker/api/types/registry"
 	"fmt"
 	"io"
-	"io/ioutil"
-	"os"
-	"path/filepath"
-	"regexp"
 	"strings"
 )
 
@@ -20,6 +14,8 @@ type Client interface {
 	RegistryLogin(ctx context.Context, auth types.AuthConfig) (registry.AuthenticateOKBody, error)
 	ImageBuild(ctx context.Context, buildContext io.Reader, options types.ImageBuildOptions) (types.ImageBuildResponse, error)
 	ImagePush(ctx context.Context, image string, options types.ImagePushOptions) (io.ReadCloser, error)
+	ImageInspectWithRaw(ctx context.Context, imageID string) (types.ImageInspect, []byte, error)
+	ImageSave(ctx context.Context, imageIDs []string) (io.ReadCloser, error)
 }
 
 var _ Client = &docker.Client{}
@@ -28,38 +24,19 @@ func Tag(registry, image, tag string) string {
 	return fmt.Sprintf("%s/%s:%s", registry, image, tag)
 }
 
-func ParseDockerignore(dir string) ([]string, error) {
-	var empty []string
-	filePath := filepath.Join(dir, ".dockerignore")
-	if _, err := os.Stat(filePath); os.IsNotExist(err) {
-		return empty, nil
-	}
-	if file, err := ioutil.ReadFile(filePath); err != nil {
-		return empty, err
-	} else {
-		var result []string
-		scanner := bufio.NewScanner(bytes.NewReader(file))
-		for scanner.Scan() {
-			text := scanner.Text()
-			if len(text) > 0 {
-				result = append(result, text)
-			}
-		}
-		return result, nil
+// Tags returns the tag of image in each of the registries
+func Tags(registries []string, image, tag string) []string {
+	var tags []string
+	for _, registry := range registries {
+		tags = append(tags, Tag(registry, image, tag))
 	}
+	return tags
 }
 
-func FindStages(content string) []string {
-	var stages []string
-
-	re := regexp.MustCompile(`(?i)^FROM .* AS (.*)$`)
-	scanner := bufio.NewScanner(strings.NewReader(content))
-	for scanner.Scan() {
-		text := scanner.Text()
-		matches := re.FindStringSubmatch(text)
-		if len(matches) != 0 {
-			stages = append(stages, matches[1])
-		}
+// PlatformTag returns the tag used for the variant of an image built for platform, i.e. abc123-linux-arm64
+func PlatformTag(tag, platform string) string {
+	if len(platform) == 0 {
+		return tag
 	}
-	return stages
+	return fmt.Sprintf("%s-%s", tag, strings.Replace(platform, "/", "-", -1))
 }
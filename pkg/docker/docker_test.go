@@ -14,7 +14,7 @@ func TestParseDockerignore_FileMissing(t *testing.T) {
 	defer func() { _ = os.RemoveAll(name) }()
 
 	var empty []string
-	result, err := ParseDockerignore(name)
+	result, err := ParseDockerignore(name, "Dockerfile")
 	assert.NoError(t, err)
 	assert.Equal(t, empty, result)
 }
@@ -27,7 +27,7 @@ func TestParseDockerignore_EmptyFile(t *testing.T) {
 	_ = ioutil.WriteFile(filepath.Join(name, ".dockerignore"), []byte(content), 0777)
 
 	var empty []string
-	result, err := ParseDockerignore(name)
+	result, err := ParseDockerignore(name, "Dockerfile")
 	assert.NoError(t, err)
 	assert.Equal(t, empty, result)
 }
@@ -38,7 +38,7 @@ func TestParseDockerignore_UnreadableFile(t *testing.T) {
 	filename := filepath.Join(name, ".dockerignore")
 	_ = os.Mkdir(filename, 0777)
 
-	_, err := ParseDockerignore(name)
+	_, err := ParseDockerignore(name, "Dockerfile")
 	assert.EqualError(t, err, fmt.Sprintf("read %s: is a directory", filename))
 }
 
@@ -51,7 +51,59 @@ node_modules
 *.swp`
 	_ = ioutil.WriteFile(filepath.Join(name, ".dockerignore"), []byte(content), 0777)
 
-	result, err := ParseDockerignore(name)
+	result, err := ParseDockerignore(name, "Dockerfile")
 	assert.NoError(t, err)
 	assert.Equal(t, []string{"node_modules", "*.swp"}, result)
 }
+
+func TestParseDockerignore_Semantics(t *testing.T) {
+	name, _ := ioutil.TempDir(os.TempDir(), "build-tools")
+	defer func() { _ = os.RemoveAll(name) }()
+
+	content := "\xef\xbb\xbf# comment\n  # not a comment\n/secrets/\n./build/../dist\n**/*.log\n! dist/keep.log  \n\n"
+	_ = ioutil.WriteFile(filepath.Join(name, ".dockerignore"), []byte(content), 0777)
+
+	result, err := ParseDockerignore(name, "Dockerfile")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"# not a comment", "secrets", "dist", "**/*.log", "!dist/keep.log"}, result)
+}
+
+func TestParseDockerignore_KeepsBuildFiles(t *testing.T) {
+	name, _ := ioutil.TempDir(os.TempDir(), "build-tools")
+	defer func() { _ = os.RemoveAll(name) }()
+
+	_ = ioutil.WriteFile(filepath.Join(name, ".dockerignore"), []byte("*\n!src"), 0777)
+
+	result, err := ParseDockerignore(name, "./docker/Dockerfile.prod")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"*", "!src", "!.dockerignore", "!docker/Dockerfile.prod"}, result)
+}
+
+func TestParseDockerignore_DockerfileSpecific(t *testing.T) {
+	name, _ := ioutil.TempDir(os.TempDir(), "build-tools")
+	defer func() { _ = os.RemoveAll(name) }()
+
+	_ = ioutil.WriteFile(filepath.Join(name, ".dockerignore"), []byte("node_modules"), 0777)
+	_ = ioutil.WriteFile(filepath.Join(name, "Dockerfile.web.dockerignore"), []byte("target"), 0777)
+
+	result, err := ParseDockerignore(name, "Dockerfile.web")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"target"}, result)
+
+	result, err = ParseDockerignore(name, "Dockerfile")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"node_modules"}, result)
+}
+
+func TestParseDockerignore_InvalidPattern(t *testing.T) {
+	name, _ := ioutil.TempDir(os.TempDir(), "build-tools")
+	defer func() { _ = os.RemoveAll(name) }()
+
+	_ = ioutil.WriteFile(filepath.Join(name, ".dockerignore"), []byte("target\n!\n"), 0777)
+	_, err := ParseDockerignore(name, "Dockerfile")
+	assert.EqualError(t, err, "invalid .dockerignore: line 2: illegal exclusion pattern '!'")
+
+	_ = ioutil.WriteFile(filepath.Join(name, ".dockerignore"), []byte("[a-"), 0777)
+	_, err = ParseDockerignore(name, "Dockerfile")
+	assert.EqualError(t, err, "invalid .dockerignore: line 1: invalid pattern '[a-': syntax error in pattern")
+}
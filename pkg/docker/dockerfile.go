@@ -0,0 +1,383 @@
+package docker
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Stage is a build stage of a Dockerfile, started by a FROM instruction
+type Stage struct {
+	// Index is the position of the stage in the Dockerfile, which can be used instead of the name in `COPY --from`
+	Index int
+	// Name is the name given with `FROM <image> AS <name>` in lower case, empty for unnamed stages
+	Name string
+	// Base is the image the stage starts from with ARGs resolved, or the name of the stage it's based on
+	Base string
+	// Platform is the value of `FROM --platform`, if given
+	Platform string
+	// Dependencies are the indexes of the earlier stages the stage is based on, copies from or mounts
+	Dependencies []int
+}
+
+// Dockerfile is the parsed structure of a Dockerfile
+type Dockerfile struct {
+	// Args are the ARGs declared before the first FROM with their resolved values
+	Args   map[string]string
+	Stages []Stage
+}
+
+// instruction is a single logical line of a Dockerfile, with continuations joined and comments removed
+type instruction struct {
+	line    int
+	command string
+	args    string
+}
+
+var (
+	directivePattern = regexp.MustCompile(`^#\s*([a-zA-Z][a-zA-Z0-9]*)\s*=\s*(.+?)\s*$`)
+	heredocPattern   = regexp.MustCompile(`^[0-9]*<<(-?)(["']?)([A-Za-z_][A-Za-z0-9_]*)(["']?)$`)
+	variablePattern  = regexp.MustCompile(`\$(?:\{([A-Za-z_][A-Za-z0-9_]*)(?:(:[-+])([^}]*))?\}|([A-Za-z_][A-Za-z0-9_]*))`)
+	stageNamePattern = regexp.MustCompile(`^[a-z][a-z0-9-_.]*$`)
+)
+
+// ParseDockerfile parses the stages of a Dockerfile. ARGs declared before the first FROM are resolved with their
+// default values, or the values in buildArgs, the same way as docker does
+func ParseDockerfile(content string, buildArgs map[string]*string) (*Dockerfile, error) {
+	instructions, err := parseInstructions(content)
+	if err != nil {
+		return nil, err
+	}
+	d := &Dockerfile{Args: make(map[string]string)}
+	byName := make(map[string]int)
+	for _, inst := range instructions {
+		if inst.command == "FROM" {
+			stage, err := d.parseFrom(inst, byName)
+			if err != nil {
+				return nil, err
+			}
+			d.Stages = append(d.Stages, stage)
+			continue
+		}
+		if len(d.Stages) == 0 {
+			if inst.command != "ARG" {
+				return nil, fmt.Errorf("line %d: %s before the first FROM", inst.line, inst.command)
+			}
+			d.declareArgs(inst.args, buildArgs)
+			continue
+		}
+		current := &d.Stages[len(d.Stages)-1]
+		for _, from := range fromFlags(inst) {
+			dependency, err := d.stageReference(inst, d.expand(from), byName, current.Index)
+			if err != nil {
+				return nil, err
+			}
+			if dependency >= 0 {
+				current.Dependencies = appendUnique(current.Dependencies, dependency)
+			}
+		}
+	}
+	if len(d.Stages) == 0 {
+		return nil, errors.New("no FROM instruction found in Dockerfile")
+	}
+	return d, nil
+}
+
+// Stage returns the stage named name, or the last stage if name is empty
+func (d *Dockerfile) Stage(name string) (*Stage, error) {
+	if len(name) == 0 {
+		return &d.Stages[len(d.Stages)-1], nil
+	}
+	for i := range d.Stages {
+		if d.Stages[i].Name == strings.ToLower(name) {
+			return &d.Stages[i], nil
+		}
+	}
+	return nil, fmt.Errorf("no stage named '%s' found in Dockerfile", name)
+}
+
+// Required returns the stages needed to build the stage target (including target itself) in the order they appear
+// in the Dockerfile. The last stage is used if target is empty
+func (d *Dockerfile) Required(target string) ([]Stage, error) {
+	stage, err := d.Stage(target)
+	if err != nil {
+		return nil, err
+	}
+	needed := make([]bool, len(d.Stages))
+	var visit func(i int)
+	visit = func(i int) {
+		if needed[i] {
+			return
+		}
+		needed[i] = true
+		for _, dependency := range d.Stages[i].Dependencies {
+			visit(dependency)
+		}
+	}
+	visit(stage.Index)
+	var required []Stage
+	for i, stage := range d.Stages {
+		if needed[i] {
+			required = append(required, stage)
+		}
+	}
+	return required, nil
+}
+
+// CacheStages returns the names of the named stages the final stage depends on, in the order they appear.
+// These stages are built, tagged and pushed separately so later builds can use them as cache
+func (d *Dockerfile) CacheStages() []string {
+	required, _ := d.Required("")
+	var names []string
+	for _, stage := range required[:len(required)-1] {
+		if len(stage.Name) > 0 {
+			names = append(names, stage.Name)
+		}
+	}
+	return names
+}
+
+// StageNames returns the names of all named stages
+func (d *Dockerfile) StageNames() []string {
+	var names []string
+	for _, stage := range d.Stages {
+		if len(stage.Name) > 0 {
+			names = append(names, stage.Name)
+		}
+	}
+	return names
+}
+
+// parseFrom parses `FROM [--platform=<platform>] <image> [AS <name>]`
+func (d *Dockerfile) parseFrom(inst instruction, byName map[string]int) (Stage, error) {
+	stage := Stage{Index: len(d.Stages)}
+	fields := strings.Fields(inst.args)
+	for len(fields) > 0 && strings.HasPrefix(fields[0], "--") {
+		if value := strings.TrimPrefix(fields[0], "--platform="); value != fields[0] {
+			stage.Platform = unquote(value)
+		}
+		fields = fields[1:]
+	}
+	switch {
+	case len(fields) == 1:
+	case len(fields) == 3 && strings.EqualFold(fields[1], "AS"):
+		stage.Name = strings.ToLower(fields[2])
+		if !stageNamePattern.MatchString(stage.Name) {
+			return stage, fmt.Errorf("line %d: invalid stage name '%s'", inst.line, fields[2])
+		}
+		if _, exists := byName[stage.Name]; exists {
+			return stage, fmt.Errorf("line %d: duplicate stage name '%s'", inst.line, fields[2])
+		}
+		byName[stage.Name] = stage.Index
+	default:
+		return stage, fmt.Errorf("line %d: invalid FROM instruction 'FROM %s'", inst.line, inst.args)
+	}
+	stage.Base = d.expand(fields[0])
+	if len(stage.Base) == 0 {
+		return stage, fmt.Errorf("line %d: base image '%s' resolves to an empty name", inst.line, fields[0])
+	}
+	if index, exists := byName[strings.ToLower(stage.Base)]; exists && index < stage.Index {
+		stage.Dependencies = []int{index}
+	}
+	return stage, nil
+}
+
+// declareArgs adds the ARGs declared in args, i.e. `ARG VERSION=1.0 DEBUG`, using the value in buildArgs if there is one
+func (d *Dockerfile) declareArgs(args string, buildArgs map[string]*string) {
+	for _, field := range splitQuoted(args) {
+		parts := strings.SplitN(field, "=", 2)
+		value := ""
+		if len(parts) == 2 {
+			value = d.expand(unquote(parts[1]))
+		}
+		if override, exists := buildArgs[parts[0]]; exists && override != nil {
+			value = *override
+		}
+		d.Args[parts[0]] = value
+	}
+}
+
+// stageReference returns the index of the stage referenced by `--from`, or -1 if it references an image
+func (d *Dockerfile) stageReference(inst instruction, from string, byName map[string]int, current int) (int, error) {
+	if index, exists := byName[strings.ToLower(from)]; exists && index < current {
+		return index, nil
+	}
+	if index, err := strconv.Atoi(from); err == nil {
+		if index < 0 || index >= current {
+			return -1, fmt.Errorf("line %d: invalid stage index %d, only earlier stages can be referenced", inst.line, index)
+		}
+		return index, nil
+	}
+	return -1, nil
+}
+
+// expand replaces $VAR, ${VAR}, ${VAR:-default} and ${VAR:+value} with the values of the ARGs
+func (d *Dockerfile) expand(s string) string {
+	return variablePattern.ReplaceAllStringFunc(s, func(match string) string {
+		groups := variablePattern.FindStringSubmatch(match)
+		name := groups[1]
+		if len(name) == 0 {
+			name = groups[4]
+		}
+		value := d.Args[name]
+		switch groups[2] {
+		case ":-":
+			if len(value) == 0 {
+				return groups[3]
+			}
+		case ":+":
+			if len(value) > 0 {
+				return groups[3]
+			}
+			return ""
+		}
+		return value
+	})
+}
+
+// fromFlags returns the stages or images an instruction copies from, i.e. `COPY --from=build` or `RUN --mount=from=build`
+func fromFlags(inst instruction) []string {
+	var from []string
+	for _, field := range strings.Fields(inst.args) {
+		if !strings.HasPrefix(field, "--") {
+			break
+		}
+		switch {
+		case inst.command == "COPY" && strings.HasPrefix(field, "--from="):
+			from = append(from, unquote(strings.TrimPrefix(field, "--from=")))
+		case inst.command == "RUN" && strings.HasPrefix(field, "--mount="):
+			for _, option := range strings.Split(strings.TrimPrefix(field, "--mount="), ",") {
+				if strings.HasPrefix(option, "from=") {
+					from = append(from, unquote(strings.TrimPrefix(option, "from=")))
+				}
+			}
+		}
+	}
+	return from
+}
+
+// parseInstructions splits content into instructions, handling parser directives, comments, line continuations and heredocs
+func parseInstructions(content string) ([]instruction, error) {
+	lines := strings.Split(strings.Replace(content, "\r\n", "\n", -1), "\n")
+	escape := `\`
+	for _, line := range lines {
+		matches := directivePattern.FindStringSubmatch(line)
+		if matches == nil {
+			break
+		}
+		if strings.ToLower(matches[1]) == "escape" {
+			if matches[2] != "`" && matches[2] != `\` {
+				return nil, fmt.Errorf("invalid escape token '%s', expected ` or \\", matches[2])
+			}
+			escape = matches[2]
+		}
+	}
+
+	var instructions []instruction
+	var current []string
+	var heredocs [][]string
+	start := 0
+	for i, line := range lines {
+		if len(heredocs) > 0 {
+			body := line
+			if heredocs[0][1] == "-" {
+				body = strings.TrimLeft(body, "\t")
+			}
+			if body == heredocs[0][3] {
+				heredocs = heredocs[1:]
+			}
+			continue
+		}
+		trimmed := strings.TrimSpace(line)
+		if len(trimmed) == 0 || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		if len(current) == 0 {
+			start = i + 1
+		}
+		if strings.HasSuffix(trimmed, escape) {
+			current = append(current, strings.TrimSpace(strings.TrimSuffix(trimmed, escape)))
+			continue
+		}
+		current = append(current, trimmed)
+		inst := newInstruction(start, strings.Join(current, " "))
+		current = nil
+		if inst.command == "RUN" || inst.command == "COPY" || inst.command == "ADD" {
+			heredocs = findHeredocs(inst.args)
+		}
+		instructions = append(instructions, inst)
+	}
+	if len(current) > 0 {
+		instructions = append(instructions, newInstruction(start, strings.Join(current, " ")))
+	}
+	return instructions, nil
+}
+
+// findHeredocs returns the heredocs started in args. Like BuildKit, only words starting with << (optionally preceded by
+// a file descriptor) are heredocs, so shifts like $((x<<y)) and here-strings (<<<) are not
+func findHeredocs(args string) [][]string {
+	var heredocs [][]string
+	for _, word := range splitQuoted(args) {
+		if matches := heredocPattern.FindStringSubmatch(word); matches != nil && matches[2] == matches[4] {
+			heredocs = append(heredocs, matches)
+		}
+	}
+	return heredocs
+}
+
+func newInstruction(line int, text string) instruction {
+	parts := strings.SplitN(text, " ", 2)
+	inst := instruction{line: line, command: strings.ToUpper(parts[0])}
+	if len(parts) == 2 {
+		inst.args = strings.TrimSpace(parts[1])
+	}
+	return inst
+}
+
+// splitQuoted splits s on whitespace outside of quotes
+func splitQuoted(s string) []string {
+	var fields []string
+	var field strings.Builder
+	var quote rune
+	for _, r := range s {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+			field.WriteRune(r)
+		case r == '"' || r == '\'':
+			quote = r
+			field.WriteRune(r)
+		case r == ' ' || r == '\t':
+			if field.Len() > 0 {
+				fields = append(fields, field.String())
+				field.Reset()
+			}
+		default:
+			field.WriteRune(r)
+		}
+	}
+	if field.Len() > 0 {
+		fields = append(fields, field.String())
+	}
+	return fields
+}
+
+func unquote(s string) string {
+	if len(s) >= 2 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0] {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
+
+func appendUnique(indexes []int, index int) []int {
+	for _, i := range indexes {
+		if i == index {
+			return indexes
+		}
+	}
+	return append(indexes, index)
+}
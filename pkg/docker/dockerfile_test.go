@@ -0,0 +1,159 @@
+package docker
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestParseDockerfile_Stages(t *testing.T) {
+	content := `
+# syntax=docker/dockerfile:1
+ARG GO_VERSION=1.12
+ARG REGISTRY
+FROM --platform=$BUILDPLATFORM golang:${GO_VERSION} AS Build
+RUN go build ./...
+from ${REGISTRY:-docker.io}/alpine:3.11 as test
+FROM scratch
+COPY --from=build /app /app
+`
+	result, err := ParseDockerfile(content, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"GO_VERSION": "1.12", "REGISTRY": ""}, result.Args)
+	assert.Equal(t, []Stage{
+		{Index: 0, Name: "build", Base: "golang:1.12", Platform: "$BUILDPLATFORM"},
+		{Index: 1, Name: "test", Base: "docker.io/alpine:3.11"},
+		{Index: 2, Base: "scratch", Dependencies: []int{0}},
+	}, result.Stages)
+	assert.Equal(t, []string{"build"}, result.CacheStages())
+	assert.Equal(t, []string{"build", "test"}, result.StageNames())
+}
+
+func TestParseDockerfile_BuildArgs(t *testing.T) {
+	version := "1.14"
+	content := "ARG GO_VERSION=1.12 BASE=\"golang\"\nFROM ${BASE}:${GO_VERSION}"
+
+	result, err := ParseDockerfile(content, map[string]*string{"GO_VERSION": &version, "UNUSED": &version})
+	assert.NoError(t, err)
+	assert.Equal(t, "golang:1.14", result.Stages[0].Base)
+	assert.Equal(t, map[string]string{"GO_VERSION": "1.14", "BASE": "golang"}, result.Args)
+}
+
+func TestParseDockerfile_Continuations(t *testing.T) {
+	content := `FROM alpine \
+  # a comment inside the instruction
+
+  AS base
+FROM base AS build
+RUN --mount=type=cache,target=/root/.cache \
+    --mount=type=bind,from=base,source=/etc,target=/etc \
+    make
+FROM scratch
+COPY --from=1 \
+  /app /app
+`
+	result, err := ParseDockerfile(content, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []Stage{
+		{Index: 0, Name: "base", Base: "alpine"},
+		{Index: 1, Name: "build", Base: "base", Dependencies: []int{0}},
+		{Index: 2, Base: "scratch", Dependencies: []int{1}},
+	}, result.Stages)
+	assert.Equal(t, []string{"base", "build"}, result.CacheStages())
+}
+
+func TestParseDockerfile_EscapeDirective(t *testing.T) {
+	content := "# escape=`\nFROM mcr.microsoft.com/windows/servercore `\n  AS build\nRUN dir c:\\\nFROM build"
+
+	result, err := ParseDockerfile(content, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []Stage{
+		{Index: 0, Name: "build", Base: "mcr.microsoft.com/windows/servercore"},
+		{Index: 1, Base: "build", Dependencies: []int{0}},
+	}, result.Stages)
+}
+
+func TestParseDockerfile_Heredoc(t *testing.T) {
+	content := `FROM alpine AS build
+RUN <<EOF
+FROM ignored AS ignored
+EOF
+COPY <<-SCRIPT /run.sh
+	FROM also-ignored
+	SCRIPT
+FROM scratch
+`
+	result, err := ParseDockerfile(content, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"build"}, result.StageNames())
+	assert.Equal(t, 2, len(result.Stages))
+}
+
+func TestParseDockerfile_NotHeredoc(t *testing.T) {
+	content := `FROM alpine AS build
+RUN echo $((x<<y)) && cat <<<foo && echo "<<EOF"
+FROM scratch
+COPY --from=build /app /app
+`
+	result, err := ParseDockerfile(content, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"build"}, result.StageNames())
+	assert.Equal(t, 2, len(result.Stages))
+}
+
+func TestFindHeredocs(t *testing.T) {
+	heredocs := findHeredocs(`<<EOF cat 2<<-"SCRIPT" <<'A' x<<B <<<C "<<D" <<"E'`)
+	var names []string
+	for _, heredoc := range heredocs {
+		names = append(names, heredoc[1]+heredoc[3])
+	}
+	assert.Equal(t, []string{"EOF", "-SCRIPT", "A"}, names)
+}
+
+func TestParseDockerfile_UnusedStages(t *testing.T) {
+	content := `
+FROM alpine AS deps
+FROM deps AS build
+FROM alpine AS lint
+FROM alpine AS docs
+COPY --from=lint /report /report
+FROM scratch
+COPY --from=build /app /app
+COPY --from=nginx:latest /etc/nginx /etc/nginx
+`
+	result, err := ParseDockerfile(content, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"deps", "build"}, result.CacheStages())
+	assert.Equal(t, []string{"deps", "build", "lint", "docs"}, result.StageNames())
+
+	required, err := result.Required("docs")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(required))
+	assert.Equal(t, "lint", required[0].Name)
+	assert.Equal(t, "docs", required[1].Name)
+
+	_, err = result.Required("missing")
+	assert.EqualError(t, err, "no stage named 'missing' found in Dockerfile")
+}
+
+func TestParseDockerfile_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		err     string
+	}{
+		{name: "empty", content: "# only a comment\n", err: "no FROM instruction found in Dockerfile"},
+		{name: "instruction before FROM", content: "RUN true\nFROM scratch", err: "line 1: RUN before the first FROM"},
+		{name: "missing image", content: "FROM --platform=linux/amd64", err: "line 1: invalid FROM instruction 'FROM --platform=linux/amd64'"},
+		{name: "empty image", content: "ARG BASE\nFROM $BASE", err: "line 2: base image '$BASE' resolves to an empty name"},
+		{name: "invalid name", content: "FROM scratch AS 1st", err: "line 1: invalid stage name '1st'"},
+		{name: "duplicate name", content: "FROM scratch AS a\nFROM scratch AS A", err: "line 2: duplicate stage name 'A'"},
+		{name: "forward index", content: "FROM scratch\nCOPY --from=1 a b\nFROM scratch", err: "line 2: invalid stage index 1, only earlier stages can be referenced"},
+		{name: "invalid escape", content: "# escape=x\nFROM scratch", err: "invalid escape token 'x', expected ` or \\"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseDockerfile(tt.content, nil)
+			assert.EqualError(t, err, tt.err)
+		})
+	}
+}
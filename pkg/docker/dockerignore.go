@@ -0,0 +1,84 @@
+package docker
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"github.com/docker/docker/pkg/fileutils"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DockerignoreFile returns the ignore file used for the build context in dir when building dockerfile.
+// A `<Dockerfile>.dockerignore` next to the Dockerfile takes precedence over `.dockerignore` in the root of the context
+func DockerignoreFile(dir, dockerfile string) string {
+	specific := filepath.Join(dir, dockerfile+".dockerignore")
+	if _, err := os.Stat(specific); err == nil {
+		return specific
+	}
+	return filepath.Join(dir, ".dockerignore")
+}
+
+// ParseDockerignore reads the exclude patterns for the build context in dir when building dockerfile, following the
+// same rules as docker: lines starting with # are comments, patterns are cleaned and made relative to the context and
+// later `!` patterns re-include files excluded by earlier patterns. The Dockerfile and .dockerignore are always kept,
+// as the daemon needs them
+func ParseDockerignore(dir, dockerfile string) ([]string, error) {
+	var empty []string
+	filePath := DockerignoreFile(dir, dockerfile)
+	if _, err := os.Stat(filePath); os.IsNotExist(err) {
+		return empty, nil
+	}
+	content, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return empty, err
+	}
+	patterns, err := readPatterns(content)
+	if err != nil {
+		return empty, fmt.Errorf("invalid %s: %v", filepath.Base(filePath), err)
+	}
+	for _, keep := range []string{".dockerignore", filepath.ToSlash(filepath.Clean(dockerfile))} {
+		if excluded, _ := fileutils.Matches(keep, patterns); excluded {
+			patterns = append(patterns, "!"+keep)
+		}
+	}
+	return patterns, nil
+}
+
+func readPatterns(content []byte) ([]string, error) {
+	var patterns []string
+	scanner := bufio.NewScanner(bytes.NewReader(bytes.TrimPrefix(content, []byte("\xef\xbb\xbf"))))
+	line := 0
+	for scanner.Scan() {
+		line++
+		pattern := scanner.Text()
+		if strings.HasPrefix(pattern, "#") {
+			continue
+		}
+		pattern = strings.TrimSpace(pattern)
+		if len(pattern) == 0 {
+			continue
+		}
+		invert := pattern[0] == '!'
+		if invert {
+			pattern = strings.TrimSpace(pattern[1:])
+			if len(pattern) == 0 {
+				return nil, fmt.Errorf("line %d: illegal exclusion pattern '!'", line)
+			}
+		}
+		pattern = filepath.ToSlash(filepath.Clean(pattern))
+		if len(pattern) > 1 && pattern[0] == '/' {
+			pattern = pattern[1:]
+		}
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("line %d: invalid pattern '%s': %v", line, pattern, err)
+		}
+		if invert {
+			pattern = "!" + pattern
+		}
+		patterns = append(patterns, pattern)
+	}
+	return patterns, scanner.Err()
+}
@@ -3,6 +3,7 @@
 package docker
 
 import (
+	"bytes"
 	"context"
 	"docker.io/go-docker/api/types"
 	"docker.io/go-docker/api/types/registry"
@@ -10,6 +11,7 @@ import (
 	"io"
 	"io/ioutil"
 	"strings"
+	"sync"
 )
 
 type MockDocker struct {
@@ -23,9 +25,19 @@ type MockDocker struct {
 	BuildCount    int
 	BuildError    []error
 	PushError     error
-	PushOutput    *string
+	// PushErrors are returned by consecutive pushes, PushError is used when there are no more errors
+	PushErrors []error
+	PushCount  int
+	PushOutput *string
+	// ImageIDs are the ids of the local images by tag, inspecting other images fails
+	ImageIDs map[string]string
+	// SaveOutput is the archive returned when saving any image, Saved records the saved images
+	SaveOutput    []byte
+	SaveError     error
+	Saved         []string
 	BrokenOutput  bool
 	ResponseError error
+	mutex         sync.Mutex
 }
 
 func (m *MockDocker) ImageBuild(ctx context.Context, buildContext io.Reader, options types.ImageBuildOptions) (types.ImageBuildResponse, error) {
@@ -46,8 +58,14 @@ func (m *MockDocker) ImageBuild(ctx context.Context, buildContext io.Reader, opt
 }
 
 func (m *MockDocker) ImagePush(ctx context.Context, image string, options types.ImagePushOptions) (io.ReadCloser, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	defer func() { m.PushCount = m.PushCount + 1 }()
 	m.Images = append(m.Images, image)
 
+	if len(m.PushErrors) > m.PushCount && m.PushErrors[m.PushCount] != nil {
+		return ioutil.NopCloser(strings.NewReader("Push error")), m.PushErrors[m.PushCount]
+	}
 	if m.PushError != nil {
 		return ioutil.NopCloser(strings.NewReader("Push error")), m.PushError
 	}
@@ -65,4 +83,19 @@ func (m *MockDocker) RegistryLogin(ctx context.Context, auth types.AuthConfig) (
 	return registry.AuthenticateOKBody{Status: "Logged in"}, nil
 }
 
+func (m *MockDocker) ImageInspectWithRaw(ctx context.Context, imageID string) (types.ImageInspect, []byte, error) {
+	if id, exists := m.ImageIDs[imageID]; exists {
+		return types.ImageInspect{ID: id, RepoTags: []string{imageID}}, nil, nil
+	}
+	return types.ImageInspect{}, nil, fmt.Errorf("Error: No such image: %s", imageID)
+}
+
+func (m *MockDocker) ImageSave(ctx context.Context, imageIDs []string) (io.ReadCloser, error) {
+	m.Saved = append(m.Saved, imageIDs...)
+	if m.SaveError != nil {
+		return nil, m.SaveError
+	}
+	return ioutil.NopCloser(bytes.NewReader(m.SaveOutput)), nil
+}
+
 var _ Client = &MockDocker{}
@@ -0,0 +1,139 @@
+package promote
+
+import (
+	docker2 "docker.io/go-docker"
+	"flag"
+	"fmt"
+	"github.com/liamg/tml"
+	"github.com/sparetimecoders/build-tools/pkg/config"
+	"github.com/sparetimecoders/build-tools/pkg/docker"
+	"github.com/sparetimecoders/build-tools/pkg/registry"
+	"io"
+	"strings"
+)
+
+// Promote adds tags to an already pushed image by copying its manifest through the registry API
+func Promote(dir string, out, eout io.Writer, args ...string) int {
+	var from, source, target string
+	var only arrayFlags
+	set := flag.NewFlagSet("promote", flag.ContinueOnError)
+	set.SetOutput(eout)
+	set.Usage = func() {
+		_, _ = fmt.Fprintf(eout, "Usage: promote [options] <tag>...\n\nFor example `promote --from abc123 prod` would tag the image pushed as `abc123` with `prod`\n\nOptions:\n")
+		set.PrintDefaults()
+	}
+	set.StringVar(&from, "from", "", "tag of the image to promote, defaults to the current commit")
+	set.StringVar(&source, "source", "", "registry to promote the image from, i.e. ecr (defaults to the current registry)")
+	set.StringVar(&target, "target", "", "registry to promote the image to, i.e. quay (defaults to the source registry)")
+	set.Var(&only, "only", "only promote the image with this name (can be repeated)")
+	if err := set.Parse(args); err != nil {
+		return -1
+	}
+	if set.NArg() < 1 {
+		set.Usage()
+		return -1
+	}
+
+	client, err := docker2.NewEnvClient()
+	if err != nil {
+		_, _ = fmt.Fprintln(eout, tml.Sprintf("<red>%s</red>", err.Error()))
+		return -2
+	}
+	cfg, err := config.Load(dir, out)
+	if err != nil {
+		_, _ = fmt.Fprintln(eout, tml.Sprintf("<red>%s</red>", err.Error()))
+		return -2
+	}
+	if target == "" {
+		target = source
+	}
+	return doPromote(client, cfg, from, source, target, set.Args(), only, out, eout)
+}
+
+func doPromote(client docker.Client, cfg *config.Config, from, source, target string, tags, only []string, out, eout io.Writer) int {
+	sourceRegistry, err := cfg.RegistryNamed(source)
+	if err != nil {
+		_, _ = fmt.Fprintln(eout, tml.Sprintf("<red>%s</red>", err.Error()))
+		return -3
+	}
+	targetRegistry, err := cfg.RegistryNamed(target)
+	if err != nil {
+		_, _ = fmt.Fprintln(eout, tml.Sprintf("<red>%s</red>", err.Error()))
+		return -3
+	}
+
+	if err := sourceRegistry.Login(client, out); err != nil {
+		_, _ = fmt.Fprintln(eout, tml.Sprintf("<red>%s</red>", err.Error()))
+		return -4
+	}
+	sourceAPI, err := registry.NewRegistryAPI(sourceRegistry)
+	if err != nil {
+		_, _ = fmt.Fprintln(eout, tml.Sprintf("<red>%s</red>", err.Error()))
+		return -4
+	}
+	targetAPI := sourceAPI
+	if targetRegistry != sourceRegistry {
+		if err := targetRegistry.Login(client, out); err != nil {
+			_, _ = fmt.Fprintln(eout, tml.Sprintf("<red>%s</red>", err.Error()))
+			return -4
+		}
+		if targetAPI, err = registry.NewRegistryAPI(targetRegistry); err != nil {
+			_, _ = fmt.Fprintln(eout, tml.Sprintf("<red>%s</red>", err.Error()))
+			return -4
+		}
+	}
+
+	images, err := cfg.CurrentImages("Dockerfile", only)
+	if err != nil {
+		_, _ = fmt.Fprintln(eout, tml.Sprintf("<red>%s</red>", err.Error()))
+		return -5
+	}
+	if from == "" {
+		from = cfg.CurrentCI().Commit()
+	}
+	if from == "" {
+		_, _ = fmt.Fprint(eout, tml.Sprintf("Commit information is <red>missing</red>, use --from to select the image to promote"))
+		return -6
+	}
+
+	for _, image := range images {
+		if err := targetRegistry.Create(image.Name); err != nil {
+			_, _ = fmt.Fprintln(eout, tml.Sprintf("<red>%s</red>", err.Error()))
+			return -7
+		}
+		src, err := registry.ParseReference(docker.Tag(sourceRegistry.RegistryUrl(), image.Name, from))
+		if err != nil {
+			_, _ = fmt.Fprintln(eout, tml.Sprintf("<red>%s</red>", err.Error()))
+			return -8
+		}
+		srcAPI := sourceAPI
+		for _, tag := range tags {
+			dst, err := registry.ParseReference(docker.Tag(targetRegistry.RegistryUrl(), image.Name, tag))
+			if err != nil {
+				_, _ = fmt.Fprintln(eout, tml.Sprintf("<red>%s</red>", err.Error()))
+				return -8
+			}
+			_, _ = fmt.Fprintln(out, tml.Sprintf("Promoting '<green>%s</green>' to '<green>%s</green>'", src, dst))
+			digest, err := registry.Copy(srcAPI, src, targetAPI, dst, out)
+			if err != nil {
+				_, _ = fmt.Fprintln(eout, tml.Sprintf("<red>%s</red>", err.Error()))
+				return -8
+			}
+			_, _ = fmt.Fprintln(out, tml.Sprintf("Promoted '<green>%s</green>' with digest <green>%s</green>", dst, digest))
+			// Promote from the copy in the target registry to avoid copying blobs again
+			srcAPI, src = targetAPI, dst
+		}
+	}
+	return 0
+}
+
+type arrayFlags []string
+
+func (i *arrayFlags) String() string {
+	return strings.Join(*i, ",")
+}
+
+func (i *arrayFlags) Set(value string) error {
+	*i = append(*i, strings.TrimSpace(value))
+	return nil
+}
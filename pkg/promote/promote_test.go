@@ -0,0 +1,148 @@
+package promote
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/sparetimecoders/build-tools/pkg"
+	"github.com/sparetimecoders/build-tools/pkg/config"
+	"github.com/sparetimecoders/build-tools/pkg/docker"
+	"github.com/sparetimecoders/build-tools/pkg/registry"
+	"github.com/sparetimecoders/build-tools/pkg/vcs"
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestPromote_MissingTag(t *testing.T) {
+	eout := &bytes.Buffer{}
+	code := Promote(".", &bytes.Buffer{}, eout)
+	assert.Equal(t, -1, code)
+	assert.Contains(t, eout.String(), "Usage: promote [options] <tag>...")
+}
+
+func TestPromote_BadDockerHost(t *testing.T) {
+	defer pkg.SetEnv("DOCKER_HOST", "abc-123")()
+	code := Promote(".", &bytes.Buffer{}, &bytes.Buffer{}, "prod")
+	assert.Equal(t, -2, code)
+}
+
+func TestPromote_BrokenConfig(t *testing.T) {
+	name, _ := ioutil.TempDir(os.TempDir(), "build-tools")
+	defer func() { _ = os.RemoveAll(name) }()
+	_ = ioutil.WriteFile(name+"/.buildtools.yaml", []byte(`ci: [] `), 0777)
+	code := Promote(name, &bytes.Buffer{}, &bytes.Buffer{}, "prod")
+	assert.Equal(t, -2, code)
+}
+
+func TestPromote_SameRegistry(t *testing.T) {
+	server := registry.NewMockRegistryServer()
+	defer server.Close()
+	digest := server.AddImage("reponame", "abc123", nil)
+
+	out := &bytes.Buffer{}
+	eout := &bytes.Buffer{}
+	client := &docker.MockDocker{}
+	cfg := config.InitEmptyConfig()
+	cfg.CI.Gitlab.CIBuildName = "reponame"
+	cfg.CI.Gitlab.CICommit = "abc123"
+	cfg.Registry.Dockerhub.Repository = server.Host()
+
+	code := doPromote(client, cfg, "", "", "", []string{"staging", "prod"}, nil, out, eout)
+
+	assert.Equal(t, 0, code)
+	assert.Equal(t, "", eout.String())
+	assert.Equal(t, digest, server.Manifest("reponame", "staging").Digest)
+	assert.Equal(t, digest, server.Manifest("reponame", "prod").Digest)
+	assert.Contains(t, out.String(), fmt.Sprintf("\x1b[0mPromoting '\x1b[32m%s/reponame:abc123\x1b[39m' to '\x1b[32m%s/reponame:staging\x1b[39m'\x1b[0m\n", server.Host(), server.Host()))
+	assert.Contains(t, out.String(), fmt.Sprintf("\x1b[0mPromoted '\x1b[32m%s/reponame:prod\x1b[39m' with digest \x1b[32m%s\x1b[39m\x1b[0m\n", server.Host(), digest))
+	assert.NotContains(t, out.String(), "Copying blob")
+}
+
+func TestPromote_OtherRegistry(t *testing.T) {
+	source := registry.NewMockRegistryServer()
+	defer source.Close()
+	target := registry.NewMockRegistryServer()
+	defer target.Close()
+	digest := source.AddImage("reponame", "v1.0.0", nil)
+
+	out := &bytes.Buffer{}
+	eout := &bytes.Buffer{}
+	client := &docker.MockDocker{}
+	cfg := config.InitEmptyConfig()
+	cfg.CI.Gitlab.CIBuildName = "reponame"
+	cfg.Registry.Dockerhub.Repository = source.Host()
+	cfg.Registry.Gitlab.Repository = target.Host() + "/group/project"
+
+	code := doPromote(client, cfg, "v1.0.0", "dockerhub", "gitlab", []string{"v1.0.0", "prod"}, nil, out, eout)
+
+	assert.Equal(t, 0, code)
+	assert.Equal(t, "", eout.String())
+	assert.Equal(t, digest, target.Manifest("group/reponame", "v1.0.0").Digest)
+	assert.Equal(t, digest, target.Manifest("group/reponame", "prod").Digest)
+	assert.Equal(t, 2, bytes.Count(out.Bytes(), []byte("Copying blob")))
+}
+
+func TestPromote_UnknownRegistry(t *testing.T) {
+	eout := &bytes.Buffer{}
+	cfg := config.InitEmptyConfig()
+	code := doPromote(&docker.MockDocker{}, cfg, "abc123", "", "acme", []string{"prod"}, nil, &bytes.Buffer{}, eout)
+	assert.Equal(t, -3, code)
+	assert.Equal(t, "\x1b[0m\x1b[31munknown registry 'acme'\x1b[39m\x1b[0m\n", eout.String())
+}
+
+func TestPromote_LoginError(t *testing.T) {
+	eout := &bytes.Buffer{}
+	cfg := config.InitEmptyConfig()
+	cfg.Registry.Dockerhub.Repository = "repo"
+	code := doPromote(&docker.MockDocker{LoginError: errors.New("invalid username/password")}, cfg, "abc123", "", "", []string{"prod"}, nil, &bytes.Buffer{}, eout)
+	assert.Equal(t, -4, code)
+	assert.Equal(t, "\x1b[0m\x1b[31minvalid username/password\x1b[39m\x1b[0m\n", eout.String())
+}
+
+func TestPromote_UnknownImage(t *testing.T) {
+	eout := &bytes.Buffer{}
+	cfg := config.InitEmptyConfig()
+	cfg.Registry.Dockerhub.Repository = "repo"
+	cfg.Images = []config.Image{{Name: "api"}}
+	code := doPromote(&docker.MockDocker{}, cfg, "abc123", "", "", []string{"prod"}, []string{"web"}, &bytes.Buffer{}, eout)
+	assert.Equal(t, -5, code)
+}
+
+func TestPromote_MissingCommit(t *testing.T) {
+	eout := &bytes.Buffer{}
+	cfg := config.InitEmptyConfig()
+	cfg.VCS.VCS = &no{}
+	cfg.CI.Gitlab.CIBuildName = "reponame"
+	cfg.Registry.Dockerhub.Repository = "repo"
+	code := doPromote(&docker.MockDocker{}, cfg, "", "", "", []string{"prod"}, nil, &bytes.Buffer{}, eout)
+	assert.Equal(t, -6, code)
+	assert.Contains(t, eout.String(), "use --from to select the image to promote")
+}
+
+func TestPromote_MissingImage(t *testing.T) {
+	server := registry.NewMockRegistryServer()
+	defer server.Close()
+
+	eout := &bytes.Buffer{}
+	cfg := config.InitEmptyConfig()
+	cfg.CI.Gitlab.CIBuildName = "reponame"
+	cfg.Registry.Dockerhub.Repository = server.Host()
+	code := doPromote(&docker.MockDocker{}, cfg, "abc123", "", "", []string{"prod"}, nil, &bytes.Buffer{}, eout)
+	assert.Equal(t, -8, code)
+	assert.Equal(t, fmt.Sprintf("\x1b[0m\x1b[31munable to fetch manifest for %s/reponame:abc123: not found\x1b[39m\x1b[0m\n", server.Host()), eout.String())
+}
+
+type no struct {
+	vcs.CommonVCS
+}
+
+func (v no) Identify(dir string, out io.Writer) bool {
+	return true
+}
+
+func (v no) Name() string {
+	return "none"
+}
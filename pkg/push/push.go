@@ -1,21 +1,35 @@
 package push
 
 import (
+	"context"
+	"crypto/ecdsa"
 	docker2 "docker.io/go-docker"
 	"flag"
 	"fmt"
 	"github.com/liamg/tml"
+	"github.com/sparetimecoders/build-tools/pkg/changes"
 	"github.com/sparetimecoders/build-tools/pkg/ci"
 	"github.com/sparetimecoders/build-tools/pkg/config"
 	"github.com/sparetimecoders/build-tools/pkg/docker"
+	"github.com/sparetimecoders/build-tools/pkg/registry"
+	"github.com/sparetimecoders/build-tools/pkg/report"
+	"github.com/sparetimecoders/build-tools/pkg/sign"
 	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 )
 
 func Push(dir string, out, eout io.Writer, args ...string) int {
 	var dockerfile string
+	var only arrayFlags
+	var buildArgs arrayFlags
+	var skipUnchanged bool
+	var since string
+	var platforms arrayFlags
+	var reportFile string
+	var registries arrayFlags
 	const (
 		defaultDockerfile = "Dockerfile"
 		usage             = "name of the Dockerfile to use"
@@ -23,6 +37,13 @@ func Push(dir string, out, eout io.Writer, args ...string) int {
 	set := flag.NewFlagSet("push", flag.ExitOnError)
 	set.StringVar(&dockerfile, "file", defaultDockerfile, usage)
 	set.StringVar(&dockerfile, "f", defaultDockerfile, usage+" (shorthand)")
+	set.Var(&buildArgs, "build-arg", "build-arg the image was built with, to push the same Dockerfile stages (can be repeated)")
+	set.Var(&only, "only", "only push the image with this name (can be repeated)")
+	set.Var(&registries, "registry", "registry to push to, i.e. ecr or all for every configured registry (can be repeated or comma separated)")
+	set.BoolVar(&skipUnchanged, "skip-unchanged", false, "retag the previous image instead of pushing images whose context and Dockerfile did not change")
+	set.StringVar(&reportFile, "report", "", "write a JSON report of the pushed images to this file")
+	set.Var(&platforms, "platform", "platform the image was built for, i.e. linux/arm64 (can be repeated or comma separated)")
+	set.StringVar(&since, "since", "", "commit to compare against when skipping unchanged images (implies --skip-unchanged)")
 	_ = set.Parse(args)
 
 	client, err := docker2.NewEnvClient()
@@ -35,12 +56,63 @@ func Push(dir string, out, eout io.Writer, args ...string) int {
 		_, _ = fmt.Fprintln(eout, tml.Sprintf("<red>%s</red>", err.Error()))
 		return -2
 	}
-	return doPush(client, cfg, dir, dockerfile, out, eout)
+	if len(platforms) > 0 {
+		cfg.Build.Platforms = platforms
+	}
+	if len(registries) > 0 {
+		cfg.Registry.Targets = registries
+	}
+	var detector *changes.Detector
+	if skipUnchanged || len(since) > 0 {
+		detector = &changes.Detector{Since: since}
+	}
+	pushReport := &report.Report{}
+	if code := doPush(client, cfg, dir, dockerfile, buildArgs, detector, pushReport, out, eout, only...); code != 0 {
+		return code
+	}
+	if len(reportFile) > 0 {
+		if err := pushReport.Write(reportFile); err != nil {
+			_, _ = fmt.Fprintln(eout, tml.Sprintf("<red>%s</red>", err.Error()))
+			return -12
+		}
+		_, _ = fmt.Fprintln(out, tml.Sprintf("Wrote push report to <green>%s</green>", reportFile))
+	}
+	return 0
 }
 
-func doPush(client docker.Client, cfg *config.Config, dir, dockerfile string, out, eout io.Writer) int {
+func doPush(client docker.Client, cfg *config.Config, dir, dockerfile string, buildArgs []string, detector *changes.Detector, pushReport *report.Report, out, eout io.Writer, only ...string) int {
+	registries, err := cfg.CurrentRegistries(nil)
+	if err != nil {
+		_, _ = fmt.Fprintln(eout, tml.Sprintf("<red>%s</red>", err.Error()))
+		return -13
+	}
+	if len(registries) == 1 {
+		return pushRegistry(client, cfg, registries[0], dir, dockerfile, buildArgs, detector, pushReport, out, eout, only...)
+	}
+
+	// Push to every registry before failing, returning the code of the first failure
+	result := 0
+	codes := make([]int, len(registries))
+	for i, currentRegistry := range registries {
+		_, _ = fmt.Fprintln(out, tml.Sprintf("Pushing to registry <green>%s</green>", currentRegistry.Name()))
+		codes[i] = pushRegistry(client, cfg, currentRegistry, dir, dockerfile, buildArgs, detector, pushReport, out, eout, only...)
+		if codes[i] != 0 && result == 0 {
+			result = codes[i]
+		}
+	}
+	for i, currentRegistry := range registries {
+		if codes[i] == 0 {
+			_, _ = fmt.Fprintln(out, tml.Sprintf("Registry <green>%s</green>: <green>pushed</green>", currentRegistry.Name()))
+		} else {
+			_, _ = fmt.Fprintln(out, tml.Sprintf("Registry <green>%s</green>: <red>failed with code %d</red>", currentRegistry.Name(), codes[i]))
+		}
+	}
+	return result
+}
+
+// pushRegistry pushes the images to a single registry
+func pushRegistry(client docker.Client, cfg *config.Config, currentRegistry registry.Registry, dir, dockerfile string, buildArgs []string, detector *changes.Detector, pushReport *report.Report, out, eout io.Writer, only ...string) int {
 	currentCI := cfg.CurrentCI()
-	currentRegistry := cfg.CurrentRegistry()
 
 	if err := currentRegistry.Login(client, out); err != nil {
 		_, _ = fmt.Fprintln(eout, tml.Sprintf("<red>%s</red>", err.Error()))
@@ -49,46 +121,337 @@ func doPush(client docker.Client, cfg *config.Config, dir, dockerfile string, ou
 
 	auth := currentRegistry.GetAuthInfo()
 
-	if err := currentRegistry.Create(currentCI.BuildName()); err != nil {
+	images, err := cfg.CurrentImages(dockerfile, only)
+	if err != nil {
 		_, _ = fmt.Fprintln(eout, tml.Sprintf("<red>%s</red>", err.Error()))
-		return -4
+		return -9
 	}
 
-	content, err := ioutil.ReadFile(filepath.Join(dir, dockerfile))
+	platforms, err := cfg.CurrentPlatforms(nil)
 	if err != nil {
 		_, _ = fmt.Fprintln(eout, tml.Sprintf("<red>%s</red>", err.Error()))
-		return -5
+		return -10
 	}
-	stages := docker.FindStages(string(content))
+	multiPlatform := len(platforms) > 1 || len(platforms[0]) > 0
 
-	var tags []string
-	for _, stage := range stages {
-		tags = append(tags, docker.Tag(currentRegistry.RegistryUrl(), currentCI.BuildName(), stage))
+	api, err := registry.NewRegistryAPI(currentRegistry)
+	if err != nil {
+		_, _ = fmt.Fprintln(eout, tml.Sprintf("<red>%s</red>", err.Error()))
+		return -3
+	}
+	if detector != nil {
+		detector.VCS = cfg.CurrentVCS()
+		detector.API = api
+		detector.RegistryUrl = currentRegistry.RegistryUrl()
+		detector.Tags = []string{"latest"}
+		if branch := currentCI.BranchReplaceSlash(); len(branch) > 0 {
+			detector.Tags = []string{branch, "latest"}
+		}
+	}
+	var signingKey *ecdsa.PrivateKey
+	if cfg.Signing.Sign() {
+		if signingKey, err = sign.LoadPrivateKey(cfg.Signing.Key, []byte(cfg.Signing.Password)); err != nil {
+			_, _ = fmt.Fprintln(eout, tml.Sprintf("<red>%s</red>", err.Error()))
+			return -15
+		}
 	}
 
-	if dockerTag := os.Getenv("DOCKER_TAG"); len(dockerTag) > 0 {
-		tag := docker.Tag(currentRegistry.RegistryUrl(), currentCI.BuildName(), dockerTag)
-		tags = append(tags, tag)
-		_, _ = fmt.Fprintf(out, "overriding docker tags with value from env DOCKER_TAG %s\n", dockerTag)
-	} else {
-		if !ci.IsValid(currentCI) {
+	for _, image := range images {
+		if err := currentRegistry.Create(image.Name); err != nil {
+			_, _ = fmt.Fprintln(eout, tml.Sprintf("<red>%s</red>", err.Error()))
+			return -4
+		}
+
+		if detector != nil {
+			if previous, err := detector.Unchanged(image); err != nil {
+				_, _ = fmt.Fprintln(out, tml.Sprintf("<yellow>Unable to detect changes for image %s, pushing it: %s</yellow>", image.Name, err.Error()))
+			} else if previous != nil {
+				entry := pushReport.Add(image.Name, "")
+				entry.Registry = currentRegistry.Name()
+				if code := retag(api, cfg, currentRegistry.RegistryUrl(), image, previous, entry, out, eout); code != 0 {
+					return code
+				}
+				if signingKey != nil {
+					if err := signImage(api, signingKey, entry, out); err != nil {
+						_, _ = fmt.Fprintln(eout, tml.Sprintf("<red>%s</red>", err.Error()))
+						return -15
+					}
+				}
+				entry.Done()
+				continue
+			}
+		}
+
+		entry := pushReport.Add(image.Name, "")
+		entry.Registry = currentRegistry.Name()
+		content, err := ioutil.ReadFile(filepath.Join(dir, image.Context, image.Dockerfile))
+		if err != nil {
+			_, _ = fmt.Fprintln(eout, tml.Sprintf("<red>%s</red>", err.Error()))
+			return -5
+		}
+		parsed, err := docker.ParseDockerfile(string(content), cfg.BuildArgs(image, buildArgs, ioutil.Discard))
+		if err != nil {
+			_, _ = fmt.Fprintln(eout, tml.Sprintf("<red>unable to parse %s: %s</red>", image.Dockerfile, err.Error()))
+			return -5
+		}
+		stages := parsed.CacheStages()
+		entry.Stages = stages
+
+		var tags []string
+		for _, platform := range platforms {
+			for _, stage := range stages {
+				tags = append(tags, docker.Tag(currentRegistry.RegistryUrl(), image.Name, docker.PlatformTag(stage, platform)))
+			}
+		}
+
+		if len(os.Getenv("DOCKER_TAG")) == 0 && !ci.IsValid(currentCI) {
 			_, _ = fmt.Fprint(eout, tml.Sprintf("Commit and/or branch information is <red>missing</red>. Perhaps your not in a Git repository or forgot to set environment variables?"))
 			return -6
 		}
-		tags = append(tags,
-			docker.Tag(currentRegistry.RegistryUrl(), currentCI.BuildName(), currentCI.Commit()),
-			docker.Tag(currentRegistry.RegistryUrl(), currentCI.BuildName(), currentCI.BranchReplaceSlash()),
-		)
-		if currentCI.Branch() == "master" {
-			tags = append(tags, docker.Tag(currentRegistry.RegistryUrl(), currentCI.BuildName(), "latest"))
+		imageTags, err := cfg.ImageTags(out)
+		if err != nil {
+			_, _ = fmt.Fprintln(eout, tml.Sprintf("<red>%s</red>", err.Error()))
+			return -8
+		}
+		if multiPlatform {
+			// The platform variants are only pushed with a single tag, the manifest list gets all tags
+			for _, platform := range platforms {
+				tags = append(tags, docker.Tag(currentRegistry.RegistryUrl(), image.Name, docker.PlatformTag(imageTags[0], platform)))
+			}
+		} else {
+			for _, tag := range imageTags {
+				tags = append(tags, docker.Tag(currentRegistry.RegistryUrl(), image.Name, tag))
+			}
 		}
+		existing := make(map[string]*report.Pushed)
+		var pending []string
+		for _, tag := range tags {
+			if pushed := upToDate(client, api, tag, out); pushed != nil {
+				existing[tag] = pushed
+			} else {
+				pending = append(pending, tag)
+			}
+		}
+		results, err := pushTags(client, currentRegistry, auth, pending, cfg.Push, out, eout)
+		if err != nil {
+			_, _ = fmt.Fprintln(eout, tml.Sprintf("<red>%s</red>", err.Error()))
+			return -14
+		}
+		failed := false
+		byTag := make(map[string]*tagResult)
+		for _, result := range results {
+			byTag[result.tag] = result
+			failed = failed || result.err != nil
+		}
+		for _, tag := range tags {
+			if pushed, exists := existing[tag]; exists {
+				entry.Tags = append(entry.Tags, tag)
+				entry.Pushed = append(entry.Pushed, *pushed)
+			} else if result := byTag[tag]; result.err == nil {
+				entry.Tags = append(entry.Tags, tag)
+				if result.result != nil {
+					entry.Pushed = append(entry.Pushed, report.Pushed{Tag: tag, Digest: result.result.Digest, Size: result.result.Size})
+				}
+			}
+		}
+		for _, tag := range tags {
+			if _, exists := existing[tag]; exists {
+				_, _ = fmt.Fprintln(out, tml.Sprintf("Tag '%s': <green>up to date</green>", tag))
+			} else if byTag[tag].err == nil {
+				_, _ = fmt.Fprintln(out, tml.Sprintf("Tag '%s': <green>pushed</green>", tag))
+			} else {
+				_, _ = fmt.Fprintln(out, tml.Sprintf("Tag '%s': <red>failed</red>", tag))
+			}
+		}
+		if failed {
+			return -7
+		}
+		if multiPlatform {
+			digest, err := pushManifestList(api, currentRegistry.RegistryUrl(), image, platforms, imageTags, out)
+			if err != nil {
+				_, _ = fmt.Fprintln(eout, tml.Sprintf("<red>%s</red>", err.Error()))
+				return -7
+			}
+			entry.ManifestList = digest
+			for _, tag := range imageTags {
+				entry.Tags = append(entry.Tags, docker.Tag(currentRegistry.RegistryUrl(), image.Name, tag))
+			}
+		}
+		if err := attachSBOMs(api, cfg, dir, currentRegistry.RegistryUrl(), image, platforms, imageTags, entry, out); err != nil {
+			_, _ = fmt.Fprintln(eout, tml.Sprintf("<red>%s</red>", err.Error()))
+			return -16
+		}
+		if signingKey != nil {
+			if err := signImage(api, signingKey, entry, out); err != nil {
+				_, _ = fmt.Fprintln(eout, tml.Sprintf("<red>%s</red>", err.Error()))
+				return -15
+			}
+		}
+		entry.Done()
 	}
-	for _, tag := range tags {
-		_, _ = fmt.Fprintln(out, tml.Sprintf("Pushing tag '<green>%s</green>'", tag))
-		if err := currentRegistry.PushImage(client, auth, tag, out, eout); err != nil {
+	return 0
+}
+
+// upToDate returns the tag as pushed if the registry already has the local image with the tag, so it doesn't have to be pushed again
+func upToDate(client docker.Client, api *registry.API, tag string, out io.Writer) *report.Pushed {
+	local, _, err := client.ImageInspectWithRaw(context.Background(), tag)
+	if err != nil || local.ID == "" {
+		return nil
+	}
+	ref, err := registry.ParseReference(tag)
+	if err != nil {
+		return nil
+	}
+	manifest, err := api.Manifest(ref)
+	if err != nil {
+		if err != registry.ErrNotFound {
+			_, _ = fmt.Fprintln(out, tml.Sprintf("<yellow>Unable to check if tag '%s' is up to date, pushing it: %s</yellow>", tag, err.Error()))
+		}
+		return nil
+	}
+	if remote, err := manifest.ConfigDigest(); err != nil || remote != local.ID {
+		return nil
+	}
+	_, _ = fmt.Fprintln(out, tml.Sprintf("Tag '<green>%s</green>' is <green>up to date</green>", tag))
+	return &report.Pushed{Tag: tag, Digest: manifest.Digest, Size: int64(len(manifest.Content)), UpToDate: true}
+}
+
+// manifestUpToDate returns true if ref already points at manifest, so it doesn't have to be put again.
+// Registries with immutable tags reject putting a manifest for an existing tag, even if it's the same manifest
+func manifestUpToDate(api *registry.API, ref registry.Reference, manifest *registry.Manifest, out io.Writer) bool {
+	digest, err := api.ManifestDigest(ref)
+	if err != nil {
+		if err != registry.ErrNotFound {
+			_, _ = fmt.Fprintln(out, tml.Sprintf("<yellow>Unable to check if tag '%s' is up to date, pushing it: %s</yellow>", ref, err.Error()))
+		}
+		return false
+	}
+	if digest != manifest.Digest {
+		return false
+	}
+	_, _ = fmt.Fprintln(out, tml.Sprintf("Tag '<green>%s</green>' is <green>up to date</green>", ref))
+	return true
+}
+
+// signImage signs the manifests referenced by the tags of entry, each manifest is only signed once
+func signImage(api *registry.API, key *ecdsa.PrivateKey, entry *report.Image, out io.Writer) error {
+	signed := make(map[string]bool)
+	for _, tag := range entry.Tags {
+		ref, err := registry.ParseReference(tag)
+		if err != nil {
+			return err
+		}
+		digest, err := api.ManifestDigest(ref)
+		if err != nil {
+			return fmt.Errorf("unable to fetch digest for %s: %v", ref, err)
+		}
+		if signed[digest] {
+			continue
+		}
+		signed[digest] = true
+		added, err := sign.Sign(api, ref.WithDigest(digest), key)
+		if err != nil {
+			return err
+		}
+		if added {
+			_, _ = fmt.Fprintln(out, tml.Sprintf("Signed '<green>%s</green>'", ref.WithDigest(digest)))
+		} else {
+			_, _ = fmt.Fprintln(out, tml.Sprintf("'<green>%s</green>' is <green>already signed</green>", ref.WithDigest(digest)))
+		}
+		entry.Signed = append(entry.Signed, digest)
+	}
+	return nil
+}
+
+// pushManifestList creates a manifest list referencing the pushed platform variants of image, pushes it with every tag
+// and returns its digest
+func pushManifestList(api *registry.API, registryUrl string, image config.Image, platforms, imageTags []string, out io.Writer) (string, error) {
+	var manifests []registry.PlatformManifest
+	for _, platform := range platforms {
+		ref, err := registry.ParseReference(docker.Tag(registryUrl, image.Name, docker.PlatformTag(imageTags[0], platform)))
+		if err != nil {
+			return "", err
+		}
+		manifest, err := api.Manifest(ref)
+		if err != nil {
+			return "", fmt.Errorf("unable to fetch manifest for %s: %v", ref, err)
+		}
+		parsed, err := registry.ParsePlatform(platform)
+		if err != nil {
+			return "", err
+		}
+		_, _ = fmt.Fprintln(out, tml.Sprintf("Platform <green>%s</green> digest <green>%s</green>", platform, manifest.Digest))
+		manifests = append(manifests, registry.PlatformManifest{Platform: parsed, Manifest: manifest})
+	}
+	list, err := registry.NewManifestList(manifests)
+	if err != nil {
+		return "", err
+	}
+	for _, tag := range imageTags {
+		ref, err := registry.ParseReference(docker.Tag(registryUrl, image.Name, tag))
+		if err != nil {
+			return "", err
+		}
+		if manifestUpToDate(api, ref, list, out) {
+			continue
+		}
+		_, _ = fmt.Fprintln(out, tml.Sprintf("Pushing manifest list '<green>%s</green>'", ref))
+		if _, err := api.PutManifest(ref, list); err != nil {
+			return "", err
+		}
+	}
+	_, _ = fmt.Fprintln(out, tml.Sprintf("Manifest list digest <green>%s</green>", list.Digest))
+	return list.Digest, nil
+}
+
+// retag points the tags of the current build at the manifest of the previously built image
+func retag(api *registry.API, cfg *config.Config, registryUrl string, image config.Image, previous *changes.Previous, entry *report.Image, out, eout io.Writer) int {
+	if len(os.Getenv("DOCKER_TAG")) == 0 && !ci.IsValid(cfg.CurrentCI()) {
+		_, _ = fmt.Fprint(eout, tml.Sprintf("Commit and/or branch information is <red>missing</red>. Perhaps your not in a Git repository or forgot to set environment variables?"))
+		return -6
+	}
+	imageTags, err := cfg.ImageTags(out)
+	if err != nil {
+		_, _ = fmt.Fprintln(eout, tml.Sprintf("<red>%s</red>", err.Error()))
+		return -8
+	}
+	_, _ = fmt.Fprintln(out, tml.Sprintf("Image <green>%s</green> unchanged since <green>%s</green>, retagging <green>%s</green>", image.Name, previous.Revision, previous.Reference))
+	entry.Unchanged = previous.Revision
+	manifest, err := api.Manifest(previous.Reference)
+	if err != nil {
+		_, _ = fmt.Fprintln(eout, tml.Sprintf("<red>%s</red>", err.Error()))
+		return -7
+	}
+	for _, tag := range imageTags {
+		ref, err := registry.ParseReference(docker.Tag(registryUrl, image.Name, tag))
+		if err != nil {
 			_, _ = fmt.Fprintln(eout, tml.Sprintf("<red>%s</red>", err.Error()))
 			return -7
 		}
+		if manifestUpToDate(api, ref, manifest, out) {
+			entry.Tags = append(entry.Tags, ref.String())
+			entry.Pushed = append(entry.Pushed, report.Pushed{Tag: ref.String(), Digest: manifest.Digest, Size: int64(len(manifest.Content)), UpToDate: true})
+			continue
+		}
+		_, _ = fmt.Fprintln(out, tml.Sprintf("Tagging '<green>%s</green>'", ref))
+		digest, err := api.PutManifest(ref, manifest)
+		if err != nil {
+			_, _ = fmt.Fprintln(eout, tml.Sprintf("<red>%s</red>", err.Error()))
+			return -7
+		}
+		entry.Tags = append(entry.Tags, ref.String())
+		entry.Pushed = append(entry.Pushed, report.Pushed{Tag: ref.String(), Digest: digest, Size: int64(len(manifest.Content))})
 	}
 	return 0
 }
+
+type arrayFlags []string
+
+func (i *arrayFlags) String() string {
+	return strings.Join(*i, ",")
+}
+
+func (i *arrayFlags) Set(value string) error {
+	*i = append(*i, strings.TrimSpace(value))
+	return nil
+}
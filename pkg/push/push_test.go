@@ -4,17 +4,20 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
-	"github.com/stretchr/testify/assert"
 	"github.com/sparetimecoders/build-tools/pkg"
+	"github.com/sparetimecoders/build-tools/pkg/changes"
 	"github.com/sparetimecoders/build-tools/pkg/config"
 	"github.com/sparetimecoders/build-tools/pkg/docker"
 	"github.com/sparetimecoders/build-tools/pkg/file"
 	"github.com/sparetimecoders/build-tools/pkg/registry"
+	"github.com/sparetimecoders/build-tools/pkg/report"
 	"github.com/sparetimecoders/build-tools/pkg/vcs"
+	"github.com/stretchr/testify/assert"
 	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -75,7 +78,7 @@ func TestPush_NoRegistry(t *testing.T) {
 	cfg := config.InitEmptyConfig()
 	cfg.VCS.VCS = &no{}
 
-	exitCode := doPush(client, cfg, name, "Dockerfile", out, eout)
+	exitCode := doPush(client, cfg, name, "Dockerfile", nil, nil, &report.Report{}, out, eout)
 
 	assert.Equal(t, -6, exitCode)
 	assert.Equal(t, "\x1b[0mAuthentication \x1b[33mnot supported\x1b[39m for registry \x1b[32mNo docker registry\x1b[39m\x1b[0m\n", out.String())
@@ -90,12 +93,12 @@ func TestPush_LoginFailure(t *testing.T) {
 	cfg := config.InitEmptyConfig()
 	cfg.Registry.ECR.Url = "abc"
 
-	exitCode := doPush(client, cfg, name, "Dockerfile", out, eout)
+	exitCode := doPush(client, cfg, name, "Dockerfile", nil, nil, &report.Report{}, out, eout)
 
 	assert.NotNil(t, exitCode)
 	assert.Equal(t, -3, exitCode)
-	assert.Equal(t, "", out.String())
-	assert.Equal(t, "\x1b[0m\x1b[31mMissingRegion: could not find region configuration\x1b[39m\x1b[0m\n", eout.String())
+	assert.Equal(t, "\x1b[0m\x1b[33munable to get ECR authorization token: MissingRegion: could not find region configuration, trying docker credentials for abc\x1b[39m\x1b[0m\n", out.String())
+	assert.Equal(t, "\x1b[0m\x1b[31munable to get ECR authorization token: MissingRegion: could not find region configuration, no docker credentials found for abc\x1b[39m\x1b[0m\n", eout.String())
 }
 
 func TestPush_PushError(t *testing.T) {
@@ -110,7 +113,7 @@ func TestPush_PushError(t *testing.T) {
 	cfg.VCS.VCS = &no{}
 	cfg.Registry.Dockerhub.Repository = "repo"
 
-	exitCode := doPush(client, cfg, name, "Dockerfile", out, eout)
+	exitCode := doPush(client, cfg, name, "Dockerfile", nil, nil, &report.Report{}, out, eout)
 
 	assert.NotNil(t, exitCode)
 	assert.Equal(t, -6, exitCode)
@@ -132,11 +135,11 @@ func TestPush_PushFeatureBranch(t *testing.T) {
 	cfg.CI.Gitlab.CIBranchName = "feature1"
 	cfg.Registry.Dockerhub.Repository = "repo"
 
-	exitCode := doPush(client, cfg, name, "Dockerfile", out, eout)
+	exitCode := doPush(client, cfg, name, "Dockerfile", nil, nil, &report.Report{}, out, eout)
 
 	assert.Equal(t, 0, exitCode)
 	assert.Equal(t, []string{"repo/reponame:abc123", "repo/reponame:feature1"}, client.Images)
-	assert.Equal(t, "Logged in\n\x1b[0mPushing tag '\x1b[32mrepo/reponame:abc123\x1b[39m'\x1b[0m\nPush successful\n\x1b[0mPushing tag '\x1b[32mrepo/reponame:feature1\x1b[39m'\x1b[0m\nPush successful\n", out.String())
+	assert.Equal(t, "Logged in\n\x1b[0mPushing tag '\x1b[32mrepo/reponame:abc123\x1b[39m'\x1b[0m\nPush successful\n\x1b[0mPushing tag '\x1b[32mrepo/reponame:feature1\x1b[39m'\x1b[0m\nPush successful\n\x1b[0mTag 'repo/reponame:abc123': \x1b[32mpushed\x1b[39m\x1b[0m\n\x1b[0mTag 'repo/reponame:feature1': \x1b[32mpushed\x1b[39m\x1b[0m\n", out.String())
 	assert.Equal(t, "", eout.String())
 }
 
@@ -153,11 +156,103 @@ func TestPush_PushMasterBranch(t *testing.T) {
 	cfg.CI.Gitlab.CICommit = "abc123"
 	cfg.CI.Gitlab.CIBranchName = "master"
 	cfg.Registry.Dockerhub.Repository = "repo"
-	exitCode := doPush(client, cfg, name, "Dockerfile", out, eout)
+	exitCode := doPush(client, cfg, name, "Dockerfile", nil, nil, &report.Report{}, out, eout)
 
 	assert.Equal(t, 0, exitCode)
 	assert.Equal(t, []string{"repo/reponame:abc123", "repo/reponame:master", "repo/reponame:latest"}, client.Images)
-	assert.Equal(t, "Logged in\n\x1b[0mPushing tag '\x1b[32mrepo/reponame:abc123\x1b[39m'\x1b[0m\nPush successful\n\x1b[0mPushing tag '\x1b[32mrepo/reponame:master\x1b[39m'\x1b[0m\nPush successful\n\x1b[0mPushing tag '\x1b[32mrepo/reponame:latest\x1b[39m'\x1b[0m\nPush successful\n", out.String())
+	assert.Equal(t, "Logged in\n\x1b[0mPushing tag '\x1b[32mrepo/reponame:abc123\x1b[39m'\x1b[0m\nPush successful\n\x1b[0mPushing tag '\x1b[32mrepo/reponame:master\x1b[39m'\x1b[0m\nPush successful\n\x1b[0mPushing tag '\x1b[32mrepo/reponame:latest\x1b[39m'\x1b[0m\nPush successful\n\x1b[0mTag 'repo/reponame:abc123': \x1b[32mpushed\x1b[39m\x1b[0m\n\x1b[0mTag 'repo/reponame:master': \x1b[32mpushed\x1b[39m\x1b[0m\n\x1b[0mTag 'repo/reponame:latest': \x1b[32mpushed\x1b[39m\x1b[0m\n", out.String())
+	assert.Equal(t, "", eout.String())
+}
+
+func TestPush_PushGitTag(t *testing.T) {
+	defer func() { _ = os.RemoveAll(name) }()
+	_ = file.Write(name, "Dockerfile", "FROM scratch")
+
+	out := &bytes.Buffer{}
+	eout := &bytes.Buffer{}
+	pushOut := `{"status":"Push successful"}`
+	client := &docker.MockDocker{PushOutput: &pushOut}
+	cfg := config.InitEmptyConfig()
+	cfg.CI.Github.CIBuildName = "reponame"
+	cfg.CI.Github.CICommit = "abc123"
+	cfg.CI.Github.CIBranchName = "refs/tags/v1.4.2"
+	cfg.Registry.Dockerhub.Repository = "repo"
+
+	exitCode := doPush(client, cfg, name, "Dockerfile", nil, nil, &report.Report{}, out, eout)
+
+	assert.Equal(t, 0, exitCode)
+	assert.Equal(t, []string{"repo/reponame:abc123", "repo/reponame:1.4.2", "repo/reponame:1.4", "repo/reponame:1"}, client.Images)
+	assert.Equal(t, "", eout.String())
+}
+
+func TestPush_ConfiguredTags(t *testing.T) {
+	defer func() { _ = os.RemoveAll(name) }()
+	_ = file.Write(name, "Dockerfile", "FROM scratch")
+
+	out := &bytes.Buffer{}
+	eout := &bytes.Buffer{}
+	pushOut := `{"status":"Push successful"}`
+	client := &docker.MockDocker{PushOutput: &pushOut}
+	cfg := config.InitEmptyConfig()
+	cfg.CI.Gitlab.CIBuildName = "reponame"
+	cfg.CI.Gitlab.CICommit = "abc1234567"
+	cfg.CI.Gitlab.CIBranchName = "trunk"
+	cfg.Registry.Dockerhub.Repository = "repo"
+	cfg.Tags.Templates = []string{"{{ .ShortCommit }}"}
+	cfg.Tags.MainBranches = []string{"main", "trunk"}
+
+	exitCode := doPush(client, cfg, name, "Dockerfile", nil, nil, &report.Report{}, out, eout)
+
+	assert.Equal(t, 0, exitCode)
+	assert.Equal(t, []string{"repo/reponame:abc1234", "repo/reponame:latest"}, client.Images)
+	assert.Equal(t, "", eout.String())
+}
+
+func TestPush_MultipleImages(t *testing.T) {
+	defer func() { _ = os.RemoveAll(name) }()
+	_ = os.MkdirAll(filepath.Join(name, "api"), 0777)
+	_ = os.MkdirAll(filepath.Join(name, "web"), 0777)
+	_ = file.Write(filepath.Join(name, "api"), "Dockerfile", "FROM scratch as build\nFROM scratch\nCOPY --from=build file .")
+	_ = file.Write(filepath.Join(name, "web"), "Dockerfile", "FROM scratch")
+
+	out := &bytes.Buffer{}
+	eout := &bytes.Buffer{}
+	pushOut := `{"status":"Push successful"}`
+	client := &docker.MockDocker{PushOutput: &pushOut}
+	cfg := config.InitEmptyConfig()
+	cfg.CI.Gitlab.CIBuildName = "reponame"
+	cfg.CI.Gitlab.CICommit = "abc123"
+	cfg.CI.Gitlab.CIBranchName = "feature1"
+	cfg.Registry.Dockerhub.Repository = "repo"
+	cfg.Images = []config.Image{{Name: "api", Context: "api"}, {Name: "web", Context: "web"}}
+
+	exitCode := doPush(client, cfg, name, "Dockerfile", nil, nil, &report.Report{}, out, eout)
+
+	assert.Equal(t, 0, exitCode)
+	assert.Equal(t, []string{"repo/api:build", "repo/api:abc123", "repo/api:feature1", "repo/web:abc123", "repo/web:feature1"}, client.Images)
+	assert.Equal(t, "", eout.String())
+}
+
+func TestPush_OnlyImage(t *testing.T) {
+	defer func() { _ = os.RemoveAll(name) }()
+	_ = os.MkdirAll(filepath.Join(name, "web"), 0777)
+	_ = file.Write(filepath.Join(name, "web"), "Dockerfile", "FROM scratch")
+
+	out := &bytes.Buffer{}
+	eout := &bytes.Buffer{}
+	pushOut := `{"status":"Push successful"}`
+	client := &docker.MockDocker{PushOutput: &pushOut}
+	cfg := config.InitEmptyConfig()
+	cfg.CI.Gitlab.CIBuildName = "reponame"
+	cfg.CI.Gitlab.CICommit = "abc123"
+	cfg.CI.Gitlab.CIBranchName = "feature1"
+	cfg.Registry.Dockerhub.Repository = "repo"
+	cfg.Images = []config.Image{{Name: "api", Context: "api"}, {Name: "web", Context: "web"}}
+
+	exitCode := doPush(client, cfg, name, "Dockerfile", nil, nil, &report.Report{}, out, eout, "web")
+
+	assert.Equal(t, 0, exitCode)
+	assert.Equal(t, []string{"repo/web:abc123", "repo/web:feature1"}, client.Images)
 	assert.Equal(t, "", eout.String())
 }
 
@@ -175,11 +270,11 @@ func TestPush_DockerTagOverride(t *testing.T) {
 	cfg.CI.Gitlab.CICommit = "abc123"
 	cfg.CI.Gitlab.CIBranchName = "master"
 	cfg.Registry.Dockerhub.Repository = "repo"
-	exitCode := doPush(client, cfg, name, "Dockerfile", out, eout)
+	exitCode := doPush(client, cfg, name, "Dockerfile", nil, nil, &report.Report{}, out, eout)
 
 	assert.Equal(t, 0, exitCode)
 	assert.Equal(t, []string{"repo/reponame:override"}, client.Images)
-	assert.Equal(t, "Logged in\noverriding docker tags with value from env DOCKER_TAG override\n\x1b[0mPushing tag '\x1b[32mrepo/reponame:override\x1b[39m'\x1b[0m\nPush successful\n", out.String())
+	assert.Equal(t, "Logged in\noverriding docker tags with value from env DOCKER_TAG override\n\x1b[0mPushing tag '\x1b[32mrepo/reponame:override\x1b[39m'\x1b[0m\nPush successful\n\x1b[0mTag 'repo/reponame:override': \x1b[32mpushed\x1b[39m\x1b[0m\n", out.String())
 	assert.Equal(t, "", eout.String())
 }
 
@@ -206,14 +301,40 @@ COPY --from=test file2 .
 	cfg.CI.Gitlab.CIBranchName = "master"
 	cfg.Registry.Dockerhub.Repository = "repo"
 
-	exitCode := doPush(client, cfg, name, "Dockerfile", out, eout)
+	exitCode := doPush(client, cfg, name, "Dockerfile", nil, nil, &report.Report{}, out, eout)
 
 	assert.Equal(t, 0, exitCode)
 	assert.Equal(t, []string{"repo/reponame:build", "repo/reponame:test", "repo/reponame:abc123", "repo/reponame:master", "repo/reponame:latest"}, client.Images)
-	assert.Equal(t, "Logged in\n\x1b[0mPushing tag '\x1b[32mrepo/reponame:build\x1b[39m'\x1b[0m\nPush successful\n\x1b[0mPushing tag '\x1b[32mrepo/reponame:test\x1b[39m'\x1b[0m\nPush successful\n\x1b[0mPushing tag '\x1b[32mrepo/reponame:abc123\x1b[39m'\x1b[0m\nPush successful\n\x1b[0mPushing tag '\x1b[32mrepo/reponame:master\x1b[39m'\x1b[0m\nPush successful\n\x1b[0mPushing tag '\x1b[32mrepo/reponame:latest\x1b[39m'\x1b[0m\nPush successful\n", out.String())
+	assert.Equal(t, "Logged in\n\x1b[0mPushing tag '\x1b[32mrepo/reponame:build\x1b[39m'\x1b[0m\nPush successful\n\x1b[0mPushing tag '\x1b[32mrepo/reponame:test\x1b[39m'\x1b[0m\nPush successful\n\x1b[0mPushing tag '\x1b[32mrepo/reponame:abc123\x1b[39m'\x1b[0m\nPush successful\n\x1b[0mPushing tag '\x1b[32mrepo/reponame:master\x1b[39m'\x1b[0m\nPush successful\n\x1b[0mPushing tag '\x1b[32mrepo/reponame:latest\x1b[39m'\x1b[0m\nPush successful\n\x1b[0mTag 'repo/reponame:build': \x1b[32mpushed\x1b[39m\x1b[0m\n\x1b[0mTag 'repo/reponame:test': \x1b[32mpushed\x1b[39m\x1b[0m\n\x1b[0mTag 'repo/reponame:abc123': \x1b[32mpushed\x1b[39m\x1b[0m\n\x1b[0mTag 'repo/reponame:master': \x1b[32mpushed\x1b[39m\x1b[0m\n\x1b[0mTag 'repo/reponame:latest': \x1b[32mpushed\x1b[39m\x1b[0m\n", out.String())
 	assert.Equal(t, "", eout.String())
 }
 
+func TestPush_MultistageWithBuildArgs(t *testing.T) {
+	defer func() { _ = os.RemoveAll(name) }()
+	dockerfile := `
+ARG TARGET=build
+FROM scratch as build
+FROM scratch as test
+FROM ${TARGET} as target
+FROM scratch
+COPY --from=target file .
+`
+	_ = file.Write(name, "Dockerfile", dockerfile)
+
+	pushOut := `{"status":"Push successful"}`
+	client := &docker.MockDocker{PushOutput: &pushOut}
+	cfg := config.InitEmptyConfig()
+	cfg.CI.Gitlab.CIBuildName = "reponame"
+	cfg.CI.Gitlab.CICommit = "abc123"
+	cfg.CI.Gitlab.CIBranchName = "master"
+	cfg.Registry.Dockerhub.Repository = "repo"
+
+	exitCode := doPush(client, cfg, name, "Dockerfile", []string{"TARGET=test"}, nil, &report.Report{}, &bytes.Buffer{}, &bytes.Buffer{})
+
+	assert.Equal(t, 0, exitCode)
+	assert.Equal(t, []string{"repo/reponame:test", "repo/reponame:target", "repo/reponame:abc123", "repo/reponame:master", "repo/reponame:latest"}, client.Images)
+}
+
 func TestPush_Output(t *testing.T) {
 	defer func() { _ = os.RemoveAll(name) }()
 	_ = file.Write(name, "Dockerfile", "FROM scratch")
@@ -266,11 +387,11 @@ func TestPush_Output(t *testing.T) {
 	cfg.CI.Gitlab.CIBranchName = "master"
 	cfg.Registry.Dockerhub.Repository = "repo"
 
-	exitCode := doPush(client, cfg, name, "Dockerfile", out, eout)
+	exitCode := doPush(client, cfg, name, "Dockerfile", nil, nil, &report.Report{}, out, eout)
 
 	assert.Equal(t, 0, exitCode)
 	assert.Equal(t, []string{"repo/reponame:abc123", "repo/reponame:master", "repo/reponame:latest"}, client.Images)
-	assert.Equal(t, "Logged in\n\x1b[0mPushing tag '\x1b[32mrepo/reponame:abc123\x1b[39m'\x1b[0m\nThe push refers to repository [registry.gitlab.com/project/image]\nc49bda176134: Preparing\ncb13bd9b95b6: Preparing\n5905e8d02856: Preparing\ne3ef84c7b541: Preparing\n6096558c3d50: Preparing\n3b12aae5d4ca: Preparing\nac7b6b272904: Preparing\n5b1304247ae3: Preparing\n75e70aa52609: Preparing\ndda151859818: Preparing\nfbd2732ad777: Preparing\nba9de9d8475e: Preparing\ndda151859818: Waiting\n3b12aae5d4ca: Waiting\nac7b6b272904: Waiting\nba9de9d8475e: Waiting\n5b1304247ae3: Waiting\n75e70aa52609: Waiting\nfbd2732ad777: Waiting\n6096558c3d50: Layer already exists\nc49bda176134: Layer already exists\ne3ef84c7b541: Layer already exists\ncb13bd9b95b6: Pushing [=>                                                 ]     512B/13.09kB\ncb13bd9b95b6: Pushing [==================================================>]   16.9kB\n5905e8d02856: Pushing [=======>                                           ]     512B/3.511kB\n5905e8d02856: Pushing [==================================================>]  6.144kB\nac7b6b272904: Layer already exists\n3b12aae5d4ca: Layer already exists\n5b1304247ae3: Layer already exists\n75e70aa52609: Layer already exists\ndda151859818: Layer already exists\nfbd2732ad777: Layer already exists\nba9de9d8475e: Layer already exists\n5905e8d02856: Pushed\ncb13bd9b95b6: Pushed\ncd38b8b25e3e62d05589ad6b4639e2e222086604: digest: sha256:af534ee896ce2ac80f3413318329e45e3b3e74b89eb337b9364b8ac1e83498b7 size: 2828\n\x1b[0mPushing tag '\x1b[32mrepo/reponame:master\x1b[39m'\x1b[0m\nThe push refers to repository [registry.gitlab.com/project/image]\nc49bda176134: Preparing\ncb13bd9b95b6: Preparing\n5905e8d02856: Preparing\ne3ef84c7b541: Preparing\n6096558c3d50: Preparing\n3b12aae5d4ca: Preparing\nac7b6b272904: Preparing\n5b1304247ae3: Preparing\n75e70aa52609: Preparing\ndda151859818: Preparing\nfbd2732ad777: Preparing\nba9de9d8475e: Preparing\ndda151859818: Waiting\n3b12aae5d4ca: Waiting\nac7b6b272904: Waiting\nba9de9d8475e: Waiting\n5b1304247ae3: Waiting\n75e70aa52609: Waiting\nfbd2732ad777: Waiting\n6096558c3d50: Layer already exists\nc49bda176134: Layer already exists\ne3ef84c7b541: Layer already exists\ncb13bd9b95b6: Pushing [=>                                                 ]     512B/13.09kB\ncb13bd9b95b6: Pushing [==================================================>]   16.9kB\n5905e8d02856: Pushing [=======>                                           ]     512B/3.511kB\n5905e8d02856: Pushing [==================================================>]  6.144kB\nac7b6b272904: Layer already exists\n3b12aae5d4ca: Layer already exists\n5b1304247ae3: Layer already exists\n75e70aa52609: Layer already exists\ndda151859818: Layer already exists\nfbd2732ad777: Layer already exists\nba9de9d8475e: Layer already exists\n5905e8d02856: Pushed\ncb13bd9b95b6: Pushed\ncd38b8b25e3e62d05589ad6b4639e2e222086604: digest: sha256:af534ee896ce2ac80f3413318329e45e3b3e74b89eb337b9364b8ac1e83498b7 size: 2828\n\x1b[0mPushing tag '\x1b[32mrepo/reponame:latest\x1b[39m'\x1b[0m\nThe push refers to repository [registry.gitlab.com/project/image]\nc49bda176134: Preparing\ncb13bd9b95b6: Preparing\n5905e8d02856: Preparing\ne3ef84c7b541: Preparing\n6096558c3d50: Preparing\n3b12aae5d4ca: Preparing\nac7b6b272904: Preparing\n5b1304247ae3: Preparing\n75e70aa52609: Preparing\ndda151859818: Preparing\nfbd2732ad777: Preparing\nba9de9d8475e: Preparing\ndda151859818: Waiting\n3b12aae5d4ca: Waiting\nac7b6b272904: Waiting\nba9de9d8475e: Waiting\n5b1304247ae3: Waiting\n75e70aa52609: Waiting\nfbd2732ad777: Waiting\n6096558c3d50: Layer already exists\nc49bda176134: Layer already exists\ne3ef84c7b541: Layer already exists\ncb13bd9b95b6: Pushing [=>                                                 ]     512B/13.09kB\ncb13bd9b95b6: Pushing [==================================================>]   16.9kB\n5905e8d02856: Pushing [=======>                                           ]     512B/3.511kB\n5905e8d02856: Pushing [==================================================>]  6.144kB\nac7b6b272904: Layer already exists\n3b12aae5d4ca: Layer already exists\n5b1304247ae3: Layer already exists\n75e70aa52609: Layer already exists\ndda151859818: Layer already exists\nfbd2732ad777: Layer already exists\nba9de9d8475e: Layer already exists\n5905e8d02856: Pushed\ncb13bd9b95b6: Pushed\ncd38b8b25e3e62d05589ad6b4639e2e222086604: digest: sha256:af534ee896ce2ac80f3413318329e45e3b3e74b89eb337b9364b8ac1e83498b7 size: 2828\n", out.String())
+	assert.Equal(t, "Logged in\n\x1b[0mPushing tag '\x1b[32mrepo/reponame:abc123\x1b[39m'\x1b[0m\nThe push refers to repository [registry.gitlab.com/project/image]\nc49bda176134: Preparing\ncb13bd9b95b6: Preparing\n5905e8d02856: Preparing\ne3ef84c7b541: Preparing\n6096558c3d50: Preparing\n3b12aae5d4ca: Preparing\nac7b6b272904: Preparing\n5b1304247ae3: Preparing\n75e70aa52609: Preparing\ndda151859818: Preparing\nfbd2732ad777: Preparing\nba9de9d8475e: Preparing\ndda151859818: Waiting\n3b12aae5d4ca: Waiting\nac7b6b272904: Waiting\nba9de9d8475e: Waiting\n5b1304247ae3: Waiting\n75e70aa52609: Waiting\nfbd2732ad777: Waiting\n6096558c3d50: Layer already exists\nc49bda176134: Layer already exists\ne3ef84c7b541: Layer already exists\ncb13bd9b95b6: Pushing [=>                                                 ]     512B/13.09kB\ncb13bd9b95b6: Pushing [==================================================>]   16.9kB\n5905e8d02856: Pushing [=======>                                           ]     512B/3.511kB\n5905e8d02856: Pushing [==================================================>]  6.144kB\nac7b6b272904: Layer already exists\n3b12aae5d4ca: Layer already exists\n5b1304247ae3: Layer already exists\n75e70aa52609: Layer already exists\ndda151859818: Layer already exists\nfbd2732ad777: Layer already exists\nba9de9d8475e: Layer already exists\n5905e8d02856: Pushed\ncb13bd9b95b6: Pushed\ncd38b8b25e3e62d05589ad6b4639e2e222086604: digest: sha256:af534ee896ce2ac80f3413318329e45e3b3e74b89eb337b9364b8ac1e83498b7 size: 2828\n\x1b[0mPushing tag '\x1b[32mrepo/reponame:master\x1b[39m'\x1b[0m\nThe push refers to repository [registry.gitlab.com/project/image]\nc49bda176134: Preparing\ncb13bd9b95b6: Preparing\n5905e8d02856: Preparing\ne3ef84c7b541: Preparing\n6096558c3d50: Preparing\n3b12aae5d4ca: Preparing\nac7b6b272904: Preparing\n5b1304247ae3: Preparing\n75e70aa52609: Preparing\ndda151859818: Preparing\nfbd2732ad777: Preparing\nba9de9d8475e: Preparing\ndda151859818: Waiting\n3b12aae5d4ca: Waiting\nac7b6b272904: Waiting\nba9de9d8475e: Waiting\n5b1304247ae3: Waiting\n75e70aa52609: Waiting\nfbd2732ad777: Waiting\n6096558c3d50: Layer already exists\nc49bda176134: Layer already exists\ne3ef84c7b541: Layer already exists\ncb13bd9b95b6: Pushing [=>                                                 ]     512B/13.09kB\ncb13bd9b95b6: Pushing [==================================================>]   16.9kB\n5905e8d02856: Pushing [=======>                                           ]     512B/3.511kB\n5905e8d02856: Pushing [==================================================>]  6.144kB\nac7b6b272904: Layer already exists\n3b12aae5d4ca: Layer already exists\n5b1304247ae3: Layer already exists\n75e70aa52609: Layer already exists\ndda151859818: Layer already exists\nfbd2732ad777: Layer already exists\nba9de9d8475e: Layer already exists\n5905e8d02856: Pushed\ncb13bd9b95b6: Pushed\ncd38b8b25e3e62d05589ad6b4639e2e222086604: digest: sha256:af534ee896ce2ac80f3413318329e45e3b3e74b89eb337b9364b8ac1e83498b7 size: 2828\n\x1b[0mPushing tag '\x1b[32mrepo/reponame:latest\x1b[39m'\x1b[0m\nThe push refers to repository [registry.gitlab.com/project/image]\nc49bda176134: Preparing\ncb13bd9b95b6: Preparing\n5905e8d02856: Preparing\ne3ef84c7b541: Preparing\n6096558c3d50: Preparing\n3b12aae5d4ca: Preparing\nac7b6b272904: Preparing\n5b1304247ae3: Preparing\n75e70aa52609: Preparing\ndda151859818: Preparing\nfbd2732ad777: Preparing\nba9de9d8475e: Preparing\ndda151859818: Waiting\n3b12aae5d4ca: Waiting\nac7b6b272904: Waiting\nba9de9d8475e: Waiting\n5b1304247ae3: Waiting\n75e70aa52609: Waiting\nfbd2732ad777: Waiting\n6096558c3d50: Layer already exists\nc49bda176134: Layer already exists\ne3ef84c7b541: Layer already exists\ncb13bd9b95b6: Pushing [=>                                                 ]     512B/13.09kB\ncb13bd9b95b6: Pushing [==================================================>]   16.9kB\n5905e8d02856: Pushing [=======>                                           ]     512B/3.511kB\n5905e8d02856: Pushing [==================================================>]  6.144kB\nac7b6b272904: Layer already exists\n3b12aae5d4ca: Layer already exists\n5b1304247ae3: Layer already exists\n75e70aa52609: Layer already exists\ndda151859818: Layer already exists\nfbd2732ad777: Layer already exists\nba9de9d8475e: Layer already exists\n5905e8d02856: Pushed\ncb13bd9b95b6: Pushed\ncd38b8b25e3e62d05589ad6b4639e2e222086604: digest: sha256:af534ee896ce2ac80f3413318329e45e3b3e74b89eb337b9364b8ac1e83498b7 size: 2828\n\x1b[0mTag 'repo/reponame:abc123': \x1b[32mpushed\x1b[39m\x1b[0m\n\x1b[0mTag 'repo/reponame:master': \x1b[32mpushed\x1b[39m\x1b[0m\n\x1b[0mTag 'repo/reponame:latest': \x1b[32mpushed\x1b[39m\x1b[0m\n", out.String())
 	assert.Equal(t, "", eout.String())
 }
 
@@ -287,10 +408,11 @@ func TestPush_BrokenOutput(t *testing.T) {
 	cfg.CI.Gitlab.CICommit = "abc123"
 	cfg.CI.Gitlab.CIBranchName = "master"
 	cfg.Registry.Dockerhub.Repository = "repo"
-	exitCode := doPush(client, cfg, name, "Dockerfile", out, eout)
+	exitCode := doPush(client, cfg, name, "Dockerfile", nil, nil, &report.Report{}, out, eout)
 
 	assert.Equal(t, -7, exitCode)
-	assert.Equal(t, "Unable to parse response: Broken output, Error: invalid character 'B' looking for beginning of value\n\x1b[0m\x1b[31minvalid character 'B' looking for beginning of value\x1b[39m\x1b[0m\n", eout.String())
+	// Every tag is pushed even if some of them fail
+	assert.Equal(t, strings.Repeat("Unable to parse response: Broken output, Error: invalid character 'B' looking for beginning of value\n\x1b[0m\x1b[31minvalid character 'B' looking for beginning of value\x1b[39m\x1b[0m\n", 3), eout.String())
 }
 
 func TestPush_ErrorDetail(t *testing.T) {
@@ -306,11 +428,12 @@ func TestPush_ErrorDetail(t *testing.T) {
 	cfg.CI.Gitlab.CICommit = "abc123"
 	cfg.CI.Gitlab.CIBranchName = "master"
 	cfg.Registry.Dockerhub.Repository = "repo"
-	exitCode := doPush(client, cfg, name, "Dockerfile", out, eout)
+	exitCode := doPush(client, cfg, name, "Dockerfile", nil, nil, &report.Report{}, out, eout)
 
 	assert.Equal(t, -7, exitCode)
-	assert.Equal(t, "Logged in\n\x1b[0mPushing tag '\x1b[32mrepo/reponame:abc123\x1b[39m'\x1b[0m\n", out.String())
-	assert.Equal(t, "\x1b[0m\x1b[31merror details\x1b[39m\x1b[0m\n", eout.String())
+	assert.Equal(t, "Logged in\n\x1b[0mPushing tag '\x1b[32mrepo/reponame:abc123\x1b[39m'\x1b[0m\n\x1b[0mPushing tag '\x1b[32mrepo/reponame:master\x1b[39m'\x1b[0m\n\x1b[0mPushing tag '\x1b[32mrepo/reponame:latest\x1b[39m'\x1b[0m\n"+
+		"\x1b[0mTag 'repo/reponame:abc123': \x1b[31mfailed\x1b[39m\x1b[0m\n\x1b[0mTag 'repo/reponame:master': \x1b[31mfailed\x1b[39m\x1b[0m\n\x1b[0mTag 'repo/reponame:latest': \x1b[31mfailed\x1b[39m\x1b[0m\n", out.String())
+	assert.Equal(t, strings.Repeat("\x1b[0m\x1b[31merror details\x1b[39m\x1b[0m\n", 3), eout.String())
 }
 
 func TestPush_Create_Error(t *testing.T) {
@@ -327,7 +450,7 @@ func TestPush_Create_Error(t *testing.T) {
 	cfg.CI.Gitlab.CICommit = "abc123"
 	cfg.CI.Gitlab.CIBranchName = "master"
 	cfg.Registry.Dockerhub.Repository = "repo"
-	exitCode := doPush(client, cfg, name, "Dockerfile", out, eout)
+	exitCode := doPush(client, cfg, name, "Dockerfile", nil, nil, &report.Report{}, out, eout)
 
 	assert.Equal(t, -4, exitCode)
 	assert.Equal(t, "\x1b[0m\x1b[31mcreate error\x1b[39m\x1b[0m\n", eout.String())
@@ -347,7 +470,7 @@ func TestPush_UnreadableDockerfile(t *testing.T) {
 	cfg.CI.Gitlab.CICommit = "abc123"
 	cfg.CI.Gitlab.CIBranchName = "master"
 	cfg.Registry.Dockerhub.Repository = "repo"
-	exitCode := doPush(client, cfg, name, "Dockerfile", out, eout)
+	exitCode := doPush(client, cfg, name, "Dockerfile", nil, nil, &report.Report{}, out, eout)
 
 	assert.Equal(t, -5, exitCode)
 	assert.Equal(t, fmt.Sprintf("\x1b[0m\x1b[31mread %s: is a directory\x1b[39m\x1b[0m\n", dockerfile), eout.String())
@@ -380,7 +503,7 @@ func (m mockRegistry) Create(repository string) error {
 	return errors.New("create error")
 }
 
-func (m mockRegistry) PushImage(client docker.Client, auth, image string, out, eout io.Writer) error {
+func (m mockRegistry) PushImage(client docker.Client, auth, image string, out, eout io.Writer) (*registry.PushResult, error) {
 	panic("implement me")
 }
 
@@ -402,3 +525,250 @@ func (v no) Name() string {
 }
 
 var _ vcs.VCS = &no{}
+
+func TestPush_SkipUnchanged(t *testing.T) {
+	defer func() { _ = os.RemoveAll(name) }()
+	_ = os.MkdirAll(filepath.Join(name, "api"), 0777)
+	_ = os.MkdirAll(filepath.Join(name, "web"), 0777)
+	_ = file.Write(filepath.Join(name, "api"), "Dockerfile", "FROM scratch")
+	_ = file.Write(filepath.Join(name, "web"), "Dockerfile", "FROM scratch")
+	server := registry.NewMockRegistryServer()
+	defer server.Close()
+	digest := server.AddImage("api", "feature1", map[string]string{changes.RevisionLabel: "def456"})
+	server.AddImage("web", "feature1", map[string]string{changes.RevisionLabel: "def456"})
+
+	out := &bytes.Buffer{}
+	eout := &bytes.Buffer{}
+	pushOut := `{"status":"Push successful"}`
+	client := &docker.MockDocker{PushOutput: &pushOut}
+	cfg := config.InitEmptyConfig()
+	cfg.VCS.VCS = vcs.NewMockVcsWithChanges("web/main.go")
+	cfg.CI.Gitlab.CIBuildName = "reponame"
+	cfg.CI.Gitlab.CICommit = "abc123"
+	cfg.CI.Gitlab.CIBranchName = "feature1"
+	cfg.Registry.Dockerhub.Repository = server.Host()
+	cfg.Images = []config.Image{{Name: "api", Context: "api"}, {Name: "web", Context: "web"}}
+
+	exitCode := doPush(client, cfg, name, "Dockerfile", nil, &changes.Detector{}, &report.Report{}, out, eout)
+
+	assert.Equal(t, 0, exitCode)
+	assert.Equal(t, []string{server.Host() + "/web:abc123", server.Host() + "/web:feature1"}, client.Images)
+	assert.Equal(t, digest, server.Manifest("api", "abc123").Digest)
+	assert.Contains(t, out.String(), fmt.Sprintf("\x1b[0mImage \x1b[32mapi\x1b[39m unchanged since \x1b[32mdef456\x1b[39m, retagging \x1b[32m%s/api:feature1\x1b[39m\x1b[0m\n", server.Host()))
+	assert.Equal(t, "", eout.String())
+}
+
+func TestPush_SkipUnchangedRerunWithImmutableTags(t *testing.T) {
+	defer func() { _ = os.RemoveAll(name) }()
+	_ = file.Write(name, "Dockerfile", "FROM scratch")
+	server := registry.NewMockRegistryServer()
+	defer server.Close()
+	digest := server.AddImage("reponame", "feature1", map[string]string{changes.RevisionLabel: "def456"})
+	server.ImmutableTags = true
+
+	cfg := config.InitEmptyConfig()
+	cfg.VCS.VCS = vcs.NewMockVcsWithChanges()
+	cfg.CI.Gitlab.CIBuildName = "reponame"
+	cfg.CI.Gitlab.CICommit = "abc123"
+	cfg.CI.Gitlab.CIBranchName = "feature1"
+	cfg.Registry.Dockerhub.Repository = server.Host()
+
+	for i := 0; i < 2; i++ {
+		out := &bytes.Buffer{}
+		eout := &bytes.Buffer{}
+		exitCode := doPush(&docker.MockDocker{}, cfg, name, "Dockerfile", nil, &changes.Detector{}, &report.Report{}, out, eout)
+
+		assert.Equal(t, 0, exitCode)
+		assert.Equal(t, "", eout.String())
+		assert.Equal(t, digest, server.Manifest("reponame", "abc123").Digest)
+		assert.Contains(t, out.String(), fmt.Sprintf("\x1b[0mTag '\x1b[32m%s/reponame:feature1\x1b[39m' is \x1b[32mup to date\x1b[39m\x1b[0m\n", server.Host()))
+	}
+}
+
+func TestPush_Platforms(t *testing.T) {
+	defer func() { _ = os.RemoveAll(name) }()
+	_ = file.Write(name, "Dockerfile", "FROM scratch")
+	server := registry.NewMockRegistryServer()
+	defer server.Close()
+	amd64 := server.AddImage("reponame", "abc123-linux-amd64", nil)
+	arm64 := server.AddImage("reponame", "abc123-linux-arm64", nil)
+
+	out := &bytes.Buffer{}
+	eout := &bytes.Buffer{}
+	pushOut := `{"status":"Push successful"}`
+	client := &docker.MockDocker{PushOutput: &pushOut}
+	cfg := config.InitEmptyConfig()
+	cfg.CI.Gitlab.CIBuildName = "reponame"
+	cfg.CI.Gitlab.CICommit = "abc123"
+	cfg.CI.Gitlab.CIBranchName = "feature1"
+	cfg.Registry.Dockerhub.Repository = server.Host()
+	cfg.Build.Platforms = []string{"linux/amd64", "linux/arm64"}
+
+	exitCode := doPush(client, cfg, name, "Dockerfile", nil, nil, &report.Report{}, out, eout)
+
+	assert.Equal(t, 0, exitCode)
+	assert.Equal(t, "", eout.String())
+	assert.Equal(t, []string{server.Host() + "/reponame:abc123-linux-amd64", server.Host() + "/reponame:abc123-linux-arm64"}, client.Images)
+	assert.Contains(t, out.String(), fmt.Sprintf("\x1b[0mPlatform \x1b[32mlinux/amd64\x1b[39m digest \x1b[32m%s\x1b[39m\x1b[0m\n", amd64))
+	assert.Contains(t, out.String(), fmt.Sprintf("\x1b[0mPlatform \x1b[32mlinux/arm64\x1b[39m digest \x1b[32m%s\x1b[39m\x1b[0m\n", arm64))
+	list := server.Manifest("reponame", "feature1")
+	assert.Equal(t, registry.MediaTypeManifestList, list.MediaType)
+	assert.Equal(t, list.Digest, server.Manifest("reponame", "abc123").Digest)
+	assert.Contains(t, string(list.Content), amd64)
+	assert.Contains(t, string(list.Content), arm64)
+}
+
+func TestPush_PlatformsRerunWithImmutableTags(t *testing.T) {
+	defer func() { _ = os.RemoveAll(name) }()
+	_ = file.Write(name, "Dockerfile", "FROM scratch")
+	server := registry.NewMockRegistryServer()
+	defer server.Close()
+	server.AddImage("reponame", "abc123-linux-amd64", nil)
+	server.AddImage("reponame", "abc123-linux-arm64", nil)
+	server.ImmutableTags = true
+
+	pushOut := `{"status":"Push successful"}`
+	cfg := config.InitEmptyConfig()
+	cfg.CI.Gitlab.CIBuildName = "reponame"
+	cfg.CI.Gitlab.CICommit = "abc123"
+	cfg.CI.Gitlab.CIBranchName = "feature1"
+	cfg.Registry.Dockerhub.Repository = server.Host()
+	cfg.Build.Platforms = []string{"linux/amd64", "linux/arm64"}
+
+	exitCode := doPush(&docker.MockDocker{PushOutput: &pushOut}, cfg, name, "Dockerfile", nil, nil, &report.Report{}, &bytes.Buffer{}, &bytes.Buffer{})
+	assert.Equal(t, 0, exitCode)
+	list := server.Manifest("reponame", "feature1")
+
+	out := &bytes.Buffer{}
+	eout := &bytes.Buffer{}
+	exitCode = doPush(&docker.MockDocker{PushOutput: &pushOut}, cfg, name, "Dockerfile", nil, nil, &report.Report{}, out, eout)
+
+	assert.Equal(t, 0, exitCode)
+	assert.Equal(t, "", eout.String())
+	assert.Equal(t, list, server.Manifest("reponame", "feature1"))
+	assert.Contains(t, out.String(), fmt.Sprintf("\x1b[0mTag '\x1b[32m%s/reponame:abc123\x1b[39m' is \x1b[32mup to date\x1b[39m\x1b[0m\n", server.Host()))
+	assert.Contains(t, out.String(), fmt.Sprintf("\x1b[0mTag '\x1b[32m%s/reponame:feature1\x1b[39m' is \x1b[32mup to date\x1b[39m\x1b[0m\n", server.Host()))
+	assert.NotContains(t, out.String(), "Pushing manifest list")
+}
+
+func TestPush_PlatformMissingInRegistry(t *testing.T) {
+	defer func() { _ = os.RemoveAll(name) }()
+	_ = file.Write(name, "Dockerfile", "FROM scratch")
+	server := registry.NewMockRegistryServer()
+	defer server.Close()
+
+	out := &bytes.Buffer{}
+	eout := &bytes.Buffer{}
+	pushOut := `{"status":"Push successful"}`
+	client := &docker.MockDocker{PushOutput: &pushOut}
+	cfg := config.InitEmptyConfig()
+	cfg.CI.Gitlab.CIBuildName = "reponame"
+	cfg.CI.Gitlab.CICommit = "abc123"
+	cfg.CI.Gitlab.CIBranchName = "feature1"
+	cfg.Registry.Dockerhub.Repository = server.Host()
+	cfg.Build.Platforms = []string{"linux/amd64"}
+
+	exitCode := doPush(client, cfg, name, "Dockerfile", nil, nil, &report.Report{}, out, eout)
+
+	assert.Equal(t, -7, exitCode)
+	assert.Equal(t, fmt.Sprintf("\x1b[0m\x1b[31munable to fetch manifest for %s/reponame:abc123-linux-amd64: not found\x1b[39m\x1b[0m\n", server.Host()), eout.String())
+}
+
+func TestPush_MultipleRegistries(t *testing.T) {
+	defer func() { _ = os.RemoveAll(name) }()
+	_ = file.Write(name, "Dockerfile", "FROM scratch")
+
+	out := &bytes.Buffer{}
+	eout := &bytes.Buffer{}
+	pushOut := `{"status":"Push successful"}`
+	client := &docker.MockDocker{PushOutput: &pushOut}
+	cfg := config.InitEmptyConfig()
+	cfg.CI.Gitlab.CIBuildName = "reponame"
+	cfg.CI.Gitlab.CICommit = "abc123"
+	cfg.CI.Gitlab.CIBranchName = "feature1"
+	cfg.Registry.Dockerhub.Repository = "repo"
+	cfg.Registry.Quay.Repository = "org"
+	cfg.Registry.Targets = []string{"quay", "dockerhub"}
+	pushReport := &report.Report{}
+
+	exitCode := doPush(client, cfg, name, "Dockerfile", nil, nil, pushReport, out, eout)
+
+	assert.Equal(t, 0, exitCode)
+	assert.Equal(t, "", eout.String())
+	assert.Equal(t, []string{"quay.io/org/reponame:abc123", "quay.io/org/reponame:feature1", "repo/reponame:abc123", "repo/reponame:feature1"}, client.Images)
+	assert.Equal(t, 2, len(pushReport.Images))
+	assert.Equal(t, "Quay.io", pushReport.Images[0].Registry)
+	assert.Equal(t, "Dockerhub", pushReport.Images[1].Registry)
+	assert.Contains(t, out.String(), "\x1b[0mRegistry \x1b[32mQuay.io\x1b[39m: \x1b[32mpushed\x1b[39m\x1b[0m\n")
+	assert.Contains(t, out.String(), "\x1b[0mRegistry \x1b[32mDockerhub\x1b[39m: \x1b[32mpushed\x1b[39m\x1b[0m\n")
+}
+
+func TestPush_MultipleRegistriesOneFailing(t *testing.T) {
+	defer func() { _ = os.RemoveAll(name) }()
+	_ = file.Write(name, "Dockerfile", "FROM scratch")
+	server := registry.NewMockRegistryServer()
+	defer server.Close()
+	server.AddImage("reponame", "abc123-linux-amd64", nil)
+	server.AddImage("reponame", "abc123-linux-arm64", nil)
+
+	out := &bytes.Buffer{}
+	eout := &bytes.Buffer{}
+	pushOut := `{"status":"Push successful"}`
+	client := &docker.MockDocker{PushOutput: &pushOut}
+	cfg := config.InitEmptyConfig()
+	cfg.CI.Gitlab.CIBuildName = "reponame"
+	cfg.CI.Gitlab.CICommit = "abc123"
+	cfg.CI.Gitlab.CIBranchName = "feature1"
+	cfg.Registry.Gitlab.Repository = "127.0.0.1:1/group/project"
+	cfg.Registry.Dockerhub.Repository = server.Host()
+	cfg.Registry.Targets = []string{"gitlab", "dockerhub"}
+	cfg.Build.Platforms = []string{"linux/amd64", "linux/arm64"}
+
+	exitCode := doPush(client, cfg, name, "Dockerfile", nil, nil, &report.Report{}, out, eout)
+
+	assert.Equal(t, -7, exitCode)
+	assert.Contains(t, eout.String(), "unable to fetch manifest for 127.0.0.1:1/group/reponame:abc123-linux-amd64")
+	assert.Equal(t, registry.MediaTypeManifestList, server.Manifest("reponame", "feature1").MediaType)
+	assert.Contains(t, out.String(), "\x1b[0mRegistry \x1b[32mGitlab\x1b[39m: \x1b[31mfailed with code -7\x1b[39m\x1b[0m\n")
+	assert.Contains(t, out.String(), "\x1b[0mRegistry \x1b[32mDockerhub\x1b[39m: \x1b[32mpushed\x1b[39m\x1b[0m\n")
+}
+
+func TestPush_UnknownRegistry(t *testing.T) {
+	defer func() { _ = os.RemoveAll(name) }()
+
+	out := &bytes.Buffer{}
+	eout := &bytes.Buffer{}
+	cfg := config.InitEmptyConfig()
+	cfg.Registry.Targets = []string{"acme"}
+
+	exitCode := doPush(&docker.MockDocker{}, cfg, name, "Dockerfile", nil, nil, &report.Report{}, out, eout)
+
+	assert.Equal(t, -13, exitCode)
+	assert.Equal(t, "\x1b[0m\x1b[31munknown registry 'acme'\x1b[39m\x1b[0m\n", eout.String())
+}
+
+func TestPush_Report(t *testing.T) {
+	defer func() { _ = os.RemoveAll(name) }()
+	_ = file.Write(name, "Dockerfile", "FROM scratch as build\nFROM scratch\nCOPY --from=build file .")
+
+	out := &bytes.Buffer{}
+	eout := &bytes.Buffer{}
+	pushOut := `{"status":"abc123: digest: sha256:aaa size: 528"}
+{"progressDetail":{},"aux":{"Tag":"abc123","Digest":"sha256:aaa","Size":528}}`
+	client := &docker.MockDocker{PushOutput: &pushOut}
+	cfg := config.InitEmptyConfig()
+	cfg.CI.Gitlab.CIBuildName = "reponame"
+	cfg.CI.Gitlab.CICommit = "abc123"
+	cfg.CI.Gitlab.CIBranchName = "feature1"
+	cfg.Registry.Dockerhub.Repository = "repo"
+	pushReport := &report.Report{}
+
+	exitCode := doPush(client, cfg, name, "Dockerfile", nil, nil, pushReport, out, eout)
+
+	assert.Equal(t, 0, exitCode)
+	assert.Equal(t, 1, len(pushReport.Images))
+	assert.Equal(t, "reponame", pushReport.Images[0].Name)
+	assert.Equal(t, []string{"build"}, pushReport.Images[0].Stages)
+	assert.Equal(t, []string{"repo/reponame:build", "repo/reponame:abc123", "repo/reponame:feature1"}, pushReport.Images[0].Tags)
+	assert.Equal(t, report.Pushed{Tag: "repo/reponame:abc123", Digest: "sha256:aaa", Size: 528}, pushReport.Images[0].Pushed[1])
+}
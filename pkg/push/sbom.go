@@ -0,0 +1,50 @@
+package push
+
+import (
+	"fmt"
+	"github.com/liamg/tml"
+	"github.com/sparetimecoders/build-tools/pkg/config"
+	"github.com/sparetimecoders/build-tools/pkg/docker"
+	"github.com/sparetimecoders/build-tools/pkg/registry"
+	"github.com/sparetimecoders/build-tools/pkg/report"
+	"github.com/sparetimecoders/build-tools/pkg/sbom"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// attachSBOMs attaches the SBOMs written by build to the pushed platform variants of image
+func attachSBOMs(api *registry.API, cfg *config.Config, dir, registryUrl string, image config.Image, platforms, imageTags []string, entry *report.Image, out io.Writer) error {
+	if len(imageTags) == 0 {
+		return nil
+	}
+	sbomDir := cfg.Build.SBOMDirectory(dir)
+	for _, platform := range platforms {
+		file := filepath.Join(sbomDir, sbom.FileName(image.Name, platform))
+		content, err := ioutil.ReadFile(file)
+		if os.IsNotExist(err) {
+			if len(cfg.Build.SBOM) > 0 {
+				_, _ = fmt.Fprintln(out, tml.Sprintf("<yellow>No SBOM found for image %s at %s, not attaching it</yellow>", docker.PlatformTag(image.Name, platform), file))
+			}
+			continue
+		} else if err != nil {
+			return err
+		}
+		ref, err := registry.ParseReference(docker.Tag(registryUrl, image.Name, docker.PlatformTag(imageTags[0], platform)))
+		if err != nil {
+			return err
+		}
+		digest, err := api.ManifestDigest(ref)
+		if err != nil {
+			return fmt.Errorf("unable to fetch digest for %s: %v", ref, err)
+		}
+		attached, err := sbom.Attach(api, ref.WithDigest(digest), content)
+		if err != nil {
+			return err
+		}
+		_, _ = fmt.Fprintln(out, tml.Sprintf("Attached SBOM '<green>%s</green>' to '<green>%s</green>'", attached, ref))
+		entry.SBOMs = append(entry.SBOMs, attached.String())
+	}
+	return nil
+}
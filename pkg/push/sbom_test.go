@@ -0,0 +1,115 @@
+package push
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/sparetimecoders/build-tools/pkg/docker"
+	"github.com/sparetimecoders/build-tools/pkg/file"
+	"github.com/sparetimecoders/build-tools/pkg/registry"
+	"github.com/sparetimecoders/build-tools/pkg/report"
+	"github.com/sparetimecoders/build-tools/pkg/sbom"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeSBOM(t *testing.T, dir, name string) []byte {
+	bom := &sbom.SBOM{Image: "reponame", Packages: []sbom.Package{{Name: "musl", Version: "1.2.3", Type: sbom.TypeApk}}}
+	content, err := bom.Encode(sbom.FormatCycloneDX)
+	assert.NoError(t, err)
+	assert.NoError(t, os.MkdirAll(dir, 0777))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, name), content, 0666))
+	return content
+}
+
+func TestPush_AttachSBOM(t *testing.T) {
+	defer func() { _ = os.RemoveAll(name) }()
+	_ = file.Write(name, "Dockerfile", "FROM scratch")
+	content := writeSBOM(t, filepath.Join(name, "sbom"), "reponame.json")
+	server := registry.NewMockRegistryServer()
+	defer server.Close()
+	digest := server.AddImage("reponame", "abc123", nil)
+
+	out := &bytes.Buffer{}
+	eout := &bytes.Buffer{}
+	pushOut := `{"status":"Push successful"}`
+	cfg := pushConfig("feature1")
+	cfg.Registry.Dockerhub.Repository = server.Host()
+	pushReport := &report.Report{}
+
+	exitCode := doPush(&docker.MockDocker{PushOutput: &pushOut}, cfg, name, "Dockerfile", nil, nil, pushReport, out, eout)
+
+	assert.Equal(t, 0, exitCode)
+	assert.Equal(t, "", eout.String())
+	attached := fmt.Sprintf("%s/reponame:%s", server.Host(), sbom.Tag(digest))
+	assert.Contains(t, out.String(), fmt.Sprintf("\x1b[0mAttached SBOM '\x1b[32m%s\x1b[39m' to '\x1b[32m%s/reponame:abc123\x1b[39m'\x1b[0m\n", attached, server.Host()))
+	assert.Equal(t, []string{attached}, pushReport.Images[0].SBOMs)
+	assert.NotNil(t, server.Manifest("reponame", sbom.Tag(digest)))
+	assert.Equal(t, content, server.Blobs["reponame@"+registry.Digest(content)])
+}
+
+func TestPush_AttachSBOMPlatforms(t *testing.T) {
+	defer func() { _ = os.RemoveAll(name) }()
+	_ = file.Write(name, "Dockerfile", "FROM scratch")
+	writeSBOM(t, filepath.Join(name, "target"), "reponame-linux-amd64.json")
+	server := registry.NewMockRegistryServer()
+	defer server.Close()
+	amd64 := server.AddImage("reponame", "abc123-linux-amd64", nil)
+	arm64 := server.AddImage("reponame", "abc123-linux-arm64", nil)
+
+	out := &bytes.Buffer{}
+	eout := &bytes.Buffer{}
+	pushOut := `{"status":"Push successful"}`
+	cfg := pushConfig("feature1")
+	cfg.Registry.Dockerhub.Repository = server.Host()
+	cfg.Build.Platforms = []string{"linux/amd64", "linux/arm64"}
+	cfg.Build.SBOM = "cyclonedx"
+	cfg.Build.SBOMDir = "target"
+
+	exitCode := doPush(&docker.MockDocker{PushOutput: &pushOut}, cfg, name, "Dockerfile", nil, nil, &report.Report{}, out, eout)
+
+	assert.Equal(t, 0, exitCode)
+	assert.Equal(t, "", eout.String())
+	assert.NotNil(t, server.Manifest("reponame", sbom.Tag(amd64)))
+	assert.Nil(t, server.Manifest("reponame", sbom.Tag(arm64)))
+	assert.Contains(t, out.String(), fmt.Sprintf("\x1b[0m\x1b[33mNo SBOM found for image reponame-linux-arm64 at %s, not attaching it\x1b[39m\x1b[0m\n", filepath.Join(name, "target", "reponame-linux-arm64.json")))
+}
+
+func TestPush_NoSBOMConfigured(t *testing.T) {
+	defer func() { _ = os.RemoveAll(name) }()
+	_ = file.Write(name, "Dockerfile", "FROM scratch")
+	server := registry.NewMockRegistryServer()
+	defer server.Close()
+	digest := server.AddImage("reponame", "abc123", nil)
+
+	out := &bytes.Buffer{}
+	pushOut := `{"status":"Push successful"}`
+	cfg := pushConfig("feature1")
+	cfg.Registry.Dockerhub.Repository = server.Host()
+
+	exitCode := doPush(&docker.MockDocker{PushOutput: &pushOut}, cfg, name, "Dockerfile", nil, nil, &report.Report{}, out, &bytes.Buffer{})
+
+	assert.Equal(t, 0, exitCode)
+	assert.NotContains(t, out.String(), "SBOM")
+	assert.Nil(t, server.Manifest("reponame", sbom.Tag(digest)))
+}
+
+func TestPush_AttachSBOMImageMissing(t *testing.T) {
+	defer func() { _ = os.RemoveAll(name) }()
+	_ = file.Write(name, "Dockerfile", "FROM scratch")
+	writeSBOM(t, filepath.Join(name, "sbom"), "reponame.json")
+	server := registry.NewMockRegistryServer()
+	defer server.Close()
+
+	eout := &bytes.Buffer{}
+	pushOut := `{"status":"Push successful"}`
+	cfg := pushConfig("feature1")
+	cfg.Registry.Dockerhub.Repository = server.Host()
+
+	exitCode := doPush(&docker.MockDocker{PushOutput: &pushOut}, cfg, name, "Dockerfile", nil, nil, &report.Report{}, &bytes.Buffer{}, eout)
+
+	assert.Equal(t, -16, exitCode)
+	assert.Contains(t, eout.String(), fmt.Sprintf("unable to fetch digest for %s/reponame:abc123: not found", server.Host()))
+}
@@ -0,0 +1,120 @@
+package push
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/sparetimecoders/build-tools/pkg/docker"
+	"github.com/sparetimecoders/build-tools/pkg/file"
+	"github.com/sparetimecoders/build-tools/pkg/registry"
+	"github.com/sparetimecoders/build-tools/pkg/report"
+	"github.com/sparetimecoders/build-tools/pkg/sign"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPush_Sign(t *testing.T) {
+	defer func() { _ = os.RemoveAll(name) }()
+	_ = file.Write(name, "Dockerfile", "FROM scratch")
+	server := registry.NewMockRegistryServer()
+	defer server.Close()
+	commitDigest := server.AddImage("reponame", "abc123", nil)
+	branchDigest := server.AddImage("reponame", "feature1", nil)
+	key := signingKey(name)
+
+	out := &bytes.Buffer{}
+	eout := &bytes.Buffer{}
+	pushOut := `{"status":"Push successful"}`
+	cfg := pushConfig("feature1")
+	cfg.Registry.Dockerhub.Repository = server.Host()
+	cfg.Signing.Key = filepath.Join(name, "cosign.key")
+	pushReport := &report.Report{}
+
+	exitCode := doPush(&docker.MockDocker{PushOutput: &pushOut}, cfg, name, "Dockerfile", nil, nil, pushReport, out, eout)
+
+	assert.Equal(t, 0, exitCode)
+	assert.Equal(t, "", eout.String())
+	image := server.Host() + "/reponame"
+	assert.Contains(t, out.String(), fmt.Sprintf("\x1b[0mSigned '\x1b[32m%s@%s\x1b[39m'\x1b[0m\n\x1b[0mSigned '\x1b[32m%s@%s\x1b[39m'\x1b[0m\n", image, commitDigest, image, branchDigest))
+	assert.Equal(t, []string{commitDigest, branchDigest}, pushReport.Images[0].Signed)
+	ref, _ := registry.ParseReference(image + ":abc123")
+	verified, err := sign.Verify(registry.NewAPI(""), ref, &key.PublicKey)
+	assert.NoError(t, err)
+	assert.Equal(t, commitDigest, verified)
+}
+
+func TestPush_SignSameManifestOnce(t *testing.T) {
+	defer func() { _ = os.RemoveAll(name) }()
+	_ = file.Write(name, "Dockerfile", "FROM scratch")
+	server := registry.NewMockRegistryServer()
+	defer server.Close()
+	digest := server.AddImage("reponame", "abc123", nil)
+	server.Manifests["reponame:feature1"] = server.Manifest("reponame", "abc123")
+	signingKey(name)
+
+	out := &bytes.Buffer{}
+	pushOut := `{"status":"Push successful"}`
+	cfg := pushConfig("feature1")
+	cfg.Registry.Dockerhub.Repository = server.Host()
+	cfg.Signing.Key = filepath.Join(name, "cosign.key")
+	pushReport := &report.Report{}
+
+	exitCode := doPush(&docker.MockDocker{PushOutput: &pushOut}, cfg, name, "Dockerfile", nil, nil, pushReport, out, &bytes.Buffer{})
+	assert.Equal(t, 0, exitCode)
+	assert.Equal(t, []string{digest}, pushReport.Images[0].Signed)
+
+	out.Reset()
+	exitCode = doPush(&docker.MockDocker{PushOutput: &pushOut}, cfg, name, "Dockerfile", nil, nil, &report.Report{}, out, &bytes.Buffer{})
+	assert.Equal(t, 0, exitCode)
+	assert.Contains(t, out.String(), fmt.Sprintf("\x1b[0m'\x1b[32m%s/reponame@%s\x1b[39m' is \x1b[32malready signed\x1b[39m\x1b[0m\n", server.Host(), digest))
+}
+
+func TestPush_SigningKeyMissing(t *testing.T) {
+	defer func() { _ = os.RemoveAll(name) }()
+	_ = file.Write(name, "Dockerfile", "FROM scratch")
+
+	eout := &bytes.Buffer{}
+	client := &docker.MockDocker{}
+	cfg := pushConfig("feature1")
+	cfg.Signing.Key = "missing.key"
+
+	exitCode := doPush(client, cfg, name, "Dockerfile", nil, nil, &report.Report{}, &bytes.Buffer{}, eout)
+
+	assert.Equal(t, -15, exitCode)
+	assert.Equal(t, "\x1b[0m\x1b[31munable to read key: open missing.key: no such file or directory\x1b[39m\x1b[0m\n", eout.String())
+	assert.Equal(t, 0, client.PushCount)
+}
+
+func TestPush_SignImageMissingInRegistry(t *testing.T) {
+	defer func() { _ = os.RemoveAll(name) }()
+	_ = file.Write(name, "Dockerfile", "FROM scratch")
+	server := registry.NewMockRegistryServer()
+	defer server.Close()
+	signingKey(name)
+
+	eout := &bytes.Buffer{}
+	pushOut := `{"status":"Push successful"}`
+	cfg := pushConfig("feature1")
+	cfg.Registry.Dockerhub.Repository = server.Host()
+	cfg.Signing.Key = filepath.Join(name, "cosign.key")
+
+	exitCode := doPush(&docker.MockDocker{PushOutput: &pushOut}, cfg, name, "Dockerfile", nil, nil, &report.Report{}, &bytes.Buffer{}, eout)
+
+	assert.Equal(t, -15, exitCode)
+	assert.Equal(t, fmt.Sprintf("\x1b[0m\x1b[31munable to fetch digest for %s/reponame:abc123: not found\x1b[39m\x1b[0m\n", server.Host()), eout.String())
+}
+
+// signingKey writes a new unencrypted private key to dir/cosign.key
+func signingKey(dir string) *ecdsa.PrivateKey {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	der, _ := x509.MarshalPKCS8PrivateKey(key)
+	_ = ioutil.WriteFile(filepath.Join(dir, "cosign.key"), pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600)
+	return key
+}
@@ -0,0 +1,125 @@
+package push
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/cenkalti/backoff"
+	"github.com/liamg/tml"
+	"github.com/sparetimecoders/build-tools/pkg/config"
+	"github.com/sparetimecoders/build-tools/pkg/docker"
+	"github.com/sparetimecoders/build-tools/pkg/registry"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// transientErrors are (lower case) parts of error messages for failures worth retrying
+var transientErrors = []string{
+	"500 internal server error",
+	"502 bad gateway",
+	"503 service unavailable",
+	"504 gateway timeout",
+	"429 too many requests",
+	"toomanyrequests",
+	"too many requests",
+	"throttl",
+	"rate exceeded",
+	"connection reset",
+	"connection refused",
+	"broken pipe",
+	"i/o timeout",
+	"tls handshake timeout",
+	"unexpected eof",
+}
+
+// tagResult is the outcome of pushing a single tag
+type tagResult struct {
+	tag    string
+	result *registry.PushResult
+	err    error
+}
+
+// pushTags pushes the tags, retrying transient failures. Every tag is pushed even if some of them fail.
+// The results are returned in the same order as the tags
+func pushTags(client docker.Client, currentRegistry registry.Registry, auth string, tags []string, settings *config.PushConfig, out, eout io.Writer) ([]*tagResult, error) {
+	delay, err := settings.InitialDelay()
+	if err != nil {
+		return nil, err
+	}
+	retries := settings.MaxRetries()
+	results := make([]*tagResult, len(tags))
+	parallel := settings.Concurrency()
+	if parallel == 1 || len(tags) < 2 {
+		for i, tag := range tags {
+			results[i] = pushTag(client, currentRegistry, auth, tag, retries, delay, out, eout)
+		}
+		return results, nil
+	}
+
+	// The output of each tag is buffered and written in the order of the tags when all pushes are done
+	outputs := make([]*bytes.Buffer, len(tags))
+	errOutputs := make([]*bytes.Buffer, len(tags))
+	slots := make(chan struct{}, parallel)
+	wg := sync.WaitGroup{}
+	for i, tag := range tags {
+		outputs[i] = &bytes.Buffer{}
+		errOutputs[i] = &bytes.Buffer{}
+		wg.Add(1)
+		go func(i int, tag string) {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+			results[i] = pushTag(client, currentRegistry, auth, tag, retries, delay, outputs[i], errOutputs[i])
+		}(i, tag)
+	}
+	wg.Wait()
+	for i := range tags {
+		_, _ = out.Write(outputs[i].Bytes())
+		_, _ = eout.Write(errOutputs[i].Bytes())
+	}
+	return results, nil
+}
+
+// pushTag pushes a single tag, retrying with exponential backoff if the push fails with a transient error
+func pushTag(client docker.Client, currentRegistry registry.Registry, auth, tag string, retries int, delay time.Duration, out, eout io.Writer) *tagResult {
+	_, _ = fmt.Fprintln(out, tml.Sprintf("Pushing tag '<green>%s</green>'", tag))
+	policy := backoff.NewExponentialBackOff()
+	policy.InitialInterval = delay
+	// The number of retries limits the attempts, not the elapsed time
+	policy.MaxElapsedTime = 0
+
+	result := &tagResult{tag: tag}
+	operation := func() error {
+		pushed, err := currentRegistry.PushImage(client, auth, tag, out, eout)
+		if err != nil && !transient(err) {
+			return backoff.Permanent(err)
+		}
+		result.result = pushed
+		return err
+	}
+	notify := func(err error, wait time.Duration) {
+		_, _ = fmt.Fprintln(out, tml.Sprintf("<yellow>Pushing tag '%s' failed: %s, retrying in %s</yellow>", tag, err.Error(), wait.Round(time.Millisecond)))
+	}
+	// WithMaxRetries doesn't limit the number of retries when given 0
+	var retryPolicy backoff.BackOff = &backoff.StopBackOff{}
+	if retries > 0 {
+		retryPolicy = backoff.WithMaxRetries(policy, uint64(retries))
+	}
+	if err := backoff.RetryNotify(operation, retryPolicy, notify); err != nil {
+		_, _ = fmt.Fprintln(eout, tml.Sprintf("<red>%s</red>", err.Error()))
+		result.err = err
+	}
+	return result
+}
+
+// transient returns true if err is likely to be resolved by trying again
+func transient(err error) bool {
+	message := strings.ToLower(err.Error())
+	for _, part := range transientErrors {
+		if strings.Contains(message, part) {
+			return true
+		}
+	}
+	return strings.HasSuffix(message, ": eof") || message == "eof"
+}
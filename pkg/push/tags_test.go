@@ -0,0 +1,232 @@
+package push
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/sparetimecoders/build-tools/pkg/config"
+	"github.com/sparetimecoders/build-tools/pkg/docker"
+	"github.com/sparetimecoders/build-tools/pkg/file"
+	"github.com/sparetimecoders/build-tools/pkg/registry"
+	"github.com/sparetimecoders/build-tools/pkg/report"
+	"os"
+	"testing"
+)
+
+func TestPush_RetryTransientError(t *testing.T) {
+	defer func() { _ = os.RemoveAll(name) }()
+	_ = file.Write(name, "Dockerfile", "FROM scratch")
+
+	out := &bytes.Buffer{}
+	eout := &bytes.Buffer{}
+	pushOut := `{"status":"Push successful"}`
+	client := &docker.MockDocker{PushOutput: &pushOut, PushErrors: []error{
+		fmt.Errorf("received unexpected HTTP status: 502 Bad Gateway"),
+		fmt.Errorf("read tcp 10.0.0.1:443: read: connection reset by peer"),
+	}}
+	cfg := pushConfig("feature1")
+	pushReport := &report.Report{}
+
+	exitCode := doPush(client, cfg, name, "Dockerfile", nil, nil, pushReport, out, eout)
+
+	assert.Equal(t, 0, exitCode)
+	assert.Equal(t, "", eout.String())
+	assert.Equal(t, []string{"repo/reponame:abc123", "repo/reponame:abc123", "repo/reponame:abc123", "repo/reponame:feature1"}, client.Images)
+	assert.Contains(t, out.String(), "\x1b[0m\x1b[33mPushing tag 'repo/reponame:abc123' failed: received unexpected HTTP status: 502 Bad Gateway, retrying in ")
+	assert.Contains(t, out.String(), "\x1b[0m\x1b[33mPushing tag 'repo/reponame:abc123' failed: read tcp 10.0.0.1:443: read: connection reset by peer, retrying in ")
+	assert.Equal(t, []string{"repo/reponame:abc123", "repo/reponame:feature1"}, pushReport.Images[0].Tags)
+}
+
+func TestPush_RetriesExhausted(t *testing.T) {
+	defer func() { _ = os.RemoveAll(name) }()
+	_ = file.Write(name, "Dockerfile", "FROM scratch")
+
+	out := &bytes.Buffer{}
+	eout := &bytes.Buffer{}
+	client := &docker.MockDocker{PushError: fmt.Errorf("toomanyrequests: Rate exceeded")}
+	cfg := pushConfig("feature1")
+	cfg.Push.Retries = 2
+
+	exitCode := doPush(client, cfg, name, "Dockerfile", nil, nil, &report.Report{}, out, eout)
+
+	assert.Equal(t, -7, exitCode)
+	assert.Equal(t, 6, client.PushCount)
+	assert.Equal(t, "\x1b[0m\x1b[31mtoomanyrequests: Rate exceeded\x1b[39m\x1b[0m\n\x1b[0m\x1b[31mtoomanyrequests: Rate exceeded\x1b[39m\x1b[0m\n", eout.String())
+	assert.Contains(t, out.String(), "\x1b[0mTag 'repo/reponame:abc123': \x1b[31mfailed\x1b[39m\x1b[0m\n\x1b[0mTag 'repo/reponame:feature1': \x1b[31mfailed\x1b[39m\x1b[0m\n")
+}
+
+func TestPush_NoRetryForPermanentError(t *testing.T) {
+	defer func() { _ = os.RemoveAll(name) }()
+	_ = file.Write(name, "Dockerfile", "FROM scratch")
+
+	out := &bytes.Buffer{}
+	eout := &bytes.Buffer{}
+	pushOut := `{"status":"Push successful"}`
+	client := &docker.MockDocker{PushOutput: &pushOut, PushErrors: []error{fmt.Errorf("denied: requested access to the resource is denied")}}
+	cfg := pushConfig("feature1")
+	pushReport := &report.Report{}
+
+	exitCode := doPush(client, cfg, name, "Dockerfile", nil, nil, pushReport, out, eout)
+
+	assert.Equal(t, -7, exitCode)
+	assert.Equal(t, []string{"repo/reponame:abc123", "repo/reponame:feature1"}, client.Images)
+	assert.NotContains(t, out.String(), "retrying")
+	assert.Equal(t, "\x1b[0m\x1b[31mdenied: requested access to the resource is denied\x1b[39m\x1b[0m\n", eout.String())
+	assert.Contains(t, out.String(), "\x1b[0mTag 'repo/reponame:abc123': \x1b[31mfailed\x1b[39m\x1b[0m\n\x1b[0mTag 'repo/reponame:feature1': \x1b[32mpushed\x1b[39m\x1b[0m\n")
+}
+
+func TestPush_RetriesDisabled(t *testing.T) {
+	defer func() { _ = os.RemoveAll(name) }()
+	_ = file.Write(name, "Dockerfile", "FROM scratch")
+
+	client := &docker.MockDocker{PushError: fmt.Errorf("received unexpected HTTP status: 503 Service Unavailable")}
+	cfg := pushConfig("feature1")
+	cfg.Push.Retries = -1
+
+	exitCode := doPush(client, cfg, name, "Dockerfile", nil, nil, &report.Report{}, &bytes.Buffer{}, &bytes.Buffer{})
+
+	assert.Equal(t, -7, exitCode)
+	assert.Equal(t, 2, client.PushCount)
+}
+
+func TestPush_Parallel(t *testing.T) {
+	defer func() { _ = os.RemoveAll(name) }()
+	_ = file.Write(name, "Dockerfile", "FROM scratch")
+
+	out := &bytes.Buffer{}
+	eout := &bytes.Buffer{}
+	pushOut := `{"status":"Push successful"}`
+	client := &docker.MockDocker{PushOutput: &pushOut}
+	cfg := pushConfig("master")
+	cfg.Push.Parallel = 2
+	pushReport := &report.Report{}
+
+	exitCode := doPush(client, cfg, name, "Dockerfile", nil, nil, pushReport, out, eout)
+
+	assert.Equal(t, 0, exitCode)
+	assert.Equal(t, "", eout.String())
+	assert.ElementsMatch(t, []string{"repo/reponame:abc123", "repo/reponame:master", "repo/reponame:latest"}, client.Images)
+	assert.Equal(t, "Logged in\n\x1b[0mPushing tag '\x1b[32mrepo/reponame:abc123\x1b[39m'\x1b[0m\nPush successful\n\x1b[0mPushing tag '\x1b[32mrepo/reponame:master\x1b[39m'\x1b[0m\nPush successful\n\x1b[0mPushing tag '\x1b[32mrepo/reponame:latest\x1b[39m'\x1b[0m\nPush successful\n\x1b[0mTag 'repo/reponame:abc123': \x1b[32mpushed\x1b[39m\x1b[0m\n\x1b[0mTag 'repo/reponame:master': \x1b[32mpushed\x1b[39m\x1b[0m\n\x1b[0mTag 'repo/reponame:latest': \x1b[32mpushed\x1b[39m\x1b[0m\n", out.String())
+	assert.Equal(t, []string{"repo/reponame:abc123", "repo/reponame:master", "repo/reponame:latest"}, pushReport.Images[0].Tags)
+}
+
+func TestPush_InvalidRetryDelay(t *testing.T) {
+	defer func() { _ = os.RemoveAll(name) }()
+	_ = file.Write(name, "Dockerfile", "FROM scratch")
+
+	eout := &bytes.Buffer{}
+	client := &docker.MockDocker{}
+	cfg := pushConfig("feature1")
+	cfg.Push.RetryDelay = "soon"
+
+	exitCode := doPush(client, cfg, name, "Dockerfile", nil, nil, &report.Report{}, &bytes.Buffer{}, eout)
+
+	assert.Equal(t, -14, exitCode)
+	assert.Equal(t, "\x1b[0m\x1b[31minvalid push retry delay 'soon'\x1b[39m\x1b[0m\n", eout.String())
+	assert.Equal(t, 0, client.PushCount)
+}
+
+func TestPush_SkipUpToDateTags(t *testing.T) {
+	defer func() { _ = os.RemoveAll(name) }()
+	_ = file.Write(name, "Dockerfile", "FROM scratch")
+	server := registry.NewMockRegistryServer()
+	defer server.Close()
+	digest := server.AddImage("reponame", "abc123", nil)
+	imageID, _ := server.Manifest("reponame", "abc123").ConfigDigest()
+
+	out := &bytes.Buffer{}
+	eout := &bytes.Buffer{}
+	pushOut := `{"status":"Push successful"}`
+	image := server.Host() + "/reponame"
+	client := &docker.MockDocker{PushOutput: &pushOut, ImageIDs: map[string]string{image + ":abc123": imageID, image + ":feature1": imageID}}
+	cfg := pushConfig("feature1")
+	cfg.Registry.Dockerhub.Repository = server.Host()
+	pushReport := &report.Report{}
+
+	exitCode := doPush(client, cfg, name, "Dockerfile", nil, nil, pushReport, out, eout)
+
+	assert.Equal(t, 0, exitCode)
+	assert.Equal(t, "", eout.String())
+	assert.Equal(t, []string{image + ":feature1"}, client.Images)
+	assert.Equal(t, fmt.Sprintf("Logged in\n\x1b[0mTag '\x1b[32m%s:abc123\x1b[39m' is \x1b[32mup to date\x1b[39m\x1b[0m\n\x1b[0mPushing tag '\x1b[32m%s:feature1\x1b[39m'\x1b[0m\nPush successful\n\x1b[0mTag '%s:abc123': \x1b[32mup to date\x1b[39m\x1b[0m\n\x1b[0mTag '%s:feature1': \x1b[32mpushed\x1b[39m\x1b[0m\n", image, image, image, image), out.String())
+	assert.Equal(t, []string{image + ":abc123", image + ":feature1"}, pushReport.Images[0].Tags)
+	assert.Equal(t, report.Pushed{Tag: image + ":abc123", Digest: digest, Size: int64(len(server.Manifest("reponame", "abc123").Content)), UpToDate: true}, pushReport.Images[0].Pushed[0])
+	assert.False(t, pushReport.Images[0].Pushed[1].UpToDate)
+}
+
+func TestPush_OtherImageInRegistry(t *testing.T) {
+	defer func() { _ = os.RemoveAll(name) }()
+	_ = file.Write(name, "Dockerfile", "FROM scratch")
+	server := registry.NewMockRegistryServer()
+	defer server.Close()
+	server.AddImage("reponame", "abc123", nil)
+
+	out := &bytes.Buffer{}
+	pushOut := `{"status":"Push successful"}`
+	image := server.Host() + "/reponame"
+	client := &docker.MockDocker{PushOutput: &pushOut, ImageIDs: map[string]string{image + ":abc123": "sha256:1234"}}
+	cfg := pushConfig("feature1")
+	cfg.Registry.Dockerhub.Repository = server.Host()
+
+	exitCode := doPush(client, cfg, name, "Dockerfile", nil, nil, &report.Report{}, out, &bytes.Buffer{})
+
+	assert.Equal(t, 0, exitCode)
+	assert.Equal(t, []string{image + ":abc123", image + ":feature1"}, client.Images)
+	assert.NotContains(t, out.String(), "up to date")
+}
+
+func TestPush_UpToDateCheckFailing(t *testing.T) {
+	defer func() { _ = os.RemoveAll(name) }()
+	_ = file.Write(name, "Dockerfile", "FROM scratch")
+
+	out := &bytes.Buffer{}
+	pushOut := `{"status":"Push successful"}`
+	client := &docker.MockDocker{PushOutput: &pushOut, ImageIDs: map[string]string{"127.0.0.1:1/reponame:abc123": "sha256:1234"}}
+	cfg := pushConfig("feature1")
+	cfg.Registry.Dockerhub.Repository = "127.0.0.1:1"
+
+	exitCode := doPush(client, cfg, name, "Dockerfile", nil, nil, &report.Report{}, out, &bytes.Buffer{})
+
+	assert.Equal(t, 0, exitCode)
+	assert.Equal(t, []string{"127.0.0.1:1/reponame:abc123", "127.0.0.1:1/reponame:feature1"}, client.Images)
+	assert.Contains(t, out.String(), "\x1b[0m\x1b[33mUnable to check if tag '127.0.0.1:1/reponame:abc123' is up to date, pushing it: ")
+}
+
+func TestPush_SummaryWithUpToDateTags(t *testing.T) {
+	defer func() { _ = os.RemoveAll(name) }()
+	_ = file.Write(name, "Dockerfile", "FROM scratch")
+	server := registry.NewMockRegistryServer()
+	defer server.Close()
+	server.AddImage("reponame", "abc123", nil)
+	imageID, _ := server.Manifest("reponame", "abc123").ConfigDigest()
+
+	out := &bytes.Buffer{}
+	image := server.Host() + "/reponame"
+	client := &docker.MockDocker{PushError: fmt.Errorf("denied: requested access to the resource is denied"), ImageIDs: map[string]string{image + ":abc123": imageID}}
+	cfg := pushConfig("feature1")
+	cfg.Registry.Dockerhub.Repository = server.Host()
+
+	exitCode := doPush(client, cfg, name, "Dockerfile", nil, nil, &report.Report{}, out, &bytes.Buffer{})
+
+	assert.Equal(t, -7, exitCode)
+	assert.Contains(t, out.String(), fmt.Sprintf("\x1b[0mTag '%s:abc123': \x1b[32mup to date\x1b[39m\x1b[0m\n\x1b[0mTag '%s:feature1': \x1b[31mfailed\x1b[39m\x1b[0m\n", image, image))
+}
+
+func TestTransient(t *testing.T) {
+	assert.True(t, transient(fmt.Errorf("received unexpected HTTP status: 502 Bad Gateway")))
+	assert.True(t, transient(fmt.Errorf("ThrottlingException: Rate exceeded")))
+	assert.True(t, transient(fmt.Errorf("Put https://registry/v2/: net/http: TLS handshake timeout")))
+	assert.True(t, transient(fmt.Errorf("Patch https://registry/v2/repo/blobs/uploads/1: EOF")))
+	assert.False(t, transient(fmt.Errorf("denied: requested access to the resource is denied")))
+	assert.False(t, transient(fmt.Errorf("name unknown: repository does not exist")))
+}
+
+func pushConfig(branch string) *config.Config {
+	cfg := config.InitEmptyConfig()
+	cfg.CI.Gitlab.CIBuildName = "reponame"
+	cfg.CI.Gitlab.CICommit = "abc123"
+	cfg.CI.Gitlab.CIBranchName = branch
+	cfg.Registry.Dockerhub.Repository = "repo"
+	cfg.Push.RetryDelay = "1ms"
+	return cfg
+}
@@ -0,0 +1,344 @@
+package registry_gc
+
+import (
+	docker2 "docker.io/go-docker"
+	"flag"
+	"fmt"
+	"github.com/liamg/tml"
+	"github.com/sparetimecoders/build-tools/pkg/ci"
+	"github.com/sparetimecoders/build-tools/pkg/config"
+	"github.com/sparetimecoders/build-tools/pkg/docker"
+	"github.com/sparetimecoders/build-tools/pkg/registry"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+var (
+	commitTag   = regexp.MustCompile(`^[0-9a-f]{7,40}$`)
+	versionTag  = regexp.MustCompile(`^v?[0-9]+(\.[0-9]+){0,2}([-+].*)?$`)
+	platformTag = regexp.MustCompile(`^(.+)-(linux|windows|darwin)-[a-z0-9]+(-v[0-9]+)?$`)
+	// attachedTag matches artifacts stored next to an image, i.e. signatures tagged sha256-<digest>.sig
+	attachedTag = regexp.MustCompile(`^sha256-([0-9a-f]{64})\.[a-z]+$`)
+)
+
+// RegistryGC deletes tags of deleted branches and old commit tags from the registry
+func RegistryGC(dir string, out, eout io.Writer, args ...string) int {
+	var registryName string
+	var dryRun bool
+	var keepCommits int
+	var only arrayFlags
+	set := flag.NewFlagSet("registry-gc", flag.ContinueOnError)
+	set.SetOutput(eout)
+	set.StringVar(&registryName, "registry", "", "registry to clean up, i.e. ecr (defaults to the current registry)")
+	set.BoolVar(&dryRun, "dry-run", false, "print the tags that would be deleted without deleting them")
+	set.IntVar(&keepCommits, "keep-commits", 0, "number of commit tags to keep per image (overrides gc.keepCommits)")
+	set.Var(&only, "only", "only clean up the image with this name (can be repeated)")
+	if err := set.Parse(args); err != nil {
+		return -1
+	}
+
+	client, err := docker2.NewEnvClient()
+	if err != nil {
+		_, _ = fmt.Fprintln(eout, tml.Sprintf("<red>%s</red>", err.Error()))
+		return -2
+	}
+	cfg, err := config.Load(dir, out)
+	if err != nil {
+		_, _ = fmt.Fprintln(eout, tml.Sprintf("<red>%s</red>", err.Error()))
+		return -2
+	}
+	if keepCommits > 0 {
+		cfg.GC.KeepCommits = keepCommits
+	}
+	return doRegistryGC(client, cfg, dir, registryName, dryRun, only, out, eout)
+}
+
+// tagPlan is the decision made for a single tag
+type tagPlan struct {
+	tag    string
+	digest string
+	delete bool
+	reason string
+	// attached is set for artifacts stored next to an image, which are kept or deleted with the image
+	attached bool
+}
+
+func doRegistryGC(client docker.Client, cfg *config.Config, dir, registryName string, dryRun bool, only []string, out, eout io.Writer) int {
+	currentRegistry, err := cfg.RegistryNamed(registryName)
+	if err != nil {
+		_, _ = fmt.Fprintln(eout, tml.Sprintf("<red>%s</red>", err.Error()))
+		return -3
+	}
+	if err := currentRegistry.Login(client, out); err != nil {
+		_, _ = fmt.Fprintln(eout, tml.Sprintf("<red>%s</red>", err.Error()))
+		return -4
+	}
+	api, err := registry.NewRegistryAPI(currentRegistry)
+	if err != nil {
+		_, _ = fmt.Fprintln(eout, tml.Sprintf("<red>%s</red>", err.Error()))
+		return -4
+	}
+	images, err := cfg.CurrentImages("Dockerfile", only)
+	if err != nil {
+		_, _ = fmt.Fprintln(eout, tml.Sprintf("<red>%s</red>", err.Error()))
+		return -5
+	}
+	branches, err := cfg.CurrentVCS().Branches()
+	if err != nil {
+		_, _ = fmt.Fprintln(eout, tml.Sprintf("<red>%s</red>", err.Error()))
+		return -6
+	}
+	keep, err := cfg.GC.KeepPatterns()
+	if err != nil {
+		_, _ = fmt.Fprintln(eout, tml.Sprintf("<red>%s</red>", err.Error()))
+		return -7
+	}
+	if len(branches) <= 1 {
+		_, _ = fmt.Fprintln(eout, tml.Sprintf("<red>only %d branch is known to git, fetch all branches before running registry-gc, i.e. git fetch origin '+refs/heads/*:refs/remotes/origin/*'</red>", len(branches)))
+		return -6
+	}
+	branchTags := make(map[string]bool)
+	for _, branch := range branches {
+		branchTags[ci.BranchTag(branch)] = true
+	}
+
+	code := 0
+	for _, image := range images {
+		ref, err := registry.ParseReference(fmt.Sprintf("%s/%s", currentRegistry.RegistryUrl(), image.Name))
+		if err != nil {
+			_, _ = fmt.Fprintln(eout, tml.Sprintf("<red>%s</red>", err.Error()))
+			return -8
+		}
+		var stages []string
+		if content, err := ioutil.ReadFile(filepath.Join(dir, image.Context, image.Dockerfile)); err == nil {
+			if parsed, err := docker.ParseDockerfile(string(content), nil); err == nil {
+				stages = parsed.StageNames()
+			}
+		}
+		plans, err := plan(api, ref, cfg, stages, branchTags, keep)
+		if err != nil {
+			_, _ = fmt.Fprintln(eout, tml.Sprintf("<red>%s</red>", err.Error()))
+			return -8
+		}
+		if c := apply(api, ref, plans, dryRun, out, eout); c != 0 && code == 0 {
+			code = c
+		}
+	}
+	return code
+}
+
+// plan decides which tags of the repository ref to delete
+func plan(api *registry.API, ref registry.Reference, cfg *config.Config, stages []string, branchTags map[string]bool, keep []*regexp.Regexp) ([]*tagPlan, error) {
+	tags, err := api.Tags(ref)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list tags for %s: %v", ref, err)
+	}
+
+	var plans []*tagPlan
+	var attached []*tagPlan
+	var unknown []*tagPlan
+	commits := make(map[string][]*tagPlan)
+	for _, tag := range tags {
+		p := &tagPlan{tag: tag}
+		plans = append(plans, p)
+		base := tag
+		if match := platformTag.FindStringSubmatch(tag); match != nil {
+			base = match[1]
+		}
+		switch {
+		case attachedTag.MatchString(tag):
+			p.attached = true
+			attached = append(attached, p)
+		case matchesAny(keep, tag):
+			p.reason = "matches keep pattern"
+		case base == "latest" || cfg.Tags.IsMainBranch(base):
+			p.reason = "main branch"
+		case contains(stages, base):
+			p.reason = "build stage"
+		case commitTag.MatchString(base):
+			commits[base] = append(commits[base], p)
+		case versionTag.MatchString(base):
+			p.reason = "version"
+		case branchTags[base] || hasBranchPrefix(base, branchTags):
+			p.reason = "branch exists"
+		default:
+			unknown = append(unknown, p)
+		}
+	}
+
+	// Only tags named after the branch the image was built from are deleted, other tags (i.e. promoted images or
+	// DOCKER_TAG overrides) are kept since there is no way to tell if they are still used
+	for _, p := range unknown {
+		config, err := api.ImageConfig(ref.WithTag(p.tag))
+		if err != nil {
+			return nil, fmt.Errorf("unable to fetch image config for %s: %v", ref.WithTag(p.tag), err)
+		}
+		base := p.tag
+		if match := platformTag.FindStringSubmatch(p.tag); match != nil {
+			base = match[1]
+		}
+		if branch := builtFromBranch(config); len(branch) > 0 && ci.BranchTag(branch) == base {
+			p.delete = true
+			p.reason = "branch no longer exists"
+		} else {
+			p.reason = "not the tag of a deleted branch"
+		}
+	}
+
+	if len(commits) > 0 {
+		// The variants of a commit (i.e. platforms) are kept or deleted together, ordered by the newest image
+		created := make(map[string]time.Time)
+		var ordered []string
+		for commit, variants := range commits {
+			for _, variant := range variants {
+				config, err := api.ImageConfig(ref.WithTag(variant.tag))
+				if err != nil {
+					return nil, fmt.Errorf("unable to fetch image config for %s: %v", ref.WithTag(variant.tag), err)
+				}
+				if config.Created.After(created[commit]) {
+					created[commit] = config.Created
+				}
+			}
+			ordered = append(ordered, commit)
+		}
+		sort.Slice(ordered, func(i, j int) bool {
+			if created[ordered[i]].Equal(created[ordered[j]]) {
+				return ordered[i] < ordered[j]
+			}
+			return created[ordered[i]].After(created[ordered[j]])
+		})
+		for i, commit := range ordered {
+			for _, p := range commits[commit] {
+				if i < cfg.GC.CommitsToKeep() {
+					p.reason = fmt.Sprintf("one of the %d newest commits", cfg.GC.CommitsToKeep())
+				} else {
+					p.delete = true
+					p.reason = fmt.Sprintf("older than the %d newest commits", cfg.GC.CommitsToKeep())
+				}
+			}
+		}
+	}
+
+	for _, p := range plans {
+		digest, err := api.ManifestDigest(ref.WithTag(p.tag))
+		if err != nil {
+			return nil, fmt.Errorf("unable to fetch digest for %s: %v", ref.WithTag(p.tag), err)
+		}
+		p.digest = digest
+	}
+	// Deleting a manifest removes every tag referencing it, so tags sharing a digest with a kept tag must be kept
+	kept := make(map[string]string)
+	for _, p := range plans {
+		if !p.delete && !p.attached {
+			kept[p.digest] = p.tag
+		}
+	}
+	// Artifacts attached to an image are kept as long as the image is kept
+	for _, p := range attached {
+		digest := "sha256:" + attachedTag.FindStringSubmatch(p.tag)[1]
+		if tag, exists := kept[digest]; exists {
+			p.reason = fmt.Sprintf("attached to %s", tag)
+		} else {
+			p.delete = true
+			p.reason = "attached image is deleted"
+		}
+	}
+	for _, p := range plans {
+		if tag, exists := kept[p.digest]; p.delete && exists {
+			p.delete = false
+			p.reason = fmt.Sprintf("%s, but the image is also tagged %s", p.reason, tag)
+		}
+	}
+	return plans, nil
+}
+
+// apply deletes the planned tags, or just prints the plan if dryRun is set
+func apply(api *registry.API, ref registry.Reference, plans []*tagPlan, dryRun bool, out, eout io.Writer) int {
+	code := 0
+	deleted := 0
+	digests := make(map[string]bool)
+	for _, p := range plans {
+		if !p.delete {
+			if dryRun {
+				_, _ = fmt.Fprintln(out, tml.Sprintf("Keeping '<green>%s</green>' (%s)", ref.WithTag(p.tag), p.reason))
+			}
+			continue
+		}
+		if dryRun {
+			_, _ = fmt.Fprintln(out, tml.Sprintf("Would delete '<yellow>%s</yellow>' (%s)", ref.WithTag(p.tag), p.reason))
+			deleted++
+			continue
+		}
+		_, _ = fmt.Fprintln(out, tml.Sprintf("Deleting '<yellow>%s</yellow>' (%s)", ref.WithTag(p.tag), p.reason))
+		if !digests[p.digest] {
+			if err := api.DeleteManifest(ref, p.digest); err != nil {
+				_, _ = fmt.Fprintln(eout, tml.Sprintf("<red>unable to delete %s: %s</red>", ref.WithTag(p.tag), err.Error()))
+				code = -9
+				continue
+			}
+			digests[p.digest] = true
+		}
+		deleted++
+	}
+	repository := fmt.Sprintf("%s/%s", ref.Host, ref.Repository)
+	if dryRun {
+		_, _ = fmt.Fprintln(out, tml.Sprintf("Would delete <green>%d</green> of %d tags from <green>%s</green>", deleted, len(plans), repository))
+	} else {
+		_, _ = fmt.Fprintln(out, tml.Sprintf("Deleted <green>%d</green> of %d tags from <green>%s</green>", deleted, len(plans), repository))
+	}
+	return code
+}
+
+// builtFromBranch returns the branch an image was built from, or an empty string if it was built from a tag or the
+// image lacks the labels needed to tell
+func builtFromBranch(image *registry.ImageConfig) string {
+	labels := image.Config.Labels
+	if ref := labels[config.LabelRefName]; ref != labels[config.LabelVersion] {
+		return ref
+	}
+	return ""
+}
+
+func matchesAny(patterns []*regexp.Regexp, tag string) bool {
+	for _, pattern := range patterns {
+		if pattern.MatchString(tag) {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// hasBranchPrefix returns true for tags rendered from a branch and other values, i.e. feature1-42
+func hasBranchPrefix(tag string, branchTags map[string]bool) bool {
+	for branch := range branchTags {
+		if strings.HasPrefix(tag, branch+"-") {
+			return true
+		}
+	}
+	return false
+}
+
+type arrayFlags []string
+
+func (i *arrayFlags) String() string {
+	return strings.Join(*i, ",")
+}
+
+func (i *arrayFlags) Set(value string) error {
+	*i = append(*i, strings.TrimSpace(value))
+	return nil
+}
@@ -0,0 +1,286 @@
+package registry_gc
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/sparetimecoders/build-tools/pkg"
+	"github.com/sparetimecoders/build-tools/pkg/config"
+	"github.com/sparetimecoders/build-tools/pkg/docker"
+	"github.com/sparetimecoders/build-tools/pkg/registry"
+	"github.com/sparetimecoders/build-tools/pkg/vcs"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRegistryGC_BadFlag(t *testing.T) {
+	eout := &bytes.Buffer{}
+	code := RegistryGC(".", &bytes.Buffer{}, eout, "--unknown")
+	assert.Equal(t, -1, code)
+	assert.Contains(t, eout.String(), "flag provided but not defined: -unknown")
+}
+
+func TestRegistryGC_BadDockerHost(t *testing.T) {
+	defer pkg.SetEnv("DOCKER_HOST", "abc-123")()
+	code := RegistryGC(".", &bytes.Buffer{}, &bytes.Buffer{})
+	assert.Equal(t, -2, code)
+}
+
+func TestRegistryGC_BrokenConfig(t *testing.T) {
+	name, _ := ioutil.TempDir(os.TempDir(), "build-tools")
+	defer func() { _ = os.RemoveAll(name) }()
+	_ = ioutil.WriteFile(name+"/.buildtools.yaml", []byte(`ci: [] `), 0777)
+	code := RegistryGC(name, &bytes.Buffer{}, &bytes.Buffer{})
+	assert.Equal(t, -2, code)
+}
+
+func TestRegistryGC_DryRun(t *testing.T) {
+	server, cfg := setup("master", "feature/login")
+	defer server.Close()
+
+	out := &bytes.Buffer{}
+	eout := &bytes.Buffer{}
+	code := doRegistryGC(&docker.MockDocker{}, cfg, "", "", true, nil, out, eout)
+
+	assert.Equal(t, 0, code)
+	assert.Equal(t, "", eout.String())
+	image := server.Host() + "/reponame"
+	assert.Contains(t, out.String(), fmt.Sprintf("\x1b[0mKeeping '\x1b[32m%s:latest\x1b[39m' (main branch)\x1b[0m\n", image))
+	assert.Contains(t, out.String(), fmt.Sprintf("\x1b[0mKeeping '\x1b[32m%s:master\x1b[39m' (main branch)\x1b[0m\n", image))
+	assert.Contains(t, out.String(), fmt.Sprintf("\x1b[0mKeeping '\x1b[32m%s:feature_login\x1b[39m' (branch exists)\x1b[0m\n", image))
+	assert.Contains(t, out.String(), fmt.Sprintf("\x1b[0mKeeping '\x1b[32m%s:v1.2.0\x1b[39m' (version)\x1b[0m\n", image))
+	assert.Contains(t, out.String(), fmt.Sprintf("\x1b[0mKeeping '\x1b[32m%s:abc1234\x1b[39m' (one of the 2 newest commits)\x1b[0m\n", image))
+	assert.Contains(t, out.String(), fmt.Sprintf("\x1b[0mKeeping '\x1b[32m%s:def5678-linux-arm64\x1b[39m' (one of the 2 newest commits)\x1b[0m\n", image))
+	assert.Contains(t, out.String(), fmt.Sprintf("\x1b[0mWould delete '\x1b[33m%s:0123abc\x1b[39m' (older than the 2 newest commits)\x1b[0m\n", image))
+	assert.Contains(t, out.String(), fmt.Sprintf("\x1b[0mWould delete '\x1b[33m%s:old-feature\x1b[39m' (branch no longer exists)\x1b[0m\n", image))
+	assert.Contains(t, out.String(), fmt.Sprintf("\x1b[0mWould delete \x1b[32m2\x1b[39m of 8 tags from \x1b[32m%s\x1b[39m\x1b[0m\n", image))
+	assert.NotNil(t, server.Manifest("reponame", "0123abc"))
+	assert.NotNil(t, server.Manifest("reponame", "old-feature"))
+}
+
+func TestRegistryGC_Delete(t *testing.T) {
+	server, cfg := setup("master", "feature/login")
+	defer server.Close()
+
+	out := &bytes.Buffer{}
+	eout := &bytes.Buffer{}
+	code := doRegistryGC(&docker.MockDocker{}, cfg, "", "", false, nil, out, eout)
+
+	assert.Equal(t, 0, code)
+	assert.Equal(t, "", eout.String())
+	image := server.Host() + "/reponame"
+	assert.NotContains(t, out.String(), "Keeping")
+	assert.Contains(t, out.String(), fmt.Sprintf("\x1b[0mDeleting '\x1b[33m%s:old-feature\x1b[39m' (branch no longer exists)\x1b[0m\n", image))
+	assert.Contains(t, out.String(), fmt.Sprintf("\x1b[0mDeleted \x1b[32m2\x1b[39m of 8 tags from \x1b[32m%s\x1b[39m\x1b[0m\n", image))
+	assert.Nil(t, server.Manifest("reponame", "0123abc"))
+	assert.Nil(t, server.Manifest("reponame", "old-feature"))
+	for _, tag := range []string{"latest", "master", "feature_login", "v1.2.0", "abc1234", "def5678-linux-arm64"} {
+		assert.NotNil(t, server.Manifest("reponame", tag), tag)
+	}
+}
+
+func TestRegistryGC_SharedDigest(t *testing.T) {
+	server, cfg := setup("master", "develop")
+	defer server.Close()
+	server.Manifests["reponame:release-candidate"] = server.Manifest("reponame", "old-feature")
+
+	out := &bytes.Buffer{}
+	eout := &bytes.Buffer{}
+	code := doRegistryGC(&docker.MockDocker{}, cfg, "", "", false, nil, out, eout)
+
+	assert.Equal(t, 0, code)
+	assert.Equal(t, "", eout.String())
+	assert.NotNil(t, server.Manifest("reponame", "release-candidate"))
+	assert.NotNil(t, server.Manifest("reponame", "old-feature"))
+	assert.Nil(t, server.Manifest("reponame", "feature_login"))
+}
+
+func TestRegistryGC_SharedDigest_DryRun(t *testing.T) {
+	server, cfg := setup("master", "develop")
+	defer server.Close()
+	server.Manifests["reponame:release-candidate"] = server.Manifest("reponame", "old-feature")
+
+	out := &bytes.Buffer{}
+	code := doRegistryGC(&docker.MockDocker{}, cfg, "", "", true, nil, out, &bytes.Buffer{})
+
+	assert.Equal(t, 0, code)
+	assert.Contains(t, out.String(), fmt.Sprintf("\x1b[0mKeeping '\x1b[32m%s/reponame:old-feature\x1b[39m' (branch no longer exists, but the image is also tagged release-candidate)\x1b[0m\n", server.Host()))
+}
+
+func TestRegistryGC_Signatures(t *testing.T) {
+	server, cfg := setup("master", "develop")
+	defer server.Close()
+	kept := strings.Replace(server.Manifest("reponame", "abc1234").Digest, ":", "-", 1) + ".sig"
+	deleted := strings.Replace(server.Manifest("reponame", "0123abc").Digest, ":", "-", 1) + ".sig"
+	server.AddImage("reponame", kept, nil)
+	server.AddImage("reponame", deleted, nil)
+
+	out := &bytes.Buffer{}
+	code := doRegistryGC(&docker.MockDocker{}, cfg, "", "", true, nil, out, &bytes.Buffer{})
+
+	assert.Equal(t, 0, code)
+	image := server.Host() + "/reponame"
+	assert.Contains(t, out.String(), fmt.Sprintf("\x1b[0mKeeping '\x1b[32m%s:%s\x1b[39m' (attached to abc1234)\x1b[0m\n", image, kept))
+	assert.Contains(t, out.String(), fmt.Sprintf("\x1b[0mWould delete '\x1b[33m%s:%s\x1b[39m' (attached image is deleted)\x1b[0m\n", image, deleted))
+
+	code = doRegistryGC(&docker.MockDocker{}, cfg, "", "", false, nil, &bytes.Buffer{}, &bytes.Buffer{})
+
+	assert.Equal(t, 0, code)
+	assert.NotNil(t, server.Manifest("reponame", kept))
+	assert.Nil(t, server.Manifest("reponame", deleted))
+}
+
+func TestRegistryGC_KeepPatternsAndStages(t *testing.T) {
+	server, cfg := setup("master", "develop")
+	defer server.Close()
+	cfg.GC.Keep = []string{"release-.*"}
+	server.AddImage("reponame", "release-2020", nil)
+	server.AddImage("reponame", "build", nil)
+	dir, _ := ioutil.TempDir(os.TempDir(), "build-tools")
+	defer func() { _ = os.RemoveAll(dir) }()
+	_ = ioutil.WriteFile(filepath.Join(dir, "Dockerfile"), []byte("FROM scratch as build\nFROM scratch\n"), 0777)
+
+	out := &bytes.Buffer{}
+	code := doRegistryGC(&docker.MockDocker{}, cfg, dir, "", true, nil, out, &bytes.Buffer{})
+
+	assert.Equal(t, 0, code)
+	assert.Contains(t, out.String(), fmt.Sprintf("\x1b[0mKeeping '\x1b[32m%s/reponame:release-2020\x1b[39m' (matches keep pattern)\x1b[0m\n", server.Host()))
+	assert.Contains(t, out.String(), fmt.Sprintf("\x1b[0mKeeping '\x1b[32m%s/reponame:build\x1b[39m' (build stage)\x1b[0m\n", server.Host()))
+}
+
+func TestRegistryGC_KeepsUnknownTags(t *testing.T) {
+	server, cfg := setup("master", "develop")
+	defer server.Close()
+	// Promoted images keep the labels of the build, so their tag doesn't match the branch they were built from
+	server.AddImage("reponame", "prod", branchLabels("master"))
+	server.AddImage("reponame", "custom-tag", nil)
+	server.AddImage("reponame", "release-x", map[string]string{config.LabelRefName: "release-x", config.LabelVersion: "release-x"})
+
+	out := &bytes.Buffer{}
+	code := doRegistryGC(&docker.MockDocker{}, cfg, "", "", false, nil, out, &bytes.Buffer{})
+
+	assert.Equal(t, 0, code)
+	for _, tag := range []string{"prod", "custom-tag", "release-x"} {
+		assert.NotNil(t, server.Manifest("reponame", tag), tag)
+	}
+	assert.Nil(t, server.Manifest("reponame", "old-feature"))
+	assert.Nil(t, server.Manifest("reponame", "feature_login"))
+}
+
+func TestRegistryGC_SingleBranchClone(t *testing.T) {
+	server, cfg := setup("master")
+	defer server.Close()
+
+	eout := &bytes.Buffer{}
+	code := doRegistryGC(&docker.MockDocker{}, cfg, "", "", false, nil, &bytes.Buffer{}, eout)
+
+	assert.Equal(t, -6, code)
+	assert.Equal(t, "\x1b[0m\x1b[31monly 1 branch is known to git, fetch all branches before running registry-gc, i.e. git fetch origin '+refs/heads/*:refs/remotes/origin/*'\x1b[39m\x1b[0m\n", eout.String())
+	assert.NotNil(t, server.Manifest("reponame", "old-feature"))
+}
+
+func TestRegistryGC_UnknownRegistry(t *testing.T) {
+	server, cfg := setup("master", "develop")
+	defer server.Close()
+
+	eout := &bytes.Buffer{}
+	code := doRegistryGC(&docker.MockDocker{}, cfg, "", "missing", true, nil, &bytes.Buffer{}, eout)
+
+	assert.Equal(t, -3, code)
+	assert.Equal(t, "\x1b[0m\x1b[31munknown registry 'missing'\x1b[39m\x1b[0m\n", eout.String())
+}
+
+func TestRegistryGC_LoginError(t *testing.T) {
+	server, cfg := setup("master", "develop")
+	defer server.Close()
+
+	eout := &bytes.Buffer{}
+	client := &docker.MockDocker{LoginError: fmt.Errorf("invalid username/password")}
+	code := doRegistryGC(client, cfg, "", "", true, nil, &bytes.Buffer{}, eout)
+
+	assert.Equal(t, -4, code)
+	assert.Equal(t, "\x1b[0m\x1b[31minvalid username/password\x1b[39m\x1b[0m\n", eout.String())
+}
+
+func TestRegistryGC_UnknownImage(t *testing.T) {
+	server, cfg := setup("master", "develop")
+	defer server.Close()
+
+	code := doRegistryGC(&docker.MockDocker{}, cfg, "", "", true, []string{"other"}, &bytes.Buffer{}, &bytes.Buffer{})
+
+	assert.Equal(t, -5, code)
+}
+
+func TestRegistryGC_NoBranches(t *testing.T) {
+	server, cfg := setup()
+	defer server.Close()
+	cfg.VCS.VCS = &no{}
+
+	eout := &bytes.Buffer{}
+	code := doRegistryGC(&docker.MockDocker{}, cfg, "", "", true, nil, &bytes.Buffer{}, eout)
+
+	assert.Equal(t, -6, code)
+	assert.Equal(t, "\x1b[0m\x1b[31mlisting branches is not supported without a VCS\x1b[39m\x1b[0m\n", eout.String())
+}
+
+func TestRegistryGC_InvalidKeepPattern(t *testing.T) {
+	server, cfg := setup("master", "develop")
+	defer server.Close()
+	cfg.GC.Keep = []string{"("}
+
+	code := doRegistryGC(&docker.MockDocker{}, cfg, "", "", true, nil, &bytes.Buffer{}, &bytes.Buffer{})
+
+	assert.Equal(t, -7, code)
+}
+
+func TestRegistryGC_ListTagsError(t *testing.T) {
+	server, cfg := setup("master", "develop")
+	server.Close()
+
+	eout := &bytes.Buffer{}
+	code := doRegistryGC(&docker.MockDocker{}, cfg, "", "", true, nil, &bytes.Buffer{}, eout)
+
+	assert.Equal(t, -8, code)
+	assert.Contains(t, eout.String(), "unable to list tags for")
+}
+
+func setup(branches ...string) (*registry.MockRegistryServer, *config.Config) {
+	server := registry.NewMockRegistryServer()
+	created := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	server.AddImageCreated("reponame", "latest", nil, created)
+	server.AddImageCreated("reponame", "master", nil, created)
+	server.AddImageCreated("reponame", "feature_login", branchLabels("feature/login"), created)
+	server.AddImageCreated("reponame", "old-feature", branchLabels("old-feature"), created)
+	server.AddImageCreated("reponame", "v1.2.0", nil, created)
+	server.AddImageCreated("reponame", "abc1234", nil, created.Add(2*time.Hour))
+	server.AddImageCreated("reponame", "def5678-linux-arm64", nil, created.Add(time.Hour))
+	server.AddImageCreated("reponame", "0123abc", nil, created)
+
+	cfg := config.InitEmptyConfig()
+	cfg.CI.Gitlab.CIBuildName = "reponame"
+	cfg.Registry.Dockerhub.Repository = server.Host()
+	cfg.VCS.VCS = vcs.NewMockVcsWithBranches(branches...)
+	cfg.GC.KeepCommits = 2
+	return server, cfg
+}
+
+func branchLabels(branch string) map[string]string {
+	return map[string]string{config.LabelRefName: branch, config.LabelVersion: "v1.2.0-3-gabc1234"}
+}
+
+type no struct {
+	vcs.CommonVCS
+}
+
+func (n no) Identify(dir string, out io.Writer) bool {
+	return true
+}
+
+func (n no) Name() string {
+	return "none"
+}
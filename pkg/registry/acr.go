@@ -0,0 +1,179 @@
+package registry
+
+import (
+	"context"
+	"docker.io/go-docker/api/types"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/sparetimecoders/build-tools/pkg/docker"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// acrRefreshTokenUsername is the username used when logging in with a refresh token from the token exchange
+const acrRefreshTokenUsername = "00000000-0000-0000-0000-000000000000"
+
+var azureAuthority = "https://login.microsoftonline.com"
+
+// ACR is Azure Container Registry
+type ACR struct {
+	dockerRegistry
+	// Registry is the name of the registry or its login server, i.e. myregistry or myregistry.azurecr.io
+	Registry     string `yaml:"registry" env:"ACR_REGISTRY"`
+	ClientID     string `yaml:"clientId" env:"ACR_CLIENT_ID"`
+	ClientSecret string `yaml:"clientSecret" env:"ACR_CLIENT_SECRET"`
+	// TenantID enables the refresh token exchange for the service principal instead of logging in with its credentials
+	TenantID string `yaml:"tenantId" env:"ACR_TENANT_ID"`
+	// AccessToken is an Azure AD access token, i.e. from `az account get-access-token`, exchanged for a refresh token
+	AccessToken string `yaml:"accessToken" env:"ACR_ACCESS_TOKEN"`
+	username    string
+	password    string
+}
+
+var _ Registry = &ACR{}
+
+func (r *ACR) Name() string {
+	return "ACR"
+}
+
+func (r *ACR) Configured() bool {
+	return len(r.Registry) > 0
+}
+
+func (r *ACR) Login(client docker.Client, out io.Writer) error {
+	if err := r.credentials(); err != nil {
+		return err
+	}
+	if ok, err := client.RegistryLogin(context.Background(), r.authConfig()); err == nil {
+		_, _ = fmt.Fprintln(out, ok.Status)
+		return nil
+	} else {
+		return err
+	}
+}
+
+// credentials sets the username and password, exchanging an Azure AD access token for an ACR refresh token if possible
+func (r *ACR) credentials() error {
+	accessToken := r.AccessToken
+	if len(accessToken) == 0 && len(r.TenantID) > 0 && len(r.ClientID) > 0 {
+		token, err := r.servicePrincipalToken()
+		if err != nil {
+			return err
+		}
+		accessToken = token
+	}
+	if len(accessToken) > 0 {
+		refreshToken, err := r.exchange(accessToken)
+		if err != nil {
+			return err
+		}
+		r.username = acrRefreshTokenUsername
+		r.password = refreshToken
+		return nil
+	}
+	if len(r.ClientID) > 0 {
+		r.username = r.ClientID
+		r.password = r.ClientSecret
+		return nil
+	}
+	if auth, err := DockerCredentials(r.host()); err != nil {
+		return err
+	} else if auth != nil {
+		r.username = auth.Username
+		r.password = auth.Password
+		if len(auth.IdentityToken) > 0 {
+			// Stored by `az acr login`, the identity token is a refresh token
+			r.username = acrRefreshTokenUsername
+			r.password = auth.IdentityToken
+		}
+		return nil
+	}
+	return errors.New("ACR requires service principal credentials, an access token or credentials in the docker config")
+}
+
+// servicePrincipalToken gets an Azure AD access token for the service principal using the client credentials flow
+func (r *ACR) servicePrincipalToken() (string, error) {
+	response := struct {
+		AccessToken string `json:"access_token"`
+	}{}
+	err := postForm(fmt.Sprintf("%s/%s/oauth2/v2.0/token", azureAuthority, r.TenantID), url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {r.ClientID},
+		"client_secret": {r.ClientSecret},
+		"scope":         {"https://management.azure.com/.default"},
+	}, &response)
+	if err != nil {
+		return "", fmt.Errorf("unable to get Azure AD token: %v", err)
+	}
+	return response.AccessToken, nil
+}
+
+// exchange exchanges an Azure AD access token for an ACR refresh token
+func (r *ACR) exchange(accessToken string) (string, error) {
+	values := url.Values{
+		"grant_type":   {"access_token"},
+		"service":      {r.host()},
+		"access_token": {accessToken},
+	}
+	if len(r.TenantID) > 0 {
+		values.Set("tenant", r.TenantID)
+	}
+	response := struct {
+		RefreshToken string `json:"refresh_token"`
+	}{}
+	if err := postForm(fmt.Sprintf("%s://%s/oauth2/exchange", urlScheme(r.host()), r.host()), values, &response); err != nil {
+		return "", fmt.Errorf("unable to exchange token with ACR: %v", err)
+	}
+	return response.RefreshToken, nil
+}
+
+func postForm(u string, values url.Values, response interface{}) error {
+	resp, err := http.PostForm(u, values)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(response)
+}
+
+// resolveCredentials resolves the credentials unless Login already did
+func (r *ACR) resolveCredentials() error {
+	if len(r.username) > 0 {
+		return nil
+	}
+	return r.credentials()
+}
+
+// GetAuthInfo returns the credentials resolved by Login or NewRegistryAPI
+func (r *ACR) GetAuthInfo() string {
+	auth := r.authConfig()
+	authBytes, _ := json.Marshal(auth)
+	return base64.URLEncoding.EncodeToString(authBytes)
+}
+
+func (r *ACR) authConfig() types.AuthConfig {
+	return types.AuthConfig{Username: r.username, Password: r.password, ServerAddress: r.host()}
+}
+
+func (r *ACR) host() string {
+	if strings.Contains(r.Registry, ".") || strings.Contains(r.Registry, ":") {
+		return r.Registry
+	}
+	return fmt.Sprintf("%s.azurecr.io", r.Registry)
+}
+
+func (r *ACR) RegistryUrl() string {
+	return r.host()
+}
+
+// Create does nothing, repositories are created when pushed
+func (r *ACR) Create(repository string) error {
+	return nil
+}
@@ -0,0 +1,154 @@
+package registry
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/sparetimecoders/build-tools/pkg/docker"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// mockAzure is a stand-in for both Azure AD and the ACR token exchange
+type mockAzure struct {
+	*httptest.Server
+	forms map[string]url.Values
+}
+
+func newMockAzure() *mockAzure {
+	m := &mockAzure{forms: make(map[string]url.Values)}
+	m.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		m.forms[r.URL.Path] = r.PostForm
+		switch {
+		case r.URL.Path == "/tenant/oauth2/v2.0/token" && r.PostForm.Get("client_secret") == "secret":
+			_, _ = fmt.Fprint(w, `{"token_type":"Bearer","access_token":"aad-token"}`)
+		case r.URL.Path == "/oauth2/exchange" && r.PostForm.Get("access_token") == "aad-token":
+			_, _ = fmt.Fprint(w, `{"refresh_token":"refresh-token"}`)
+		default:
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	azureAuthority = m.URL
+	return m
+}
+
+func (m *mockAzure) host() string {
+	return strings.TrimPrefix(m.URL, "http://")
+}
+
+func TestACR_LoginWithServicePrincipal(t *testing.T) {
+	client := &docker.MockDocker{}
+	registry := &ACR{Registry: "myregistry", ClientID: "client", ClientSecret: "secret"}
+	out := &bytes.Buffer{}
+	err := registry.Login(client, out)
+	assert.Nil(t, err)
+	assert.Equal(t, "client", client.Username)
+	assert.Equal(t, "secret", client.Password)
+	assert.Equal(t, "myregistry.azurecr.io", client.ServerAddress)
+	assert.Equal(t, "Logged in\n", out.String())
+}
+
+func TestACR_LoginWithTokenExchange(t *testing.T) {
+	azure := newMockAzure()
+	defer azure.Close()
+
+	client := &docker.MockDocker{}
+	registry := &ACR{Registry: azure.host(), ClientID: "client", ClientSecret: "secret", TenantID: "tenant"}
+	err := registry.Login(client, &bytes.Buffer{})
+	assert.Nil(t, err)
+	assert.Equal(t, "00000000-0000-0000-0000-000000000000", client.Username)
+	assert.Equal(t, "refresh-token", client.Password)
+	assert.Equal(t, azure.host(), client.ServerAddress)
+	assert.Equal(t, "client_credentials", azure.forms["/tenant/oauth2/v2.0/token"].Get("grant_type"))
+	assert.Equal(t, "client", azure.forms["/tenant/oauth2/v2.0/token"].Get("client_id"))
+	exchange := azure.forms["/oauth2/exchange"]
+	assert.Equal(t, "access_token", exchange.Get("grant_type"))
+	assert.Equal(t, azure.host(), exchange.Get("service"))
+	assert.Equal(t, "tenant", exchange.Get("tenant"))
+}
+
+func TestACR_LoginWithAccessToken(t *testing.T) {
+	azure := newMockAzure()
+	defer azure.Close()
+
+	client := &docker.MockDocker{}
+	registry := &ACR{Registry: azure.host(), AccessToken: "aad-token"}
+	err := registry.Login(client, &bytes.Buffer{})
+	assert.Nil(t, err)
+	assert.Equal(t, "refresh-token", client.Password)
+	assert.Nil(t, azure.forms["/tenant/oauth2/v2.0/token"])
+}
+
+func TestACR_LoginWithInvalidSecret(t *testing.T) {
+	azure := newMockAzure()
+	defer azure.Close()
+
+	registry := &ACR{Registry: azure.host(), ClientID: "client", ClientSecret: "wrong", TenantID: "tenant"}
+	err := registry.Login(&docker.MockDocker{}, &bytes.Buffer{})
+	assert.EqualError(t, err, "unable to get Azure AD token: unexpected status 401 Unauthorized")
+}
+
+func TestACR_LoginWithInvalidAccessToken(t *testing.T) {
+	azure := newMockAzure()
+	defer azure.Close()
+
+	registry := &ACR{Registry: azure.host(), AccessToken: "expired"}
+	err := registry.Login(&docker.MockDocker{}, &bytes.Buffer{})
+	assert.EqualError(t, err, "unable to exchange token with ACR: unexpected status 401 Unauthorized")
+}
+
+func TestACR_LoginWithoutCredentials(t *testing.T) {
+	registry := &ACR{Registry: "myregistry"}
+	err := registry.Login(&docker.MockDocker{}, &bytes.Buffer{})
+	assert.EqualError(t, err, "ACR requires service principal credentials, an access token or credentials in the docker config")
+}
+
+func TestACR_LoginError(t *testing.T) {
+	client := &docker.MockDocker{LoginError: fmt.Errorf("invalid username/password")}
+	registry := &ACR{Registry: "myregistry", ClientID: "client", ClientSecret: "secret"}
+	out := &bytes.Buffer{}
+	err := registry.Login(client, out)
+	assert.EqualError(t, err, "invalid username/password")
+	assert.Equal(t, "", out.String())
+}
+
+func TestACR_GetAuthInfo(t *testing.T) {
+	registry := &ACR{Registry: "myregistry", ClientID: "client", ClientSecret: "secret"}
+	_ = registry.Login(&docker.MockDocker{}, &bytes.Buffer{})
+	decoded, _ := base64.URLEncoding.DecodeString(registry.GetAuthInfo())
+	assert.Equal(t, `{"username":"client","password":"secret","serveraddress":"myregistry.azurecr.io"}`, string(decoded))
+}
+
+func TestACR_NewRegistryAPIWithTokenExchange(t *testing.T) {
+	azure := newMockAzure()
+	defer azure.Close()
+
+	api, err := NewRegistryAPI(&ACR{Registry: azure.host(), AccessToken: "aad-token"})
+	assert.NoError(t, err)
+	assert.Equal(t, "00000000-0000-0000-0000-000000000000", api.username)
+	assert.Equal(t, "refresh-token", api.password)
+}
+
+func TestACR_NewRegistryAPIWithInvalidAccessToken(t *testing.T) {
+	azure := newMockAzure()
+	defer azure.Close()
+
+	_, err := NewRegistryAPI(&ACR{Registry: azure.host(), AccessToken: "expired"})
+	assert.EqualError(t, err, "unable to exchange token with ACR: unexpected status 401 Unauthorized")
+}
+
+func TestACR_RegistryUrl(t *testing.T) {
+	assert.Equal(t, "myregistry.azurecr.io", (&ACR{Registry: "myregistry"}).RegistryUrl())
+	assert.Equal(t, "myregistry.azurecr.cn", (&ACR{Registry: "myregistry.azurecr.cn"}).RegistryUrl())
+}
+
+func TestACR_Create(t *testing.T) {
+	registry := &ACR{}
+	err := registry.Create("repo")
+	assert.Nil(t, err)
+}
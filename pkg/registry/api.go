@@ -0,0 +1,552 @@
+package registry
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"docker.io/go-docker/api/types"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	MediaTypeManifest     = "application/vnd.docker.distribution.manifest.v2+json"
+	MediaTypeManifestList = "application/vnd.docker.distribution.manifest.list.v2+json"
+	MediaTypeOCIManifest  = "application/vnd.oci.image.manifest.v1+json"
+	MediaTypeOCIIndex     = "application/vnd.oci.image.index.v1+json"
+)
+
+var acceptedManifests = []string{MediaTypeManifestList, MediaTypeOCIIndex, MediaTypeManifest, MediaTypeOCIManifest}
+
+// ErrNotFound is returned when the requested manifest, tag or blob does not exist in the registry
+var ErrNotFound = errors.New("not found")
+
+// Reference is a parsed image reference, i.e. host/repository:tag or host/repository@digest
+type Reference struct {
+	Host       string
+	Repository string
+	Tag        string
+	Digest     string
+}
+
+// ParseReference parses an image name the same way as the docker CLI, defaulting to Docker Hub
+// if the first part of the name is not a host
+func ParseReference(image string) (Reference, error) {
+	ref := Reference{}
+	name := image
+	if i := strings.Index(name, "@"); i != -1 {
+		ref.Digest = name[i+1:]
+		name = name[:i]
+	}
+	if i := strings.LastIndex(name, ":"); i != -1 && !strings.Contains(name[i:], "/") {
+		ref.Tag = name[i+1:]
+		name = name[:i]
+	}
+	if ref.Tag == "" && ref.Digest == "" {
+		ref.Tag = "latest"
+	}
+	parts := strings.SplitN(name, "/", 2)
+	if len(parts) == 2 && (strings.ContainsAny(parts[0], ".:") || parts[0] == "localhost") {
+		ref.Host = parts[0]
+		ref.Repository = parts[1]
+	} else {
+		ref.Host = "docker.io"
+		ref.Repository = name
+		if len(parts) == 1 {
+			ref.Repository = "library/" + name
+		}
+	}
+	if ref.Repository == "" {
+		return ref, fmt.Errorf("invalid image reference '%s'", image)
+	}
+	return ref, nil
+}
+
+// WithTag returns a copy of the reference pointing at tag
+func (r Reference) WithTag(tag string) Reference {
+	return Reference{Host: r.Host, Repository: r.Repository, Tag: tag}
+}
+
+// WithDigest returns a copy of the reference pointing at digest
+func (r Reference) WithDigest(digest string) Reference {
+	return Reference{Host: r.Host, Repository: r.Repository, Digest: digest}
+}
+
+func (r Reference) String() string {
+	if r.Digest != "" {
+		return fmt.Sprintf("%s/%s@%s", r.Host, r.Repository, r.Digest)
+	}
+	return fmt.Sprintf("%s/%s:%s", r.Host, r.Repository, r.Tag)
+}
+
+func (r Reference) reference() string {
+	if r.Digest != "" {
+		return r.Digest
+	}
+	return r.Tag
+}
+
+func (r Reference) baseUrl() string {
+	host := r.Host
+	if host == "docker.io" {
+		host = "registry-1.docker.io"
+	}
+	return fmt.Sprintf("%s://%s/v2/%s", urlScheme(host), host, r.Repository)
+}
+
+// urlScheme returns the scheme to use for host, plain http is only used for local registries
+func urlScheme(host string) string {
+	if hostname, _, err := net.SplitHostPort(host); err == nil && isLocal(hostname) || isLocal(host) {
+		return "http"
+	}
+	return "https"
+}
+
+func isLocal(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// Manifest is a raw manifest as stored in the registry
+type Manifest struct {
+	MediaType string
+	Digest    string
+	Content   []byte
+}
+
+// ConfigDigest returns the digest of the image configuration referenced by the manifest,
+// which is the id of the image in the docker daemon
+func (m *Manifest) ConfigDigest() (string, error) {
+	content := manifestContent{}
+	if err := json.Unmarshal(m.Content, &content); err != nil {
+		return "", err
+	}
+	if content.Config.Digest == "" {
+		return "", fmt.Errorf("unsupported manifest type '%s'", m.MediaType)
+	}
+	return content.Config.Digest, nil
+}
+
+// Descriptor describes content stored in the registry
+type Descriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Size        int64             `json:"size"`
+	Digest      string            `json:"digest"`
+	Platform    *Platform         `json:"platform,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+type manifestContent struct {
+	MediaType string       `json:"mediaType"`
+	Config    Descriptor   `json:"config"`
+	Layers    []Descriptor `json:"layers"`
+	Manifests []Descriptor `json:"manifests"`
+}
+
+// ImageConfig is the part of the image configuration build-tools cares about
+type ImageConfig struct {
+	Architecture string    `json:"architecture"`
+	OS           string    `json:"os"`
+	Created      time.Time `json:"created"`
+	Config       struct {
+		Labels map[string]string `json:"Labels"`
+	} `json:"config"`
+}
+
+// API is a minimal client for the Docker Registry HTTP API V2
+type API struct {
+	Client   *http.Client
+	username string
+	password string
+	// registryToken is a bearer token sent as is, instead of fetching tokens from the authentication realm
+	registryToken string
+	tokens        map[string]string
+}
+
+// HTTPClientProvider is implemented by registries needing a custom HTTP client for the registry API, i.e. for TLS settings
+type HTTPClientProvider interface {
+	HTTPClient() (*http.Client, error)
+}
+
+// credentialsResolver is implemented by registries which must resolve their credentials, i.e. from a key file or by
+// exchanging a token, before GetAuthInfo returns them
+type credentialsResolver interface {
+	resolveCredentials() error
+}
+
+// NewRegistryAPI creates a client for the API of reg, using the HTTP client provided by reg if any
+func NewRegistryAPI(reg Registry) (*API, error) {
+	if resolver, ok := reg.(credentialsResolver); ok {
+		if err := resolver.resolveCredentials(); err != nil {
+			return nil, err
+		}
+	}
+	api := NewAPI(reg.GetAuthInfo())
+	if provider, ok := reg.(HTTPClientProvider); ok {
+		client, err := provider.HTTPClient()
+		if err != nil {
+			return nil, err
+		}
+		api.Client = client
+	}
+	return api, nil
+}
+
+// NewAPI creates a client authenticating with the (base64 encoded) auth info returned from Registry.GetAuthInfo
+func NewAPI(auth string) *API {
+	api := &API{Client: http.DefaultClient, tokens: make(map[string]string)}
+	if decoded, err := base64.URLEncoding.DecodeString(auth); err == nil {
+		authConfig := types.AuthConfig{}
+		if err := json.Unmarshal(decoded, &authConfig); err == nil {
+			api.username = authConfig.Username
+			api.password = authConfig.Password
+			if authConfig.IdentityToken != "" {
+				api.password = authConfig.IdentityToken
+			}
+			api.registryToken = authConfig.RegistryToken
+		}
+	}
+	return api
+}
+
+// Manifest fetches the manifest for ref
+func (a *API) Manifest(ref Reference) (*Manifest, error) {
+	resp, err := a.do(http.MethodGet, fmt.Sprintf("%s/manifests/%s", ref.baseUrl(), ref.reference()), scope(ref, "pull"), nil, map[string]string{"Accept": strings.Join(acceptedManifests, ", ")})
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	content, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	digest := resp.Header.Get("Docker-Content-Digest")
+	if digest == "" {
+		digest = Digest(content)
+	}
+	mediaType := resp.Header.Get("Content-Type")
+	if i := strings.Index(mediaType, ";"); i != -1 {
+		mediaType = mediaType[:i]
+	}
+	return &Manifest{MediaType: mediaType, Digest: digest, Content: content}, nil
+}
+
+// ManifestDigest returns the digest of the manifest for ref
+func (a *API) ManifestDigest(ref Reference) (string, error) {
+	resp, err := a.do(http.MethodHead, fmt.Sprintf("%s/manifests/%s", ref.baseUrl(), ref.reference()), scope(ref, "pull"), nil, map[string]string{"Accept": strings.Join(acceptedManifests, ", ")})
+	if err != nil {
+		return "", err
+	}
+	_ = resp.Body.Close()
+	if digest := resp.Header.Get("Docker-Content-Digest"); digest != "" {
+		return digest, nil
+	}
+	manifest, err := a.Manifest(ref)
+	if err != nil {
+		return "", err
+	}
+	return manifest.Digest, nil
+}
+
+// PutManifest uploads manifest as ref and returns the digest reported by the registry
+func (a *API) PutManifest(ref Reference, manifest *Manifest) (string, error) {
+	resp, err := a.do(http.MethodPut, fmt.Sprintf("%s/manifests/%s", ref.baseUrl(), ref.reference()), scope(ref, "pull,push"), manifest.Content, map[string]string{"Content-Type": manifest.MediaType})
+	if err != nil {
+		return "", err
+	}
+	_ = resp.Body.Close()
+	if digest := resp.Header.Get("Docker-Content-Digest"); digest != "" {
+		return digest, nil
+	}
+	return Digest(manifest.Content), nil
+}
+
+// Blob fetches the blob with the given digest from the repository of ref
+func (a *API) Blob(ref Reference, digest string) (io.ReadCloser, error) {
+	resp, err := a.do(http.MethodGet, fmt.Sprintf("%s/blobs/%s", ref.baseUrl(), digest), scope(ref, "pull"), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// ImageConfig fetches the image configuration for ref, for manifest lists the first image is used
+func (a *API) ImageConfig(ref Reference) (*ImageConfig, error) {
+	manifest, err := a.Manifest(ref)
+	if err != nil {
+		return nil, err
+	}
+	content := manifestContent{}
+	if err := json.Unmarshal(manifest.Content, &content); err != nil {
+		return nil, err
+	}
+	if len(content.Manifests) > 0 {
+		return a.ImageConfig(ref.WithDigest(content.Manifests[0].Digest))
+	}
+	if content.Config.Digest == "" {
+		return nil, fmt.Errorf("unsupported manifest type '%s' for %s", manifest.MediaType, ref)
+	}
+	blob, err := a.Blob(ref, content.Config.Digest)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = blob.Close() }()
+	config := &ImageConfig{}
+	if err := json.NewDecoder(blob).Decode(config); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// Tags lists the tags in the repository of ref
+func (a *API) Tags(ref Reference) ([]string, error) {
+	var tags []string
+	next := fmt.Sprintf("%s/tags/list", ref.baseUrl())
+	for next != "" {
+		resp, err := a.do(http.MethodGet, next, scope(ref, "pull"), nil, nil)
+		if err == ErrNotFound {
+			return nil, nil
+		} else if err != nil {
+			return nil, err
+		}
+		list := struct {
+			Tags []string `json:"tags"`
+		}{}
+		err = json.NewDecoder(resp.Body).Decode(&list)
+		_ = resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		tags = append(tags, list.Tags...)
+		next = nextLink(resp.Request.URL, resp.Header.Get("Link"))
+	}
+	return tags, nil
+}
+
+var linkHeader = regexp.MustCompile(`<([^>]+)>;\s*rel="next"`)
+
+// nextLink returns the absolute URL of the next page from a Link header, or an empty string if there are no more pages
+func nextLink(current *url.URL, header string) string {
+	match := linkHeader.FindStringSubmatch(header)
+	if match == nil {
+		return ""
+	}
+	next, err := current.Parse(match[1])
+	if err != nil {
+		return ""
+	}
+	return next.String()
+}
+
+// DeleteManifest deletes the manifest with the given digest from the repository of ref, removing every tag referencing it
+func (a *API) DeleteManifest(ref Reference, digest string) error {
+	resp, err := a.do(http.MethodDelete, fmt.Sprintf("%s/manifests/%s", ref.baseUrl(), digest), scope(ref, "*"), nil, nil)
+	if err != nil {
+		return err
+	}
+	_ = resp.Body.Close()
+	return nil
+}
+
+// BlobExists returns true if the blob with the given digest exists in the repository of ref
+func (a *API) BlobExists(ref Reference, digest string) (bool, error) {
+	resp, err := a.do(http.MethodHead, fmt.Sprintf("%s/blobs/%s", ref.baseUrl(), digest), scope(ref, "pull"), nil, nil)
+	if err == ErrNotFound {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	_ = resp.Body.Close()
+	return true, nil
+}
+
+// MountBlob tries to mount the blob with the given digest from the repository from into the repository of ref,
+// which only works within a registry. Returns false if the registry did not mount the blob
+func (a *API) MountBlob(ref Reference, digest, from string) (bool, error) {
+	u := fmt.Sprintf("%s/blobs/uploads/?mount=%s&from=%s", ref.baseUrl(), url.QueryEscape(digest), url.QueryEscape(from))
+	resp, err := a.do(http.MethodPost, u, scope(ref, "pull,push")+" "+fmt.Sprintf("repository:%s:pull", from), nil, nil)
+	if err != nil {
+		return false, err
+	}
+	_ = resp.Body.Close()
+	return resp.StatusCode == http.StatusCreated, nil
+}
+
+// UploadBlob uploads size bytes read from content as the blob with the given digest to the repository of ref
+func (a *API) UploadBlob(ref Reference, digest string, content io.Reader, size int64) error {
+	pushScope := scope(ref, "pull,push")
+	resp, err := a.do(http.MethodPost, fmt.Sprintf("%s/blobs/uploads/", ref.baseUrl()), pushScope, nil, nil)
+	if err != nil {
+		return err
+	}
+	_ = resp.Body.Close()
+	location, err := resp.Request.URL.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		return err
+	}
+	query := location.Query()
+	query.Set("digest", digest)
+	location.RawQuery = query.Encode()
+
+	// The upload can't be retried with a new token since content is streamed, the token from the POST above is reused
+	req, err := http.NewRequest(http.MethodPut, location.String(), content)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	req.Header.Set("Content-Type", "application/octet-stream")
+	if authorization := a.tokens[pushScope]; authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	put, err := a.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = put.Body.Close() }()
+	if put.StatusCode != http.StatusCreated {
+		body, _ := ioutil.ReadAll(put.Body)
+		return fmt.Errorf("unable to upload blob %s: %s %s", digest, put.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// PushBlob uploads content as a blob to the repository of ref, unless the blob already exists
+func (a *API) PushBlob(ref Reference, content []byte) error {
+	digest := Digest(content)
+	if exists, err := a.BlobExists(ref, digest); err != nil {
+		return err
+	} else if exists {
+		return nil
+	}
+	return a.UploadBlob(ref, digest, bytes.NewReader(content), int64(len(content)))
+}
+
+// Digest returns the sha256 digest of content
+func Digest(content []byte) string {
+	return fmt.Sprintf("sha256:%x", sha256.Sum256(content))
+}
+
+// scope returns the token scope needed to perform actions on the repository of ref
+func scope(ref Reference, actions string) string {
+	return fmt.Sprintf("repository:%s:%s", ref.Repository, actions)
+}
+
+func (a *API) do(method, u string, scope string, body []byte, headers map[string]string) (*http.Response, error) {
+	resp, err := a.request(method, u, body, headers, a.tokens[scope])
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		challenge := resp.Header.Get("WWW-Authenticate")
+		_ = resp.Body.Close()
+		authorization, err := a.authorize(challenge, scope)
+		if err != nil {
+			return nil, err
+		}
+		a.tokens[scope] = authorization
+		if resp, err = a.request(method, u, body, headers, authorization); err != nil {
+			return nil, err
+		}
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		_ = resp.Body.Close()
+		return nil, ErrNotFound
+	}
+	if resp.StatusCode >= 300 {
+		content, _ := ioutil.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		return nil, fmt.Errorf("%s %s: %s %s", method, u, resp.Status, strings.TrimSpace(string(content)))
+	}
+	return resp, nil
+}
+
+func (a *API) request(method, u string, body []byte, headers map[string]string, authorization string) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequest(method, u, reader)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	return a.Client.Do(req)
+}
+
+var challengeParams = regexp.MustCompile(`(\w+)="([^"]*)"`)
+
+// authorize handles the authentication challenge returned by the registry and returns the
+// value to use in the Authorization header
+func (a *API) authorize(challenge, scope string) (string, error) {
+	if a.registryToken != "" {
+		return "Bearer " + a.registryToken, nil
+	}
+	if strings.HasPrefix(strings.ToLower(challenge), "basic") {
+		if a.username == "" && a.password == "" {
+			return "", errors.New("registry requires authentication but no credentials are available")
+		}
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(a.username+":"+a.password)), nil
+	}
+	if !strings.HasPrefix(strings.ToLower(challenge), "bearer") {
+		return "", fmt.Errorf("unsupported authentication challenge '%s'", challenge)
+	}
+	params := make(map[string]string)
+	for _, match := range challengeParams.FindAllStringSubmatch(challenge, -1) {
+		params[match[1]] = match[2]
+	}
+	realm, err := url.Parse(params["realm"])
+	if err != nil || params["realm"] == "" {
+		return "", fmt.Errorf("invalid authentication realm in '%s'", challenge)
+	}
+	query := realm.Query()
+	if service, exists := params["service"]; exists {
+		query.Set("service", service)
+	}
+	for _, s := range strings.Fields(scope) {
+		query.Add("scope", s)
+	}
+	realm.RawQuery = query.Encode()
+	req, err := http.NewRequest(http.MethodGet, realm.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	if a.username != "" || a.password != "" {
+		req.SetBasicAuth(a.username, a.password)
+	}
+	resp, err := a.Client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unable to fetch token from %s: %s", realm.Host, resp.Status)
+	}
+	token := struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", err
+	}
+	if token.Token == "" {
+		token.Token = token.AccessToken
+	}
+	return "Bearer " + token.Token, nil
+}
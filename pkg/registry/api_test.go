@@ -0,0 +1,193 @@
+package registry
+
+import (
+	"encoding/base64"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestParseReference(t *testing.T) {
+	tests := map[string]Reference{
+		"alpine":                              {Host: "docker.io", Repository: "library/alpine", Tag: "latest"},
+		"org/image:1.0":                       {Host: "docker.io", Repository: "org/image", Tag: "1.0"},
+		"localhost:5000/image":                {Host: "localhost:5000", Repository: "image", Tag: "latest"},
+		"quay.io/org/image:abc123":            {Host: "quay.io", Repository: "org/image", Tag: "abc123"},
+		"ghcr.io/org/image@sha256:0123abcdef": {Host: "ghcr.io", Repository: "org/image", Digest: "sha256:0123abcdef"},
+	}
+	for image, expected := range tests {
+		ref, err := ParseReference(image)
+		assert.NoError(t, err, image)
+		assert.Equal(t, expected, ref, image)
+	}
+}
+
+func TestReference_BaseUrl(t *testing.T) {
+	ref, _ := ParseReference("alpine")
+	assert.Equal(t, "https://registry-1.docker.io/v2/library/alpine", ref.baseUrl())
+	ref, _ = ParseReference("127.0.0.1:5000/image")
+	assert.Equal(t, "http://127.0.0.1:5000/v2/image", ref.baseUrl())
+}
+
+func TestAPI_CopyManifest(t *testing.T) {
+	server := NewMockRegistryServer()
+	defer server.Close()
+	digest := server.AddImage("image", "master", map[string]string{"revision": "abc123"})
+
+	api := NewAPI("")
+	source, _ := ParseReference(server.Host() + "/image:master")
+	manifest, err := api.Manifest(source)
+	assert.NoError(t, err)
+	assert.Equal(t, digest, manifest.Digest)
+	assert.Equal(t, MediaTypeManifest, manifest.MediaType)
+
+	pushed, err := api.PutManifest(source.WithTag("def456"), manifest)
+	assert.NoError(t, err)
+	assert.Equal(t, digest, pushed)
+	assert.Equal(t, manifest.Content, server.Manifest("image", "def456").Content)
+
+	found, err := api.ManifestDigest(source.WithTag("def456"))
+	assert.NoError(t, err)
+	assert.Equal(t, digest, found)
+}
+
+func TestAPI_ImageConfig(t *testing.T) {
+	server := NewMockRegistryServer()
+	defer server.Close()
+	server.AddImage("org/image", "latest", map[string]string{"revision": "abc123"})
+
+	ref, _ := ParseReference(server.Host() + "/org/image")
+	config, err := NewAPI("").ImageConfig(ref)
+	assert.NoError(t, err)
+	assert.Equal(t, "linux", config.OS)
+	assert.Equal(t, "abc123", config.Config.Labels["revision"])
+}
+
+func TestManifest_ConfigDigest(t *testing.T) {
+	manifest := &Manifest{MediaType: MediaTypeManifest, Content: []byte(`{"config":{"digest":"sha256:abc123"}}`)}
+	digest, err := manifest.ConfigDigest()
+	assert.NoError(t, err)
+	assert.Equal(t, "sha256:abc123", digest)
+
+	list := &Manifest{MediaType: "application/vnd.docker.distribution.manifest.list.v2+json", Content: []byte(`{"manifests":[]}`)}
+	_, err = list.ConfigDigest()
+	assert.EqualError(t, err, "unsupported manifest type 'application/vnd.docker.distribution.manifest.list.v2+json'")
+}
+
+func TestAPI_NotFound(t *testing.T) {
+	server := NewMockRegistryServer()
+	defer server.Close()
+
+	ref, _ := ParseReference(server.Host() + "/image:missing")
+	_, err := NewAPI("").ImageConfig(ref)
+	assert.Equal(t, ErrNotFound, err)
+}
+
+func TestAPI_BearerToken(t *testing.T) {
+	registry := NewMockRegistryServer()
+	defer registry.Close()
+	registry.AddImage("image", "latest", nil)
+
+	var tokenRequest *http.Request
+	auth := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tokenRequest = r
+		_, _ = w.Write([]byte(`{"token":"secret-token"}`))
+	}))
+	defer auth.Close()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret-token" {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="`+auth.URL+`/token",service="registry.example.com"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		registry.Config.Handler.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	api := NewAPI(base64.URLEncoding.EncodeToString([]byte(`{"username":"user","password":"pass"}`)))
+	ref, _ := ParseReference(strings.TrimPrefix(server.URL, "http://") + "/image")
+	_, err := api.ManifestDigest(ref)
+	assert.NoError(t, err)
+	assert.Equal(t, "registry.example.com", tokenRequest.URL.Query().Get("service"))
+	assert.Equal(t, "repository:image:pull", tokenRequest.URL.Query().Get("scope"))
+	user, pass, _ := tokenRequest.BasicAuth()
+	assert.Equal(t, "user", user)
+	assert.Equal(t, "pass", pass)
+}
+
+func TestAPI_BasicAuthWithoutCredentials(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("WWW-Authenticate", `Basic realm="registry"`)
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	ref, _ := ParseReference(strings.TrimPrefix(server.URL, "http://") + "/image")
+	_, err := NewAPI("").Manifest(ref)
+	assert.EqualError(t, err, "registry requires authentication but no credentials are available")
+}
+
+func TestAPI_RegistryToken(t *testing.T) {
+	registry := NewMockRegistryServer()
+	defer registry.Close()
+	registry.AddImage("image", "latest", nil)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer registry-token" {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="http://127.0.0.1:1/token"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		registry.Config.Handler.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	api, err := NewRegistryAPI(&Generic{Url: strings.TrimPrefix(server.URL, "http://"), Token: "registry-token"})
+	assert.NoError(t, err)
+	ref, _ := ParseReference(strings.TrimPrefix(server.URL, "http://") + "/image")
+	_, err = api.ManifestDigest(ref)
+	assert.NoError(t, err)
+}
+
+func TestNewRegistryAPI_InvalidCA(t *testing.T) {
+	_, err := NewRegistryAPI(&Generic{Url: "registry.example.com", CA: "/missing/ca.pem"})
+	assert.EqualError(t, err, "unable to read CA bundle: open /missing/ca.pem: no such file or directory")
+}
+
+func TestAPI_Tags(t *testing.T) {
+	server := NewMockRegistryServer()
+	defer server.Close()
+	server.TagsPageSize = 2
+	for _, tag := range []string{"abc123", "def456", "feature1", "latest", "master"} {
+		server.AddImage("image", tag, nil)
+	}
+	api := NewAPI("")
+
+	ref, _ := ParseReference(server.Host() + "/image")
+	tags, err := api.Tags(ref)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"abc123", "def456", "feature1", "latest", "master"}, tags)
+
+	missing, _ := ParseReference(server.Host() + "/missing")
+	tags, err = api.Tags(missing)
+	assert.NoError(t, err)
+	assert.Empty(t, tags)
+}
+
+func TestAPI_DeleteManifest(t *testing.T) {
+	server := NewMockRegistryServer()
+	defer server.Close()
+	digest := server.AddImage("image", "abc123", nil)
+	other := server.AddImage("image", "def456", nil)
+	api := NewAPI("")
+	ref, _ := ParseReference(server.Host() + "/image:feature1")
+	manifest, _ := api.Manifest(ref.WithDigest(digest))
+	_, _ = api.PutManifest(ref, manifest)
+
+	assert.NoError(t, api.DeleteManifest(ref, digest))
+	tags, _ := api.Tags(ref)
+	assert.Equal(t, []string{"def456"}, tags)
+	assert.Equal(t, other, server.Manifest("image", "def456").Digest)
+	assert.Equal(t, ErrNotFound, api.DeleteManifest(ref, digest))
+}
@@ -0,0 +1,55 @@
+package registry
+
+import (
+	"encoding/json"
+)
+
+// MediaTypeOCIConfig is the media type of the image configuration in an OCI manifest
+const MediaTypeOCIConfig = "application/vnd.oci.image.config.v1+json"
+
+// artifactManifest is an OCI manifest used to store artifacts, i.e. signatures, next to an image
+type artifactManifest struct {
+	SchemaVersion int          `json:"schemaVersion"`
+	MediaType     string       `json:"mediaType"`
+	Config        Descriptor   `json:"config"`
+	Layers        []Descriptor `json:"layers"`
+}
+
+// artifactConfig is the minimal image configuration referencing the layers of an artifact
+type artifactConfig struct {
+	Architecture string `json:"architecture"`
+	Created      string `json:"created"`
+	OS           string `json:"os"`
+	RootFS       struct {
+		Type    string   `json:"type"`
+		DiffIDs []string `json:"diff_ids"`
+	} `json:"rootfs"`
+	Config struct{} `json:"config"`
+}
+
+// PushArtifact pushes an OCI manifest referencing layers as ref, in the layout cosign uses for signatures and attachments.
+// The layers must already be uploaded. Returns the digest of the manifest
+func (a *API) PushArtifact(ref Reference, layers []Descriptor) (string, error) {
+	config := artifactConfig{Created: "0001-01-01T00:00:00Z"}
+	config.RootFS.Type = "layers"
+	for _, layer := range layers {
+		config.RootFS.DiffIDs = append(config.RootFS.DiffIDs, layer.Digest)
+	}
+	configContent, err := json.Marshal(config)
+	if err != nil {
+		return "", err
+	}
+	if err := a.PushBlob(ref, configContent); err != nil {
+		return "", err
+	}
+	content, err := json.Marshal(artifactManifest{
+		SchemaVersion: 2,
+		MediaType:     MediaTypeOCIManifest,
+		Config:        Descriptor{MediaType: MediaTypeOCIConfig, Size: int64(len(configContent)), Digest: Digest(configContent)},
+		Layers:        layers,
+	})
+	if err != nil {
+		return "", err
+	}
+	return a.PutManifest(ref, &Manifest{MediaType: MediaTypeOCIManifest, Digest: Digest(content), Content: content})
+}
@@ -0,0 +1,74 @@
+package registry
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/liamg/tml"
+	"io"
+)
+
+// Copy copies the manifest referenced by src to dst without pulling the image. When copying between repositories,
+// the blobs and manifests referenced are copied (or mounted within the same registry) if missing in dst.
+// Returns the digest of the manifest in dst
+func Copy(srcAPI *API, src Reference, dstAPI *API, dst Reference, out io.Writer) (string, error) {
+	manifest, err := srcAPI.Manifest(src)
+	if err != nil {
+		return "", fmt.Errorf("unable to fetch manifest for %s: %v", src, err)
+	}
+	if src.Host != dst.Host || src.Repository != dst.Repository {
+		if err := copyReferenced(srcAPI, src, dstAPI, dst, manifest, out); err != nil {
+			return "", err
+		}
+	}
+	return dstAPI.PutManifest(dst, manifest)
+}
+
+func copyReferenced(srcAPI *API, src Reference, dstAPI *API, dst Reference, manifest *Manifest, out io.Writer) error {
+	content := manifestContent{}
+	if err := json.Unmarshal(manifest.Content, &content); err != nil {
+		return err
+	}
+	for _, child := range content.Manifests {
+		childManifest, err := srcAPI.Manifest(src.WithDigest(child.Digest))
+		if err != nil {
+			return fmt.Errorf("unable to fetch manifest %s: %v", child.Digest, err)
+		}
+		if err := copyReferenced(srcAPI, src, dstAPI, dst, childManifest, out); err != nil {
+			return err
+		}
+		if _, err := dstAPI.PutManifest(dst.WithDigest(child.Digest), childManifest); err != nil {
+			return err
+		}
+	}
+	var blobs []Descriptor
+	if content.Config.Digest != "" {
+		blobs = append(blobs, content.Config)
+	}
+	for _, blob := range append(blobs, content.Layers...) {
+		if err := copyBlob(srcAPI, src, dstAPI, dst, blob, out); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func copyBlob(srcAPI *API, src Reference, dstAPI *API, dst Reference, blob Descriptor, out io.Writer) error {
+	if exists, err := dstAPI.BlobExists(dst, blob.Digest); err != nil {
+		return err
+	} else if exists {
+		return nil
+	}
+	if src.Host == dst.Host {
+		if mounted, err := dstAPI.MountBlob(dst, blob.Digest, src.Repository); err == nil && mounted {
+			_, _ = fmt.Fprintln(out, tml.Sprintf("Mounted blob <green>%s</green>", blob.Digest))
+			return nil
+		}
+	}
+	_, _ = fmt.Fprintln(out, tml.Sprintf("Copying blob <green>%s</green> (%d bytes)", blob.Digest, blob.Size))
+	content, err := srcAPI.Blob(src, blob.Digest)
+	if err != nil {
+		return fmt.Errorf("unable to fetch blob %s: %v", blob.Digest, err)
+	}
+	defer func() { _ = content.Close() }()
+	return dstAPI.UploadBlob(dst, blob.Digest, content, blob.Size)
+}
@@ -0,0 +1,113 @@
+package registry
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestCopy_SameRepository(t *testing.T) {
+	server := NewMockRegistryServer()
+	defer server.Close()
+	digest := server.AddImage("repo", "abc123", nil)
+	api := NewAPI("")
+
+	out := &bytes.Buffer{}
+	src, _ := ParseReference(server.Host() + "/repo:abc123")
+	dst, _ := ParseReference(server.Host() + "/repo:prod")
+	result, err := Copy(api, src, api, dst, out)
+
+	assert.NoError(t, err)
+	assert.Equal(t, digest, result)
+	assert.Equal(t, digest, server.Manifest("repo", "prod").Digest)
+	assert.Equal(t, "", out.String())
+}
+
+func TestCopy_MountsWithinRegistry(t *testing.T) {
+	server := NewMockRegistryServer()
+	defer server.Close()
+	digest := server.AddImage("repo", "abc123", nil)
+	api := NewAPI("")
+
+	out := &bytes.Buffer{}
+	src, _ := ParseReference(server.Host() + "/repo:abc123")
+	dst, _ := ParseReference(server.Host() + "/other:prod")
+	result, err := Copy(api, src, api, dst, out)
+
+	assert.NoError(t, err)
+	assert.Equal(t, digest, result)
+	assert.Equal(t, digest, server.Manifest("other", "prod").Digest)
+	assert.Equal(t, 2, bytes.Count(out.Bytes(), []byte("Mounted blob")))
+	assert.NotContains(t, out.String(), "Copying blob")
+}
+
+func TestCopy_BetweenRegistries(t *testing.T) {
+	source := NewMockRegistryServer()
+	defer source.Close()
+	target := NewMockRegistryServer()
+	defer target.Close()
+	digest := source.AddImage("repo", "abc123", nil)
+	api := NewAPI("")
+
+	out := &bytes.Buffer{}
+	src, _ := ParseReference(source.Host() + "/repo:abc123")
+	dst, _ := ParseReference(target.Host() + "/repo:prod")
+	result, err := Copy(api, src, api, dst, out)
+
+	assert.NoError(t, err)
+	assert.Equal(t, digest, result)
+	assert.Equal(t, digest, target.Manifest("repo", "prod").Digest)
+	assert.Equal(t, 2, bytes.Count(out.Bytes(), []byte("Copying blob")))
+
+	out.Reset()
+	_, err = Copy(api, src, api, dst, out)
+	assert.NoError(t, err)
+	assert.Equal(t, "", out.String())
+}
+
+func TestCopy_ManifestList(t *testing.T) {
+	source := NewMockRegistryServer()
+	defer source.Close()
+	target := NewMockRegistryServer()
+	defer target.Close()
+	amd64 := source.AddImage("repo", "abc123-linux-amd64", nil)
+	arm64 := source.AddImage("repo", "abc123-linux-arm64", nil)
+	api := NewAPI("")
+
+	var manifests []PlatformManifest
+	for _, p := range []string{"linux/amd64", "linux/arm64"} {
+		ref, _ := ParseReference(source.Host() + "/repo:abc123-" + p[:5] + "-" + p[6:])
+		manifest, err := api.Manifest(ref)
+		assert.NoError(t, err)
+		platform, _ := ParsePlatform(p)
+		manifests = append(manifests, PlatformManifest{Platform: platform, Manifest: manifest})
+	}
+	list, err := NewManifestList(manifests)
+	assert.NoError(t, err)
+	src, _ := ParseReference(source.Host() + "/repo:abc123")
+	_, err = api.PutManifest(src, list)
+	assert.NoError(t, err)
+
+	dst, _ := ParseReference(target.Host() + "/repo:prod")
+	result, err := Copy(api, src, api, dst, &bytes.Buffer{})
+
+	assert.NoError(t, err)
+	assert.Equal(t, list.Digest, result)
+	assert.Equal(t, MediaTypeManifestList, target.Manifest("repo", "prod").MediaType)
+	_, err = api.Manifest(dst.WithDigest(amd64))
+	assert.NoError(t, err)
+	_, err = api.Manifest(dst.WithDigest(arm64))
+	assert.NoError(t, err)
+}
+
+func TestCopy_MissingManifest(t *testing.T) {
+	server := NewMockRegistryServer()
+	defer server.Close()
+	api := NewAPI("")
+
+	src, _ := ParseReference(server.Host() + "/repo:abc123")
+	dst, _ := ParseReference(server.Host() + "/repo:prod")
+	_, err := Copy(api, src, api, dst, &bytes.Buffer{})
+
+	assert.EqualError(t, err, "unable to fetch manifest for "+server.Host()+"/repo:abc123: not found")
+}
@@ -0,0 +1,186 @@
+package registry
+
+import (
+	"bytes"
+	"docker.io/go-docker/api/types"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// dockerHubServer is the key used for Docker Hub in config.json and by credential helpers
+const dockerHubServer = "https://index.docker.io/v1/"
+
+// tokenUsername is returned by credential helpers when the secret is an identity token
+const tokenUsername = "<token>"
+
+type dockerConfig struct {
+	Auths       map[string]dockerConfigAuth `json:"auths"`
+	CredsStore  string                      `json:"credsStore"`
+	CredHelpers map[string]string           `json:"credHelpers"`
+}
+
+type dockerConfigAuth struct {
+	Auth          string `json:"auth"`
+	Username      string `json:"username"`
+	Password      string `json:"password"`
+	IdentityToken string `json:"identitytoken"`
+}
+
+type helperCredentials struct {
+	ServerURL string `json:"ServerURL"`
+	Username  string `json:"Username"`
+	Secret    string `json:"Secret"`
+}
+
+// dockerConfigFile returns the path of the docker CLI configuration, in $DOCKER_CONFIG or ~/.docker
+func dockerConfigFile() string {
+	dir := os.Getenv("DOCKER_CONFIG")
+	if dir == "" {
+		home, _ := os.UserHomeDir()
+		dir = filepath.Join(home, ".docker")
+	}
+	return filepath.Join(dir, "config.json")
+}
+
+// DockerCredentials looks up the credentials for host in the docker CLI configuration, using the credential helpers
+// configured for the host (credHelpers), the default credential store (credsStore) or the auths stored in the file.
+// Returns nil if no credentials are found
+func DockerCredentials(host string) (*types.AuthConfig, error) {
+	content, err := ioutil.ReadFile(dockerConfigFile())
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	config := dockerConfig{}
+	if err := json.Unmarshal(content, &config); err != nil {
+		return nil, fmt.Errorf("unable to parse %s: %v", dockerConfigFile(), err)
+	}
+
+	server := normalizeServer(host)
+	var helperKeys []string
+	for key := range config.CredHelpers {
+		helperKeys = append(helperKeys, key)
+	}
+	if key, found := matchServer(helperKeys, host); found {
+		return helperGet(config.CredHelpers[key], key)
+	}
+	if config.CredsStore != "" {
+		key := server
+		if server == normalizeServer(dockerHubServer) {
+			key = dockerHubServer
+		}
+		if auth, err := helperGet(config.CredsStore, key); err != nil || auth != nil {
+			return auth, err
+		}
+	}
+	var authKeys []string
+	for key := range config.Auths {
+		authKeys = append(authKeys, key)
+	}
+	if key, found := matchServer(authKeys, host); found {
+		entry := config.Auths[key]
+		auth := &types.AuthConfig{Username: entry.Username, Password: entry.Password, IdentityToken: entry.IdentityToken}
+		if entry.Auth != "" {
+			decoded, err := base64.StdEncoding.DecodeString(entry.Auth)
+			if err != nil {
+				return nil, fmt.Errorf("invalid auth for %s in %s", key, dockerConfigFile())
+			}
+			parts := strings.SplitN(string(decoded), ":", 2)
+			if len(parts) != 2 {
+				return nil, fmt.Errorf("invalid auth for %s in %s", key, dockerConfigFile())
+			}
+			auth.Username, auth.Password = parts[0], parts[1]
+		}
+		if auth.Username == "" && auth.Password == "" && auth.IdentityToken == "" {
+			return nil, nil
+		}
+		return auth, nil
+	}
+	return nil, nil
+}
+
+// matchServer returns the key for host, preferring a key equal to host over keys for the same normalized server.
+// Keys are compared in sorted order, so the same key is found every time if several match
+func matchServer(keys []string, host string) (string, bool) {
+	sort.Strings(keys)
+	for _, key := range keys {
+		if key == host {
+			return key, true
+		}
+	}
+	server := normalizeServer(host)
+	for _, key := range keys {
+		if normalizeServer(key) == server {
+			return key, true
+		}
+	}
+	return "", false
+}
+
+// normalizeServer strips the scheme and path from a server address, mapping all Docker Hub hosts to index.docker.io
+func normalizeServer(server string) string {
+	server = strings.TrimPrefix(strings.TrimPrefix(server, "https://"), "http://")
+	server = strings.SplitN(server, "/", 2)[0]
+	switch server {
+	case "", "docker.io", "registry-1.docker.io", "registry.hub.docker.com":
+		return "index.docker.io"
+	}
+	return server
+}
+
+// credentialHelper runs `docker-credential-<helper> get` with server as input and returns the output and error output
+var credentialHelper = func(helper, server string) ([]byte, []byte, error) {
+	cmd := exec.Command("docker-credential-"+helper, "get")
+	cmd.Stdin = strings.NewReader(server)
+	stdout := &bytes.Buffer{}
+	stderr := &bytes.Buffer{}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	err := cmd.Run()
+	return stdout.Bytes(), stderr.Bytes(), err
+}
+
+func helperGet(helper, server string) (*types.AuthConfig, error) {
+	output, errOutput, err := credentialHelper(helper, server)
+	if err != nil {
+		// The helpers in docker-credential-helpers print errors on stdout
+		message := strings.TrimSpace(string(output) + "\n" + string(errOutput))
+		if strings.Contains(message, "credentials not found") {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("credential helper %s failed: %v %s", helper, err, message)
+	}
+	credentials := helperCredentials{}
+	if err := json.Unmarshal(output, &credentials); err != nil {
+		return nil, fmt.Errorf("unable to parse output from credential helper %s: %v", helper, err)
+	}
+	if credentials.Username == tokenUsername {
+		return &types.AuthConfig{IdentityToken: credentials.Secret}, nil
+	}
+	return &types.AuthConfig{Username: credentials.Username, Password: credentials.Secret}, nil
+}
+
+// withDockerCredentials returns auth with the credentials for host from the docker CLI configuration,
+// unless auth already has credentials
+func withDockerCredentials(auth types.AuthConfig, host string) (types.AuthConfig, error) {
+	if auth.Username != "" || auth.Password != "" || auth.IdentityToken != "" || auth.RegistryToken != "" {
+		return auth, nil
+	}
+	credentials, err := DockerCredentials(host)
+	if err != nil {
+		return auth, fmt.Errorf("unable to get docker credentials for %s: %v", host, err)
+	}
+	if credentials != nil {
+		credentials.ServerAddress = auth.ServerAddress
+		return *credentials, nil
+	}
+	return auth, nil
+}
@@ -0,0 +1,221 @@
+package registry
+
+import (
+	"bytes"
+	"docker.io/go-docker/api/types"
+	"encoding/base64"
+	"github.com/stretchr/testify/assert"
+	"github.com/sparetimecoders/build-tools/pkg"
+	"github.com/sparetimecoders/build-tools/pkg/docker"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const fakeHelper = `#!/bin/sh
+server=$(cat)
+case "$server" in
+  quay.io) echo '{"ServerURL":"quay.io","Username":"helper-user","Secret":"helper-pass"}';;
+  https://index.docker.io/v1/) echo '{"ServerURL":"https://index.docker.io/v1/","Username":"hub-user","Secret":"hub-pass"}';;
+  token.example.com) echo '{"ServerURL":"token.example.com","Username":"<token>","Secret":"identity"}';;
+  warning.example.com) echo 'warning: deprecated' >&2; echo '{"ServerURL":"warning.example.com","Username":"warning-user","Secret":"warning-pass"}';;
+  broken.example.com) echo 'boom' >&2; exit 2;;
+  *) echo 'credentials not found in native keychain'; exit 1;;
+esac
+`
+
+// withDockerConfig writes config as the docker config and installs the fake credential helper, returning a cleanup function
+func withDockerConfig(t *testing.T, config string) func() {
+	dir, _ := ioutil.TempDir(os.TempDir(), "build-tools")
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "config.json"), []byte(config), 0600))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "docker-credential-fake"), []byte(fakeHelper), 0700))
+	resetConfig := pkg.SetEnv("DOCKER_CONFIG", dir)
+	path := os.Getenv("PATH")
+	_ = os.Setenv("PATH", dir+string(os.PathListSeparator)+path)
+	return func() {
+		_ = os.Setenv("PATH", path)
+		resetConfig()
+		_ = os.RemoveAll(dir)
+	}
+}
+
+func basicAuth(username, password string) string {
+	return base64.StdEncoding.EncodeToString([]byte(username + ":" + password))
+}
+
+func TestDockerCredentials_MissingConfig(t *testing.T) {
+	defer pkg.SetEnv("DOCKER_CONFIG", "/missing")()
+	auth, err := DockerCredentials("quay.io")
+	assert.NoError(t, err)
+	assert.Nil(t, auth)
+}
+
+func TestDockerCredentials_InvalidConfig(t *testing.T) {
+	defer withDockerConfig(t, `{"auths":`)()
+	_, err := DockerCredentials("quay.io")
+	assert.Error(t, err)
+}
+
+func TestDockerCredentials_Auths(t *testing.T) {
+	defer withDockerConfig(t, `{"auths":{
+  "https://index.docker.io/v1/":{"auth":"`+basicAuth("hub", "secret:with:colons")+`"},
+  "registry.example.com:5000":{"username":"user","password":"pass"},
+  "https://token.example.com":{"identitytoken":"identity"},
+  "empty.example.com":{}
+}}`)()
+
+	auth, err := DockerCredentials("docker.io")
+	assert.NoError(t, err)
+	assert.Equal(t, &types.AuthConfig{Username: "hub", Password: "secret:with:colons"}, auth)
+
+	auth, err = DockerCredentials("registry.example.com:5000")
+	assert.NoError(t, err)
+	assert.Equal(t, &types.AuthConfig{Username: "user", Password: "pass"}, auth)
+
+	auth, err = DockerCredentials("token.example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, &types.AuthConfig{IdentityToken: "identity"}, auth)
+
+	auth, err = DockerCredentials("empty.example.com")
+	assert.NoError(t, err)
+	assert.Nil(t, auth)
+
+	auth, err = DockerCredentials("quay.io")
+	assert.NoError(t, err)
+	assert.Nil(t, auth)
+}
+
+func TestDockerCredentials_InvalidAuth(t *testing.T) {
+	defer withDockerConfig(t, `{"auths":{"quay.io":{"auth":"`+base64.StdEncoding.EncodeToString([]byte("nocolon"))+`"}}}`)()
+	_, err := DockerCredentials("quay.io")
+	assert.Contains(t, err.Error(), "invalid auth for quay.io in")
+}
+
+func TestDockerCredentials_CredHelpers(t *testing.T) {
+	defer withDockerConfig(t, `{
+  "auths":{"quay.io":{"username":"file-user","password":"file-pass"}},
+  "credHelpers":{"quay.io":"fake","token.example.com":"fake","warning.example.com":"fake","broken.example.com":"fake","missing.example.com":"fake"}
+}`)()
+
+	auth, err := DockerCredentials("quay.io")
+	assert.NoError(t, err)
+	assert.Equal(t, &types.AuthConfig{Username: "helper-user", Password: "helper-pass"}, auth)
+
+	auth, err = DockerCredentials("token.example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, &types.AuthConfig{IdentityToken: "identity"}, auth)
+
+	auth, err = DockerCredentials("warning.example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, &types.AuthConfig{Username: "warning-user", Password: "warning-pass"}, auth)
+
+	auth, err = DockerCredentials("missing.example.com")
+	assert.NoError(t, err)
+	assert.Nil(t, auth)
+
+	_, err = DockerCredentials("broken.example.com")
+	assert.EqualError(t, err, "credential helper fake failed: exit status 2 boom")
+}
+
+func TestDockerCredentials_PrefersExactMatch(t *testing.T) {
+	defer withDockerConfig(t, `{
+  "auths":{
+    "https://registry.example.com":{"username":"https-user","password":"pass"},
+    "registry.example.com":{"username":"exact-user","password":"pass"},
+    "registry.example.com/v2/":{"username":"path-user","password":"pass"},
+    "https://other.example.com/v1/":{"username":"https-user","password":"pass"},
+    "other.example.com/v2/":{"username":"path-user","password":"pass"}
+  },
+  "credHelpers":{"https://quay.io":"missing","quay.io":"fake"}
+}`)()
+
+	for i := 0; i < 10; i++ {
+		auth, err := DockerCredentials("quay.io")
+		assert.NoError(t, err)
+		assert.Equal(t, &types.AuthConfig{Username: "helper-user", Password: "helper-pass"}, auth)
+
+		auth, err = DockerCredentials("registry.example.com")
+		assert.NoError(t, err)
+		assert.Equal(t, &types.AuthConfig{Username: "exact-user", Password: "pass"}, auth)
+
+		auth, err = DockerCredentials("other.example.com")
+		assert.NoError(t, err)
+		assert.Equal(t, &types.AuthConfig{Username: "https-user", Password: "pass"}, auth)
+	}
+}
+
+func TestMatchServer(t *testing.T) {
+	keys := []string{"registry.example.com/v2/", "https://registry.example.com", "quay.io", "https://index.docker.io/v1/"}
+
+	key, found := matchServer(keys, "quay.io")
+	assert.True(t, found)
+	assert.Equal(t, "quay.io", key)
+	key, found = matchServer(keys, "registry.example.com")
+	assert.True(t, found)
+	assert.Equal(t, "https://registry.example.com", key)
+	key, found = matchServer(keys, "docker.io")
+	assert.True(t, found)
+	assert.Equal(t, "https://index.docker.io/v1/", key)
+	_, found = matchServer(keys, "gcr.io")
+	assert.False(t, found)
+}
+
+func TestDockerCredentials_CredsStore(t *testing.T) {
+	defer withDockerConfig(t, `{
+  "auths":{"quay.io":{},"registry.example.com":{"username":"file-user","password":"file-pass"}},
+  "credsStore":"fake"
+}`)()
+
+	auth, err := DockerCredentials("registry-1.docker.io")
+	assert.NoError(t, err)
+	assert.Equal(t, &types.AuthConfig{Username: "hub-user", Password: "hub-pass"}, auth)
+
+	auth, err = DockerCredentials("quay.io")
+	assert.NoError(t, err)
+	assert.Equal(t, &types.AuthConfig{Username: "helper-user", Password: "helper-pass"}, auth)
+
+	auth, err = DockerCredentials("registry.example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, &types.AuthConfig{Username: "file-user", Password: "file-pass"}, auth)
+}
+
+func TestDockerCredentials_UsedByRegistries(t *testing.T) {
+	defer withDockerConfig(t, `{"credsStore":"fake","auths":{"registry.example.com":{"username":"user","password":"pass"}}}`)()
+
+	client := &docker.MockDocker{}
+	assert.NoError(t, (&Quay{Repository: "org"}).Login(client, &bytes.Buffer{}))
+	assert.Equal(t, "helper-user", client.Username)
+	assert.Equal(t, "helper-pass", client.Password)
+	assert.Equal(t, "quay.io", client.ServerAddress)
+
+	decoded, _ := base64.URLEncoding.DecodeString((&Dockerhub{Repository: "repo"}).GetAuthInfo())
+	assert.Equal(t, `{"username":"hub-user","password":"hub-pass"}`, string(decoded))
+
+	decoded, _ = base64.URLEncoding.DecodeString((&Generic{Url: "registry.example.com"}).GetAuthInfo())
+	assert.Equal(t, `{"username":"user","password":"pass","serveraddress":"registry.example.com"}`, string(decoded))
+
+	// Explicit credentials take precedence
+	client = &docker.MockDocker{}
+	assert.NoError(t, (&Quay{Repository: "org", Username: "explicit", Password: "secret"}).Login(client, &bytes.Buffer{}))
+	assert.Equal(t, "explicit", client.Username)
+}
+
+func TestDockerCredentials_ErrorsReportedByRegistries(t *testing.T) {
+	defer withDockerConfig(t, `{"credHelpers":{"broken.example.com":"fake"}}`)()
+
+	err := (&Generic{Url: "broken.example.com"}).Login(&docker.MockDocker{}, &bytes.Buffer{})
+	assert.EqualError(t, err, "unable to get docker credentials for broken.example.com: credential helper fake failed: exit status 2 boom")
+
+	_, err = NewRegistryAPI(&Gitlab{Registry: "broken.example.com"})
+	assert.EqualError(t, err, "unable to get docker credentials for broken.example.com: credential helper fake failed: exit status 2 boom")
+}
+
+func TestDockerCredentials_ACRIdentityToken(t *testing.T) {
+	defer withDockerConfig(t, `{"auths":{"myregistry.azurecr.io":{"identitytoken":"refresh"}}}`)()
+
+	client := &docker.MockDocker{}
+	assert.NoError(t, (&ACR{Registry: "myregistry"}).Login(client, &bytes.Buffer{}))
+	assert.Equal(t, "00000000-0000-0000-0000-000000000000", client.Username)
+	assert.Equal(t, "refresh", client.Password)
+}
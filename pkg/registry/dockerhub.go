@@ -28,7 +28,11 @@ func (r Dockerhub) Configured() bool {
 }
 
 func (r Dockerhub) Login(client docker.Client, out io.Writer) error {
-	if ok, err := client.RegistryLogin(context.Background(), r.authConfig()); err == nil {
+	auth, err := r.authConfig()
+	if err != nil {
+		return err
+	}
+	if ok, err := client.RegistryLogin(context.Background(), auth); err == nil {
 		_, _ = fmt.Fprintln(out, ok.Status)
 		return nil
 	} else {
@@ -37,13 +41,21 @@ func (r Dockerhub) Login(client docker.Client, out io.Writer) error {
 	}
 }
 
+// resolveCredentials reports errors reading the credentials from the docker config
+func (r Dockerhub) resolveCredentials() error {
+	_, err := r.authConfig()
+	return err
+}
+
+// GetAuthInfo returns the credentials, errors are reported by Login and NewRegistryAPI
 func (r Dockerhub) GetAuthInfo() string {
-	authBytes, _ := json.Marshal(r.authConfig())
+	auth, _ := r.authConfig()
+	authBytes, _ := json.Marshal(auth)
 	return base64.URLEncoding.EncodeToString(authBytes)
 }
 
-func (r Dockerhub) authConfig() types.AuthConfig {
-	return types.AuthConfig{Username: r.Username, Password: r.Password}
+func (r Dockerhub) authConfig() (types.AuthConfig, error) {
+	return withDockerCredentials(types.AuthConfig{Username: r.Username, Password: r.Password}, dockerHubServer)
 }
 
 func (r Dockerhub) RegistryUrl() string {
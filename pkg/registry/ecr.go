@@ -1,25 +1,53 @@
 package registry
 
 import (
+	"bytes"
 	"context"
 	"docker.io/go-docker/api/types"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
 	"github.com/aws/aws-sdk-go/aws/session"
 	awsecr "github.com/aws/aws-sdk-go/service/ecr"
 	"github.com/aws/aws-sdk-go/service/ecr/ecriface"
+	"github.com/liamg/tml"
 	"github.com/sparetimecoders/build-tools/pkg/docker"
 	"io"
+	"io/ioutil"
+	"reflect"
 	"regexp"
+	"strconv"
 	"strings"
 )
 
 type ECR struct {
 	dockerRegistry
-	Url      string `yaml:"url" env:"ECR_URL"`
-	Region   string `yaml:"region" env:"ECR_REGION"`
+	Url    string `yaml:"url" env:"ECR_URL"`
+	Region string `yaml:"region" env:"ECR_REGION"`
+	// RegistryID is the AWS account id of the registry, needed when it's not the account of the credentials
+	RegistryID string `yaml:"registryId" env:"ECR_REGISTRY_ID"`
+	// RoleArn is a role to assume before calling ECR, i.e. a role in the account of the registry
+	RoleArn     string `yaml:"roleArn" env:"ECR_ROLE_ARN"`
+	ExternalID  string `yaml:"externalId" env:"ECR_EXTERNAL_ID"`
+	SessionName string `yaml:"sessionName" env:"ECR_SESSION_NAME"`
+	// LifecyclePolicy is the lifecycle policy JSON document, or LifecyclePolicyFile the path to it.
+	// New repositories get a policy expiring untagged images if none is configured
+	LifecyclePolicy     string `yaml:"lifecyclePolicy" env:"ECR_LIFECYCLE_POLICY"`
+	LifecyclePolicyFile string `yaml:"lifecyclePolicyFile" env:"ECR_LIFECYCLE_POLICY_FILE"`
+	// ScanOnPush is true or false, the setting is left as it is if empty
+	ScanOnPush string `yaml:"scanOnPush" env:"ECR_SCAN_ON_PUSH"`
+	// ImageTagMutability is either MUTABLE or IMMUTABLE
+	ImageTagMutability string `yaml:"imageTagMutability" env:"ECR_IMAGE_TAG_MUTABILITY"`
+	// Encryption is either AES256 or KMS, KMS is used if a KMSKey is set
+	Encryption string `yaml:"encryption" env:"ECR_ENCRYPTION"`
+	KMSKey     string `yaml:"kmsKey" env:"ECR_KMS_KEY"`
+	// RepositoryPolicy is the repository policy JSON document (i.e. allowing other accounts to pull), or RepositoryPolicyFile the path to it
+	RepositoryPolicy     string `yaml:"repositoryPolicy" env:"ECR_REPOSITORY_POLICY"`
+	RepositoryPolicyFile string `yaml:"repositoryPolicyFile" env:"ECR_REPOSITORY_POLICY_FILE"`
+
 	username string
 	password string
 	svc      ecriface.ECRAPI
@@ -27,6 +55,9 @@ type ECR struct {
 
 var _ Registry = &ECR{}
 
+// assumeRole returns the credentials for the assumed role, it's a variable to be replaced in tests
+var assumeRole = stscreds.NewCredentials
+
 func (r *ECR) Name() string {
 	return "ECR"
 }
@@ -37,7 +68,21 @@ func (r *ECR) Configured() bool {
 		if err != nil {
 			return false
 		}
-		r.svc = awsecr.New(sess)
+		if r.RoleArn == "" {
+			r.svc = awsecr.New(sess)
+			return true
+		}
+		sessionName := r.SessionName
+		if sessionName == "" {
+			sessionName = "build-tools"
+		}
+		creds := assumeRole(sess, r.RoleArn, func(p *stscreds.AssumeRoleProvider) {
+			p.RoleSessionName = sessionName
+			if r.ExternalID != "" {
+				p.ExternalID = aws.String(r.ExternalID)
+			}
+		})
+		r.svc = awsecr.New(sess, &aws.Config{Credentials: creds})
 		return true
 	}
 	return false
@@ -54,21 +99,9 @@ func (r *ECR) region() *string {
 }
 
 func (r *ECR) Login(client docker.Client, out io.Writer) error {
-	input := &awsecr.GetAuthorizationTokenInput{}
-
-	result, err := r.svc.GetAuthorizationToken(input)
-	if err != nil {
+	if err := r.credentials(out); err != nil {
 		return err
 	}
-
-	decoded, err := base64.StdEncoding.DecodeString(*result.AuthorizationData[0].AuthorizationToken)
-	if err != nil {
-		return err
-	}
-	parts := strings.Split(string(decoded), ":")
-	r.username = parts[0]
-	r.password = parts[1]
-
 	if ok, err := client.RegistryLogin(context.Background(), types.AuthConfig{Username: r.username, Password: r.password, ServerAddress: r.Url}); err == nil {
 		_, _ = fmt.Fprintln(out, ok.Status)
 		return nil
@@ -77,6 +110,47 @@ func (r *ECR) Login(client docker.Client, out io.Writer) error {
 	}
 }
 
+// credentials sets the username and password from an ECR authorization token, or the docker config if no token can be had
+func (r *ECR) credentials(out io.Writer) error {
+	input := &awsecr.GetAuthorizationTokenInput{}
+	if r.RegistryID != "" {
+		input.RegistryIds = []*string{aws.String(r.RegistryID)}
+	}
+
+	result, err := r.svc.GetAuthorizationToken(input)
+	if err != nil {
+		// Fall back to the docker config, i.e. docker-credential-ecr-login
+		_, _ = fmt.Fprintln(out, tml.Sprintf("<yellow>unable to get ECR authorization token: %v, trying docker credentials for %s</yellow>", err, r.Url))
+		auth, dockerErr := DockerCredentials(r.Url)
+		if dockerErr != nil {
+			return fmt.Errorf("unable to get ECR authorization token: %v, docker credentials for %s: %v", err, r.Url, dockerErr)
+		}
+		if auth == nil {
+			return fmt.Errorf("unable to get ECR authorization token: %v, no docker credentials found for %s", err, r.Url)
+		}
+		r.username = auth.Username
+		r.password = auth.Password
+	} else {
+		decoded, err := base64.StdEncoding.DecodeString(*result.AuthorizationData[0].AuthorizationToken)
+		if err != nil {
+			return err
+		}
+		parts := strings.Split(string(decoded), ":")
+		r.username = parts[0]
+		r.password = parts[1]
+	}
+	return nil
+}
+
+// resolveCredentials resolves the credentials unless Login already did
+func (r *ECR) resolveCredentials() error {
+	if len(r.username) > 0 {
+		return nil
+	}
+	return r.credentials(ioutil.Discard)
+}
+
+// GetAuthInfo returns the credentials resolved by Login or NewRegistryAPI
 func (r *ECR) GetAuthInfo() string {
 	auth := types.AuthConfig{Username: r.username, Password: r.password}
 	authBytes, _ := json.Marshal(auth)
@@ -87,21 +161,217 @@ func (r ECR) RegistryUrl() string {
 	return r.Url
 }
 
+// registryID returns the configured registry id, or nil to use the default registry of the credentials
+func (r ECR) registryID() *string {
+	if r.RegistryID == "" {
+		return nil
+	}
+	return aws.String(r.RegistryID)
+}
+
+const defaultLifecyclePolicy = `{"rules":[{"rulePriority":10,"description":"Only keep 20 images","selection":{"tagStatus":"untagged","countType":"imageCountMoreThan","countNumber":20},"action":{"type":"expire"}}]}`
+
+// Create creates the repository with the configured settings. The settings of an existing repository are
+// updated to match the configuration, settings that are not configured are left as they are
 func (r ECR) Create(repository string) error {
-	if _, err := r.svc.DescribeRepositories(&awsecr.DescribeRepositoriesInput{RepositoryNames: []*string{&repository}}); err != nil {
+	lifecyclePolicy, err := document("lifecycle policy", r.LifecyclePolicy, r.LifecyclePolicyFile)
+	if err != nil {
+		return err
+	}
+	repositoryPolicy, err := document("repository policy", r.RepositoryPolicy, r.RepositoryPolicyFile)
+	if err != nil {
+		return err
+	}
+	mutability, err := r.imageTagMutability()
+	if err != nil {
+		return err
+	}
+	encryption, err := r.encryptionConfiguration()
+	if err != nil {
+		return err
+	}
+	scanOnPush, err := r.scanOnPush()
+	if err != nil {
+		return err
+	}
+
+	existing, err := r.svc.DescribeRepositories(&awsecr.DescribeRepositoriesInput{RegistryId: r.registryID(), RepositoryNames: []*string{&repository}})
+	if err != nil {
+		if !isAwsError(err, awsecr.ErrCodeRepositoryNotFoundException) {
+			return fmt.Errorf("unable to describe repository '%s': %v", repository, err)
+		}
+		// CreateRepository has no registry id, the repository is always created in the account of the credentials
+		if r.RegistryID != "" && r.RoleArn == "" {
+			return fmt.Errorf("repository '%s' does not exist in registry %s, creating it in another account requires a roleArn in that account", repository, r.RegistryID)
+		}
 		input := &awsecr.CreateRepositoryInput{
-			RepositoryName: aws.String(repository),
+			RepositoryName:          aws.String(repository),
+			EncryptionConfiguration: encryption,
+		}
+		if scanOnPush != nil {
+			input.ImageScanningConfiguration = &awsecr.ImageScanningConfiguration{ScanOnPush: scanOnPush}
+		}
+		if mutability != "" {
+			input.ImageTagMutability = aws.String(mutability)
 		}
-
 		if _, err := r.svc.CreateRepository(input); err != nil {
 			return err
-		} else {
-			policyText := `{"rules":[{"rulePriority":10,"description":"Only keep 20 images","selection":{"tagStatus":"untagged","countType":"imageCountMoreThan","countNumber":20},"action":{"type":"expire"}}]}`
-			if _, err := r.svc.PutLifecyclePolicy(&awsecr.PutLifecyclePolicyInput{LifecyclePolicyText: &policyText, RepositoryName: &repository}); err != nil {
+		}
+		if lifecyclePolicy == "" {
+			lifecyclePolicy = defaultLifecyclePolicy
+		}
+		if _, err := r.svc.PutLifecyclePolicy(&awsecr.PutLifecyclePolicyInput{RegistryId: r.registryID(), LifecyclePolicyText: &lifecyclePolicy, RepositoryName: &repository}); err != nil {
+			return err
+		}
+		if repositoryPolicy != "" {
+			if _, err := r.svc.SetRepositoryPolicy(&awsecr.SetRepositoryPolicyInput{RegistryId: r.registryID(), PolicyText: &repositoryPolicy, RepositoryName: &repository}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	current := &awsecr.Repository{}
+	if len(existing.Repositories) > 0 {
+		current = existing.Repositories[0]
+	}
+	return r.reconcile(repository, current, lifecyclePolicy, repositoryPolicy, mutability, scanOnPush, encryption)
+}
+
+// reconcile updates the configured settings of an existing repository which differs from the configuration
+func (r ECR) reconcile(repository string, current *awsecr.Repository, lifecyclePolicy, repositoryPolicy, mutability string, scanOnPush *bool, encryption *awsecr.EncryptionConfiguration) error {
+	if encryption != nil {
+		currentType := awsecr.EncryptionTypeAes256
+		if current.EncryptionConfiguration != nil && current.EncryptionConfiguration.EncryptionType != nil {
+			currentType = *current.EncryptionConfiguration.EncryptionType
+		}
+		if currentType != *encryption.EncryptionType {
+			return fmt.Errorf("encryption of existing repository '%s' can't be changed from %s to %s", repository, currentType, *encryption.EncryptionType)
+		}
+	}
+	if scanOnPush != nil {
+		if current.ImageScanningConfiguration == nil || aws.BoolValue(current.ImageScanningConfiguration.ScanOnPush) != *scanOnPush {
+			input := &awsecr.PutImageScanningConfigurationInput{
+				RegistryId:                 r.registryID(),
+				RepositoryName:             &repository,
+				ImageScanningConfiguration: &awsecr.ImageScanningConfiguration{ScanOnPush: scanOnPush},
+			}
+			if _, err := r.svc.PutImageScanningConfiguration(input); err != nil {
+				return err
+			}
+		}
+	}
+	if mutability != "" && aws.StringValue(current.ImageTagMutability) != mutability {
+		if _, err := r.svc.PutImageTagMutability(&awsecr.PutImageTagMutabilityInput{RegistryId: r.registryID(), RepositoryName: &repository, ImageTagMutability: &mutability}); err != nil {
+			return err
+		}
+	}
+	if lifecyclePolicy != "" {
+		var currentPolicy string
+		if output, err := r.svc.GetLifecyclePolicy(&awsecr.GetLifecyclePolicyInput{RegistryId: r.registryID(), RepositoryName: &repository}); err == nil {
+			currentPolicy = aws.StringValue(output.LifecyclePolicyText)
+		} else if !isAwsError(err, awsecr.ErrCodeLifecyclePolicyNotFoundException) {
+			return err
+		}
+		if !sameDocument(currentPolicy, lifecyclePolicy) {
+			if _, err := r.svc.PutLifecyclePolicy(&awsecr.PutLifecyclePolicyInput{RegistryId: r.registryID(), LifecyclePolicyText: &lifecyclePolicy, RepositoryName: &repository}); err != nil {
+				return err
+			}
+		}
+	}
+	if repositoryPolicy != "" {
+		var currentPolicy string
+		if output, err := r.svc.GetRepositoryPolicy(&awsecr.GetRepositoryPolicyInput{RegistryId: r.registryID(), RepositoryName: &repository}); err == nil {
+			currentPolicy = aws.StringValue(output.PolicyText)
+		} else if !isAwsError(err, awsecr.ErrCodeRepositoryPolicyNotFoundException) {
+			return err
+		}
+		if !sameDocument(currentPolicy, repositoryPolicy) {
+			if _, err := r.svc.SetRepositoryPolicy(&awsecr.SetRepositoryPolicyInput{RegistryId: r.registryID(), PolicyText: &repositoryPolicy, RepositoryName: &repository}); err != nil {
 				return err
 			}
-			return nil
 		}
 	}
 	return nil
 }
+
+func (r ECR) scanOnPush() (*bool, error) {
+	if r.ScanOnPush == "" {
+		return nil, nil
+	}
+	scan, err := strconv.ParseBool(r.ScanOnPush)
+	if err != nil {
+		return nil, fmt.Errorf("invalid scanOnPush '%s', must be true or false", r.ScanOnPush)
+	}
+	return &scan, nil
+}
+
+func (r ECR) imageTagMutability() (string, error) {
+	mutability := strings.ToUpper(r.ImageTagMutability)
+	switch mutability {
+	case "", awsecr.ImageTagMutabilityMutable, awsecr.ImageTagMutabilityImmutable:
+		return mutability, nil
+	default:
+		return "", fmt.Errorf("invalid imageTagMutability '%s', must be %s or %s", r.ImageTagMutability, awsecr.ImageTagMutabilityMutable, awsecr.ImageTagMutabilityImmutable)
+	}
+}
+
+func (r ECR) encryptionConfiguration() (*awsecr.EncryptionConfiguration, error) {
+	encryption := strings.ToUpper(r.Encryption)
+	if encryption == "" && r.KMSKey != "" {
+		encryption = awsecr.EncryptionTypeKms
+	}
+	switch encryption {
+	case "":
+		return nil, nil
+	case awsecr.EncryptionTypeAes256:
+		if r.KMSKey != "" {
+			return nil, fmt.Errorf("kmsKey can only be used with %s encryption", awsecr.EncryptionTypeKms)
+		}
+		return &awsecr.EncryptionConfiguration{EncryptionType: aws.String(encryption)}, nil
+	case awsecr.EncryptionTypeKms:
+		config := &awsecr.EncryptionConfiguration{EncryptionType: aws.String(encryption)}
+		if r.KMSKey != "" {
+			config.KmsKey = aws.String(r.KMSKey)
+		}
+		return config, nil
+	default:
+		return nil, fmt.Errorf("invalid encryption '%s', must be %s or %s", r.Encryption, awsecr.EncryptionTypeAes256, awsecr.EncryptionTypeKms)
+	}
+}
+
+// document returns the compacted JSON document given inline or read from file
+func document(name, inline, file string) (string, error) {
+	if inline != "" && file != "" {
+		return "", fmt.Errorf("only one of an inline %s and a %s file can be set", name, name)
+	}
+	content := []byte(inline)
+	if file != "" {
+		var err error
+		if content, err = ioutil.ReadFile(file); err != nil {
+			return "", fmt.Errorf("unable to read %s: %v", name, err)
+		}
+	}
+	if len(content) == 0 {
+		return "", nil
+	}
+	buffer := &bytes.Buffer{}
+	if err := json.Compact(buffer, content); err != nil {
+		return "", fmt.Errorf("invalid %s: %v", name, err)
+	}
+	return buffer.String(), nil
+}
+
+// sameDocument returns true if the JSON documents are equal, ignoring formatting and the order of keys
+func sameDocument(a, b string) bool {
+	var x, y interface{}
+	if json.Unmarshal([]byte(a), &x) != nil || json.Unmarshal([]byte(b), &y) != nil {
+		return false
+	}
+	return reflect.DeepEqual(x, y)
+}
+
+func isAwsError(err error, code string) bool {
+	awsErr, ok := err.(awserr.Error)
+	return ok && awsErr.Code() == code
+}
@@ -3,20 +3,43 @@ package registry
 import (
 	"bytes"
 	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
 	awsecr "github.com/aws/aws-sdk-go/service/ecr"
 	"github.com/aws/aws-sdk-go/service/ecr/ecriface"
 	"github.com/stretchr/testify/assert"
+	"github.com/sparetimecoders/build-tools/pkg"
 	"github.com/sparetimecoders/build-tools/pkg/docker"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
 )
 
 func TestEcr_LoginAuthRequestFailed(t *testing.T) {
+	defer pkg.SetEnv("DOCKER_CONFIG", "/missing")()
 	client := &docker.MockDocker{}
 	registry := &ECR{Url: "ecr-url", Region: "eu-west-1", svc: &MockECR{loginError: fmt.Errorf("auth failure")}}
 	out := &bytes.Buffer{}
 	err := registry.Login(client, out)
-	assert.EqualError(t, err, "auth failure")
-	assert.Equal(t, "", out.String())
+	assert.EqualError(t, err, "unable to get ECR authorization token: auth failure, no docker credentials found for ecr-url")
+	assert.Equal(t, "\x1b[0m\x1b[33munable to get ECR authorization token: auth failure, trying docker credentials for ecr-url\x1b[39m\x1b[0m\n", out.String())
+}
+
+func TestEcr_LoginAuthRequestFailedInvalidDockerConfig(t *testing.T) {
+	dir, _ := ioutil.TempDir(os.TempDir(), "build-tools")
+	defer func() { _ = os.RemoveAll(dir) }()
+	_ = ioutil.WriteFile(filepath.Join(dir, "config.json"), []byte("not json"), 0644)
+	defer pkg.SetEnv("DOCKER_CONFIG", dir)()
+
+	client := &docker.MockDocker{}
+	registry := &ECR{Url: "ecr-url", Region: "eu-west-1", svc: &MockECR{loginError: fmt.Errorf("auth failure")}}
+	err := registry.Login(client, &bytes.Buffer{})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "unable to get ECR authorization token: auth failure, docker credentials for ecr-url: ")
 }
 
 func TestEcr_LoginInvalidAuthData(t *testing.T) {
@@ -49,12 +72,72 @@ func TestEcr_LoginSuccess(t *testing.T) {
 	assert.Equal(t, "Logged in\n", out.String())
 }
 
+func TestEcr_LoginWithRegistryID(t *testing.T) {
+	client := &docker.MockDocker{}
+	mock := &MockECR{authData: "QVdTOmFiYzEyMw=="}
+	registry := &ECR{Url: "ecr-url", Region: "eu-west-1", RegistryID: "123456789012", svc: mock}
+	err := registry.Login(client, &bytes.Buffer{})
+	assert.NoError(t, err)
+	assert.Equal(t, []*string{aws.String("123456789012")}, mock.getAuthorizationTokenInput.RegistryIds)
+}
+
+func TestEcr_ConfiguredWithAssumeRole(t *testing.T) {
+	defer func() { assumeRole = stscreds.NewCredentials }()
+	creds := credentials.NewStaticCredentials("id", "secret", "")
+	provider := &stscreds.AssumeRoleProvider{}
+	assumeRole = func(c client.ConfigProvider, roleARN string, options ...func(*stscreds.AssumeRoleProvider)) *credentials.Credentials {
+		provider.RoleARN = roleARN
+		for _, option := range options {
+			option(provider)
+		}
+		return creds
+	}
+
+	registry := &ECR{Url: "123456789012.dkr.ecr.eu-west-1.amazonaws.com", RoleArn: "arn:aws:iam::123456789012:role/push", ExternalID: "external"}
+	assert.True(t, registry.Configured())
+	assert.Equal(t, "arn:aws:iam::123456789012:role/push", provider.RoleARN)
+	assert.Equal(t, "build-tools", provider.RoleSessionName)
+	assert.Equal(t, aws.String("external"), provider.ExternalID)
+	assert.Equal(t, creds, registry.svc.(*awsecr.ECR).Config.Credentials)
+
+	registry = &ECR{Url: "123456789012.dkr.ecr.eu-west-1.amazonaws.com", RoleArn: "arn:aws:iam::123456789012:role/push", SessionName: "pipeline-42"}
+	provider = &stscreds.AssumeRoleProvider{}
+	assert.True(t, registry.Configured())
+	assert.Equal(t, "pipeline-42", provider.RoleSessionName)
+	assert.Nil(t, provider.ExternalID)
+}
+
+func TestEcr_ConfiguredWithoutAssumeRole(t *testing.T) {
+	defer func() { assumeRole = stscreds.NewCredentials }()
+	assumeRole = func(c client.ConfigProvider, roleARN string, options ...func(*stscreds.AssumeRoleProvider)) *credentials.Credentials {
+		t.Fatal("no role should be assumed")
+		return nil
+	}
+
+	registry := &ECR{Url: "123456789012.dkr.ecr.eu-west-1.amazonaws.com"}
+	assert.True(t, registry.Configured())
+	assert.NotNil(t, registry.svc)
+}
+
 func TestEcr_GetAuthInfo(t *testing.T) {
 	registry := &ECR{Url: "ecr-url", Region: "eu-west-1", username: "AWS", password: "abc123"}
 	auth := registry.GetAuthInfo()
 	assert.Equal(t, "eyJ1c2VybmFtZSI6IkFXUyIsInBhc3N3b3JkIjoiYWJjMTIzIn0=", auth)
 }
 
+func TestEcr_NewRegistryAPI(t *testing.T) {
+	api, err := NewRegistryAPI(&ECR{Url: "ecr-url", Region: "eu-west-1", svc: &MockECR{authData: "QVdTOmFiYzEyMw=="}})
+	assert.NoError(t, err)
+	assert.Equal(t, "AWS", api.username)
+	assert.Equal(t, "abc123", api.password)
+}
+
+func TestEcr_NewRegistryAPIAuthRequestFailed(t *testing.T) {
+	defer pkg.SetEnv("DOCKER_CONFIG", "/missing")()
+	_, err := NewRegistryAPI(&ECR{Url: "ecr-url", Region: "eu-west-1", svc: &MockECR{loginError: fmt.Errorf("auth failure")}})
+	assert.EqualError(t, err, "unable to get ECR authorization token: auth failure, no docker credentials found for ecr-url")
+}
+
 func TestEcr_ExistingRepository(t *testing.T) {
 	mock := &MockECR{repoExists: true}
 	registry := &ECR{svc: mock}
@@ -64,6 +147,31 @@ func TestEcr_ExistingRepository(t *testing.T) {
 	assert.Equal(t, []*string{&repo}, mock.describeRepositoriesInput.RepositoryNames)
 }
 
+func TestEcr_DescribeRepositoryError(t *testing.T) {
+	mock := &MockECR{describeError: fmt.Errorf("access denied")}
+	registry := &ECR{svc: mock}
+	err := registry.Create("repo")
+	assert.EqualError(t, err, "unable to describe repository 'repo': access denied")
+	assert.Nil(t, mock.createRepositoryInput)
+}
+
+func TestEcr_NewRepositoryInOtherAccountWithoutRole(t *testing.T) {
+	mock := &MockECR{}
+	registry := &ECR{svc: mock, RegistryID: "123456789012"}
+	err := registry.Create("repo")
+	assert.EqualError(t, err, "repository 'repo' does not exist in registry 123456789012, creating it in another account requires a roleArn in that account")
+	assert.Nil(t, mock.createRepositoryInput)
+}
+
+func TestEcr_NewRepositoryInOtherAccountWithRole(t *testing.T) {
+	mock := &MockECR{}
+	registry := &ECR{svc: mock, RegistryID: "123456789012", RoleArn: "arn:aws:iam::123456789012:role/push"}
+	err := registry.Create("repo")
+	assert.NoError(t, err)
+	assert.Equal(t, aws.String("repo"), mock.createRepositoryInput.RepositoryName)
+	assert.Equal(t, aws.String("123456789012"), mock.putLifecyclePolicyInput.RegistryId)
+}
+
 func TestEcr_NewRepositoryCreateError(t *testing.T) {
 	registry := &ECR{svc: &MockECR{createError: fmt.Errorf("create error")}}
 	err := registry.Create("repo")
@@ -87,6 +195,142 @@ func TestEcr_NewRepository(t *testing.T) {
 	assert.Equal(t, &policyText, mock.putLifecyclePolicyInput.LifecyclePolicyText)
 }
 
+func TestEcr_NewRepositoryWithSettings(t *testing.T) {
+	dir, _ := ioutil.TempDir(os.TempDir(), "build-tools")
+	defer func() { _ = os.RemoveAll(dir) }()
+	policyFile := filepath.Join(dir, "policy.json")
+	_ = ioutil.WriteFile(policyFile, []byte(`{
+  "Version": "2012-10-17",
+  "Statement": [{"Sid": "pull", "Effect": "Allow", "Principal": {"AWS": "arn:aws:iam::123456789012:root"}, "Action": ["ecr:BatchGetImage", "ecr:GetDownloadUrlForLayer"]}]
+}`), 0666)
+
+	mock := &MockECR{}
+	registry := &ECR{
+		svc:                  mock,
+		LifecyclePolicy:      `{"rules": []}`,
+		ScanOnPush:           "true",
+		ImageTagMutability:   "immutable",
+		KMSKey:               "alias/ecr",
+		RepositoryPolicyFile: policyFile,
+	}
+	repo := "repo"
+	err := registry.Create(repo)
+	assert.NoError(t, err)
+	assert.Equal(t, &awsecr.CreateRepositoryInput{
+		RepositoryName:             &repo,
+		ImageScanningConfiguration: &awsecr.ImageScanningConfiguration{ScanOnPush: aws.Bool(true)},
+		ImageTagMutability:         aws.String("IMMUTABLE"),
+		EncryptionConfiguration:    &awsecr.EncryptionConfiguration{EncryptionType: aws.String("KMS"), KmsKey: aws.String("alias/ecr")},
+	}, mock.createRepositoryInput)
+	assert.Equal(t, `{"rules":[]}`, *mock.putLifecyclePolicyInput.LifecyclePolicyText)
+	assert.Equal(t, `{"Version":"2012-10-17","Statement":[{"Sid":"pull","Effect":"Allow","Principal":{"AWS":"arn:aws:iam::123456789012:root"},"Action":["ecr:BatchGetImage","ecr:GetDownloadUrlForLayer"]}]}`, *mock.setRepositoryPolicyInput.PolicyText)
+}
+
+func TestEcr_NewRepositorySetPolicyError(t *testing.T) {
+	registry := &ECR{svc: &MockECR{setRepositoryPolicyError: fmt.Errorf("policy error")}, RepositoryPolicy: `{}`}
+	err := registry.Create("repo")
+	assert.EqualError(t, err, "policy error")
+}
+
+func TestEcr_InvalidSettings(t *testing.T) {
+	tests := []struct {
+		name     string
+		registry ECR
+		err      string
+	}{
+		{name: "mutability", registry: ECR{ImageTagMutability: "sometimes"}, err: "invalid imageTagMutability 'sometimes', must be MUTABLE or IMMUTABLE"},
+		{name: "scan on push", registry: ECR{ScanOnPush: "always"}, err: "invalid scanOnPush 'always', must be true or false"},
+		{name: "encryption", registry: ECR{Encryption: "rot13"}, err: "invalid encryption 'rot13', must be AES256 or KMS"},
+		{name: "key without kms", registry: ECR{Encryption: "AES256", KMSKey: "key"}, err: "kmsKey can only be used with KMS encryption"},
+		{name: "invalid json", registry: ECR{LifecyclePolicy: `{"rules":`}, err: "invalid lifecycle policy: unexpected end of JSON input"},
+		{name: "inline and file", registry: ECR{RepositoryPolicy: `{}`, RepositoryPolicyFile: "policy.json"}, err: "only one of an inline repository policy and a repository policy file can be set"},
+		{name: "missing file", registry: ECR{LifecyclePolicyFile: "/missing/policy.json"}, err: "unable to read lifecycle policy: open /missing/policy.json: no such file or directory"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := &MockECR{}
+			tt.registry.svc = mock
+			err := tt.registry.Create("repo")
+			assert.EqualError(t, err, tt.err)
+			assert.Nil(t, mock.describeRepositoriesInput)
+		})
+	}
+}
+
+func TestEcr_ExistingRepositoryReconcile(t *testing.T) {
+	mock := &MockECR{
+		repoExists:      true,
+		repository:      &awsecr.Repository{ImageTagMutability: aws.String("MUTABLE")},
+		lifecyclePolicy: `{"rules":[{"rulePriority":1}]}`,
+	}
+	registry := &ECR{
+		svc:                mock,
+		LifecyclePolicy:    `{"rules":[{"rulePriority":2}]}`,
+		ScanOnPush:         "true",
+		ImageTagMutability: "IMMUTABLE",
+		RepositoryPolicy:   `{"Version":"2012-10-17"}`,
+	}
+	repo := "repo"
+	err := registry.Create(repo)
+	assert.NoError(t, err)
+	assert.Nil(t, mock.createRepositoryInput)
+	assert.Equal(t, &awsecr.PutImageScanningConfigurationInput{RepositoryName: &repo, ImageScanningConfiguration: &awsecr.ImageScanningConfiguration{ScanOnPush: aws.Bool(true)}}, mock.putImageScanningConfigurationInput)
+	assert.Equal(t, &awsecr.PutImageTagMutabilityInput{RepositoryName: &repo, ImageTagMutability: aws.String("IMMUTABLE")}, mock.putImageTagMutabilityInput)
+	assert.Equal(t, `{"rules":[{"rulePriority":2}]}`, *mock.putLifecyclePolicyInput.LifecyclePolicyText)
+	assert.Equal(t, `{"Version":"2012-10-17"}`, *mock.setRepositoryPolicyInput.PolicyText)
+}
+
+func TestEcr_ExistingRepositoryUpToDate(t *testing.T) {
+	mock := &MockECR{
+		repoExists: true,
+		repository: &awsecr.Repository{
+			ImageTagMutability:         aws.String("IMMUTABLE"),
+			ImageScanningConfiguration: &awsecr.ImageScanningConfiguration{ScanOnPush: aws.Bool(false)},
+			EncryptionConfiguration:    &awsecr.EncryptionConfiguration{EncryptionType: aws.String("KMS")},
+		},
+		lifecyclePolicy:  `{"rules": [ {"rulePriority": 1, "description": "x"} ]}`,
+		repositoryPolicy: `{"Version":"2012-10-17","Statement":[]}`,
+	}
+	registry := &ECR{
+		svc:                mock,
+		LifecyclePolicy:    `{"rules":[{"description":"x","rulePriority":1}]}`,
+		ScanOnPush:         "false",
+		ImageTagMutability: "IMMUTABLE",
+		Encryption:         "kms",
+		RepositoryPolicy:   `{"Statement":[],"Version":"2012-10-17"}`,
+	}
+	err := registry.Create("repo")
+	assert.NoError(t, err)
+	assert.Nil(t, mock.putImageScanningConfigurationInput)
+	assert.Nil(t, mock.putImageTagMutabilityInput)
+	assert.Nil(t, mock.putLifecyclePolicyInput)
+	assert.Nil(t, mock.setRepositoryPolicyInput)
+}
+
+func TestEcr_ExistingRepositoryWithRegistryID(t *testing.T) {
+	mock := &MockECR{repoExists: true}
+	registry := &ECR{svc: mock, RegistryID: "123456789012", LifecyclePolicy: `{"rules":[]}`}
+	err := registry.Create("repo")
+	assert.NoError(t, err)
+	assert.Equal(t, aws.String("123456789012"), mock.describeRepositoriesInput.RegistryId)
+	assert.Equal(t, aws.String("123456789012"), mock.putLifecyclePolicyInput.RegistryId)
+}
+
+func TestEcr_ExistingRepositoryEncryptionChanged(t *testing.T) {
+	mock := &MockECR{repoExists: true, repository: &awsecr.Repository{}}
+	registry := &ECR{svc: mock, KMSKey: "alias/ecr"}
+	err := registry.Create("repo")
+	assert.EqualError(t, err, "encryption of existing repository 'repo' can't be changed from AES256 to KMS")
+}
+
+func TestEcr_ExistingRepositoryGetLifecyclePolicyError(t *testing.T) {
+	mock := &MockECR{repoExists: true, getLifecyclePolicyError: fmt.Errorf("access denied")}
+	registry := &ECR{svc: mock, LifecyclePolicy: `{"rules":[]}`}
+	err := registry.Create("repo")
+	assert.EqualError(t, err, "access denied")
+	assert.Nil(t, mock.putLifecyclePolicyInput)
+}
+
 func TestEcr_ParseECRUrlIfNoRegionIsSet(t *testing.T) {
 	ecr := ECR{
 		Url: "12345678.dkr.ecr.eu-west-1.amazonaws.com",
@@ -104,17 +348,28 @@ func TestEcr_UseRegionIfSet(t *testing.T) {
 
 type MockECR struct {
 	ecriface.ECRAPI
-	loginError                error
-	authData                  string
-	describeRepositoriesInput *awsecr.DescribeRepositoriesInput
-	repoExists                bool
-	createError               error
-	createRepositoryInput     *awsecr.CreateRepositoryInput
-	putLifecyclePolicyInput   *awsecr.PutLifecyclePolicyInput
-	putError                  error
+	loginError                         error
+	authData                           string
+	getAuthorizationTokenInput         *awsecr.GetAuthorizationTokenInput
+	describeRepositoriesInput          *awsecr.DescribeRepositoriesInput
+	describeError                      error
+	repoExists                         bool
+	repository                         *awsecr.Repository
+	createError                        error
+	createRepositoryInput              *awsecr.CreateRepositoryInput
+	putLifecyclePolicyInput            *awsecr.PutLifecyclePolicyInput
+	putError                           error
+	lifecyclePolicy                    string
+	getLifecyclePolicyError            error
+	repositoryPolicy                   string
+	setRepositoryPolicyInput           *awsecr.SetRepositoryPolicyInput
+	setRepositoryPolicyError           error
+	putImageScanningConfigurationInput *awsecr.PutImageScanningConfigurationInput
+	putImageTagMutabilityInput         *awsecr.PutImageTagMutabilityInput
 }
 
-func (r MockECR) GetAuthorizationToken(input *awsecr.GetAuthorizationTokenInput) (*awsecr.GetAuthorizationTokenOutput, error) {
+func (r *MockECR) GetAuthorizationToken(input *awsecr.GetAuthorizationTokenInput) (*awsecr.GetAuthorizationTokenOutput, error) {
+	r.getAuthorizationTokenInput = input
 	if r.loginError != nil {
 		return &awsecr.GetAuthorizationTokenOutput{AuthorizationData: []*awsecr.AuthorizationData{}}, r.loginError
 	}
@@ -123,10 +378,16 @@ func (r MockECR) GetAuthorizationToken(input *awsecr.GetAuthorizationTokenInput)
 
 func (r *MockECR) DescribeRepositories(input *awsecr.DescribeRepositoriesInput) (*awsecr.DescribeRepositoriesOutput, error) {
 	r.describeRepositoriesInput = input
+	if r.describeError != nil {
+		return nil, r.describeError
+	}
 	if r.repoExists {
+		if r.repository != nil {
+			return &awsecr.DescribeRepositoriesOutput{Repositories: []*awsecr.Repository{r.repository}}, nil
+		}
 		return &awsecr.DescribeRepositoriesOutput{Repositories: []*awsecr.Repository{}}, nil
 	}
-	return &awsecr.DescribeRepositoriesOutput{Repositories: []*awsecr.Repository{}}, fmt.Errorf("NoDockerRegistry repository found")
+	return &awsecr.DescribeRepositoriesOutput{Repositories: []*awsecr.Repository{}}, awserr.New(awsecr.ErrCodeRepositoryNotFoundException, "repository does not exist", nil)
 }
 
 func (r *MockECR) CreateRepository(input *awsecr.CreateRepositoryInput) (*awsecr.CreateRepositoryOutput, error) {
@@ -138,3 +399,35 @@ func (r *MockECR) PutLifecyclePolicy(input *awsecr.PutLifecyclePolicyInput) (*aw
 	r.putLifecyclePolicyInput = input
 	return &awsecr.PutLifecyclePolicyOutput{}, r.putError
 }
+
+func (r *MockECR) GetLifecyclePolicy(input *awsecr.GetLifecyclePolicyInput) (*awsecr.GetLifecyclePolicyOutput, error) {
+	if r.getLifecyclePolicyError != nil {
+		return nil, r.getLifecyclePolicyError
+	}
+	if r.lifecyclePolicy == "" {
+		return nil, awserr.New(awsecr.ErrCodeLifecyclePolicyNotFoundException, "Lifecycle policy does not exist", nil)
+	}
+	return &awsecr.GetLifecyclePolicyOutput{LifecyclePolicyText: &r.lifecyclePolicy, RepositoryName: input.RepositoryName}, nil
+}
+
+func (r *MockECR) GetRepositoryPolicy(input *awsecr.GetRepositoryPolicyInput) (*awsecr.GetRepositoryPolicyOutput, error) {
+	if r.repositoryPolicy == "" {
+		return nil, awserr.New(awsecr.ErrCodeRepositoryPolicyNotFoundException, "Repository policy does not exist", nil)
+	}
+	return &awsecr.GetRepositoryPolicyOutput{PolicyText: &r.repositoryPolicy, RepositoryName: input.RepositoryName}, nil
+}
+
+func (r *MockECR) SetRepositoryPolicy(input *awsecr.SetRepositoryPolicyInput) (*awsecr.SetRepositoryPolicyOutput, error) {
+	r.setRepositoryPolicyInput = input
+	return &awsecr.SetRepositoryPolicyOutput{}, r.setRepositoryPolicyError
+}
+
+func (r *MockECR) PutImageScanningConfiguration(input *awsecr.PutImageScanningConfigurationInput) (*awsecr.PutImageScanningConfigurationOutput, error) {
+	r.putImageScanningConfigurationInput = input
+	return &awsecr.PutImageScanningConfigurationOutput{}, nil
+}
+
+func (r *MockECR) PutImageTagMutability(input *awsecr.PutImageTagMutabilityInput) (*awsecr.PutImageTagMutabilityOutput, error) {
+	r.putImageTagMutabilityInput = input
+	return &awsecr.PutImageTagMutabilityOutput{}, nil
+}
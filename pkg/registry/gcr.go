@@ -0,0 +1,133 @@
+package registry
+
+import (
+	"context"
+	"docker.io/go-docker/api/types"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/sparetimecoders/build-tools/pkg/docker"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+const (
+	gcrJsonKeyUsername     = "_json_key"
+	gcrAccessTokenUsername = "oauth2accesstoken"
+)
+
+// GCR is Google Container Registry (gcr.io, eu.gcr.io...) or Artifact Registry (<region>-docker.pkg.dev)
+type GCR struct {
+	dockerRegistry
+	Host string `yaml:"host" env:"GCR_HOST"`
+	// Project is the Google Cloud project id
+	Project string `yaml:"project" env:"GCR_PROJECT"`
+	// Repository is the Artifact Registry repository, not used with gcr.io
+	Repository  string `yaml:"repository" env:"GCR_REPOSITORY"`
+	KeyFile     string `yaml:"keyFile" env:"GCR_KEYFILE"`
+	Key         string `yaml:"key" env:"GCR_KEY"`
+	AccessToken string `yaml:"accessToken" env:"GCR_ACCESS_TOKEN"`
+	username    string
+	password    string
+}
+
+var _ Registry = &GCR{}
+
+func (r *GCR) Name() string {
+	return "GCR"
+}
+
+func (r *GCR) Configured() bool {
+	return len(r.Project) > 0
+}
+
+func (r *GCR) Login(client docker.Client, out io.Writer) error {
+	if err := r.credentials(); err != nil {
+		return err
+	}
+	if ok, err := client.RegistryLogin(context.Background(), r.authConfig()); err == nil {
+		_, _ = fmt.Fprintln(out, ok.Status)
+		return nil
+	} else {
+		return err
+	}
+}
+
+// credentials sets the username and password from the service account key, or the access token if no key is given
+func (r *GCR) credentials() error {
+	key := r.Key
+	if len(r.KeyFile) > 0 {
+		content, err := ioutil.ReadFile(r.KeyFile)
+		if err != nil {
+			return fmt.Errorf("unable to read GCR key file: %v", err)
+		}
+		key = string(content)
+	}
+	key = strings.TrimSpace(key)
+	if len(key) > 0 {
+		// Keys in environment variables are often base64 encoded to keep them on a single line
+		if !strings.HasPrefix(key, "{") {
+			decoded, err := base64.StdEncoding.DecodeString(key)
+			if err != nil {
+				return fmt.Errorf("GCR key is neither JSON nor base64 encoded JSON")
+			}
+			key = string(decoded)
+		}
+		r.username = gcrJsonKeyUsername
+		r.password = key
+		return nil
+	}
+	if len(r.AccessToken) > 0 {
+		r.username = gcrAccessTokenUsername
+		r.password = r.AccessToken
+		return nil
+	}
+	if auth, err := DockerCredentials(r.host()); err != nil {
+		return err
+	} else if auth != nil && len(auth.Username) > 0 {
+		r.username = auth.Username
+		r.password = auth.Password
+		return nil
+	}
+	return errors.New("GCR requires a service account key, an access token or credentials in the docker config")
+}
+
+// resolveCredentials resolves the credentials unless Login already did
+func (r *GCR) resolveCredentials() error {
+	if len(r.username) > 0 {
+		return nil
+	}
+	return r.credentials()
+}
+
+// GetAuthInfo returns the credentials resolved by Login or NewRegistryAPI
+func (r *GCR) GetAuthInfo() string {
+	auth := r.authConfig()
+	authBytes, _ := json.Marshal(auth)
+	return base64.URLEncoding.EncodeToString(authBytes)
+}
+
+func (r *GCR) authConfig() types.AuthConfig {
+	return types.AuthConfig{Username: r.username, Password: r.password, ServerAddress: r.host()}
+}
+
+func (r *GCR) host() string {
+	if len(r.Host) == 0 {
+		return "gcr.io"
+	}
+	return r.Host
+}
+
+func (r *GCR) RegistryUrl() string {
+	if strings.HasSuffix(r.host(), "-docker.pkg.dev") && len(r.Repository) > 0 {
+		return fmt.Sprintf("%s/%s/%s", r.host(), r.Project, r.Repository)
+	}
+	return fmt.Sprintf("%s/%s", r.host(), r.Project)
+}
+
+// Create does nothing, images are created when pushed (the Artifact Registry repository must exist)
+func (r *GCR) Create(repository string) error {
+	return nil
+}
@@ -0,0 +1,125 @@
+package registry
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/sparetimecoders/build-tools/pkg/docker"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const gcrKey = `{"type":"service_account","project_id":"project"}`
+
+func TestGCR_LoginWithKey(t *testing.T) {
+	client := &docker.MockDocker{}
+	registry := &GCR{Project: "project", Key: gcrKey}
+	out := &bytes.Buffer{}
+	err := registry.Login(client, out)
+	assert.Nil(t, err)
+	assert.Equal(t, "_json_key", client.Username)
+	assert.Equal(t, gcrKey, client.Password)
+	assert.Equal(t, "gcr.io", client.ServerAddress)
+	assert.Equal(t, "Logged in\n", out.String())
+}
+
+func TestGCR_LoginWithBase64Key(t *testing.T) {
+	client := &docker.MockDocker{}
+	registry := &GCR{Project: "project", Host: "eu.gcr.io", Key: base64.StdEncoding.EncodeToString([]byte(gcrKey))}
+	err := registry.Login(client, &bytes.Buffer{})
+	assert.Nil(t, err)
+	assert.Equal(t, "_json_key", client.Username)
+	assert.Equal(t, gcrKey, client.Password)
+	assert.Equal(t, "eu.gcr.io", client.ServerAddress)
+}
+
+func TestGCR_LoginWithInvalidKey(t *testing.T) {
+	registry := &GCR{Project: "project", Key: "not a key"}
+	err := registry.Login(&docker.MockDocker{}, &bytes.Buffer{})
+	assert.EqualError(t, err, "GCR key is neither JSON nor base64 encoded JSON")
+}
+
+func TestGCR_LoginWithKeyFile(t *testing.T) {
+	dir, _ := ioutil.TempDir(os.TempDir(), "build-tools")
+	defer func() { _ = os.RemoveAll(dir) }()
+	keyFile := filepath.Join(dir, "key.json")
+	_ = ioutil.WriteFile(keyFile, []byte(gcrKey+"\n"), 0600)
+
+	client := &docker.MockDocker{}
+	registry := &GCR{Project: "project", KeyFile: keyFile, AccessToken: "token"}
+	err := registry.Login(client, &bytes.Buffer{})
+	assert.Nil(t, err)
+	assert.Equal(t, "_json_key", client.Username)
+	assert.Equal(t, gcrKey, client.Password)
+}
+
+func TestGCR_LoginWithMissingKeyFile(t *testing.T) {
+	registry := &GCR{Project: "project", KeyFile: "/missing/key.json"}
+	err := registry.Login(&docker.MockDocker{}, &bytes.Buffer{})
+	assert.EqualError(t, err, "unable to read GCR key file: open /missing/key.json: no such file or directory")
+}
+
+func TestGCR_LoginWithAccessToken(t *testing.T) {
+	client := &docker.MockDocker{}
+	registry := &GCR{Project: "project", Host: "europe-west1-docker.pkg.dev", AccessToken: "ya29.token"}
+	err := registry.Login(client, &bytes.Buffer{})
+	assert.Nil(t, err)
+	assert.Equal(t, "oauth2accesstoken", client.Username)
+	assert.Equal(t, "ya29.token", client.Password)
+	assert.Equal(t, "europe-west1-docker.pkg.dev", client.ServerAddress)
+}
+
+func TestGCR_LoginWithoutCredentials(t *testing.T) {
+	registry := &GCR{Project: "project"}
+	err := registry.Login(&docker.MockDocker{}, &bytes.Buffer{})
+	assert.EqualError(t, err, "GCR requires a service account key, an access token or credentials in the docker config")
+}
+
+func TestGCR_LoginError(t *testing.T) {
+	client := &docker.MockDocker{LoginError: fmt.Errorf("invalid username/password")}
+	registry := &GCR{Project: "project", AccessToken: "token"}
+	out := &bytes.Buffer{}
+	err := registry.Login(client, out)
+	assert.EqualError(t, err, "invalid username/password")
+	assert.Equal(t, "", out.String())
+}
+
+func TestGCR_GetAuthInfo(t *testing.T) {
+	registry := &GCR{Project: "project", AccessToken: "token"}
+	_ = registry.Login(&docker.MockDocker{}, &bytes.Buffer{})
+	auth := registry.GetAuthInfo()
+	decoded, _ := base64.URLEncoding.DecodeString(auth)
+	assert.Equal(t, `{"username":"oauth2accesstoken","password":"token","serveraddress":"gcr.io"}`, string(decoded))
+}
+
+func TestGCR_NewRegistryAPI(t *testing.T) {
+	api, err := NewRegistryAPI(&GCR{Project: "project", AccessToken: "token"})
+	assert.NoError(t, err)
+	assert.Equal(t, "oauth2accesstoken", api.username)
+	assert.Equal(t, "token", api.password)
+}
+
+func TestGCR_NewRegistryAPIWithoutCredentials(t *testing.T) {
+	_, err := NewRegistryAPI(&GCR{Project: "project"})
+	assert.EqualError(t, err, "GCR requires a service account key, an access token or credentials in the docker config")
+}
+
+func TestGCR_RegistryUrl(t *testing.T) {
+	assert.Equal(t, "gcr.io/project", (&GCR{Project: "project"}).RegistryUrl())
+	assert.Equal(t, "eu.gcr.io/project", (&GCR{Host: "eu.gcr.io", Project: "project"}).RegistryUrl())
+	assert.Equal(t, "europe-west1-docker.pkg.dev/project/images", (&GCR{Host: "europe-west1-docker.pkg.dev", Project: "project", Repository: "images"}).RegistryUrl())
+}
+
+func TestGCR_Configured(t *testing.T) {
+	assert.False(t, (&GCR{}).Configured())
+	assert.True(t, (&GCR{Project: "project"}).Configured())
+}
+
+func TestGCR_Create(t *testing.T) {
+	registry := &GCR{}
+	err := registry.Create("repo")
+	assert.Nil(t, err)
+}
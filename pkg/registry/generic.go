@@ -0,0 +1,158 @@
+package registry
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"docker.io/go-docker/api/types"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/sparetimecoders/build-tools/pkg/docker"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// Generic is a self-hosted registry implementing the Docker Registry HTTP API V2, i.e. distribution, Harbor or Nexus
+type Generic struct {
+	dockerRegistry
+	// Url is the host (and port) of the registry, i.e. registry.example.com:5000
+	Url string `yaml:"url" env:"GENERIC_REGISTRY_URL"`
+	// Path is prepended to the image names, i.e. the Harbor project
+	Path     string `yaml:"path" env:"GENERIC_REGISTRY_PATH"`
+	Username string `yaml:"username" env:"GENERIC_REGISTRY_USERNAME"`
+	Password string `yaml:"password" env:"GENERIC_REGISTRY_PASSWORD"`
+	// Token is a bearer token used instead of username and password
+	Token string `yaml:"token" env:"GENERIC_REGISTRY_TOKEN"`
+	// CA is a file with the PEM encoded certificates to trust for the registry API
+	CA       string `yaml:"ca" env:"GENERIC_REGISTRY_CA"`
+	Insecure bool   `yaml:"insecure" env:"GENERIC_REGISTRY_INSECURE"`
+	// Harbor enables creating the Harbor project given by the first part of Path
+	Harbor bool `yaml:"harbor" env:"GENERIC_REGISTRY_HARBOR"`
+}
+
+var _ Registry = &Generic{}
+var _ HTTPClientProvider = &Generic{}
+
+func (r *Generic) Name() string {
+	return "Generic"
+}
+
+func (r *Generic) Configured() bool {
+	return len(r.Url) > 0
+}
+
+func (r *Generic) Login(client docker.Client, out io.Writer) error {
+	if len(r.Token) > 0 {
+		// The token is passed with each push, the docker daemon can't log in with a bearer token
+		_, _ = fmt.Fprintln(out, "Using token authentication")
+		return nil
+	}
+	auth, err := r.authConfig()
+	if err != nil {
+		return err
+	}
+	if ok, err := client.RegistryLogin(context.Background(), auth); err == nil {
+		_, _ = fmt.Fprintln(out, ok.Status)
+		return nil
+	} else {
+		return err
+	}
+}
+
+// resolveCredentials reports errors reading the credentials from the docker config
+func (r *Generic) resolveCredentials() error {
+	_, err := r.authConfig()
+	return err
+}
+
+// GetAuthInfo returns the credentials, errors are reported by Login and NewRegistryAPI
+func (r *Generic) GetAuthInfo() string {
+	auth, _ := r.authConfig()
+	authBytes, _ := json.Marshal(auth)
+	return base64.URLEncoding.EncodeToString(authBytes)
+}
+
+func (r *Generic) authConfig() (types.AuthConfig, error) {
+	if len(r.Token) > 0 {
+		return types.AuthConfig{RegistryToken: r.Token, ServerAddress: r.Url}, nil
+	}
+	return withDockerCredentials(types.AuthConfig{Username: r.Username, Password: r.Password, ServerAddress: r.Url}, r.Url)
+}
+
+func (r *Generic) RegistryUrl() string {
+	if path := strings.Trim(r.Path, "/"); len(path) > 0 {
+		return fmt.Sprintf("%s/%s", r.Url, path)
+	}
+	return r.Url
+}
+
+// HTTPClient returns a client trusting the configured CA, or skipping verification if the registry is insecure
+func (r *Generic) HTTPClient() (*http.Client, error) {
+	if len(r.CA) == 0 && !r.Insecure {
+		return http.DefaultClient, nil
+	}
+	config := &tls.Config{InsecureSkipVerify: r.Insecure}
+	if len(r.CA) > 0 {
+		content, err := ioutil.ReadFile(r.CA)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read CA bundle: %v", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(content) {
+			return nil, fmt.Errorf("no certificates found in CA bundle %s", r.CA)
+		}
+		config.RootCAs = pool
+	}
+	return &http.Client{Transport: &http.Transport{Proxy: http.ProxyFromEnvironment, TLSClientConfig: config}}, nil
+}
+
+// Create creates the Harbor project if enabled, otherwise repositories are created when pushed
+func (r *Generic) Create(repository string) error {
+	if !r.Harbor {
+		return nil
+	}
+	project := strings.Split(strings.Trim(r.Path, "/"), "/")[0]
+	if len(project) == 0 {
+		return errors.New("a path is required to create the Harbor project")
+	}
+	client, err := r.HTTPClient()
+	if err != nil {
+		return err
+	}
+	body, _ := json.Marshal(map[string]interface{}{"project_name": project, "metadata": map[string]string{"public": "false"}})
+	req, err := http.NewRequest(http.MethodPost, fmt.Sprintf("%s://%s/api/v2.0/projects", urlScheme(r.Url), r.Url), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	// Use the same credentials as Login, i.e. from the docker config if no username and password are configured
+	auth, err := r.authConfig()
+	if err != nil {
+		return err
+	}
+	if len(auth.RegistryToken) > 0 {
+		req.Header.Set("Authorization", "Bearer "+auth.RegistryToken)
+	} else if len(auth.Username) > 0 || len(auth.Password) > 0 {
+		req.SetBasicAuth(auth.Username, auth.Password)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	switch resp.StatusCode {
+	case http.StatusCreated, http.StatusConflict:
+		return nil
+	default:
+		content, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("unable to create Harbor project %s: %s", project, strings.TrimSpace(resp.Status+" "+string(content)))
+	}
+}
@@ -0,0 +1,175 @@
+package registry
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/sparetimecoders/build-tools/pkg/docker"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGeneric_LoginSuccess(t *testing.T) {
+	client := &docker.MockDocker{}
+	registry := &Generic{Url: "registry.example.com:5000", Username: "user", Password: "pass"}
+	out := &bytes.Buffer{}
+	err := registry.Login(client, out)
+	assert.Nil(t, err)
+	assert.Equal(t, "user", client.Username)
+	assert.Equal(t, "pass", client.Password)
+	assert.Equal(t, "registry.example.com:5000", client.ServerAddress)
+	assert.Equal(t, "Logged in\n", out.String())
+}
+
+func TestGeneric_LoginWithToken(t *testing.T) {
+	client := &docker.MockDocker{}
+	registry := &Generic{Url: "registry.example.com", Token: "token"}
+	out := &bytes.Buffer{}
+	err := registry.Login(client, out)
+	assert.Nil(t, err)
+	assert.Equal(t, "", client.ServerAddress)
+	assert.Equal(t, "Using token authentication\n", out.String())
+}
+
+func TestGeneric_LoginError(t *testing.T) {
+	client := &docker.MockDocker{LoginError: fmt.Errorf("invalid username/password")}
+	registry := &Generic{Url: "registry.example.com"}
+	out := &bytes.Buffer{}
+	err := registry.Login(client, out)
+	assert.EqualError(t, err, "invalid username/password")
+	assert.Equal(t, "", out.String())
+}
+
+func TestGeneric_GetAuthInfo(t *testing.T) {
+	decoded, _ := base64.URLEncoding.DecodeString((&Generic{Url: "registry.example.com", Username: "user", Password: "pass"}).GetAuthInfo())
+	assert.Equal(t, `{"username":"user","password":"pass","serveraddress":"registry.example.com"}`, string(decoded))
+	decoded, _ = base64.URLEncoding.DecodeString((&Generic{Url: "registry.example.com", Token: "token"}).GetAuthInfo())
+	assert.Equal(t, `{"serveraddress":"registry.example.com","registrytoken":"token"}`, string(decoded))
+}
+
+func TestGeneric_RegistryUrl(t *testing.T) {
+	assert.Equal(t, "registry.example.com:5000", (&Generic{Url: "registry.example.com:5000"}).RegistryUrl())
+	assert.Equal(t, "harbor.example.com/team/services", (&Generic{Url: "harbor.example.com", Path: "/team/services/"}).RegistryUrl())
+}
+
+func TestGeneric_Configured(t *testing.T) {
+	assert.False(t, (&Generic{}).Configured())
+	assert.True(t, (&Generic{Url: "registry.example.com"}).Configured())
+}
+
+func TestGeneric_HTTPClient(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	dir, _ := ioutil.TempDir(os.TempDir(), "build-tools")
+	defer func() { _ = os.RemoveAll(dir) }()
+	ca := filepath.Join(dir, "ca.pem")
+	_ = ioutil.WriteFile(ca, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0600)
+
+	client, err := (&Generic{Url: "registry.example.com"}).HTTPClient()
+	assert.NoError(t, err)
+	assert.Equal(t, http.DefaultClient, client)
+	_, err = client.Get(server.URL)
+	assert.Error(t, err)
+
+	client, err = (&Generic{Url: "registry.example.com", CA: ca}).HTTPClient()
+	assert.NoError(t, err)
+	_, err = client.Get(server.URL)
+	assert.NoError(t, err)
+
+	client, err = (&Generic{Url: "registry.example.com", Insecure: true}).HTTPClient()
+	assert.NoError(t, err)
+	_, err = client.Get(server.URL)
+	assert.NoError(t, err)
+}
+
+func TestGeneric_HTTPClientInvalidCA(t *testing.T) {
+	dir, _ := ioutil.TempDir(os.TempDir(), "build-tools")
+	defer func() { _ = os.RemoveAll(dir) }()
+	ca := filepath.Join(dir, "ca.pem")
+	_ = ioutil.WriteFile(ca, []byte("not a certificate"), 0600)
+
+	_, err := (&Generic{Url: "registry.example.com", CA: ca}).HTTPClient()
+	assert.EqualError(t, err, fmt.Sprintf("no certificates found in CA bundle %s", ca))
+	_, err = (&Generic{Url: "registry.example.com", CA: filepath.Join(dir, "missing.pem")}).HTTPClient()
+	assert.EqualError(t, err, fmt.Sprintf("unable to read CA bundle: open %s: no such file or directory", filepath.Join(dir, "missing.pem")))
+}
+
+func TestGeneric_Create(t *testing.T) {
+	registry := &Generic{Url: "registry.example.com"}
+	err := registry.Create("repo")
+	assert.Nil(t, err)
+}
+
+func TestGeneric_CreateHarborProject(t *testing.T) {
+	var projects []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != "user" || pass != "pass" || r.URL.Path != "/api/v2.0/projects" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		project := struct {
+			Name string `json:"project_name"`
+		}{}
+		_ = json.NewDecoder(r.Body).Decode(&project)
+		for _, p := range projects {
+			if p == project.Name {
+				w.WriteHeader(http.StatusConflict)
+				return
+			}
+		}
+		projects = append(projects, project.Name)
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	registry := &Generic{Url: strings.TrimPrefix(server.URL, "http://"), Path: "team/services", Username: "user", Password: "pass", Harbor: true}
+	assert.NoError(t, registry.Create("api"))
+	assert.NoError(t, registry.Create("web"))
+	assert.Equal(t, []string{"team"}, projects)
+
+	registry.Password = "wrong"
+	assert.EqualError(t, registry.Create("api"), "unable to create Harbor project team: 401 Unauthorized")
+}
+
+func TestGeneric_CreateHarborProjectWithDockerCredentials(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != "config-user" || pass != "config-pass" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+	host := strings.TrimPrefix(server.URL, "http://")
+	defer withDockerConfig(t, `{"auths":{"`+host+`":{"username":"config-user","password":"config-pass"}}}`)()
+
+	registry := &Generic{Url: host, Path: "team", Harbor: true}
+	assert.NoError(t, registry.Create("api"))
+}
+
+func TestGeneric_CreateHarborProjectWithToken(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	registry := &Generic{Url: strings.TrimPrefix(server.URL, "http://"), Path: "team", Token: "token", Harbor: true}
+	assert.NoError(t, registry.Create("api"))
+}
+
+func TestGeneric_CreateHarborProjectWithoutPath(t *testing.T) {
+	registry := &Generic{Url: "harbor.example.com", Harbor: true}
+	assert.EqualError(t, registry.Create("api"), "a path is required to create the Harbor project")
+}
@@ -29,7 +29,11 @@ func (r Github) Configured() bool {
 }
 
 func (r Github) Login(client docker.Client, out io.Writer) error {
-	if ok, err := client.RegistryLogin(context.Background(), types.AuthConfig{Username: r.Username, Password: r.password(), ServerAddress: "docker.pkg.github.com"}); err == nil {
+	auth, err := r.authConfig()
+	if err != nil {
+		return err
+	}
+	if ok, err := client.RegistryLogin(context.Background(), auth); err == nil {
 		_, _ = fmt.Fprintln(out, ok.Status)
 		return nil
 	} else {
@@ -44,12 +48,23 @@ func (r Github) password() string {
 	return r.Password
 }
 
+// resolveCredentials reports errors reading the credentials from the docker config
+func (r Github) resolveCredentials() error {
+	_, err := r.authConfig()
+	return err
+}
+
+// GetAuthInfo returns the credentials, errors are reported by Login and NewRegistryAPI
 func (r Github) GetAuthInfo() string {
-	auth := types.AuthConfig{Username: r.Username, Password: r.password(), ServerAddress: "docker.pkg.github.com"}
+	auth, _ := r.authConfig()
 	authBytes, _ := json.Marshal(auth)
 	return base64.URLEncoding.EncodeToString(authBytes)
 }
 
+func (r Github) authConfig() (types.AuthConfig, error) {
+	return withDockerCredentials(types.AuthConfig{Username: r.Username, Password: r.password(), ServerAddress: "docker.pkg.github.com"}, "docker.pkg.github.com")
+}
+
 func (r Github) RegistryUrl() string {
 	return fmt.Sprintf("docker.pkg.github.com/%s", r.Repository)
 }
@@ -29,7 +29,11 @@ func (r Gitlab) Configured() bool {
 }
 
 func (r Gitlab) Login(client docker.Client, out io.Writer) error {
-	if ok, err := client.RegistryLogin(context.Background(), types.AuthConfig{Username: "gitlab-ci-token", Password: r.Token, ServerAddress: r.Registry}); err == nil {
+	auth, err := r.authConfig()
+	if err != nil {
+		return err
+	}
+	if ok, err := client.RegistryLogin(context.Background(), auth); err == nil {
 		_, _ = fmt.Fprintln(out, ok.Status)
 		return nil
 	} else {
@@ -37,12 +41,27 @@ func (r Gitlab) Login(client docker.Client, out io.Writer) error {
 	}
 }
 
+// resolveCredentials reports errors reading the credentials from the docker config
+func (r Gitlab) resolveCredentials() error {
+	_, err := r.authConfig()
+	return err
+}
+
+// GetAuthInfo returns the credentials, errors are reported by Login and NewRegistryAPI
 func (r Gitlab) GetAuthInfo() string {
-	auth := types.AuthConfig{Username: "gitlab-ci-token", Password: r.Token, ServerAddress: r.Registry}
+	auth, _ := r.authConfig()
 	authBytes, _ := json.Marshal(auth)
 	return base64.URLEncoding.EncodeToString(authBytes)
 }
 
+func (r Gitlab) authConfig() (types.AuthConfig, error) {
+	if len(r.Token) == 0 {
+		host := strings.SplitN(r.RegistryUrl(), "/", 2)[0]
+		return withDockerCredentials(types.AuthConfig{ServerAddress: r.Registry}, host)
+	}
+	return types.AuthConfig{Username: "gitlab-ci-token", Password: r.Token, ServerAddress: r.Registry}, nil
+}
+
 func (r Gitlab) RegistryUrl() string {
 	if len(r.Repository) != 0 {
 		if strings.Index(r.Repository, "/") != -1 {
@@ -0,0 +1,70 @@
+package registry
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Platform is the platform an image in a manifest list is built for
+type Platform struct {
+	Architecture string `json:"architecture"`
+	OS           string `json:"os"`
+	Variant      string `json:"variant,omitempty"`
+}
+
+// ParsePlatform parses a platform in the format used by docker, i.e. os/arch[/variant]
+func ParsePlatform(platform string) (Platform, error) {
+	parts := strings.Split(platform, "/")
+	if len(parts) < 2 || len(parts) > 3 || parts[0] == "" || parts[1] == "" {
+		return Platform{}, fmt.Errorf("invalid platform '%s', expected os/arch[/variant]", platform)
+	}
+	p := Platform{OS: parts[0], Architecture: parts[1]}
+	if len(parts) == 3 {
+		p.Variant = parts[2]
+	}
+	return p, nil
+}
+
+func (p Platform) String() string {
+	if p.Variant != "" {
+		return fmt.Sprintf("%s/%s/%s", p.OS, p.Architecture, p.Variant)
+	}
+	return fmt.Sprintf("%s/%s", p.OS, p.Architecture)
+}
+
+// PlatformManifest is an image manifest built for a specific platform
+type PlatformManifest struct {
+	Platform Platform
+	Manifest *Manifest
+}
+
+// NewManifestList creates a manifest list referencing manifests. An OCI image index is created if the
+// manifests are OCI manifests, otherwise a Docker manifest list
+func NewManifestList(manifests []PlatformManifest) (*Manifest, error) {
+	mediaType := MediaTypeManifestList
+	var descriptors []Descriptor
+	for _, m := range manifests {
+		if m.Manifest.MediaType == MediaTypeOCIManifest {
+			mediaType = MediaTypeOCIIndex
+		} else if m.Manifest.MediaType != MediaTypeManifest {
+			return nil, fmt.Errorf("unsupported manifest type '%s' for platform %s", m.Manifest.MediaType, m.Platform)
+		}
+		platform := m.Platform
+		descriptors = append(descriptors, Descriptor{
+			MediaType: m.Manifest.MediaType,
+			Size:      int64(len(m.Manifest.Content)),
+			Digest:    m.Manifest.Digest,
+			Platform:  &platform,
+		})
+	}
+	content, err := json.MarshalIndent(struct {
+		SchemaVersion int          `json:"schemaVersion"`
+		MediaType     string       `json:"mediaType"`
+		Manifests     []Descriptor `json:"manifests"`
+	}{SchemaVersion: 2, MediaType: mediaType, Manifests: descriptors}, "", "   ")
+	if err != nil {
+		return nil, err
+	}
+	return &Manifest{MediaType: mediaType, Digest: Digest(content), Content: content}, nil
+}
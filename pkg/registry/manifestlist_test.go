@@ -0,0 +1,53 @@
+package registry
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestParsePlatform(t *testing.T) {
+	platform, err := ParsePlatform("linux/arm64/v8")
+	assert.NoError(t, err)
+	assert.Equal(t, Platform{OS: "linux", Architecture: "arm64", Variant: "v8"}, platform)
+	assert.Equal(t, "linux/arm64/v8", platform.String())
+
+	_, err = ParsePlatform("amd64")
+	assert.EqualError(t, err, "invalid platform 'amd64', expected os/arch[/variant]")
+}
+
+func TestNewManifestList(t *testing.T) {
+	amd64 := &Manifest{MediaType: MediaTypeManifest, Digest: "sha256:amd64", Content: []byte("{}")}
+	arm64 := &Manifest{MediaType: MediaTypeManifest, Digest: "sha256:arm64", Content: []byte("{ }")}
+
+	list, err := NewManifestList([]PlatformManifest{
+		{Platform: Platform{OS: "linux", Architecture: "amd64"}, Manifest: amd64},
+		{Platform: Platform{OS: "linux", Architecture: "arm64"}, Manifest: arm64},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, MediaTypeManifestList, list.MediaType)
+	assert.Equal(t, Digest(list.Content), list.Digest)
+
+	content := manifestContent{}
+	_ = json.Unmarshal(list.Content, &content)
+	assert.Equal(t, MediaTypeManifestList, content.MediaType)
+	assert.Equal(t, []Descriptor{
+		{MediaType: MediaTypeManifest, Size: 2, Digest: "sha256:amd64", Platform: &Platform{OS: "linux", Architecture: "amd64"}},
+		{MediaType: MediaTypeManifest, Size: 3, Digest: "sha256:arm64", Platform: &Platform{OS: "linux", Architecture: "arm64"}},
+	}, content.Manifests)
+}
+
+func TestNewManifestList_OCI(t *testing.T) {
+	list, err := NewManifestList([]PlatformManifest{
+		{Platform: Platform{OS: "linux", Architecture: "amd64"}, Manifest: &Manifest{MediaType: MediaTypeOCIManifest, Digest: "sha256:amd64", Content: []byte("{}")}},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, MediaTypeOCIIndex, list.MediaType)
+}
+
+func TestNewManifestList_NestedList(t *testing.T) {
+	_, err := NewManifestList([]PlatformManifest{
+		{Platform: Platform{OS: "linux", Architecture: "amd64"}, Manifest: &Manifest{MediaType: MediaTypeManifestList, Digest: "sha256:list", Content: []byte("{}")}},
+	})
+	assert.EqualError(t, err, "unsupported manifest type 'application/vnd.docker.distribution.manifest.list.v2+json' for platform linux/amd64")
+}
@@ -34,8 +34,8 @@ func (n NoDockerRegistry) Create(repository string) error {
 	return nil
 }
 
-func (n NoDockerRegistry) PushImage(client docker.Client, auth, image string, out, eout io.Writer) error {
-	return fmt.Errorf("push not supported by registry")
+func (n NoDockerRegistry) PushImage(client docker.Client, auth, image string, out, eout io.Writer) (*PushResult, error) {
+	return nil, fmt.Errorf("push not supported by registry")
 }
 
 var _ Registry = &NoDockerRegistry{}
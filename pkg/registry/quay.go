@@ -28,7 +28,11 @@ func (r *Quay) Configured() bool {
 }
 
 func (r *Quay) Login(client docker.Client, out io.Writer) error {
-	if ok, err := client.RegistryLogin(context.Background(), r.authConfig()); err == nil {
+	auth, err := r.authConfig()
+	if err != nil {
+		return err
+	}
+	if ok, err := client.RegistryLogin(context.Background(), auth); err == nil {
 		_, _ = fmt.Fprintln(out, ok.Status)
 		return nil
 	} else {
@@ -36,14 +40,21 @@ func (r *Quay) Login(client docker.Client, out io.Writer) error {
 	}
 }
 
+// resolveCredentials reports errors reading the credentials from the docker config
+func (r Quay) resolveCredentials() error {
+	_, err := r.authConfig()
+	return err
+}
+
+// GetAuthInfo returns the credentials, errors are reported by Login and NewRegistryAPI
 func (r Quay) GetAuthInfo() string {
-	auth := r.authConfig()
+	auth, _ := r.authConfig()
 	authBytes, _ := json.Marshal(auth)
 	return base64.URLEncoding.EncodeToString(authBytes)
 }
 
-func (r Quay) authConfig() types.AuthConfig {
-	return types.AuthConfig{Username: r.Username, Password: r.Password, ServerAddress: "quay.io"}
+func (r Quay) authConfig() (types.AuthConfig, error) {
+	return withDockerCredentials(types.AuthConfig{Username: r.Username, Password: r.Password, ServerAddress: "quay.io"}, "quay.io")
 }
 
 func (r Quay) RegistryUrl() string {
@@ -18,7 +18,14 @@ type Registry interface {
 	GetAuthInfo() string
 	RegistryUrl() string
 	Create(repository string) error
-	PushImage(client docker.Client, auth, image string, out, eout io.Writer) error
+	PushImage(client docker.Client, auth, image string, out, eout io.Writer) (*PushResult, error)
+}
+
+// PushResult is the digest and size of a pushed image as reported by the docker daemon
+type PushResult struct {
+	Tag    string
+	Digest string
+	Size   int64
 }
 
 type responsetype struct {
@@ -42,17 +49,18 @@ type responsetype struct {
 
 type dockerRegistry struct{}
 
-func (dockerRegistry) PushImage(client docker.Client, auth, image string, ow, eout io.Writer) error {
+func (dockerRegistry) PushImage(client docker.Client, auth, image string, ow, eout io.Writer) (*PushResult, error) {
 	if out, err := client.ImagePush(context.Background(), image, types.ImagePushOptions{All: true, RegistryAuth: auth}); err != nil {
-		return err
+		return nil, err
 	} else {
+		result := &PushResult{}
 		scanner := bufio.NewScanner(out)
 		for scanner.Scan() {
 			r := &responsetype{}
 			response := scanner.Bytes()
 			if err := json.Unmarshal(response, &r); err != nil {
 				_, _ = fmt.Fprintf(eout, "Unable to parse response: %s, Error: %v\n", string(response), err)
-				return err
+				return nil, err
 			} else {
 				if len(r.Status) != 0 {
 					if len(r.Id) == 0 {
@@ -63,11 +71,14 @@ func (dockerRegistry) PushImage(client docker.Client, auth, image string, ow, eo
 						_, _ = fmt.Fprintf(ow, "%s: %s %s\n", r.Id, r.Status, r.Progress)
 					}
 				} else if r.ErrorDetail != nil {
-					return errors.New(r.ErrorDetail.Message)
+					return nil, errors.New(r.ErrorDetail.Message)
+				}
+				if r.Aux != nil {
+					result = &PushResult{Tag: r.Aux.Tag, Digest: r.Aux.Digest, Size: r.Aux.Size}
 				}
 			}
 		}
 
-		return nil
+		return result, nil
 	}
 }
@@ -0,0 +1,203 @@
+// +build !prod
+
+package registry
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MockRegistryServer is an in-memory registry implementing the parts of the Registry HTTP API V2 used by build-tools
+type MockRegistryServer struct {
+	*httptest.Server
+	mutex sync.Mutex
+	// Manifests are keyed by repository:tag and repository@digest
+	Manifests map[string]*Manifest
+	// Blobs are keyed by repository@digest
+	Blobs    map[string][]byte
+	Requests []string
+	// TagsPageSize limits the number of tags returned per request when listing tags
+	TagsPageSize int
+	// ImmutableTags rejects putting a manifest for an existing tag, like registries with immutable tags
+	ImmutableTags bool
+	uploads       int
+}
+
+// NewMockRegistryServer starts a new MockRegistryServer, Close must be called when done
+func NewMockRegistryServer() *MockRegistryServer {
+	m := &MockRegistryServer{Manifests: make(map[string]*Manifest), Blobs: make(map[string][]byte)}
+	m.Server = httptest.NewServer(http.HandlerFunc(m.handle))
+	return m
+}
+
+// Host returns the host:port the server is listening on
+func (m *MockRegistryServer) Host() string {
+	return strings.TrimPrefix(m.URL, "http://")
+}
+
+// AddImage adds an image with the given labels as repository:tag and returns the digest of its manifest
+func (m *MockRegistryServer) AddImage(repository, tag string, labels map[string]string) string {
+	return m.AddImageCreated(repository, tag, labels, time.Time{})
+}
+
+// AddImageCreated adds an image created at the given time as repository:tag and returns the digest of its manifest
+func (m *MockRegistryServer) AddImageCreated(repository, tag string, labels map[string]string, created time.Time) string {
+	config := ImageConfig{Architecture: "amd64", OS: "linux", Created: created}
+	config.Config.Labels = labels
+	configContent, _ := json.Marshal(config)
+	configDigest := Digest(configContent)
+	layer := []byte(fmt.Sprintf("layer %s:%s", repository, tag))
+	layerDigest := Digest(layer)
+	content, _ := json.Marshal(manifestContent{
+		MediaType: MediaTypeManifest,
+		Config:    Descriptor{MediaType: "application/vnd.docker.container.image.v1+json", Size: int64(len(configContent)), Digest: configDigest},
+		Layers:    []Descriptor{{MediaType: "application/vnd.docker.image.rootfs.diff.tar.gzip", Size: int64(len(layer)), Digest: layerDigest}},
+	})
+	manifest := &Manifest{MediaType: MediaTypeManifest, Digest: Digest(content), Content: content}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.Blobs[repository+"@"+configDigest] = configContent
+	m.Blobs[repository+"@"+layerDigest] = layer
+	m.Manifests[repository+":"+tag] = manifest
+	m.Manifests[repository+"@"+manifest.Digest] = manifest
+	return manifest.Digest
+}
+
+// Manifest returns the manifest stored as repository:tag, or nil
+func (m *MockRegistryServer) Manifest(repository, tag string) *Manifest {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.Manifests[repository+":"+tag]
+}
+
+func (m *MockRegistryServer) handle(w http.ResponseWriter, r *http.Request) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.Requests = append(m.Requests, fmt.Sprintf("%s %s", r.Method, r.URL.Path))
+
+	path := strings.TrimPrefix(r.URL.Path, "/v2/")
+	if strings.HasSuffix(path, "/tags/list") {
+		m.handleTags(w, r, strings.TrimSuffix(path, "/tags/list"))
+	} else if i := strings.LastIndex(path, "/manifests/"); i != -1 {
+		m.handleManifest(w, r, path[:i], path[i+len("/manifests/"):])
+	} else if i := strings.LastIndex(path, "/blobs/uploads/"); i != -1 {
+		m.handleUpload(w, r, path[:i])
+	} else if i := strings.LastIndex(path, "/blobs/"); i != -1 {
+		if blob, exists := m.Blobs[path[:i]+"@"+path[i+len("/blobs/"):]]; exists {
+			if r.Method == http.MethodGet {
+				_, _ = w.Write(blob)
+			}
+		} else {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	} else {
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (m *MockRegistryServer) handleManifest(w http.ResponseWriter, r *http.Request, repository, reference string) {
+	key := repository + ":" + reference
+	if strings.HasPrefix(reference, "sha256:") {
+		key = repository + "@" + reference
+	}
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		manifest, exists := m.Manifests[key]
+		if !exists {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", manifest.MediaType)
+		w.Header().Set("Docker-Content-Digest", manifest.Digest)
+		if r.Method == http.MethodGet {
+			_, _ = w.Write(manifest.Content)
+		}
+	case http.MethodPut:
+		if _, exists := m.Manifests[key]; exists && m.ImmutableTags && !strings.HasPrefix(reference, "sha256:") {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = fmt.Fprintf(w, `{"errors":[{"code":"TAG_INVALID","message":"tag %s is immutable"}]}`, reference)
+			return
+		}
+		content, _ := ioutil.ReadAll(r.Body)
+		manifest := &Manifest{MediaType: r.Header.Get("Content-Type"), Digest: Digest(content), Content: content}
+		m.Manifests[key] = manifest
+		m.Manifests[repository+"@"+manifest.Digest] = manifest
+		w.Header().Set("Docker-Content-Digest", manifest.Digest)
+		w.WriteHeader(http.StatusCreated)
+	case http.MethodDelete:
+		manifest, exists := m.Manifests[key]
+		if !exists || !strings.HasPrefix(reference, "sha256:") {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		for k, v := range m.Manifests {
+			if strings.HasPrefix(k, repository+":") && v.Digest == manifest.Digest || k == key {
+				delete(m.Manifests, k)
+			}
+		}
+		w.WriteHeader(http.StatusAccepted)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// handleTags lists the tags of repository, paginated if TagsPageSize is set
+func (m *MockRegistryServer) handleTags(w http.ResponseWriter, r *http.Request, repository string) {
+	var tags []string
+	for key := range m.Manifests {
+		if strings.HasPrefix(key, repository+":") {
+			tags = append(tags, strings.TrimPrefix(key, repository+":"))
+		}
+	}
+	if len(tags) == 0 {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	sort.Strings(tags)
+	if last := r.URL.Query().Get("last"); last != "" {
+		i := sort.SearchStrings(tags, last)
+		if i < len(tags) && tags[i] == last {
+			i++
+		}
+		tags = tags[i:]
+	}
+	if m.TagsPageSize > 0 && len(tags) > m.TagsPageSize {
+		tags = tags[:m.TagsPageSize]
+		w.Header().Set("Link", fmt.Sprintf(`</v2/%s/tags/list?n=%d&last=%s>; rel="next"`, repository, m.TagsPageSize, tags[len(tags)-1]))
+	}
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"name": repository, "tags": tags})
+}
+
+func (m *MockRegistryServer) handleUpload(w http.ResponseWriter, r *http.Request, repository string) {
+	switch r.Method {
+	case http.MethodPost:
+		digest := r.URL.Query().Get("mount")
+		if blob, exists := m.Blobs[r.URL.Query().Get("from")+"@"+digest]; exists && digest != "" {
+			m.Blobs[repository+"@"+digest] = blob
+			w.WriteHeader(http.StatusCreated)
+			return
+		}
+		m.uploads++
+		w.Header().Set("Location", fmt.Sprintf("/v2/%s/blobs/uploads/%d?state=abc", repository, m.uploads))
+		w.WriteHeader(http.StatusAccepted)
+	case http.MethodPut:
+		content, _ := ioutil.ReadAll(r.Body)
+		digest := r.URL.Query().Get("digest")
+		if Digest(content) != digest || r.URL.Query().Get("state") != "abc" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		m.Blobs[repository+"@"+digest] = content
+		w.WriteHeader(http.StatusCreated)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
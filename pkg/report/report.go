@@ -0,0 +1,87 @@
+package report
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"regexp"
+	"time"
+)
+
+// Report is a machine readable summary of a build or push, written as JSON
+type Report struct {
+	Images []*Image `json:"images"`
+}
+
+// Image is the result of building or pushing a single image
+type Image struct {
+	Name      string            `json:"name"`
+	Registry  string            `json:"registry,omitempty"`
+	Platform  string            `json:"platform,omitempty"`
+	Tags      []string          `json:"tags"`
+	Stages    []string          `json:"stages,omitempty"`
+	BuildArgs map[string]string `json:"buildArgs,omitempty"`
+	// Secrets are the ids of the secrets exposed to the build, the values are never included
+	Secrets []string `json:"secrets,omitempty"`
+	// Unchanged is set to the revision the image was reused from, if it was not rebuilt
+	Unchanged string   `json:"unchanged,omitempty"`
+	Pushed    []Pushed `json:"pushed,omitempty"`
+	// ManifestList is the digest of the manifest list pushed for multi-platform images
+	ManifestList string `json:"manifestList,omitempty"`
+	// Signed are the digests of the manifests signed after pushing
+	Signed []string `json:"signed,omitempty"`
+	// SBOMs are the files build wrote the SBOMs of the image to, or the references push attached them as
+	SBOMs    []string `json:"sboms,omitempty"`
+	Duration float64  `json:"duration"`
+	start    time.Time
+}
+
+// Pushed is a tag pushed to the registry
+type Pushed struct {
+	Tag    string `json:"tag"`
+	Digest string `json:"digest"`
+	Size   int64  `json:"size,omitempty"`
+	// UpToDate is set if the registry already had the image with the tag, so it was not pushed again
+	UpToDate bool `json:"upToDate,omitempty"`
+}
+
+// Add starts tracking a new image in the report
+func (r *Report) Add(name, platform string) *Image {
+	image := &Image{Name: name, Platform: platform, Tags: []string{}, start: now()}
+	r.Images = append(r.Images, image)
+	return image
+}
+
+// Done records the time taken to handle the image
+func (i *Image) Done() {
+	i.Duration = now().Sub(i.start).Seconds()
+}
+
+const redacted = "[REDACTED]"
+
+var sensitive = regexp.MustCompile(`(?i)(password|passwd|secret|token|key|credential|auth)`)
+
+// SetBuildArgs records the build args, redacting the values of args whose name suggests they are sensitive
+func (i *Image) SetBuildArgs(args map[string]*string) {
+	i.BuildArgs = make(map[string]string)
+	for key, value := range args {
+		if sensitive.MatchString(key) {
+			i.BuildArgs[key] = redacted
+		} else if value != nil {
+			i.BuildArgs[key] = *value
+		}
+	}
+}
+
+// Write writes the report as JSON to file
+func (r *Report) Write(file string) error {
+	if r.Images == nil {
+		r.Images = []*Image{}
+	}
+	content, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(file, content, 0666)
+}
+
+var now = time.Now
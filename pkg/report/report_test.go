@@ -0,0 +1,75 @@
+package report
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestReport_Write(t *testing.T) {
+	start := time.Date(2019, 10, 1, 12, 30, 0, 0, time.UTC)
+	times := []time.Time{start, start.Add(1500 * time.Millisecond)}
+	now = func() time.Time {
+		t := times[0]
+		times = times[1:]
+		return t
+	}
+	defer func() { now = time.Now }()
+
+	dir, _ := ioutil.TempDir(os.TempDir(), "build-tools")
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	token := "abc"
+	commit := "abc123"
+	report := &Report{}
+	image := report.Add("api", "linux/amd64")
+	image.Tags = []string{"repo/api:abc123"}
+	image.SetBuildArgs(map[string]*string{"CI_COMMIT": &commit, "NPM_TOKEN": &token})
+	image.Pushed = []Pushed{{Tag: "repo/api:abc123", Digest: "sha256:123", Size: 528}}
+	image.Done()
+
+	file := filepath.Join(dir, "report.json")
+	assert.NoError(t, report.Write(file))
+	content, _ := ioutil.ReadFile(file)
+	assert.Equal(t, `{
+  "images": [
+    {
+      "name": "api",
+      "platform": "linux/amd64",
+      "tags": [
+        "repo/api:abc123"
+      ],
+      "buildArgs": {
+        "CI_COMMIT": "abc123",
+        "NPM_TOKEN": "[REDACTED]"
+      },
+      "pushed": [
+        {
+          "tag": "repo/api:abc123",
+          "digest": "sha256:123",
+          "size": 528
+        }
+      ],
+      "duration": 1.5
+    }
+  ]
+}`, string(content))
+}
+
+func TestReport_WriteEmpty(t *testing.T) {
+	dir, _ := ioutil.TempDir(os.TempDir(), "build-tools")
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	file := filepath.Join(dir, "report.json")
+	assert.NoError(t, (&Report{}).Write(file))
+	content, _ := ioutil.ReadFile(file)
+	assert.Equal(t, "{\n  \"images\": []\n}", string(content))
+}
+
+func TestReport_WriteError(t *testing.T) {
+	err := (&Report{}).Write(filepath.Join(os.TempDir(), "missing", "dir", "report.json"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,34 @@
+package sbom
+
+import (
+	"fmt"
+	"github.com/sparetimecoders/build-tools/pkg/registry"
+	"strings"
+)
+
+// Tag returns the tag the SBOM of the manifest with the given digest is attached as, i.e. sha256-abc.sbom
+func Tag(digest string) string {
+	return strings.Replace(digest, ":", "-", 1) + ".sbom"
+}
+
+// Attach stores the encoded SBOM as an OCI artifact next to the image referenced by ref (which must reference a digest),
+// in the same way as `cosign attach sbom`. An SBOM already attached to the image is replaced.
+// Returns the reference of the artifact
+func Attach(api *registry.API, ref registry.Reference, content []byte) (registry.Reference, error) {
+	if ref.Digest == "" {
+		return ref, fmt.Errorf("unable to attach SBOM to %s without a digest", ref)
+	}
+	mediaType := DetectMediaType(content)
+	if mediaType == "" {
+		return ref, fmt.Errorf("unknown SBOM format, expected %s or %s JSON", FormatCycloneDX, FormatSPDX)
+	}
+	sbomRef := ref.WithTag(Tag(ref.Digest))
+	if err := api.PushBlob(sbomRef, content); err != nil {
+		return sbomRef, fmt.Errorf("unable to push SBOM for %s: %v", ref, err)
+	}
+	layer := registry.Descriptor{MediaType: mediaType, Size: int64(len(content)), Digest: registry.Digest(content)}
+	if _, err := api.PushArtifact(sbomRef, []registry.Descriptor{layer}); err != nil {
+		return sbomRef, fmt.Errorf("unable to push SBOM for %s: %v", ref, err)
+	}
+	return sbomRef, nil
+}
@@ -0,0 +1,61 @@
+package sbom
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/sparetimecoders/build-tools/pkg/registry"
+	"testing"
+)
+
+func TestTag(t *testing.T) {
+	assert.Equal(t, "sha256-0123abc.sbom", Tag("sha256:0123abc"))
+}
+
+func TestAttach(t *testing.T) {
+	server := registry.NewMockRegistryServer()
+	defer server.Close()
+	digest := server.AddImage("image", "abc123", nil)
+	api := registry.NewAPI("")
+	ref, _ := registry.ParseReference(server.Host() + "/image@" + digest)
+	content, _ := testSBOM.Encode(FormatSPDX)
+
+	attached, err := Attach(api, ref, content)
+
+	assert.NoError(t, err)
+	assert.Equal(t, server.Host()+"/image:"+Tag(digest), attached.String())
+	manifest := server.Manifest("image", Tag(digest))
+	assert.NotNil(t, manifest)
+	assert.Equal(t, registry.MediaTypeOCIManifest, manifest.MediaType)
+	layers := struct {
+		Config registry.Descriptor   `json:"config"`
+		Layers []registry.Descriptor `json:"layers"`
+	}{}
+	_ = json.Unmarshal(manifest.Content, &layers)
+	assert.Equal(t, registry.MediaTypeOCIConfig, layers.Config.MediaType)
+	assert.Equal(t, []registry.Descriptor{{MediaType: MediaTypeSPDX, Size: int64(len(content)), Digest: registry.Digest(content)}}, layers.Layers)
+	assert.Equal(t, content, server.Blobs["image@"+registry.Digest(content)])
+
+	replaced, _ := testSBOM.Encode(FormatCycloneDX)
+	_, err = Attach(api, ref, replaced)
+
+	assert.NoError(t, err)
+	_ = json.Unmarshal(server.Manifest("image", Tag(digest)).Content, &layers)
+	assert.Equal(t, 1, len(layers.Layers))
+	assert.Equal(t, MediaTypeCycloneDX, layers.Layers[0].MediaType)
+}
+
+func TestAttach_WithoutDigest(t *testing.T) {
+	ref, _ := registry.ParseReference("localhost/image:abc123")
+
+	_, err := Attach(registry.NewAPI(""), ref, []byte("{}"))
+
+	assert.EqualError(t, err, "unable to attach SBOM to localhost/image:abc123 without a digest")
+}
+
+func TestAttach_UnknownFormat(t *testing.T) {
+	ref, _ := registry.ParseReference("localhost/image@sha256:abc")
+
+	_, err := Attach(registry.NewAPI(""), ref, []byte("{}"))
+
+	assert.EqualError(t, err, "unknown SBOM format, expected cyclonedx or spdx JSON")
+}
@@ -0,0 +1,139 @@
+package sbom
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+const (
+	whiteoutPrefix = ".wh."
+	whiteoutOpaque = ".wh..wh..opq"
+)
+
+// entry is what was found in a file of the image filesystem
+type entry struct {
+	layer    int
+	os       *OS
+	packages []Package
+}
+
+// filesystem is the merged view of the files of interest in the layers of an image
+type filesystem struct {
+	entries map[string]*entry
+	layers  int
+}
+
+func newFilesystem() *filesystem {
+	return &filesystem{entries: make(map[string]*entry)}
+}
+
+// addLayer applies the layer stored in file on top of the previously added layers, removing files deleted by whiteouts
+func (f *filesystem) addLayer(file string) error {
+	layerFile, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = layerFile.Close() }()
+	buffered := bufio.NewReader(layerFile)
+	var reader io.Reader = buffered
+	if magic, err := buffered.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(buffered)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = gz.Close() }()
+		reader = gz
+	}
+
+	layer := f.layers
+	f.layers++
+	tr := tar.NewReader(reader)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		name := path.Clean("/" + header.Name)
+		dir, base := path.Dir(name), path.Base(name)
+		switch {
+		case base == whiteoutOpaque:
+			f.remove(dir, layer, false)
+		case strings.HasPrefix(base, whiteoutPrefix):
+			f.remove(path.Join(dir, strings.TrimPrefix(base, whiteoutPrefix)), layer, true)
+		case header.Typeflag == tar.TypeDir:
+		default:
+			delete(f.entries, name)
+			if header.Typeflag != tar.TypeReg && header.Typeflag != tar.TypeRegA {
+				continue
+			}
+			found, err := inspect(name, header, tr)
+			if err != nil {
+				return err
+			}
+			if found != nil {
+				found.layer = layer
+				f.entries[name] = found
+			}
+		}
+	}
+}
+
+// remove removes what was found below target in lower layers, including target itself if self is set
+func (f *filesystem) remove(target string, layer int, self bool) {
+	prefix := strings.TrimSuffix(target, "/") + "/"
+	for name, e := range f.entries {
+		if e.layer < layer && (self && name == target || strings.HasPrefix(name, prefix)) {
+			delete(f.entries, name)
+		}
+	}
+}
+
+// sbom returns the SBOM of the merged filesystem
+func (f *filesystem) sbom() *SBOM {
+	result := &SBOM{}
+	for _, release := range []string{"/etc/os-release", "/usr/lib/os-release"} {
+		if e, exists := f.entries[release]; exists && e.os != nil {
+			result.OS = e.os
+			break
+		}
+	}
+	var names []string
+	for name := range f.entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		result.Packages = append(result.Packages, f.entries[name].packages...)
+	}
+	return result
+}
+
+// inspect reads the packages or OS information from the file name, if it is of interest. Returns nil otherwise
+func inspect(name string, header *tar.Header, content io.Reader) (*entry, error) {
+	switch {
+	case name == "/var/lib/dpkg/status" || path.Dir(name) == "/var/lib/dpkg/status.d" && !strings.HasSuffix(name, ".md5sums"):
+		packages, err := parseDpkg(content, name)
+		return &entry{packages: packages}, err
+	case name == "/lib/apk/db/installed":
+		packages, err := parseApk(content, name)
+		return &entry{packages: packages}, err
+	case name == "/etc/os-release" || name == "/usr/lib/os-release":
+		release, err := parseOSRelease(content)
+		return &entry{os: release}, err
+	case header.Mode&0111 != 0:
+		info, err := goModInfo(content)
+		if err != nil || info == "" {
+			return nil, err
+		}
+		return &entry{packages: parseModInfo(info, name)}, nil
+	}
+	return nil, nil
+}
@@ -0,0 +1,267 @@
+package sbom
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	// MediaTypeCycloneDX is the media type of CycloneDX JSON documents
+	MediaTypeCycloneDX = "application/vnd.cyclonedx+json"
+	// MediaTypeSPDX is the media type of SPDX JSON documents
+	MediaTypeSPDX = "text/spdx+json"
+	toolName      = "build-tools"
+	noAssertion   = "NOASSERTION"
+)
+
+// now is replaced in tests to get stable timestamps
+var now = time.Now
+
+type cycloneDX struct {
+	BOMFormat    string `json:"bomFormat"`
+	SpecVersion  string `json:"specVersion"`
+	SerialNumber string `json:"serialNumber"`
+	Version      int    `json:"version"`
+	Metadata     struct {
+		Timestamp string             `json:"timestamp"`
+		Tools     []cycloneDXTool    `json:"tools"`
+		Component cycloneDXComponent `json:"component"`
+	} `json:"metadata"`
+	Components []cycloneDXComponent `json:"components"`
+}
+
+type cycloneDXTool struct {
+	Name string `json:"name"`
+}
+
+type cycloneDXComponent struct {
+	Type        string              `json:"type"`
+	Name        string              `json:"name"`
+	Version     string              `json:"version,omitempty"`
+	Description string              `json:"description,omitempty"`
+	PURL        string              `json:"purl,omitempty"`
+	Properties  []cycloneDXProperty `json:"properties,omitempty"`
+}
+
+type cycloneDXProperty struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type spdx struct {
+	SPDXVersion       string `json:"spdxVersion"`
+	DataLicense       string `json:"dataLicense"`
+	SPDXID            string `json:"SPDXID"`
+	Name              string `json:"name"`
+	DocumentNamespace string `json:"documentNamespace"`
+	CreationInfo      struct {
+		Created  string   `json:"created"`
+		Creators []string `json:"creators"`
+	} `json:"creationInfo"`
+	Packages      []spdxPackage      `json:"packages"`
+	Relationships []spdxRelationship `json:"relationships"`
+}
+
+type spdxPackage struct {
+	Name                  string            `json:"name"`
+	SPDXID                string            `json:"SPDXID"`
+	VersionInfo           string            `json:"versionInfo,omitempty"`
+	DownloadLocation      string            `json:"downloadLocation"`
+	FilesAnalyzed         bool              `json:"filesAnalyzed"`
+	LicenseConcluded      string            `json:"licenseConcluded"`
+	LicenseDeclared       string            `json:"licenseDeclared"`
+	CopyrightText         string            `json:"copyrightText"`
+	SourceInfo            string            `json:"sourceInfo,omitempty"`
+	PrimaryPackagePurpose string            `json:"primaryPackagePurpose,omitempty"`
+	ExternalRefs          []spdxExternalRef `json:"externalRefs,omitempty"`
+}
+
+type spdxExternalRef struct {
+	ReferenceCategory string `json:"referenceCategory"`
+	ReferenceType     string `json:"referenceType"`
+	ReferenceLocator  string `json:"referenceLocator"`
+}
+
+type spdxRelationship struct {
+	Element string `json:"spdxElementId"`
+	Type    string `json:"relationshipType"`
+	Related string `json:"relatedSpdxElement"`
+}
+
+// Encode returns the SBOM as a JSON document in format, i.e. cyclonedx or spdx
+func (s *SBOM) Encode(format string) ([]byte, error) {
+	switch format {
+	case FormatCycloneDX:
+		return json.MarshalIndent(s.cycloneDX(), "", "  ")
+	case FormatSPDX:
+		return json.MarshalIndent(s.spdx(), "", "  ")
+	}
+	return nil, fmt.Errorf("unsupported SBOM format '%s', expected %s or %s", format, FormatCycloneDX, FormatSPDX)
+}
+
+func (s *SBOM) cycloneDX() *cycloneDX {
+	doc := &cycloneDX{
+		BOMFormat:    "CycloneDX",
+		SpecVersion:  "1.4",
+		SerialNumber: "urn:uuid:" + uuid(),
+		Version:      1,
+	}
+	doc.Metadata.Timestamp = now().UTC().Format(time.RFC3339)
+	doc.Metadata.Tools = []cycloneDXTool{{Name: toolName}}
+	name, version := s.imageName()
+	doc.Metadata.Component = cycloneDXComponent{Type: "container", Name: name, Version: version}
+	doc.Components = []cycloneDXComponent{}
+	if s.OS != nil {
+		doc.Components = append(doc.Components, cycloneDXComponent{
+			Type:        "operating-system",
+			Name:        s.OS.ID,
+			Version:     s.OS.VersionID,
+			Description: s.OS.PrettyName,
+		})
+	}
+	for _, p := range s.Packages {
+		doc.Components = append(doc.Components, cycloneDXComponent{
+			Type:       "library",
+			Name:       p.Name,
+			Version:    p.Version,
+			PURL:       p.PURL(s.OS),
+			Properties: []cycloneDXProperty{{Name: toolName + ":location", Value: p.Location}},
+		})
+	}
+	return doc
+}
+
+func (s *SBOM) spdx() *spdx {
+	name, version := s.imageName()
+	doc := &spdx{
+		SPDXVersion:       "SPDX-2.3",
+		DataLicense:       "CC0-1.0",
+		SPDXID:            "SPDXRef-DOCUMENT",
+		Name:              s.Image,
+		DocumentNamespace: fmt.Sprintf("https://github.com/sparetimecoders/build-tools/spdx/%s-%s", escape(name), uuid()),
+	}
+	doc.CreationInfo.Created = now().UTC().Format(time.RFC3339)
+	doc.CreationInfo.Creators = []string{"Tool: " + toolName}
+	image := spdxPackage{Name: name, SPDXID: "SPDXRef-Image", VersionInfo: version, PrimaryPackagePurpose: "CONTAINER"}
+	doc.Packages = []spdxPackage{image}
+	doc.Relationships = []spdxRelationship{{Element: doc.SPDXID, Type: "DESCRIBES", Related: image.SPDXID}}
+	if s.OS != nil {
+		doc.Packages = append(doc.Packages, spdxPackage{
+			Name:                  s.OS.ID,
+			SPDXID:                "SPDXRef-OperatingSystem",
+			VersionInfo:           s.OS.VersionID,
+			PrimaryPackagePurpose: "OPERATING-SYSTEM",
+		})
+	}
+	for i, p := range s.Packages {
+		doc.Packages = append(doc.Packages, spdxPackage{
+			Name:        p.Name,
+			SPDXID:      fmt.Sprintf("SPDXRef-Package-%d", i+1),
+			VersionInfo: p.Version,
+			SourceInfo:  "found in " + p.Location,
+			ExternalRefs: []spdxExternalRef{{
+				ReferenceCategory: "PACKAGE-MANAGER",
+				ReferenceType:     "purl",
+				ReferenceLocator:  p.PURL(s.OS),
+			}},
+		})
+	}
+	for i := range doc.Packages {
+		p := &doc.Packages[i]
+		p.DownloadLocation, p.LicenseConcluded, p.LicenseDeclared, p.CopyrightText = noAssertion, noAssertion, noAssertion, noAssertion
+		if i > 0 {
+			doc.Relationships = append(doc.Relationships, spdxRelationship{Element: image.SPDXID, Type: "CONTAINS", Related: p.SPDXID})
+		}
+	}
+	return doc
+}
+
+// imageName splits the image into name and tag
+func (s *SBOM) imageName() (string, string) {
+	if i := strings.LastIndex(s.Image, ":"); i != -1 && !strings.Contains(s.Image[i:], "/") {
+		return s.Image[:i], s.Image[i+1:]
+	}
+	return s.Image, ""
+}
+
+// PURL returns the package URL identifying the package, using the distribution in os as namespace for OS packages
+func (p Package) PURL(os *OS) string {
+	switch p.Type {
+	case TypeDeb, TypeApk:
+		namespace := "debian"
+		if p.Type == TypeApk {
+			namespace = "alpine"
+		}
+		if os != nil && os.ID != "" {
+			namespace = os.ID
+		}
+		purl := fmt.Sprintf("pkg:%s/%s/%s@%s", p.Type, escape(namespace), escape(p.Name), escape(p.Version))
+		if p.Arch != "" {
+			purl += "?arch=" + escape(p.Arch)
+		}
+		return purl
+	default:
+		segments := strings.Split(p.Name, "/")
+		for i, segment := range segments {
+			segments[i] = escape(segment)
+		}
+		purl := fmt.Sprintf("pkg:%s/%s", p.Type, strings.Join(segments, "/"))
+		if p.Version != "" && p.Version != "(devel)" {
+			purl += "@" + escape(p.Version)
+		}
+		return purl
+	}
+}
+
+// MediaType returns the media type of an SBOM document encoded in format
+func MediaType(format string) string {
+	if format == FormatSPDX {
+		return MediaTypeSPDX
+	}
+	return MediaTypeCycloneDX
+}
+
+// DetectMediaType returns the media type of an encoded SBOM document, or an empty string if it is not a known format
+func DetectMediaType(content []byte) string {
+	var doc struct {
+		BOMFormat   string `json:"bomFormat"`
+		SPDXVersion string `json:"spdxVersion"`
+	}
+	if err := json.Unmarshal(content, &doc); err != nil {
+		return ""
+	}
+	switch {
+	case doc.BOMFormat == "CycloneDX":
+		return MediaTypeCycloneDX
+	case strings.HasPrefix(doc.SPDXVersion, "SPDX-"):
+		return MediaTypeSPDX
+	}
+	return ""
+}
+
+// escape percent-encodes everything but unreserved characters
+func escape(s string) string {
+	buffer := bytes.Buffer{}
+	for _, b := range []byte(s) {
+		switch {
+		case 'a' <= b && b <= 'z', 'A' <= b && b <= 'Z', '0' <= b && b <= '9', b == '-', b == '.', b == '_', b == '~':
+			buffer.WriteByte(b)
+		default:
+			_, _ = fmt.Fprintf(&buffer, "%%%02X", b)
+		}
+	}
+	return buffer.String()
+}
+
+// uuid returns a random (version 4) UUID
+func uuid() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
@@ -0,0 +1,116 @@
+package sbom
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"regexp"
+	"testing"
+	"time"
+)
+
+var testSBOM = &SBOM{
+	Image: "registry/image:abc123",
+	OS:    &OS{ID: "debian", VersionID: "11", PrettyName: "Debian GNU/Linux 11 (bullseye)"},
+	Packages: []Package{
+		{Name: "libc6", Version: "2.31-13+deb11u5", Type: TypeDeb, Arch: "amd64", Location: "/var/lib/dpkg/status"},
+		{Name: "github.com/pkg/errors", Version: "v0.9.1", Type: TypeGolang, Location: "/app/server"},
+	},
+}
+
+func fixedTime() func() {
+	now = func() time.Time { return time.Date(2020, 2, 3, 4, 5, 6, 0, time.UTC) }
+	return func() { now = time.Now }
+}
+
+func TestEncode_CycloneDX(t *testing.T) {
+	defer fixedTime()()
+
+	content, err := testSBOM.Encode(FormatCycloneDX)
+	assert.NoError(t, err)
+
+	doc := cycloneDX{}
+	assert.NoError(t, json.Unmarshal(content, &doc))
+	assert.Equal(t, "CycloneDX", doc.BOMFormat)
+	assert.Equal(t, "1.4", doc.SpecVersion)
+	assert.Regexp(t, regexp.MustCompile(`^urn:uuid:[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`), doc.SerialNumber)
+	assert.Equal(t, "2020-02-03T04:05:06Z", doc.Metadata.Timestamp)
+	assert.Equal(t, cycloneDXComponent{Type: "container", Name: "registry/image", Version: "abc123"}, doc.Metadata.Component)
+	assert.Equal(t, []cycloneDXComponent{
+		{Type: "operating-system", Name: "debian", Version: "11", Description: "Debian GNU/Linux 11 (bullseye)"},
+		{Type: "library", Name: "libc6", Version: "2.31-13+deb11u5", PURL: "pkg:deb/debian/libc6@2.31-13%2Bdeb11u5?arch=amd64", Properties: []cycloneDXProperty{{Name: "build-tools:location", Value: "/var/lib/dpkg/status"}}},
+		{Type: "library", Name: "github.com/pkg/errors", Version: "v0.9.1", PURL: "pkg:golang/github.com/pkg/errors@v0.9.1", Properties: []cycloneDXProperty{{Name: "build-tools:location", Value: "/app/server"}}},
+	}, doc.Components)
+	assert.Equal(t, MediaTypeCycloneDX, DetectMediaType(content))
+}
+
+func TestEncode_SPDX(t *testing.T) {
+	defer fixedTime()()
+
+	content, err := testSBOM.Encode(FormatSPDX)
+	assert.NoError(t, err)
+
+	doc := spdx{}
+	assert.NoError(t, json.Unmarshal(content, &doc))
+	assert.Equal(t, "SPDX-2.3", doc.SPDXVersion)
+	assert.Equal(t, "SPDXRef-DOCUMENT", doc.SPDXID)
+	assert.Equal(t, "registry/image:abc123", doc.Name)
+	assert.Regexp(t, regexp.MustCompile(`^https://github.com/sparetimecoders/build-tools/spdx/registry%2Fimage-[0-9a-f-]{36}$`), doc.DocumentNamespace)
+	assert.Equal(t, "2020-02-03T04:05:06Z", doc.CreationInfo.Created)
+	assert.Equal(t, 4, len(doc.Packages))
+	assert.Equal(t, "CONTAINER", doc.Packages[0].PrimaryPackagePurpose)
+	assert.Equal(t, "OPERATING-SYSTEM", doc.Packages[1].PrimaryPackagePurpose)
+	assert.Equal(t, spdxPackage{
+		Name:             "libc6",
+		SPDXID:           "SPDXRef-Package-1",
+		VersionInfo:      "2.31-13+deb11u5",
+		DownloadLocation: noAssertion,
+		LicenseConcluded: noAssertion,
+		LicenseDeclared:  noAssertion,
+		CopyrightText:    noAssertion,
+		SourceInfo:       "found in /var/lib/dpkg/status",
+		ExternalRefs:     []spdxExternalRef{{ReferenceCategory: "PACKAGE-MANAGER", ReferenceType: "purl", ReferenceLocator: "pkg:deb/debian/libc6@2.31-13%2Bdeb11u5?arch=amd64"}},
+	}, doc.Packages[2])
+	assert.Equal(t, []spdxRelationship{
+		{Element: "SPDXRef-DOCUMENT", Type: "DESCRIBES", Related: "SPDXRef-Image"},
+		{Element: "SPDXRef-Image", Type: "CONTAINS", Related: "SPDXRef-OperatingSystem"},
+		{Element: "SPDXRef-Image", Type: "CONTAINS", Related: "SPDXRef-Package-1"},
+		{Element: "SPDXRef-Image", Type: "CONTAINS", Related: "SPDXRef-Package-2"},
+	}, doc.Relationships)
+	assert.Equal(t, MediaTypeSPDX, DetectMediaType(content))
+}
+
+func TestEncode_UnsupportedFormat(t *testing.T) {
+	_, err := testSBOM.Encode("syft")
+
+	assert.EqualError(t, err, "unsupported SBOM format 'syft', expected cyclonedx or spdx")
+}
+
+func TestPURL(t *testing.T) {
+	tests := []struct {
+		name string
+		pkg  Package
+		os   *OS
+		want string
+	}{
+		{name: "deb with epoch", pkg: Package{Name: "perl", Version: "1:5.32.1-4", Type: TypeDeb, Arch: "amd64"}, os: &OS{ID: "ubuntu"}, want: "pkg:deb/ubuntu/perl@1%3A5.32.1-4?arch=amd64"},
+		{name: "deb without os", pkg: Package{Name: "perl", Version: "5.32", Type: TypeDeb}, want: "pkg:deb/debian/perl@5.32"},
+		{name: "apk", pkg: Package{Name: "musl", Version: "1.2.3-r0", Type: TypeApk, Arch: "x86_64"}, want: "pkg:apk/alpine/musl@1.2.3-r0?arch=x86_64"},
+		{name: "go main module", pkg: Package{Name: "github.com/example/app", Version: "(devel)", Type: TypeGolang}, want: "pkg:golang/github.com/example/app"},
+		{name: "go module", pkg: Package{Name: "gopkg.in/yaml.v2", Version: "v2.2.2", Type: TypeGolang}, want: "pkg:golang/gopkg.in/yaml.v2@v2.2.2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.pkg.PURL(tt.os))
+		})
+	}
+}
+
+func TestDetectMediaType_Unknown(t *testing.T) {
+	assert.Equal(t, "", DetectMediaType([]byte("not json")))
+	assert.Equal(t, "", DetectMediaType([]byte(`{"name":"other"}`)))
+}
+
+func TestMediaType(t *testing.T) {
+	assert.Equal(t, MediaTypeCycloneDX, MediaType(FormatCycloneDX))
+	assert.Equal(t, MediaTypeSPDX, MediaType(FormatSPDX))
+}
@@ -0,0 +1,177 @@
+package sbom
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strconv"
+	"strings"
+)
+
+var (
+	elfMagic = []byte("\x7fELF")
+	// The sentinels the go linker surrounds the module information of a binary with
+	modInfoStart = []byte("\x30\x77\xaf\x0c\x92\x74\x08\x02\x41\xe1\xc1\x07\xe6\xd6\x18\xe6")
+	modInfoEnd   = []byte("\xf9\x32\x43\x31\x86\x18\x20\x72\x00\x82\x42\x10\x41\x16\xd8\xf2")
+)
+
+// maxModInfo limits the size of the module information read from a binary
+const maxModInfo = 1024 * 1024
+
+// parseDpkg reads the installed packages from a dpkg status file
+func parseDpkg(content io.Reader, location string) ([]Package, error) {
+	var packages []Package
+	err := paragraphs(content, func(line string) (string, string, bool) {
+		if line[0] == ' ' || line[0] == '\t' {
+			return "", "", false
+		}
+		i := strings.Index(line, ":")
+		if i < 1 {
+			return "", "", false
+		}
+		return line[:i], strings.TrimSpace(line[i+1:]), true
+	}, func(fields map[string]string) {
+		status := fields["Status"]
+		if fields["Package"] == "" || status != "" && !strings.HasSuffix(status, " installed") {
+			return
+		}
+		packages = append(packages, Package{
+			Name:     fields["Package"],
+			Version:  fields["Version"],
+			Type:     TypeDeb,
+			Arch:     fields["Architecture"],
+			Location: location,
+		})
+	})
+	return packages, err
+}
+
+// parseApk reads the installed packages from the apk database
+func parseApk(content io.Reader, location string) ([]Package, error) {
+	var packages []Package
+	err := paragraphs(content, func(line string) (string, string, bool) {
+		if len(line) < 2 || line[1] != ':' {
+			return "", "", false
+		}
+		return line[:1], line[2:], true
+	}, func(fields map[string]string) {
+		if fields["P"] == "" {
+			return
+		}
+		packages = append(packages, Package{
+			Name:     fields["P"],
+			Version:  fields["V"],
+			Type:     TypeApk,
+			Arch:     fields["A"],
+			Location: location,
+		})
+	})
+	return packages, err
+}
+
+// paragraphs calls done with the fields of each paragraph (separated by empty lines) in content,
+// using field to split a line into key and value
+func paragraphs(content io.Reader, field func(line string) (string, string, bool), done func(map[string]string)) error {
+	fields := make(map[string]string)
+	scanner := bufio.NewScanner(content)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.TrimSpace(line) == "" {
+			done(fields)
+			fields = make(map[string]string)
+			continue
+		}
+		if key, value, ok := field(line); ok {
+			fields[key] = value
+		}
+	}
+	done(fields)
+	return scanner.Err()
+}
+
+// parseOSRelease reads the distribution from an os-release file
+func parseOSRelease(content io.Reader) (*OS, error) {
+	release := &OS{}
+	scanner := bufio.NewScanner(content)
+	for scanner.Scan() {
+		parts := strings.SplitN(strings.TrimSpace(scanner.Text()), "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		value := parts[1]
+		if unquoted, err := strconv.Unquote(value); err == nil {
+			value = unquoted
+		} else {
+			value = strings.Trim(value, "'")
+		}
+		switch parts[0] {
+		case "ID":
+			release.ID = value
+		case "VERSION_ID":
+			release.VersionID = value
+		case "PRETTY_NAME":
+			release.PrettyName = value
+		}
+	}
+	return release, scanner.Err()
+}
+
+// goModInfo returns the module information embedded by the go linker if content is an ELF binary built with modules
+func goModInfo(content io.Reader) (string, error) {
+	reader := bufio.NewReaderSize(content, 64*1024)
+	magic, err := reader.Peek(len(elfMagic))
+	if err != nil || !bytes.Equal(magic, elfMagic) {
+		return "", nil
+	}
+	chunk := make([]byte, 64*1024)
+	var window []byte
+	found := false
+	for {
+		n, err := reader.Read(chunk)
+		window = append(window, chunk[:n]...)
+		if !found {
+			if i := bytes.Index(window, modInfoStart); i != -1 {
+				window = append([]byte{}, window[i+len(modInfoStart):]...)
+				found = true
+			} else if len(window) >= len(modInfoStart) {
+				// Keep the end of the window in case the sentinel is split between chunks
+				window = append([]byte{}, window[len(window)-len(modInfoStart)+1:]...)
+			}
+		}
+		if found {
+			if i := bytes.Index(window, modInfoEnd); i != -1 {
+				return string(window[:i]), nil
+			}
+			if len(window) > maxModInfo {
+				return "", nil
+			}
+		}
+		if err == io.EOF {
+			return "", nil
+		} else if err != nil {
+			return "", err
+		}
+	}
+}
+
+// parseModInfo returns the main module and the dependencies (with replacements applied) of Go module information
+func parseModInfo(info, location string) []Package {
+	var packages []Package
+	for _, line := range strings.Split(info, "\n") {
+		fields := strings.Split(line, "\t")
+		if len(fields) < 3 {
+			continue
+		}
+		switch fields[0] {
+		case "mod", "dep":
+			packages = append(packages, Package{Name: fields[1], Version: fields[2], Type: TypeGolang, Location: location})
+		case "=>":
+			if len(packages) > 0 {
+				packages[len(packages)-1].Name = fields[1]
+				packages[len(packages)-1].Version = fields[2]
+			}
+		}
+	}
+	return packages
+}
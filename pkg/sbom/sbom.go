@@ -0,0 +1,131 @@
+package sbom
+
+import (
+	"archive/tar"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/sparetimecoders/build-tools/pkg/docker"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+const (
+	// FormatCycloneDX is the CycloneDX JSON format
+	FormatCycloneDX = "cyclonedx"
+	// FormatSPDX is the SPDX JSON format
+	FormatSPDX = "spdx"
+)
+
+// Types of packages found in images
+const (
+	TypeDeb    = "deb"
+	TypeApk    = "apk"
+	TypeGolang = "golang"
+)
+
+// SBOM is the software bill of materials of an image
+type SBOM struct {
+	// Image is the name of the image the SBOM describes
+	Image    string
+	OS       *OS
+	Packages []Package
+}
+
+// OS is the distribution of an image, read from os-release
+type OS struct {
+	ID         string
+	VersionID  string
+	PrettyName string
+}
+
+// Package is a package found in an image
+type Package struct {
+	Name    string
+	Version string
+	// Type is the kind of package, i.e. deb, apk or golang
+	Type string
+	Arch string
+	// Location is the file in the image the package was found in
+	Location string
+}
+
+// Generate creates the SBOM of image by inspecting the filesystem of the image saved from the docker daemon
+func Generate(client docker.Client, image string) (*SBOM, error) {
+	archive, err := client.ImageSave(context.Background(), []string{image})
+	if err != nil {
+		return nil, fmt.Errorf("unable to save image %s: %v", image, err)
+	}
+	defer func() { _ = archive.Close() }()
+	sbom, err := Scan(archive)
+	if err != nil {
+		return nil, fmt.Errorf("unable to inspect image %s: %v", image, err)
+	}
+	sbom.Image = image
+	return sbom, nil
+}
+
+// Scan creates an SBOM from an image archive in the format written by `docker save`
+func Scan(archive io.Reader) (*SBOM, error) {
+	dir, err := ioutil.TempDir(os.TempDir(), "build-tools-sbom")
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	// The layers can come in any order and before the manifest, so they are stored until all of the archive is read
+	var manifest []struct {
+		Layers []string `json:"Layers"`
+	}
+	files := make(map[string]string)
+	reader := tar.NewReader(archive)
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		if header.Typeflag != tar.TypeReg && header.Typeflag != tar.TypeRegA {
+			continue
+		}
+		if header.Name == "manifest.json" {
+			if err := json.NewDecoder(reader).Decode(&manifest); err != nil {
+				return nil, fmt.Errorf("invalid manifest.json: %v", err)
+			}
+			continue
+		}
+		file, err := ioutil.TempFile(dir, "layer")
+		if err != nil {
+			return nil, err
+		}
+		_, err = io.Copy(file, reader)
+		_ = file.Close()
+		if err != nil {
+			return nil, err
+		}
+		files[header.Name] = file.Name()
+	}
+	if len(manifest) == 0 {
+		return nil, fmt.Errorf("no image found in archive")
+	}
+
+	fs := newFilesystem()
+	for _, layer := range manifest[0].Layers {
+		file, exists := files[layer]
+		if !exists {
+			return nil, fmt.Errorf("layer %s missing in archive", layer)
+		}
+		if err := fs.addLayer(file); err != nil {
+			return nil, fmt.Errorf("unable to read layer %s: %v", layer, err)
+		}
+	}
+	return fs.sbom(), nil
+}
+
+// FileName returns the name of the file the SBOM of the image built for platform is stored as
+func FileName(image, platform string) string {
+	return strings.Replace(docker.PlatformTag(image, platform), "/", "_", -1) + ".json"
+}
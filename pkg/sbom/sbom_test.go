@@ -0,0 +1,186 @@
+package sbom
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"github.com/sparetimecoders/build-tools/pkg/docker"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+const dpkgStatus = `Package: libc6
+Status: install ok installed
+Architecture: amd64
+Version: 2.31-13+deb11u5
+Description: GNU C Library
+ Contains the standard libraries.
+
+Package: removed
+Status: deinstall ok config-files
+Architecture: amd64
+Version: 1.0
+
+Package: tzdata
+Status: install ok installed
+Architecture: all
+Version: 2021a-1+deb11u8
+`
+
+const osRelease = `PRETTY_NAME="Debian GNU/Linux 11 (bullseye)"
+NAME="Debian GNU/Linux"
+VERSION_ID="11"
+ID=debian
+`
+
+const modInfo = "path\tgithub.com/example/app\n" +
+	"mod\tgithub.com/example/app\t(devel)\t\n" +
+	"dep\tgithub.com/pkg/errors\tv0.9.1\th1:abc=\n" +
+	"dep\tgolang.org/x/sys\tv0.1.0\th1:def=\n" +
+	"=>\tgithub.com/fork/sys\tv0.2.0\th1:ghi=\n"
+
+func TestScan_Debian(t *testing.T) {
+	archive := MockArchive(
+		map[string]string{"etc/os-release": osRelease, "var/lib/dpkg/status": dpkgStatus},
+		map[string]string{"var/lib/dpkg/status.d/base": "Package: base-files\nVersion: 11.1\nArchitecture: amd64\n", "var/lib/dpkg/status.d/base.md5sums": "abc  /etc/issue\n"},
+	)
+
+	result, err := Scan(bytes.NewReader(archive))
+
+	assert.NoError(t, err)
+	assert.Equal(t, &OS{ID: "debian", VersionID: "11", PrettyName: "Debian GNU/Linux 11 (bullseye)"}, result.OS)
+	assert.Equal(t, []Package{
+		{Name: "libc6", Version: "2.31-13+deb11u5", Type: TypeDeb, Arch: "amd64", Location: "/var/lib/dpkg/status"},
+		{Name: "tzdata", Version: "2021a-1+deb11u8", Type: TypeDeb, Arch: "all", Location: "/var/lib/dpkg/status"},
+		{Name: "base-files", Version: "11.1", Type: TypeDeb, Arch: "amd64", Location: "/var/lib/dpkg/status.d/base"},
+	}, result.Packages)
+}
+
+func TestScan_AlpineCompressedLayer(t *testing.T) {
+	layer := &bytes.Buffer{}
+	gz := gzip.NewWriter(layer)
+	_, _ = gz.Write(MockLayer(map[string]string{
+		"usr/lib/os-release":   "ID=alpine\nVERSION_ID=3.16.2\nPRETTY_NAME='Alpine Linux v3.16'\n",
+		"lib/apk/db/installed": "C:Q1abc=\nP:musl\nV:1.2.3-r0\nA:x86_64\n\nC:Q1def=\nP:busybox\nV:1.35.0-r17\nA:x86_64\n",
+	}))
+	_ = gz.Close()
+	buffer := &bytes.Buffer{}
+	archive := tar.NewWriter(buffer)
+	writeFile(archive, "abc/layer.tar", layer.String(), 0644)
+	writeFile(archive, "manifest.json", `[{"Layers":["abc/layer.tar"]}]`, 0644)
+	_ = archive.Close()
+
+	result, err := Scan(buffer)
+
+	assert.NoError(t, err)
+	assert.Equal(t, &OS{ID: "alpine", VersionID: "3.16.2", PrettyName: "Alpine Linux v3.16"}, result.OS)
+	assert.Equal(t, []Package{
+		{Name: "musl", Version: "1.2.3-r0", Type: TypeApk, Arch: "x86_64", Location: "/lib/apk/db/installed"},
+		{Name: "busybox", Version: "1.35.0-r17", Type: TypeApk, Arch: "x86_64", Location: "/lib/apk/db/installed"},
+	}, result.Packages)
+}
+
+func TestScan_GoBinary(t *testing.T) {
+	archive := MockArchive(map[string]string{"app/server": MockGoBinary(modInfo), "app/script.sh": "#!/bin/sh\n"})
+
+	result, err := Scan(bytes.NewReader(archive))
+
+	assert.NoError(t, err)
+	assert.Nil(t, result.OS)
+	assert.Equal(t, []Package{
+		{Name: "github.com/example/app", Version: "(devel)", Type: TypeGolang, Location: "/app/server"},
+		{Name: "github.com/pkg/errors", Version: "v0.9.1", Type: TypeGolang, Location: "/app/server"},
+		{Name: "github.com/fork/sys", Version: "v0.2.0", Type: TypeGolang, Location: "/app/server"},
+	}, result.Packages)
+}
+
+func TestScan_GoBinarySentinelBetweenChunks(t *testing.T) {
+	binary := string(elfMagic) + strings.Repeat("\x00", 64*1024-8) + MockGoBinary(modInfo)[len(elfMagic)+128:]
+	archive := MockArchive(map[string]string{"app": binary})
+
+	result, err := Scan(bytes.NewReader(archive))
+
+	assert.NoError(t, err)
+	assert.Equal(t, 3, len(result.Packages))
+}
+
+func TestScan_Whiteouts(t *testing.T) {
+	archive := MockArchive(
+		map[string]string{"var/lib/dpkg/status": dpkgStatus, "app/server": MockGoBinary(modInfo), "opt/tool": MockGoBinary(modInfo)},
+		map[string]string{"var/lib/dpkg/.wh.status": "", "opt/.wh..wh..opq": ""},
+		map[string]string{"app/server": "replaced by a script"},
+	)
+
+	result, err := Scan(bytes.NewReader(archive))
+
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(result.Packages))
+}
+
+func TestScan_OpaqueDirectoryKeepsFilesFromSameLayer(t *testing.T) {
+	archive := MockArchive(
+		map[string]string{"opt/old": MockGoBinary(modInfo)},
+		map[string]string{"opt/.wh..wh..opq": "", "opt/new": MockGoBinary("mod\tgithub.com/example/new\tv1.0.0\t\n")},
+	)
+
+	result, err := Scan(bytes.NewReader(archive))
+
+	assert.NoError(t, err)
+	assert.Equal(t, []Package{{Name: "github.com/example/new", Version: "v1.0.0", Type: TypeGolang, Location: "/opt/new"}}, result.Packages)
+}
+
+func TestScan_NoManifest(t *testing.T) {
+	buffer := &bytes.Buffer{}
+	archive := tar.NewWriter(buffer)
+	writeFile(archive, "abc/layer.tar", string(MockLayer(nil)), 0644)
+	_ = archive.Close()
+
+	_, err := Scan(buffer)
+
+	assert.EqualError(t, err, "no image found in archive")
+}
+
+func TestScan_MissingLayer(t *testing.T) {
+	buffer := &bytes.Buffer{}
+	archive := tar.NewWriter(buffer)
+	writeFile(archive, "manifest.json", `[{"Layers":["abc/layer.tar"]}]`, 0644)
+	_ = archive.Close()
+
+	_, err := Scan(buffer)
+
+	assert.EqualError(t, err, "layer abc/layer.tar missing in archive")
+}
+
+func TestGenerate(t *testing.T) {
+	client := &docker.MockDocker{SaveOutput: MockArchive(map[string]string{"etc/os-release": osRelease, "var/lib/dpkg/status": dpkgStatus})}
+
+	result, err := Generate(client, "registry/image:abc123")
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"registry/image:abc123"}, client.Saved)
+	assert.Equal(t, "registry/image:abc123", result.Image)
+	assert.Equal(t, 2, len(result.Packages))
+}
+
+func TestGenerate_SaveError(t *testing.T) {
+	client := &docker.MockDocker{SaveError: errors.New("no such image")}
+
+	_, err := Generate(client, "image:abc123")
+
+	assert.EqualError(t, err, "unable to save image image:abc123: no such image")
+}
+
+func TestGenerate_InvalidArchive(t *testing.T) {
+	client := &docker.MockDocker{SaveOutput: MockLayer(nil)}
+
+	_, err := Generate(client, "image:abc123")
+
+	assert.EqualError(t, err, "unable to inspect image image:abc123: no image found in archive")
+}
+
+func TestFileName(t *testing.T) {
+	assert.Equal(t, "image.json", FileName("image", ""))
+	assert.Equal(t, "group_image-linux-arm64.json", FileName("group/image", "linux/arm64"))
+}
@@ -0,0 +1,59 @@
+// +build !prod
+
+package sbom
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// MockArchive creates an image archive in the format written by `docker save` with a layer for each of the maps of file names to content.
+// Files with content starting like an ELF binary are executable
+func MockArchive(layers ...map[string]string) []byte {
+	buffer := &bytes.Buffer{}
+	archive := tar.NewWriter(buffer)
+	var names []string
+	for i, files := range layers {
+		name := fmt.Sprintf("layer%d/layer.tar", i)
+		names = append(names, name)
+		writeFile(archive, name, string(MockLayer(files)), 0644)
+	}
+	manifest, _ := json.Marshal([]map[string]interface{}{{"Config": "config.json", "Layers": names}})
+	writeFile(archive, "manifest.json", string(manifest), 0644)
+	_ = archive.Close()
+	return buffer.Bytes()
+}
+
+// MockLayer creates an uncompressed layer with the files
+func MockLayer(files map[string]string) []byte {
+	buffer := &bytes.Buffer{}
+	layer := tar.NewWriter(buffer)
+	var names []string
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		mode := int64(0644)
+		if strings.HasPrefix(files[name], string(elfMagic)) {
+			mode = 0755
+		}
+		writeFile(layer, name, files[name], mode)
+	}
+	_ = layer.Close()
+	return buffer.Bytes()
+}
+
+// MockGoBinary returns the content of an ELF binary with embedded Go module information
+func MockGoBinary(modInfo string) string {
+	return string(elfMagic) + strings.Repeat("\x00", 128) + string(modInfoStart) + modInfo + string(modInfoEnd) + strings.Repeat("\x00", 16)
+}
+
+func writeFile(archive *tar.Writer, name, content string, mode int64) {
+	_ = archive.WriteHeader(&tar.Header{Name: name, Mode: mode, Size: int64(len(content)), Typeflag: tar.TypeReg})
+	_, _ = archive.Write([]byte(content))
+}
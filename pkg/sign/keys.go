@@ -0,0 +1,127 @@
+package sign
+
+import (
+	"crypto/ecdsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/nacl/secretbox"
+	"golang.org/x/crypto/scrypt"
+	"io/ioutil"
+)
+
+// encryptedKey is the content of an encrypted private key created with `cosign generate-key-pair`
+type encryptedKey struct {
+	KDF struct {
+		Name   string `json:"name"`
+		Params struct {
+			N int `json:"N"`
+			R int `json:"r"`
+			P int `json:"p"`
+		} `json:"params"`
+		Salt []byte `json:"salt"`
+	} `json:"kdf"`
+	Cipher struct {
+		Name  string `json:"name"`
+		Nonce []byte `json:"nonce"`
+	} `json:"cipher"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// LoadPrivateKey reads an ECDSA private key from file. Both encrypted cosign keys, decrypted with password,
+// and unencrypted PKCS #8 or EC keys in PEM format are supported
+func LoadPrivateKey(file string, password []byte) (*ecdsa.PrivateKey, error) {
+	block, err := readPEM(file)
+	if err != nil {
+		return nil, err
+	}
+	var key interface{}
+	switch block.Type {
+	case "ENCRYPTED COSIGN PRIVATE KEY", "ENCRYPTED SIGSTORE PRIVATE KEY":
+		der, err := decrypt(block.Bytes, password)
+		if err != nil {
+			return nil, fmt.Errorf("unable to decrypt private key %s: %v", file, err)
+		}
+		key, err = x509.ParsePKCS8PrivateKey(der)
+		if err != nil {
+			return nil, fmt.Errorf("invalid private key %s: %v", file, err)
+		}
+	case "PRIVATE KEY":
+		if key, err = x509.ParsePKCS8PrivateKey(block.Bytes); err != nil {
+			return nil, fmt.Errorf("invalid private key %s: %v", file, err)
+		}
+	case "EC PRIVATE KEY":
+		if key, err = x509.ParseECPrivateKey(block.Bytes); err != nil {
+			return nil, fmt.Errorf("invalid private key %s: %v", file, err)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported private key type '%s' in %s", block.Type, file)
+	}
+	ecdsaKey, ok := key.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("private key %s is not an ECDSA key", file)
+	}
+	return ecdsaKey, nil
+}
+
+// LoadPublicKey reads an ECDSA public key in PEM format from file, i.e. cosign.pub
+func LoadPublicKey(file string) (*ecdsa.PublicKey, error) {
+	block, err := readPEM(file)
+	if err != nil {
+		return nil, err
+	}
+	if block.Type != "PUBLIC KEY" {
+		return nil, fmt.Errorf("unsupported public key type '%s' in %s", block.Type, file)
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key %s: %v", file, err)
+	}
+	ecdsaKey, ok := key.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("public key %s is not an ECDSA key", file)
+	}
+	return ecdsaKey, nil
+}
+
+func readPEM(file string) (*pem.Block, error) {
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read key: %v", err)
+	}
+	block, _ := pem.Decode(content)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM encoded key found in %s", file)
+	}
+	return block, nil
+}
+
+// decrypt decrypts the content of an encrypted cosign key, returning the DER encoded private key
+func decrypt(content, password []byte) ([]byte, error) {
+	encrypted := encryptedKey{}
+	if err := json.Unmarshal(content, &encrypted); err != nil {
+		return nil, err
+	}
+	if encrypted.KDF.Name != "scrypt" || encrypted.Cipher.Name != "nacl/secretbox" {
+		return nil, fmt.Errorf("unsupported encryption %s/%s", encrypted.KDF.Name, encrypted.Cipher.Name)
+	}
+	if len(encrypted.Cipher.Nonce) != 24 {
+		return nil, errors.New("invalid nonce")
+	}
+	params := encrypted.KDF.Params
+	secret, err := scrypt.Key(password, encrypted.KDF.Salt, params.N, params.R, params.P, 32)
+	if err != nil {
+		return nil, err
+	}
+	var key [32]byte
+	var nonce [24]byte
+	copy(key[:], secret)
+	copy(nonce[:], encrypted.Cipher.Nonce)
+	decrypted, ok := secretbox.Open(nil, encrypted.Ciphertext, &nonce, &key)
+	if !ok {
+		return nil, errors.New("wrong password")
+	}
+	return decrypted, nil
+}
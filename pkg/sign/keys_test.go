@@ -0,0 +1,152 @@
+package sign
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/nacl/secretbox"
+	"golang.org/x/crypto/scrypt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadPrivateKey_PKCS8(t *testing.T) {
+	dir, key := keyDir()
+	defer func() { _ = os.RemoveAll(dir) }()
+	der, _ := x509.MarshalPKCS8PrivateKey(key)
+	file := writePEM(dir, "private.pem", "PRIVATE KEY", der)
+
+	loaded, err := LoadPrivateKey(file, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, key.D, loaded.D)
+}
+
+func TestLoadPrivateKey_EC(t *testing.T) {
+	dir, key := keyDir()
+	defer func() { _ = os.RemoveAll(dir) }()
+	der, _ := x509.MarshalECPrivateKey(key)
+	file := writePEM(dir, "private.pem", "EC PRIVATE KEY", der)
+
+	loaded, err := LoadPrivateKey(file, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, key.D, loaded.D)
+}
+
+func TestLoadPrivateKey_Encrypted(t *testing.T) {
+	dir, key := keyDir()
+	defer func() { _ = os.RemoveAll(dir) }()
+	file := writePEM(dir, "cosign.key", "ENCRYPTED COSIGN PRIVATE KEY", encrypt(key, []byte("secret")))
+
+	loaded, err := LoadPrivateKey(file, []byte("secret"))
+	assert.NoError(t, err)
+	assert.Equal(t, key.D, loaded.D)
+}
+
+func TestLoadPrivateKey_WrongPassword(t *testing.T) {
+	dir, key := keyDir()
+	defer func() { _ = os.RemoveAll(dir) }()
+	file := writePEM(dir, "cosign.key", "ENCRYPTED SIGSTORE PRIVATE KEY", encrypt(key, []byte("secret")))
+
+	_, err := LoadPrivateKey(file, []byte("other"))
+	assert.EqualError(t, err, "unable to decrypt private key "+file+": wrong password")
+}
+
+func TestLoadPrivateKey_Missing(t *testing.T) {
+	_, err := LoadPrivateKey("missing.key", nil)
+	assert.EqualError(t, err, "unable to read key: open missing.key: no such file or directory")
+}
+
+func TestLoadPrivateKey_NotPEM(t *testing.T) {
+	dir, _ := keyDir()
+	defer func() { _ = os.RemoveAll(dir) }()
+	file := filepath.Join(dir, "private.pem")
+	_ = ioutil.WriteFile(file, []byte("abc"), 0600)
+
+	_, err := LoadPrivateKey(file, nil)
+	assert.EqualError(t, err, "no PEM encoded key found in "+file)
+}
+
+func TestLoadPrivateKey_UnsupportedType(t *testing.T) {
+	dir, _ := keyDir()
+	defer func() { _ = os.RemoveAll(dir) }()
+	file := writePEM(dir, "private.pem", "OPENSSH PRIVATE KEY", []byte("abc"))
+
+	_, err := LoadPrivateKey(file, nil)
+	assert.EqualError(t, err, "unsupported private key type 'OPENSSH PRIVATE KEY' in "+file)
+}
+
+func TestLoadPrivateKey_NotECDSA(t *testing.T) {
+	dir, _ := keyDir()
+	defer func() { _ = os.RemoveAll(dir) }()
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 1024)
+	der, _ := x509.MarshalPKCS8PrivateKey(rsaKey)
+	file := writePEM(dir, "private.pem", "PRIVATE KEY", der)
+
+	_, err := LoadPrivateKey(file, nil)
+	assert.EqualError(t, err, "private key "+file+" is not an ECDSA key")
+}
+
+func TestLoadPublicKey(t *testing.T) {
+	dir, key := keyDir()
+	defer func() { _ = os.RemoveAll(dir) }()
+	file := writePublicKey(dir, &key.PublicKey)
+
+	loaded, err := LoadPublicKey(file)
+	assert.NoError(t, err)
+	assert.Equal(t, key.PublicKey.X, loaded.X)
+}
+
+func TestLoadPublicKey_PrivateKeyGiven(t *testing.T) {
+	dir, key := keyDir()
+	defer func() { _ = os.RemoveAll(dir) }()
+	der, _ := x509.MarshalECPrivateKey(key)
+	file := writePEM(dir, "private.pem", "EC PRIVATE KEY", der)
+
+	_, err := LoadPublicKey(file)
+	assert.EqualError(t, err, "unsupported public key type 'EC PRIVATE KEY' in "+file)
+}
+
+func keyDir() (string, *ecdsa.PrivateKey) {
+	dir, _ := ioutil.TempDir(os.TempDir(), "build-tools")
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	return dir, key
+}
+
+func writePEM(dir, name, blockType string, content []byte) string {
+	file := filepath.Join(dir, name)
+	_ = ioutil.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: content}), 0600)
+	return file
+}
+
+func writePublicKey(dir string, key *ecdsa.PublicKey) string {
+	der, _ := x509.MarshalPKIXPublicKey(key)
+	return writePEM(dir, "cosign.pub", "PUBLIC KEY", der)
+}
+
+// encrypt encrypts key the same way as `cosign generate-key-pair`, with cheaper scrypt parameters
+func encrypt(key *ecdsa.PrivateKey, password []byte) []byte {
+	der, _ := x509.MarshalPKCS8PrivateKey(key)
+	encrypted := encryptedKey{}
+	encrypted.KDF.Name = "scrypt"
+	encrypted.KDF.Params.N = 1024
+	encrypted.KDF.Params.R = 8
+	encrypted.KDF.Params.P = 1
+	encrypted.KDF.Salt = []byte("0123456789abcdef0123456789abcdef")
+	encrypted.Cipher.Name = "nacl/secretbox"
+	encrypted.Cipher.Nonce = []byte("0123456789abcdef01234567")
+	secret, _ := scrypt.Key(password, encrypted.KDF.Salt, 1024, 8, 1, 32)
+	var k [32]byte
+	var nonce [24]byte
+	copy(k[:], secret)
+	copy(nonce[:], encrypted.Cipher.Nonce)
+	encrypted.Ciphertext = secretbox.Seal(nil, der, &nonce, &k)
+	content, _ := json.Marshal(encrypted)
+	return content
+}
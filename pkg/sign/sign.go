@@ -0,0 +1,181 @@
+package sign
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/sparetimecoders/build-tools/pkg/registry"
+	"io/ioutil"
+	"math/big"
+	"strings"
+)
+
+const (
+	// MediaTypeSimpleSigning is the media type of the signed payload layers in a signature manifest
+	MediaTypeSimpleSigning = "application/vnd.dev.cosign.simplesigning.v1+json"
+	// SignatureAnnotation is the layer annotation holding the base64 encoded signature of the payload
+	SignatureAnnotation = "dev.cosignproject.cosign/signature"
+	signatureType       = "cosign container image signature"
+)
+
+// payload is the simple signing document signed for an image, identifying the image by the digest of its manifest
+type payload struct {
+	Critical struct {
+		Identity struct {
+			DockerReference string `json:"docker-reference"`
+		} `json:"identity"`
+		Image struct {
+			DockerManifestDigest string `json:"docker-manifest-digest"`
+		} `json:"image"`
+		Type string `json:"type"`
+	} `json:"critical"`
+	Optional map[string]interface{} `json:"optional"`
+}
+
+// signatureManifest is the part of the OCI manifest holding the signatures of an image needed to verify them
+type signatureManifest struct {
+	Layers []registry.Descriptor `json:"layers"`
+}
+
+type ecdsaSignature struct {
+	R, S *big.Int
+}
+
+// SignatureTag returns the tag the signatures of the manifest with the given digest are stored as, i.e. sha256-abc.sig
+func SignatureTag(digest string) string {
+	return strings.Replace(digest, ":", "-", 1) + ".sig"
+}
+
+// Sign signs the manifest digest of ref (which must reference a digest) with key and stores the signature next to the image,
+// in the same format as cosign. Returns false if the image already has a signature made with key
+func Sign(api *registry.API, ref registry.Reference, key *ecdsa.PrivateKey) (bool, error) {
+	if ref.Digest == "" {
+		return false, fmt.Errorf("unable to sign %s without a digest", ref)
+	}
+	signatureRef := ref.WithTag(SignatureTag(ref.Digest))
+	manifest := &signatureManifest{}
+	existing, err := api.Manifest(signatureRef)
+	if err == nil {
+		if err := json.Unmarshal(existing.Content, manifest); err != nil {
+			return false, fmt.Errorf("invalid signature manifest %s: %v", signatureRef, err)
+		}
+		for _, layer := range manifest.Layers {
+			if verifyLayer(api, signatureRef, layer, ref.Digest, &key.PublicKey) == nil {
+				return false, nil
+			}
+		}
+	} else if err != registry.ErrNotFound {
+		return false, fmt.Errorf("unable to fetch signatures for %s: %v", ref, err)
+	}
+
+	content := payload{}
+	content.Critical.Identity.DockerReference = fmt.Sprintf("%s/%s", ref.Host, ref.Repository)
+	content.Critical.Image.DockerManifestDigest = ref.Digest
+	content.Critical.Type = signatureType
+	signed, err := json.Marshal(content)
+	if err != nil {
+		return false, err
+	}
+	hash := sha256.Sum256(signed)
+	r, s, err := ecdsa.Sign(rand.Reader, key, hash[:])
+	if err != nil {
+		return false, err
+	}
+	signature, err := asn1.Marshal(ecdsaSignature{R: r, S: s})
+	if err != nil {
+		return false, err
+	}
+	if err := api.PushBlob(signatureRef, signed); err != nil {
+		return false, err
+	}
+	manifest.Layers = append(manifest.Layers, registry.Descriptor{
+		MediaType:   MediaTypeSimpleSigning,
+		Size:        int64(len(signed)),
+		Digest:      registry.Digest(signed),
+		Annotations: map[string]string{SignatureAnnotation: base64.StdEncoding.EncodeToString(signature)},
+	})
+
+	if _, err := api.PushArtifact(signatureRef, manifest.Layers); err != nil {
+		return false, fmt.Errorf("unable to push signature for %s: %v", ref, err)
+	}
+	return true, nil
+}
+
+// Verify checks that the image referenced by ref has a signature made with the private key of key.
+// Returns the verified digest of the image manifest
+func Verify(api *registry.API, ref registry.Reference, key *ecdsa.PublicKey) (string, error) {
+	digest := ref.Digest
+	if digest == "" {
+		var err error
+		if digest, err = api.ManifestDigest(ref); err == registry.ErrNotFound {
+			return "", fmt.Errorf("image %s not found", ref)
+		} else if err != nil {
+			return "", fmt.Errorf("unable to fetch digest for %s: %v", ref, err)
+		}
+	}
+	signatureRef := ref.WithTag(SignatureTag(digest))
+	existing, err := api.Manifest(signatureRef)
+	if err == registry.ErrNotFound {
+		return "", fmt.Errorf("no signatures found for %s", ref)
+	} else if err != nil {
+		return "", fmt.Errorf("unable to fetch signatures for %s: %v", ref, err)
+	}
+	manifest := &signatureManifest{}
+	if err := json.Unmarshal(existing.Content, manifest); err != nil {
+		return "", fmt.Errorf("invalid signature manifest %s: %v", signatureRef, err)
+	}
+	for _, layer := range manifest.Layers {
+		if verifyLayer(api, signatureRef, layer, digest, key) == nil {
+			return digest, nil
+		}
+	}
+	return "", fmt.Errorf("no valid signature found for %s", ref)
+}
+
+// verifyLayer checks the signature of a single layer in a signature manifest
+func verifyLayer(api *registry.API, signatureRef registry.Reference, layer registry.Descriptor, digest string, key *ecdsa.PublicKey) error {
+	if layer.MediaType != MediaTypeSimpleSigning {
+		return fmt.Errorf("unsupported signature type '%s'", layer.MediaType)
+	}
+	encoded, exists := layer.Annotations[SignatureAnnotation]
+	if !exists {
+		return errors.New("missing signature")
+	}
+	der, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return err
+	}
+	signature := ecdsaSignature{}
+	if _, err := asn1.Unmarshal(der, &signature); err != nil {
+		return err
+	}
+	blob, err := api.Blob(signatureRef, layer.Digest)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = blob.Close() }()
+	signed, err := ioutil.ReadAll(blob)
+	if err != nil {
+		return err
+	}
+	if registry.Digest(signed) != layer.Digest {
+		return fmt.Errorf("digest of payload doesn't match %s", layer.Digest)
+	}
+	hash := sha256.Sum256(signed)
+	if !ecdsa.Verify(key, hash[:], signature.R, signature.S) {
+		return errors.New("invalid signature")
+	}
+	content := payload{}
+	if err := json.Unmarshal(signed, &content); err != nil {
+		return err
+	}
+	if content.Critical.Image.DockerManifestDigest != digest {
+		return fmt.Errorf("signature is for %s", content.Critical.Image.DockerManifestDigest)
+	}
+	return nil
+}
@@ -0,0 +1,144 @@
+package sign
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/sparetimecoders/build-tools/pkg/registry"
+	"testing"
+)
+
+func TestSignatureTag(t *testing.T) {
+	assert.Equal(t, "sha256-0123abc.sig", SignatureTag("sha256:0123abc"))
+}
+
+func TestSign_Verify(t *testing.T) {
+	server := registry.NewMockRegistryServer()
+	defer server.Close()
+	digest := server.AddImage("image", "abc123", nil)
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	api := registry.NewAPI("")
+	ref, _ := registry.ParseReference(server.Host() + "/image:abc123")
+
+	signed, err := Sign(api, ref.WithDigest(digest), key)
+	assert.NoError(t, err)
+	assert.True(t, signed)
+
+	manifest := server.Manifest("image", SignatureTag(digest))
+	assert.NotNil(t, manifest)
+	assert.Equal(t, registry.MediaTypeOCIManifest, manifest.MediaType)
+	content := signatureManifest{}
+	_ = json.Unmarshal(manifest.Content, &content)
+	assert.Equal(t, 1, len(content.Layers))
+	assert.Equal(t, MediaTypeSimpleSigning, content.Layers[0].MediaType)
+	assert.NotEmpty(t, content.Layers[0].Annotations[SignatureAnnotation])
+	signedPayload := payload{}
+	_ = json.Unmarshal(server.Blobs["image@"+content.Layers[0].Digest], &signedPayload)
+	assert.Equal(t, server.Host()+"/image", signedPayload.Critical.Identity.DockerReference)
+	assert.Equal(t, digest, signedPayload.Critical.Image.DockerManifestDigest)
+	assert.Equal(t, "cosign container image signature", signedPayload.Critical.Type)
+
+	verified, err := Verify(api, ref, &key.PublicKey)
+	assert.NoError(t, err)
+	assert.Equal(t, digest, verified)
+}
+
+func TestSign_AlreadySigned(t *testing.T) {
+	server := registry.NewMockRegistryServer()
+	defer server.Close()
+	digest := server.AddImage("image", "abc123", nil)
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	api := registry.NewAPI("")
+	ref, _ := registry.ParseReference(server.Host() + "/image@" + digest)
+
+	_, _ = Sign(api, ref, key)
+	before := server.Manifest("image", SignatureTag(digest))
+	signed, err := Sign(api, ref, key)
+
+	assert.NoError(t, err)
+	assert.False(t, signed)
+	assert.Equal(t, before, server.Manifest("image", SignatureTag(digest)))
+}
+
+func TestSign_AddsSignature(t *testing.T) {
+	server := registry.NewMockRegistryServer()
+	defer server.Close()
+	digest := server.AddImage("image", "abc123", nil)
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	other, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	api := registry.NewAPI("")
+	ref, _ := registry.ParseReference(server.Host() + "/image@" + digest)
+
+	_, _ = Sign(api, ref, key)
+	signed, err := Sign(api, ref, other)
+
+	assert.NoError(t, err)
+	assert.True(t, signed)
+	content := signatureManifest{}
+	_ = json.Unmarshal(server.Manifest("image", SignatureTag(digest)).Content, &content)
+	assert.Equal(t, 2, len(content.Layers))
+	_, err = Verify(api, ref, &key.PublicKey)
+	assert.NoError(t, err)
+	_, err = Verify(api, ref, &other.PublicKey)
+	assert.NoError(t, err)
+}
+
+func TestSign_WithoutDigest(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	ref, _ := registry.ParseReference("localhost:5000/image:abc123")
+
+	_, err := Sign(registry.NewAPI(""), ref, key)
+	assert.EqualError(t, err, "unable to sign localhost:5000/image:abc123 without a digest")
+}
+
+func TestVerify_Unsigned(t *testing.T) {
+	server := registry.NewMockRegistryServer()
+	defer server.Close()
+	server.AddImage("image", "abc123", nil)
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	ref, _ := registry.ParseReference(server.Host() + "/image:abc123")
+
+	_, err := Verify(registry.NewAPI(""), ref, &key.PublicKey)
+	assert.EqualError(t, err, "no signatures found for "+server.Host()+"/image:abc123")
+}
+
+func TestVerify_MissingImage(t *testing.T) {
+	server := registry.NewMockRegistryServer()
+	defer server.Close()
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	ref, _ := registry.ParseReference(server.Host() + "/image:abc123")
+
+	_, err := Verify(registry.NewAPI(""), ref, &key.PublicKey)
+	assert.EqualError(t, err, "image "+server.Host()+"/image:abc123 not found")
+}
+
+func TestVerify_OtherKey(t *testing.T) {
+	server := registry.NewMockRegistryServer()
+	defer server.Close()
+	digest := server.AddImage("image", "abc123", nil)
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	other, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	api := registry.NewAPI("")
+	ref, _ := registry.ParseReference(server.Host() + "/image:abc123")
+	_, _ = Sign(api, ref.WithDigest(digest), key)
+
+	_, err := Verify(api, ref, &other.PublicKey)
+	assert.EqualError(t, err, "no valid signature found for "+server.Host()+"/image:abc123")
+}
+
+func TestVerify_SignatureOfOtherImage(t *testing.T) {
+	server := registry.NewMockRegistryServer()
+	defer server.Close()
+	signedDigest := server.AddImage("image", "abc123", nil)
+	digest := server.AddImage("image", "def456", nil)
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	api := registry.NewAPI("")
+	ref, _ := registry.ParseReference(server.Host() + "/image:abc123")
+	_, _ = Sign(api, ref.WithDigest(signedDigest), key)
+	server.Manifests["image:"+SignatureTag(digest)] = server.Manifest("image", SignatureTag(signedDigest))
+
+	_, err := Verify(api, ref.WithTag("def456"), &key.PublicKey)
+	assert.EqualError(t, err, "no valid signature found for "+server.Host()+"/image:def456")
+}
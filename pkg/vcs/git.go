@@ -3,9 +3,16 @@ package vcs
 import (
 	"fmt"
 	git2 "gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/src-d/go-git.v4/plumbing/storer"
 	"io"
+	"net/url"
 	"os"
 	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
 )
 
 type git struct {
@@ -30,6 +37,20 @@ func (v *git) Identify(dir string, out io.Writer) bool {
 	}
 	v.CurrentCommit = ref.Hash().String()
 	v.CurrentBranch = ref.Name().Short()
+	if commit, err := repo.CommitObject(ref.Hash()); err == nil {
+		v.CurrentCommitTime = commit.Committer.When
+	}
+	if remote, err := repo.Remote(git2.DefaultRemoteName); err == nil && len(remote.Config().URLs) > 0 {
+		v.CurrentRemoteURL = publicURL(remote.Config().URLs[0])
+	}
+
+	tags, err := v.tagsByCommit()
+	if err != nil {
+		_, _ = fmt.Fprintf(out, "Unable to fetch tags: %s\n", err)
+		return true
+	}
+	v.CurrentTag = tags[ref.Hash()]
+	v.CurrentVersion = v.describe(ref.Hash(), tags)
 
 	return true
 }
@@ -38,4 +59,245 @@ func (v *git) Name() string {
 	return "Git"
 }
 
+// scpLike matches remotes in the scp-like SSH syntax, i.e. git@github.com:org/repo.git
+var scpLike = regexp.MustCompile(`^(?:[^@/]+@)?([^:/]+):([^/].*)$`)
+
+// publicURL removes any credentials from a remote URL and rewrites SSH remotes to https,
+// i.e. git@github.com:org/repo.git is returned as https://github.com/org/repo.git
+func publicURL(remote string) string {
+	if u, err := url.Parse(remote); err == nil && u.Scheme != "" && u.Host != "" {
+		u.User = nil
+		if u.Scheme == "ssh" || u.Scheme == "git" {
+			u.Scheme = "https"
+			u.Host = u.Hostname()
+		}
+		return u.String()
+	}
+	if matches := scpLike.FindStringSubmatch(remote); matches != nil {
+		return fmt.Sprintf("https://%s/%s", matches[1], matches[2])
+	}
+	return remote
+}
+
+// tagsByCommit returns the tags in the repository keyed by the commit they point at, the newest tag is used
+// for commits with several tags. Annotated tags are resolved to their target commit
+func (v *git) tagsByCommit() (map[plumbing.Hash]string, error) {
+	iter, err := v.repo.Tags()
+	if err != nil {
+		return nil, err
+	}
+	tags := make(map[plumbing.Hash]string)
+	err = iter.ForEach(func(ref *plumbing.Reference) error {
+		hash := ref.Hash()
+		if tag, err := v.repo.TagObject(hash); err == nil {
+			commit, err := tag.Commit()
+			if err != nil {
+				return nil
+			}
+			hash = commit.Hash
+		}
+		if existing, exists := tags[hash]; !exists || newerTag(ref.Name().Short(), existing) {
+			tags[hash] = ref.Name().Short()
+		}
+		return nil
+	})
+	return tags, err
+}
+
+var semverTag = regexp.MustCompile(`^v?(0|[1-9]\d*)\.(0|[1-9]\d*)\.(0|[1-9]\d*)(?:-([0-9A-Za-z.-]+))?(?:\+[0-9A-Za-z.-]+)?$`)
+
+// newerTag returns true if tag a is newer than tag b. Semantic versions are compared by precedence and are newer than
+// any other tag, other tags are compared by name
+func newerTag(a, b string) bool {
+	va, vb := semverTag.FindStringSubmatch(a), semverTag.FindStringSubmatch(b)
+	if va == nil || vb == nil {
+		if va != nil || vb != nil {
+			return va != nil
+		}
+		return a > b
+	}
+	for i := 1; i <= 3; i++ {
+		if c := compareNumeric(va[i], vb[i]); c != 0 {
+			return c > 0
+		}
+	}
+	if c := comparePrerelease(va[4], vb[4]); c != 0 {
+		return c > 0
+	}
+	return a > b
+}
+
+// compareNumeric compares two numbers without leading zeros, which might not fit in an int
+func compareNumeric(a, b string) int {
+	if len(a) != len(b) {
+		if len(a) > len(b) {
+			return 1
+		}
+		return -1
+	}
+	return strings.Compare(a, b)
+}
+
+// comparePrerelease compares the pre-release part of two semantic versions, a version without a pre-release is newer
+func comparePrerelease(a, b string) int {
+	if a == "" || b == "" {
+		if a == b {
+			return 0
+		} else if a == "" {
+			return 1
+		}
+		return -1
+	}
+	pa, pb := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(pa) && i < len(pb); i++ {
+		na, nb := isNumeric(pa[i]), isNumeric(pb[i])
+		var c int
+		switch {
+		case na && nb:
+			c = compareNumeric(pa[i], pb[i])
+		case na:
+			c = -1
+		case nb:
+			c = 1
+		default:
+			c = strings.Compare(pa[i], pb[i])
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return len(pa) - len(pb)
+}
+
+func isNumeric(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return len(s) > 0
+}
+
+// describe returns the closest tag reachable from head in the same format as `git describe --tags`,
+// i.e. the tag itself if head is tagged or <tag>-<distance>-g<short sha> otherwise
+func (v *git) describe(head plumbing.Hash, tags map[plumbing.Hash]string) string {
+	if len(tags) == 0 {
+		return ""
+	}
+	iter, err := v.repo.Log(&git2.LogOptions{From: head})
+	if err != nil {
+		return ""
+	}
+	var tag string
+	var tagged plumbing.Hash
+	_ = iter.ForEach(func(commit *object.Commit) error {
+		if name, exists := tags[commit.Hash]; exists {
+			tag, tagged = name, commit.Hash
+			return storer.ErrStop
+		}
+		return nil
+	})
+	if tag == "" || tagged == head {
+		return tag
+	}
+	distance, err := v.distance(head, tagged)
+	if err != nil {
+		return ""
+	}
+	return fmt.Sprintf("%s-%d-g%s", tag, distance, head.String()[:7])
+}
+
+// distance returns the number of commits reachable from head but not from base, like `git rev-list --count base..head`
+func (v *git) distance(head, base plumbing.Hash) (int, error) {
+	reachable := make(map[plumbing.Hash]bool)
+	iter, err := v.repo.Log(&git2.LogOptions{From: base})
+	if err != nil {
+		return 0, err
+	}
+	if err := iter.ForEach(func(commit *object.Commit) error {
+		reachable[commit.Hash] = true
+		return nil
+	}); err != nil {
+		return 0, err
+	}
+	iter, err = v.repo.Log(&git2.LogOptions{From: head})
+	if err != nil {
+		return 0, err
+	}
+	distance := 0
+	err = iter.ForEach(func(commit *object.Commit) error {
+		if !reachable[commit.Hash] {
+			distance++
+		}
+		return nil
+	})
+	return distance, err
+}
+
+// ChangedFiles returns the paths changed between the revision since and the current commit
+func (v *git) ChangedFiles(since string) ([]string, error) {
+	from, err := v.repo.ResolveRevision(plumbing.Revision(since))
+	if err != nil {
+		return nil, fmt.Errorf("unable to resolve revision '%s': %v", since, err)
+	}
+	fromTree, err := v.tree(*from)
+	if err != nil {
+		return nil, err
+	}
+	toTree, err := v.tree(plumbing.NewHash(v.CurrentCommit))
+	if err != nil {
+		return nil, err
+	}
+	changes, err := object.DiffTree(fromTree, toTree)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, change := range changes {
+		if change.From.Name != "" {
+			files = append(files, change.From.Name)
+		}
+		if change.To.Name != "" && change.To.Name != change.From.Name {
+			files = append(files, change.To.Name)
+		}
+	}
+	return files, nil
+}
+
+// Branches returns the names of the local branches and the branches of the remotes, without the remote name
+func (v *git) Branches() ([]string, error) {
+	iter, err := v.repo.References()
+	if err != nil {
+		return nil, err
+	}
+	unique := make(map[string]bool)
+	err = iter.ForEach(func(ref *plumbing.Reference) error {
+		if ref.Name().IsBranch() {
+			unique[ref.Name().Short()] = true
+		} else if ref.Name().IsRemote() {
+			if parts := strings.SplitN(ref.Name().Short(), "/", 2); len(parts) == 2 && parts[1] != "HEAD" {
+				unique[parts[1]] = true
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	var branches []string
+	for branch := range unique {
+		branches = append(branches, branch)
+	}
+	sort.Strings(branches)
+	return branches, nil
+}
+
+func (v *git) tree(hash plumbing.Hash) (*object.Tree, error) {
+	commit, err := v.repo.CommitObject(hash)
+	if err != nil {
+		return nil, err
+	}
+	return commit.Tree()
+}
+
 var _ VCS = &git{}
@@ -1,6 +1,10 @@
 package vcs
 
-import "io"
+import (
+	"errors"
+	"io"
+	"time"
+)
 
 // VCS represent the VersionControlSystem used
 type VCS interface {
@@ -12,12 +16,28 @@ type VCS interface {
 	Branch() string
 	// Commit returns the current commit
 	Commit() string
+	// CommitTime returns the time of the current commit
+	CommitTime() time.Time
+	// Tag returns the tag pointing at the current commit, if any
+	Tag() string
+	// Version returns a `git describe`-style version of the current commit
+	Version() string
+	// RemoteURL returns the URL of the origin remote without any credentials, if there is one
+	RemoteURL() string
+	// ChangedFiles returns the paths (relative to the repository root) changed between since and the current commit
+	ChangedFiles(since string) ([]string, error)
+	// Branches returns the names of the local and remote branches
+	Branches() ([]string, error)
 }
 
 // CommonVCS contains functions shared by all VCSs
 type CommonVCS struct {
-	CurrentBranch string
-	CurrentCommit string
+	CurrentBranch     string
+	CurrentCommit     string
+	CurrentCommitTime time.Time
+	CurrentTag        string
+	CurrentVersion    string
+	CurrentRemoteURL  string
 }
 
 // Branch returns the current branch
@@ -30,6 +50,36 @@ func (v CommonVCS) Commit() string {
 	return v.CurrentCommit
 }
 
+// CommitTime returns the time of the current commit
+func (v CommonVCS) CommitTime() time.Time {
+	return v.CurrentCommitTime
+}
+
+// Tag returns the tag pointing at the current commit
+func (v CommonVCS) Tag() string {
+	return v.CurrentTag
+}
+
+// Version returns a `git describe`-style version of the current commit
+func (v CommonVCS) Version() string {
+	return v.CurrentVersion
+}
+
+// RemoteURL returns the URL of the origin remote
+func (v CommonVCS) RemoteURL() string {
+	return v.CurrentRemoteURL
+}
+
+// ChangedFiles is not supported unless implemented by the actual VCS
+func (v CommonVCS) ChangedFiles(since string) ([]string, error) {
+	return nil, errors.New("listing changed files is not supported without a VCS")
+}
+
+// Branches is not supported unless implemented by the actual VCS
+func (v CommonVCS) Branches() ([]string, error) {
+	return nil, errors.New("listing branches is not supported without a VCS")
+}
+
 var systems = []VCS{&git{}}
 
 // Identify tries to identify the actual VCS
@@ -2,11 +2,16 @@ package vcs
 
 import (
 	"io"
+	"time"
 )
 
 type mockVcs struct {
-	branch string
-	commit string
+	branch   string
+	commit   string
+	tag      string
+	version  string
+	changed  []string
+	branches []string
 }
 
 // NewMockVcs returns a mockVcs with default commit and branch name
@@ -24,6 +29,35 @@ func NewMockVcsWithBranch(branch string) VCS {
 		commit: "fallback-sha",
 	}
 }
+
+// NewMockVcsWithTag returns a mockVcs where the current commit is tagged with tag
+func NewMockVcsWithTag(tag string) VCS {
+	return &mockVcs{
+		branch:  "fallback-branch",
+		commit:  "fallback-sha",
+		tag:     tag,
+		version: tag,
+	}
+}
+
+// NewMockVcsWithChanges returns a mockVcs where files have changed since any given commit
+func NewMockVcsWithChanges(files ...string) VCS {
+	return &mockVcs{
+		branch:  "fallback-branch",
+		commit:  "fallback-sha",
+		changed: files,
+	}
+}
+
+// NewMockVcsWithBranches returns a mockVcs where branches exist in the repository
+func NewMockVcsWithBranches(branches ...string) VCS {
+	return &mockVcs{
+		branch:   "fallback-branch",
+		commit:   "fallback-sha",
+		branches: branches,
+	}
+}
+
 func (m mockVcs) Identify(dir string, out io.Writer) bool {
 	panic("implement me")
 }
@@ -40,4 +74,28 @@ func (m mockVcs) Commit() string {
 	return m.commit
 }
 
+func (m mockVcs) CommitTime() time.Time {
+	return time.Date(2019, 10, 1, 12, 30, 0, 0, time.UTC)
+}
+
+func (m mockVcs) Tag() string {
+	return m.tag
+}
+
+func (m mockVcs) Version() string {
+	return m.version
+}
+
+func (m mockVcs) RemoteURL() string {
+	return "https://github.com/example/repo.git"
+}
+
+func (m mockVcs) ChangedFiles(since string) ([]string, error) {
+	return m.changed, nil
+}
+
+func (m mockVcs) Branches() ([]string, error) {
+	return m.branches, nil
+}
+
 var _ VCS = mockVcs{}
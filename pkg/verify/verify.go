@@ -0,0 +1,103 @@
+package verify
+
+import (
+	"flag"
+	"fmt"
+	"github.com/liamg/tml"
+	"github.com/sparetimecoders/build-tools/pkg/config"
+	"github.com/sparetimecoders/build-tools/pkg/docker"
+	"github.com/sparetimecoders/build-tools/pkg/registry"
+	"github.com/sparetimecoders/build-tools/pkg/sign"
+	"io"
+	"strings"
+)
+
+// Verify checks that the pushed images are signed with the configured public key
+func Verify(dir string, out, eout io.Writer, args ...string) int {
+	var tag, registryName, publicKey string
+	var only arrayFlags
+	set := flag.NewFlagSet("verify", flag.ContinueOnError)
+	set.SetOutput(eout)
+	set.StringVar(&tag, "tag", "", "tag of the images to verify, defaults to the current commit")
+	set.StringVar(&registryName, "registry", "", "registry to verify the images in, i.e. ecr (defaults to the current registry)")
+	set.StringVar(&publicKey, "key", "", "public key to verify the signatures with (overrides signing.publicKey)")
+	set.Var(&only, "only", "only verify the image with this name (can be repeated)")
+	if err := set.Parse(args); err != nil {
+		return -1
+	}
+
+	cfg, err := config.Load(dir, out)
+	if err != nil {
+		_, _ = fmt.Fprintln(eout, tml.Sprintf("<red>%s</red>", err.Error()))
+		return -2
+	}
+	if publicKey != "" {
+		cfg.Signing.PublicKey = publicKey
+	}
+	return doVerify(cfg, registryName, tag, only, out, eout)
+}
+
+func doVerify(cfg *config.Config, registryName, tag string, only []string, out, eout io.Writer) int {
+	if !cfg.Signing.Verify() {
+		_, _ = fmt.Fprintln(eout, tml.Sprintf("<red>no public key to verify the signatures with, set signing.publicKey or use --key</red>"))
+		return -3
+	}
+	currentRegistry, err := cfg.RegistryNamed(registryName)
+	if err != nil {
+		_, _ = fmt.Fprintln(eout, tml.Sprintf("<red>%s</red>", err.Error()))
+		return -3
+	}
+	images, err := cfg.CurrentImages("Dockerfile", only)
+	if err != nil {
+		_, _ = fmt.Fprintln(eout, tml.Sprintf("<red>%s</red>", err.Error()))
+		return -4
+	}
+	if tag == "" {
+		tag = cfg.CurrentCI().Commit()
+	}
+	if tag == "" {
+		_, _ = fmt.Fprint(eout, tml.Sprintf("Commit information is <red>missing</red>, use --tag to select the images to verify"))
+		return -5
+	}
+	if err := Images(currentRegistry, cfg.Signing.PublicKey, images, tag, out); err != nil {
+		_, _ = fmt.Fprintln(eout, tml.Sprintf("<red>%s</red>", err.Error()))
+		return -6
+	}
+	return 0
+}
+
+// Images verifies that the images tagged with tag in reg have a signature made with the private key of publicKey.
+// Only the registry API is used, so no docker daemon is needed
+func Images(reg registry.Registry, publicKey string, images []config.Image, tag string, out io.Writer) error {
+	key, err := sign.LoadPublicKey(publicKey)
+	if err != nil {
+		return err
+	}
+	api, err := registry.NewRegistryAPI(reg)
+	if err != nil {
+		return err
+	}
+	for _, image := range images {
+		ref, err := registry.ParseReference(docker.Tag(reg.RegistryUrl(), image.Name, tag))
+		if err != nil {
+			return err
+		}
+		digest, err := sign.Verify(api, ref, key)
+		if err != nil {
+			return err
+		}
+		_, _ = fmt.Fprintln(out, tml.Sprintf("Verified signature of '<green>%s</green>' (<green>%s</green>)", ref, digest))
+	}
+	return nil
+}
+
+type arrayFlags []string
+
+func (i *arrayFlags) String() string {
+	return strings.Join(*i, ",")
+}
+
+func (i *arrayFlags) Set(value string) error {
+	*i = append(*i, strings.TrimSpace(value))
+	return nil
+}
@@ -0,0 +1,212 @@
+package verify
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/sparetimecoders/build-tools/pkg"
+	"github.com/sparetimecoders/build-tools/pkg/config"
+	"github.com/sparetimecoders/build-tools/pkg/registry"
+	"github.com/sparetimecoders/build-tools/pkg/sign"
+	"github.com/sparetimecoders/build-tools/pkg/vcs"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestVerify_BadFlag(t *testing.T) {
+	eout := &bytes.Buffer{}
+	code := Verify(".", &bytes.Buffer{}, eout, "--unknown")
+	assert.Equal(t, -1, code)
+	assert.Contains(t, eout.String(), "flag provided but not defined: -unknown")
+}
+
+func TestVerify_WithoutDockerDaemon(t *testing.T) {
+	defer pkg.SetEnv("DOCKER_HOST", "abc-123")()
+	eout := &bytes.Buffer{}
+	code := Verify(".", &bytes.Buffer{}, eout)
+	assert.Equal(t, -3, code)
+	assert.Equal(t, "\x1b[0m\x1b[31mno public key to verify the signatures with, set signing.publicKey or use --key\x1b[39m\x1b[0m\n", eout.String())
+}
+
+func TestVerify_BrokenConfig(t *testing.T) {
+	name, _ := ioutil.TempDir(os.TempDir(), "build-tools")
+	defer func() { _ = os.RemoveAll(name) }()
+	_ = ioutil.WriteFile(name+"/.buildtools.yaml", []byte(`ci: [] `), 0777)
+	code := Verify(name, &bytes.Buffer{}, &bytes.Buffer{})
+	assert.Equal(t, -2, code)
+}
+
+func TestVerify_Signed(t *testing.T) {
+	server, cfg, key := setup()
+	defer server.Close()
+	defer func() { _ = os.RemoveAll(filepath.Dir(cfg.Signing.PublicKey)) }()
+	digest := server.AddImage("reponame", "abc123", nil)
+	signImage(server, "reponame", digest, key)
+
+	out := &bytes.Buffer{}
+	eout := &bytes.Buffer{}
+	code := doVerify(cfg, "", "", nil, out, eout)
+
+	assert.Equal(t, 0, code)
+	assert.Equal(t, "", eout.String())
+	assert.Equal(t, fmt.Sprintf("\x1b[0mVerified signature of '\x1b[32m%s/reponame:abc123\x1b[39m' (\x1b[32m%s\x1b[39m)\x1b[0m\n", server.Host(), digest), out.String())
+}
+
+func TestVerify_Tag(t *testing.T) {
+	server, cfg, key := setup()
+	defer server.Close()
+	defer func() { _ = os.RemoveAll(filepath.Dir(cfg.Signing.PublicKey)) }()
+	server.AddImage("reponame", "abc123", nil)
+	digest := server.AddImage("reponame", "v1.0.0", nil)
+	signImage(server, "reponame", digest, key)
+
+	code := doVerify(cfg, "", "v1.0.0", nil, &bytes.Buffer{}, &bytes.Buffer{})
+
+	assert.Equal(t, 0, code)
+}
+
+func TestVerify_Unsigned(t *testing.T) {
+	server, cfg, _ := setup()
+	defer server.Close()
+	defer func() { _ = os.RemoveAll(filepath.Dir(cfg.Signing.PublicKey)) }()
+	server.AddImage("reponame", "abc123", nil)
+
+	eout := &bytes.Buffer{}
+	code := doVerify(cfg, "", "", nil, &bytes.Buffer{}, eout)
+
+	assert.Equal(t, -6, code)
+	assert.Equal(t, fmt.Sprintf("\x1b[0m\x1b[31mno signatures found for %s/reponame:abc123\x1b[39m\x1b[0m\n", server.Host()), eout.String())
+}
+
+func TestVerify_SignedWithOtherKey(t *testing.T) {
+	server, cfg, _ := setup()
+	defer server.Close()
+	defer func() { _ = os.RemoveAll(filepath.Dir(cfg.Signing.PublicKey)) }()
+	digest := server.AddImage("reponame", "abc123", nil)
+	other, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	signImage(server, "reponame", digest, other)
+
+	eout := &bytes.Buffer{}
+	code := doVerify(cfg, "", "", nil, &bytes.Buffer{}, eout)
+
+	assert.Equal(t, -6, code)
+	assert.Equal(t, fmt.Sprintf("\x1b[0m\x1b[31mno valid signature found for %s/reponame:abc123\x1b[39m\x1b[0m\n", server.Host()), eout.String())
+}
+
+func TestVerify_NoPublicKey(t *testing.T) {
+	server, cfg, _ := setup()
+	defer server.Close()
+	_ = os.RemoveAll(filepath.Dir(cfg.Signing.PublicKey))
+	cfg.Signing.PublicKey = ""
+
+	eout := &bytes.Buffer{}
+	code := doVerify(cfg, "", "", nil, &bytes.Buffer{}, eout)
+
+	assert.Equal(t, -3, code)
+	assert.Equal(t, "\x1b[0m\x1b[31mno public key to verify the signatures with, set signing.publicKey or use --key\x1b[39m\x1b[0m\n", eout.String())
+}
+
+func TestVerify_UnknownRegistry(t *testing.T) {
+	server, cfg, _ := setup()
+	defer server.Close()
+	defer func() { _ = os.RemoveAll(filepath.Dir(cfg.Signing.PublicKey)) }()
+
+	eout := &bytes.Buffer{}
+	code := doVerify(cfg, "missing", "", nil, &bytes.Buffer{}, eout)
+
+	assert.Equal(t, -3, code)
+	assert.Equal(t, "\x1b[0m\x1b[31munknown registry 'missing'\x1b[39m\x1b[0m\n", eout.String())
+}
+
+func TestVerify_UnknownImage(t *testing.T) {
+	server, cfg, _ := setup()
+	defer server.Close()
+	defer func() { _ = os.RemoveAll(filepath.Dir(cfg.Signing.PublicKey)) }()
+
+	code := doVerify(cfg, "", "", []string{"other"}, &bytes.Buffer{}, &bytes.Buffer{})
+
+	assert.Equal(t, -4, code)
+}
+
+func TestVerify_MissingCommit(t *testing.T) {
+	server, cfg, _ := setup()
+	defer server.Close()
+	defer func() { _ = os.RemoveAll(filepath.Dir(cfg.Signing.PublicKey)) }()
+	cfg.CI.Gitlab.CICommit = ""
+	cfg.VCS.VCS = &no{}
+
+	eout := &bytes.Buffer{}
+	code := doVerify(cfg, "", "", nil, &bytes.Buffer{}, eout)
+
+	assert.Equal(t, -5, code)
+	assert.Equal(t, "\x1b[0mCommit information is \x1b[31mmissing\x1b[39m, use --tag to select the images to verify\x1b[0m", eout.String())
+}
+
+func TestVerify_CredentialsError(t *testing.T) {
+	server, cfg, _ := setup()
+	defer server.Close()
+	defer func() { _ = os.RemoveAll(filepath.Dir(cfg.Signing.PublicKey)) }()
+	dir := filepath.Dir(cfg.Signing.PublicKey)
+	_ = ioutil.WriteFile(filepath.Join(dir, "config.json"), []byte(`{"auths":`), 0600)
+	defer pkg.SetEnv("DOCKER_CONFIG", dir)()
+
+	eout := &bytes.Buffer{}
+	code := doVerify(cfg, "", "", nil, &bytes.Buffer{}, eout)
+
+	assert.Equal(t, -6, code)
+	assert.Equal(t, fmt.Sprintf("\x1b[0m\x1b[31munable to get docker credentials for https://index.docker.io/v1/: unable to parse %s/config.json: unexpected end of JSON input\x1b[39m\x1b[0m\n", dir), eout.String())
+}
+
+func TestVerify_InvalidPublicKey(t *testing.T) {
+	server, cfg, _ := setup()
+	defer server.Close()
+	_ = os.RemoveAll(filepath.Dir(cfg.Signing.PublicKey))
+
+	eout := &bytes.Buffer{}
+	code := doVerify(cfg, "", "", nil, &bytes.Buffer{}, eout)
+
+	assert.Equal(t, -6, code)
+	assert.Contains(t, eout.String(), "unable to read key: open ")
+}
+
+// setup returns a registry server and a config verifying images in it with the public key of the returned key
+func setup() (*registry.MockRegistryServer, *config.Config, *ecdsa.PrivateKey) {
+	server := registry.NewMockRegistryServer()
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	dir, _ := ioutil.TempDir(os.TempDir(), "build-tools")
+	der, _ := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	publicKey := filepath.Join(dir, "cosign.pub")
+	_ = ioutil.WriteFile(publicKey, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0600)
+
+	cfg := config.InitEmptyConfig()
+	cfg.CI.Gitlab.CIBuildName = "reponame"
+	cfg.CI.Gitlab.CICommit = "abc123"
+	cfg.Registry.Dockerhub.Repository = server.Host()
+	cfg.Signing.PublicKey = publicKey
+	return server, cfg, key
+}
+
+func signImage(server *registry.MockRegistryServer, repository, digest string, key *ecdsa.PrivateKey) {
+	ref, _ := registry.ParseReference(fmt.Sprintf("%s/%s@%s", server.Host(), repository, digest))
+	_, _ = sign.Sign(registry.NewAPI(""), ref, key)
+}
+
+type no struct {
+	vcs.CommonVCS
+}
+
+func (n no) Identify(dir string, out io.Writer) bool {
+	return true
+}
+
+func (n no) Name() string {
+	return "none"
+}